@@ -0,0 +1,390 @@
+package bed
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+)
+
+// ApplyOptions represents options for applying matches.
+type ApplyOptions struct {
+	// Constraints on the order that files are written.
+	Order []OrderRule
+
+	// If true, read-only files are temporarily made writable by their
+	// owner while they are written. Otherwise, their mode is unchanged.
+	ForceReadOnly bool
+
+	// If true, symlinks are replaced by a regular file containing the
+	// changes. By default, changes are written to the symlink's target.
+	NoFollowSymlinks bool
+
+	// If set, the original contents of each file are copied to BackupDir
+	// before the file is written, at the same path relative to the current
+	// directory. Files outside the current directory are copied to their
+	// absolute path within BackupDir.
+	BackupDir string
+
+	// If set, the time spent reading & writing each file is recorded.
+	Timings *Timings
+
+	// If set, called with the path of each file once its changes have been
+	// written or it has been deleted.
+	OnApply func(path string)
+}
+
+// RemoveSkipped returns matches without any that have the skip directive.
+func RemoveSkipped(matches []*Match) []*Match {
+	other := make([]*Match, 0, len(matches))
+	for _, m := range matches {
+		if m.Directive != DirectiveSkip {
+			other = append(other, m)
+		}
+	}
+	return other
+}
+
+// orderPaths returns the indexes of paths sorted topologically so that the
+// ordering rules are satisfied. Paths are otherwise kept in their original
+// order. Returns an error if the rules contain a cycle.
+func orderPaths(paths []string, rules []OrderRule) ([]int, error) {
+	order := make([]int, len(paths))
+	for i := range order {
+		order[i] = i
+	}
+	if len(rules) == 0 {
+		return order, nil
+	}
+
+	// Match each rule's globs against each path once & add an edge from every
+	// path matching "before" to every path matching "after".
+	next := make([][]int, len(paths))
+	indegree := make([]int, len(paths))
+	for _, rule := range rules {
+		var before, after []int
+		for i, path := range paths {
+			if MatchGlob(rule.Before, path) {
+				before = append(before, i)
+			}
+			if MatchGlob(rule.After, path) {
+				after = append(after, i)
+			}
+		}
+		for _, i := range before {
+			for _, j := range after {
+				if i != j {
+					next[i], indegree[j] = append(next[i], j), indegree[j]+1
+				}
+			}
+		}
+	}
+
+	// Repeatedly take the earliest path with no remaining dependencies. The
+	// initial ready list is in ascending order so it is already a heap.
+	ready := make(indexHeap, 0, len(paths))
+	for i := range paths {
+		if indegree[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	order = order[:0]
+	for len(ready) > 0 {
+		i := heap.Pop(&ready).(int)
+		order = append(order, i)
+		for _, j := range next[i] {
+			if indegree[j]--; indegree[j] == 0 {
+				heap.Push(&ready, j)
+			}
+		}
+	}
+
+	if len(order) < len(paths) {
+		var cycle []string
+		for i := range paths {
+			if indegree[i] > 0 {
+				cycle = append(cycle, paths[i])
+			}
+		}
+		return nil, fmt.Errorf("apply order rules contain a cycle: %s", strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
+// indexHeap is a min-heap of path indexes.
+type indexHeap []int
+
+func (h indexHeap) Len() int            { return len(h) }
+func (h indexHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h indexHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *indexHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+func (h *indexHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// CheckMatchData returns an error if matches do not fit within data, the
+// contents of path. Files in another character set must still decode to
+// the text which the matches refer to. Matches must be within the text &
+// must not overlap, although they may be out of order.
+func CheckMatchData(path string, data []byte, matches []*Match) error {
+	text := data
+	if charset := matchesCharset(matches); charset != "" {
+		var err error
+		if text, err = DecodeCharset(data, charset); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	text = TrimByteOrderMark(text)
+
+	for i, m := range matches {
+		if m.Pos < 0 || m.Len < 0 {
+			return fmt.Errorf("%s: match block %d: invalid position %d & length %d", path, i+1, m.Pos, m.Len)
+		} else if m.Pos+m.Len > len(text) {
+			return fmt.Errorf("%s: match block %d at byte %d extends past the end of the file, which may have changed since it was matched", path, i+1, m.Pos)
+		}
+	}
+
+	// Compare each match to the match before it in file order.
+	order := make([]int, len(matches))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return matches[order[i]].Pos < matches[order[j]].Pos })
+	for k := 1; k < len(order); k++ {
+		prev, m := matches[order[k-1]], matches[order[k]]
+		if m.Pos < prev.Pos+prev.Len {
+			return fmt.Errorf("%s: match blocks %d & %d overlap at byte %d", path, order[k-1]+1, order[k]+1, m.Pos)
+		}
+	}
+	return nil
+}
+
+// DeletesFile returns true if any of matches has the delete-file directive.
+func DeletesFile(matches []*Match) bool {
+	for _, m := range matches {
+		if m.Directive == DirectiveDeleteFile {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyMatchData returns data with matches applied in order. The matches
+// are not modified. The delete-file directive removes all data. If data
+// has CRLF line endings then line endings in match data are converted. If
+// matches refer to text in another character set then data is decoded
+// before the matches are applied & encoded again afterward.
+func ApplyMatchData(data []byte, matches []*Match) []byte {
+	if charset := matchesCharset(matches); charset != "" {
+		text, err := DecodeCharset(data, charset)
+		if err != nil {
+			return data
+		}
+		// Match data is checked when it is parsed, so any characters which
+		// still cannot be encoded are replaced rather than failing.
+		data, _ = encoding.ReplaceUnsupported(charsets[charset].NewEncoder()).Bytes(applyMatchText(text, matches))
+		return data
+	}
+	return applyMatchText(data, matches)
+}
+
+// applyMatchText returns data, in UTF-8, with matches applied in order.
+// Positions are relative to the text after any byte order mark, which is
+// kept unless the file is deleted.
+func applyMatchText(data []byte, matches []*Match) []byte {
+	if bom := byteOrderMark(data); bom != nil && !DeletesFile(matches) {
+		return append(bom, applyText(data[len(bom):], matches)...)
+	}
+	return applyText(data, matches)
+}
+
+// applyText returns data with matches applied in order.
+func applyText(data []byte, matches []*Match) []byte {
+	crlf := UsesCRLF(data)
+
+	// Copy matches so position adjustments do not affect the caller.
+	a := make([]Match, len(matches))
+	for i := range matches {
+		a[i] = *matches[i]
+	}
+
+	// Apply matches in order.
+	for i, m := range a {
+		start, end, mid := m.Pos, m.Pos+m.Len, m.Data
+		switch m.Directive {
+		case DirectiveDelete:
+			mid = nil
+		case DirectiveDeleteLine:
+			start, end = lineBounds(data, start, end)
+			mid = nil
+		case DirectiveDeleteFile:
+			start, end = 0, len(data)
+			mid = nil
+		default:
+			if crlf {
+				mid = toCRLF(data, start, end, mid)
+			}
+		}
+
+		prefix := data[:start:start]
+		mid = mid[:len(mid):len(mid)]
+		suffix := data[end:]
+
+		data = append(prefix, append(mid, suffix...)...)
+
+		// Apply difference in data size to later matches. Matches inside
+		// of a deleted line are removed along with it.
+		for j := i + 1; j < len(a); j++ {
+			if a[j].Pos >= end {
+				a[j].Pos += len(mid) - (end - start)
+			} else if a[j].Pos >= start {
+				a[j].Pos, a[j].Len, a[j].Directive = start, 0, DirectiveDelete
+			}
+		}
+	}
+	return data
+}
+
+// lineBounds expands the range from start to end to include the full lines
+// containing it, including the trailing newline.
+func lineBounds(data []byte, start, end int) (int, int) {
+	start = bytes.LastIndexByte(data[:start], '\n') + 1
+	if end == start || data[end-1] != '\n' {
+		if i := bytes.IndexByte(data[end:], '\n'); i != -1 {
+			end += i + 1
+		} else {
+			end = len(data)
+		}
+	}
+	return start, end
+}
+
+// GroupMatchesByPath returns a list of paths and a list of their associated matches.
+// Paths are returned in the order they first appear in matches.
+func GroupMatchesByPath(matches []*Match) ([]string, [][]*Match) {
+	var paths []string
+	m := make(map[string][]*Match)
+	for i := range matches {
+		if _, ok := m[matches[i].Path]; !ok {
+			paths = append(paths, matches[i].Path)
+		}
+		m[matches[i].Path] = append(m[matches[i].Path], matches[i])
+	}
+
+	pathMatches := make([][]*Match, 0, len(paths))
+	for _, path := range paths {
+		pathMatches = append(pathMatches, m[path])
+	}
+	return paths, pathMatches
+}
+
+// OrderRule requires files matching the Before glob to be applied before
+// any files matching the After glob.
+type OrderRule struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// MatchGlob returns true if path matches the glob pattern. Patterns without
+// a path separator are matched against the base name of path.
+func MatchGlob(pattern, path string) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+	if !strings.Contains(pattern, "/") {
+		path = filepath.Base(path)
+	}
+	ok, _ := filepath.Match(pattern, path)
+	return ok
+}
+
+// Edit represents the replacement of a byte range in a file.
+type Edit struct {
+	Pos  int
+	Len  int
+	Data []byte
+}
+
+// MatchEdits returns the non-overlapping edits, in file order, that transform
+// data in the same way as ApplyMatchData. If matches cannot be represented as
+// ordered edits then a single edit spanning all changes is returned.
+func MatchEdits(data []byte, matches []*Match) []Edit {
+	// Positions are relative to the text after any byte order mark.
+	bom := len(byteOrderMark(data))
+	text := data[bom:]
+
+	crlf := UsesCRLF(text)
+	var edits []Edit
+	var end int
+	for _, m := range matches {
+		// Positions in transcoded text do not refer to data so only the
+		// changed range can be found.
+		if m.Charset != "" {
+			edits = nil
+			break
+		}
+
+		start, stop, mid := m.Pos, m.Pos+m.Len, m.Data
+		switch m.Directive {
+		case DirectiveDelete:
+			mid = nil
+		case DirectiveDeleteLine:
+			start, stop = lineBounds(text, start, stop)
+			mid = nil
+		case DirectiveDeleteFile:
+			start, stop = -bom, len(text)
+			mid = nil
+		default:
+			if crlf {
+				mid = toCRLF(text, start, stop, mid)
+			}
+		}
+		start, stop = start+bom, stop+bom
+
+		// Matches inside of a previously deleted line are removed along with it.
+		if len(edits) > 0 && start < end {
+			if prev := edits[len(edits)-1]; prev.Data == nil && stop <= end {
+				continue
+			}
+			edits = nil
+			break
+		}
+		edits, end = append(edits, Edit{Pos: start, Len: stop - start, Data: mid}), stop
+	}
+
+	// Verify the edits against the actual result & fall back to replacing the
+	// entire changed range, if they differ.
+	newData := ApplyMatchData(data, matches)
+	if edits != nil && bytes.Equal(applyEdits(data, edits), newData) {
+		return edits
+	}
+
+	var prefix, suffix int
+	for prefix < len(data) && prefix < len(newData) && data[prefix] == newData[prefix] {
+		prefix++
+	}
+	for suffix < len(data)-prefix && suffix < len(newData)-prefix && data[len(data)-suffix-1] == newData[len(newData)-suffix-1] {
+		suffix++
+	}
+	if prefix == len(data) && prefix == len(newData) {
+		return nil
+	}
+	return []Edit{{Pos: prefix, Len: len(data) - prefix - suffix, Data: newData[prefix : len(newData)-suffix]}}
+}
+
+// applyEdits returns data with ordered, non-overlapping edits applied.
+func applyEdits(data []byte, edits []Edit) []byte {
+	var buf []byte
+	var pos int
+	for _, e := range edits {
+		buf = append(buf, data[pos:e.Pos]...)
+		buf = append(buf, e.Data...)
+		pos = e.Pos + e.Len
+	}
+	return append(buf, data[pos:]...)
+}
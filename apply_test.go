@@ -0,0 +1,222 @@
+package bed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyMatches_InvalidBlocks(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		matches []*Match
+		err     string
+	}{
+		{
+			name:    "PastEnd",
+			matches: []*Match{{Pos: 15, Len: 3, Data: []byte("x")}},
+			err:     "b.txt: match block 1 at byte 15 extends past the end of the file",
+		},
+		{
+			name:    "NegativePos",
+			matches: []*Match{{Pos: -3, Len: 2, Data: []byte("x")}},
+			err:     "b.txt: match block 1: invalid position -3 & length 2",
+		},
+		{
+			name:    "NegativeLen",
+			matches: []*Match{{Pos: 2, Len: -1, Data: []byte("x")}},
+			err:     "b.txt: match block 1: invalid position 2 & length -1",
+		},
+		{
+			name: "Overlap",
+			matches: []*Match{
+				{Pos: 0, Len: 5, Data: []byte("X")},
+				{Pos: 3, Len: 5, Data: []byte("Y")},
+			},
+			err: "b.txt: match blocks 1 & 2 overlap at byte 3",
+		},
+		{
+			name: "OverlapOutOfOrder",
+			matches: []*Match{
+				{Pos: 6, Len: 5, Data: []byte("X")},
+				{Pos: 0, Len: 7, Data: []byte("Y")},
+			},
+			err: "b.txt: match blocks 2 & 1 overlap at byte 6",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := chdirTemp(t)
+			writeTestFile(t, "a.txt", "foo bar")
+			writeTestFile(t, "b.txt", "Hello World")
+
+			// The valid match for a.txt must not be applied either.
+			matches := []*Match{{Path: "a.txt", Pos: 0, Len: 3, Data: []byte("baz")}}
+			for _, m := range tt.matches {
+				m.Path = "b.txt"
+				matches = append(matches, m)
+			}
+
+			err := ApplyMatches(matches, ApplyOptions{})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s := readTestFile(t, filepath.Join(dir, "a.txt")); s != "foo bar" {
+				t.Fatalf("a.txt written: %q", s)
+			} else if s := readTestFile(t, filepath.Join(dir, "b.txt")); s != "Hello World" {
+				t.Fatalf("b.txt written: %q", s)
+			}
+		})
+	}
+}
+
+func TestApplyMatches(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		data    string
+		matches []*Match
+		want    string
+	}{
+		{
+			name:    "Replace",
+			data:    "Hello World",
+			matches: []*Match{{Pos: 6, Len: 5, Data: []byte("There")}},
+			want:    "Hello There",
+		},
+		{
+			name: "Adjacent",
+			data: "Hello World",
+			matches: []*Match{
+				{Pos: 0, Len: 5, Data: []byte("Goodbye")},
+				{Pos: 5, Len: 6, Data: []byte(", World")},
+			},
+			want: "Goodbye, World",
+		},
+		{
+			name: "OutOfOrder",
+			data: "Hello World",
+			matches: []*Match{
+				{Pos: 6, Len: 5, Data: []byte("There")},
+				{Pos: 0, Len: 5, Data: []byte("Hi")},
+			},
+			want: "Hi There",
+		},
+		{
+			name:    "End",
+			data:    "Hello",
+			matches: []*Match{{Pos: 5, Len: 0, Data: []byte("!")}},
+			want:    "Hello!",
+		},
+		{
+			name:    "ByteOrderMark",
+			data:    "\xef\xbb\xbfHello",
+			matches: []*Match{{Pos: 0, Len: 5, Data: []byte("Hi")}},
+			want:    "\xef\xbb\xbfHi",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := chdirTemp(t)
+			writeTestFile(t, "a.txt", tt.data)
+			for _, m := range tt.matches {
+				m.Path = "a.txt"
+			}
+			if err := ApplyMatches(tt.matches, ApplyOptions{}); err != nil {
+				t.Fatal(err)
+			} else if s := readTestFile(t, filepath.Join(dir, "a.txt")); s != tt.want {
+				t.Fatalf("unexpected data: %q", s)
+			}
+		})
+	}
+}
+
+func TestGroupMatchesByPath(t *testing.T) {
+	matches := []*Match{
+		{Path: "b.go", Pos: 0},
+		{Path: "a.go", Pos: 1},
+		{Path: "b.go", Pos: 2},
+		{Path: "c.go", Pos: 3},
+	}
+	paths, groups := GroupMatchesByPath(matches)
+	if want := []string{"b.go", "a.go", "c.go"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("unexpected paths: %q", paths)
+	}
+
+	var got [][]int
+	for _, a := range groups {
+		var pos []int
+		for _, m := range a {
+			pos = append(pos, m.Pos)
+		}
+		got = append(got, pos)
+	}
+	if want := [][]int{{0, 2}, {1}, {3}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected groups: %v", got)
+	}
+}
+
+func TestOrderPaths(t *testing.T) {
+	paths := []string{"a.go", "b.proto", "c.txt", "gen/d.go", "e.proto"}
+	for _, tt := range []struct {
+		name  string
+		rules []OrderRule
+		want  []int
+	}{
+		{name: "NoRules", want: []int{0, 1, 2, 3, 4}},
+		{name: "Before", rules: []OrderRule{{Before: "*.proto", After: "*.go"}}, want: []int{1, 2, 4, 0, 3}},
+		{name: "Chain", rules: []OrderRule{{Before: "*.proto", After: "gen/*"}, {Before: "gen/*", After: "a.go"}}, want: []int{1, 2, 4, 3, 0}},
+		{name: "NoMatches", rules: []OrderRule{{Before: "*.rs", After: "*.go"}}, want: []int{0, 1, 2, 3, 4}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if order, err := orderPaths(paths, tt.rules); err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(order, tt.want) {
+				t.Fatalf("unexpected order: %v", order)
+			}
+		})
+	}
+
+	t.Run("Cycle", func(t *testing.T) {
+		_, err := orderPaths(paths, []OrderRule{{Before: "*.go", After: "*.proto"}, {Before: "b.proto", After: "a.go"}})
+		if err == nil || err.Error() != "apply order rules contain a cycle: a.go, b.proto, e.proto" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// chdirTemp changes to a new temporary directory for the test & returns it.
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "bed-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func writeTestFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
@@ -0,0 +1,547 @@
+// Package bed implements finding, serializing & applying bulk edits to
+// matches of a regular expression across many files. It is used by the bed
+// command line tool but can be embedded by other tools as well.
+package bed
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// FindOptions represents options for finding matches.
+type FindOptions struct {
+	// Returns the contents of path. Defaults to ReadFile(), which reads into
+	// pooled buffers.
+	ReadFile func(path string) ([]byte, error)
+
+	// If set, called with the contents returned by ReadFile once no matches
+	// refer to them so the buffer can be reused. Defaults to ReleaseBuffer()
+	// if ReadFile is also unset.
+	ReleaseFile func(data []byte)
+
+	// If set, files are decoded from this character set, or CharsetAuto to
+	// detect it, & matched as UTF-8 text. Matches refer to the decoded text.
+	Charset string
+
+	// If set, matches whose text also matches this pattern are excluded.
+	Not *regexp.Regexp
+
+	// Maximum number of matches per file. Zero means unlimited.
+	MaxCount int
+
+	// Maximum number of matches in total. The search stops once this many
+	// matches have been found. Zero means unlimited.
+	Limit int
+
+	// If set, the time spent reading & matching each file is recorded.
+	Timings *Timings
+
+	// If set, limits the bytes read & the time spent searching.
+	Budget *ScanBudget
+
+	// If set, returns the range of lines that matches in path must start
+	// within. Matches outside of the range are ignored.
+	Lines func(path string) (LineRange, bool)
+
+	// If set, called with the path of each empty file. Empty files are
+	// skipped without matching since they cannot contain any text.
+	OnEmptyFile func(path string)
+}
+
+// LineRange is an inclusive range of line numbers, starting from 1. A zero
+// End includes every line after Start.
+type LineRange struct {
+	Start, End int
+}
+
+// Contains returns true if line is within the range.
+func (r LineRange) Contains(line int) bool {
+	return line >= r.Start && (r.End == 0 || line <= r.End)
+}
+
+// Matcher finds matches of a pattern & expands replacement templates using
+// their submatches. It is implemented by *regexp.Regexp so alternative
+// regular expression engines can be used in its place.
+type Matcher interface {
+	// Returns the start & end positions of up to n matches in b, if n is
+	// non-negative, followed by the positions of their submatches.
+	FindAllSubmatchIndex(b []byte, n int) [][]int
+
+	// Appends template to dst with submatch variables replaced by the
+	// corresponding text from src, as in regexp.Regexp.Expand().
+	Expand(dst []byte, template []byte, src []byte, match []int) []byte
+}
+
+// FindAllIndexPath finds the start/end position & data of re in all paths.
+// Paths of bed's own state files are skipped. If the scan budget runs out
+// then the matches found so far are returned with ErrScanBudget.
+func FindAllIndexPaths(re Matcher, paths []string, opt FindOptions) ([]*Match, error) {
+	var matches []*Match
+	for _, path := range paths {
+		if IsStateFile(path) {
+			log.Printf("skipping bed state file: %s", path)
+			continue
+		}
+
+		// Restrict matches in each file to the remaining total limit.
+		pathOpt := opt
+		if opt.Limit > 0 {
+			remaining := opt.Limit - len(matches)
+			if remaining <= 0 {
+				break
+			} else if pathOpt.MaxCount == 0 || pathOpt.MaxCount > remaining {
+				pathOpt.MaxCount = remaining
+			}
+		}
+
+		m, err := FindAllIndexPath(re, path, pathOpt)
+		if err == ErrScanBudget {
+			return matches, err
+		} else if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m...)
+	}
+	return matches, nil
+}
+
+// FindAllIndexPath finds the start/end position & data of re in path.
+func FindAllIndexPath(re Matcher, path string, opt FindOptions) ([]*Match, error) {
+	readFile, releaseFile := opt.ReadFile, opt.ReleaseFile
+	if readFile == nil {
+		readFile, releaseFile = ReadFile, ReleaseBuffer
+	}
+
+	if opt.Budget.Expired() {
+		return nil, ErrScanBudget
+	}
+
+	var data []byte
+	if err := opt.Timings.timeStage(path, stageRead, func() (err error) {
+		data, err = readFile(path)
+		return err
+	}); err != nil {
+		return nil, err
+	} else if err := opt.Budget.spend(len(data)); err != nil {
+		return nil, err
+	}
+	opt.Timings.setSize(path, len(data))
+
+	if len(data) == 0 {
+		if opt.OnEmptyFile != nil {
+			opt.OnEmptyFile(path)
+		}
+		if releaseFile != nil {
+			releaseFile(data)
+		}
+		return nil, nil
+	}
+
+	// Decode text in other character sets to UTF-8. The decoded text is not
+	// pooled so the original buffer can be released immediately. Files with
+	// a UTF-16 byte order mark are decoded even if no charset is specified.
+	charset := opt.Charset
+	if charset == CharsetAuto {
+		charset = DetectCharset(data)
+	} else if charset == "utf-8" {
+		charset = ""
+	}
+	if charset == "" {
+		charset = bomCharset(data)
+	}
+	if charset != "" {
+		text, err := DecodeCharset(data, charset)
+		if releaseFile != nil {
+			releaseFile(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		data, releaseFile = text, nil
+	}
+
+	// Positions are relative to the text after any byte order mark so that
+	// patterns anchored to the start of the text match.
+	buf := data
+	data = TrimByteOrderMark(data)
+
+	var a [][]int
+	opt.Timings.timeStage(path, stageMatch, func() error {
+		a = re.FindAllSubmatchIndex(data, -1)
+		return nil
+	})
+
+	// Restrict matches to a range of lines, if specified. Lines are counted
+	// up to each match as matches are in order.
+	var lines *LineRange
+	if opt.Lines != nil {
+		if r, ok := opt.Lines(path); ok {
+			lines = &r
+		}
+	}
+	line, lineStart, counted := 1, 0, 0
+
+	// Text is edited with LF line endings & CRLF is restored on apply.
+	crlf := UsesCRLF(data)
+
+	// Matches refer to the file's contents instead of copying them, so the
+	// buffer is only released if no match is kept. Matches are allocated
+	// together to reduce the garbage created by large scans.
+	var matches []*Match
+	var slab []Match
+	referenced := false
+	for i := range a {
+		for {
+			j := bytes.IndexByte(data[counted:a[i][0]], '\n')
+			if j == -1 {
+				break
+			}
+			line, lineStart, counted = line+1, counted+j+1, counted+j+1
+		}
+		counted = a[i][0]
+
+		text := data[a[i][0]:a[i][1]:a[i][1]]
+		if opt.MaxCount > 0 && len(matches) >= opt.MaxCount {
+			break
+		} else if lines != nil && lines.End > 0 && line > lines.End {
+			break
+		} else if lines != nil && !lines.Contains(line) {
+			continue
+		} else if opt.Not != nil && opt.Not.Match(text) {
+			continue
+		}
+
+		if slab == nil {
+			slab = make([]Match, 0, len(a)-i)
+		}
+		slab = append(slab, Match{
+			Path: path,
+			Pos:  a[i][0],
+			Len:  a[i][1] - a[i][0],
+			Line: line,
+			Col:  a[i][0] - lineStart + 1,
+			Data: text,
+
+			Charset: charset,
+		})
+		m := &slab[len(slab)-1]
+
+		// Store submatch positions relative to the match for expanding
+		// templates. Positions from the regexp are reused in place.
+		start := a[i][0]
+		for j, pos := range a[i] {
+			if pos != -1 {
+				a[i][j] -= start
+			}
+		}
+		m.submatches = a[i]
+
+		if crlf {
+			var removed []int
+			m.Data, removed = toLF(data, m.Pos, m.Pos+m.Len)
+			shiftSubmatches(m.submatches, removed)
+			referenced = referenced || removed == nil
+		} else {
+			referenced = true
+		}
+		matches = append(matches, m)
+	}
+
+	if !referenced && releaseFile != nil {
+		releaseFile(buf)
+	}
+	return matches, nil
+}
+
+// Match contains the source & position of a match.
+type Match struct {
+	Path string
+	Pos  int
+	Len  int
+	Data []byte
+
+	// Line & column of the start of the match, numbered from 1, for display.
+	// Columns are counted in bytes. Changes are applied using Pos & Len so
+	// these are zero if unknown.
+	Line int
+	Col  int
+
+	// Action to perform instead of replacing with Data, if set.
+	Directive string
+
+	// Character set of the file, if it is not UTF-8. Pos, Len & Data then
+	// refer to the file's text decoded to UTF-8.
+	Charset string
+
+	// Start & end positions of submatches within Data. Only set when the
+	// match is found by FindAllIndexPath().
+	submatches []int
+}
+
+// Expand replaces the match's data with template after expanding submatch
+// variables such as $1 or ${name}. See regexp.Regexp.Expand() for details.
+// The match must have been found with re.
+func (m *Match) Expand(re Matcher, template string) {
+	if m.submatches == nil {
+		return
+	}
+	m.Data = re.Expand(nil, []byte(template), m.Data, m.submatches)
+}
+
+// Directives which can be specified as the only line inside a match block.
+const (
+	// Removes the matched text.
+	DirectiveDelete = "delete"
+
+	// Removes every line containing the matched text, including the newline.
+	DirectiveDeleteLine = "delete-line"
+
+	// Leaves the matched text unchanged.
+	DirectiveSkip = "skip"
+
+	// Deletes the file containing the match.
+	DirectiveDeleteFile = "delete-file"
+)
+
+// directivePrefix is the prefix used to specify a directive in a match block.
+const directivePrefix = "#bed:"
+
+// escapePrefix is written before lines of match data which would otherwise
+// be read as a directive or the end of the block, such as a line containing
+// only "#bed:end". It is removed when the match is read.
+const escapePrefix = directivePrefix + `\`
+
+// parseDirective returns the directive specified by data, if any.
+func parseDirective(data []byte) string {
+	s := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(s, directivePrefix) {
+		return ""
+	}
+
+	switch directive := strings.TrimPrefix(s, directivePrefix); directive {
+	case DirectiveDelete, DirectiveDeleteLine, DirectiveSkip, DirectiveDeleteFile:
+		return directive
+	default:
+		return ""
+	}
+}
+
+type matchJSON struct {
+	Path string `json:"path"`
+	Pos  int    `json:"pos"`
+	Len  int    `json:"len"`
+	Line int    `json:"line,omitempty"`
+	Col  int    `json:"col,omitempty"`
+	Enc  string `json:"enc,omitempty"`
+
+	Charset string `json:"charset,omitempty"`
+}
+
+func (m *Match) MarshalText() ([]byte, error) {
+	return m.marshalText(WriteOptions{})
+}
+
+// marshalText returns the match as a match block written with opt.
+func (m *Match) marshalText(opt WriteOptions) ([]byte, error) {
+	// Encode data which may not survive editing as text, if specified.
+	data := m.Data
+	h := matchJSON{Path: m.Path, Pos: m.Pos, Len: m.Len, Line: m.Line, Col: m.Col, Charset: m.Charset}
+	if opt.Encoding != "" && m.Directive == "" && needsEncoding(data) {
+		var err error
+		if data, err = encodeData(data, opt.Encoding); err != nil {
+			return nil, err
+		}
+		h.Enc = opt.Encoding
+	}
+
+	hdr, err := encodeHeader(h, opt.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	// The data is framed by the begin & end lines, excluding the newline
+	// before the end line, so data ending in a newline has a blank last line.
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "#bed:begin %s\n", hdr)
+	if m.Directive != "" {
+		fmt.Fprintln(&buf, directivePrefix+m.Directive)
+	} else {
+		buf.Write(escapeData(data))
+		buf.WriteByte('\n')
+	}
+	fmt.Fprintln(&buf, "#bed:end")
+	return buf.Bytes(), nil
+}
+
+// escapeData returns data with escapePrefix inserted before each line which
+// begins with the directive prefix, ignoring leading whitespace, so data is
+// read back byte-for-byte.
+func escapeData(data []byte) []byte {
+	if !bytes.Contains(data, []byte(directivePrefix)) {
+		return data
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	for i, line := range lines {
+		if bytes.HasPrefix(bytes.TrimLeft(line, " \t"), []byte(directivePrefix)) {
+			lines[i] = append([]byte(escapePrefix), line...)
+		}
+	}
+	return bytes.Join(lines, nil)
+}
+
+// unescapeData returns data with the escapePrefix removed from each line.
+func unescapeData(data []byte) []byte {
+	if !bytes.Contains(data, []byte(escapePrefix)) {
+		return data
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimPrefix(line, []byte(escapePrefix))
+	}
+	return bytes.Join(lines, nil)
+}
+
+func (m *Match) UnmarshalText(data []byte) error {
+	a := matchTextRegex.FindSubmatch(data)
+	if len(a) == 0 {
+		return errors.New("missing #bed:begin or #bed:end tags")
+	}
+
+	hdr, err := decodeHeader(bytes.TrimSpace(a[1]))
+	if err != nil {
+		return err
+	}
+	m.Path, m.Pos, m.Len, m.Line, m.Col = hdr.Path, hdr.Pos, hdr.Len, hdr.Line, hdr.Col
+	m.Charset = hdr.Charset
+	if m.Directive = parseDirective(a[2]); m.Directive != "" {
+		m.Data = nil
+	} else if hdr.Enc != "" {
+		if m.Data, err = decodeData(a[2], hdr.Enc); err != nil {
+			return fmt.Errorf("%s:%d: %s", m.Path, m.Pos, err)
+		}
+	} else {
+		m.Data = unescapeData(a[2])
+	}
+
+	// Changes must be representable in the file's character set.
+	if m.Charset != "" {
+		if _, err := EncodeCharset(m.Data, m.Charset); err != nil {
+			return fmt.Errorf("%s:%d: %s", m.Path, m.Pos, err)
+		}
+	}
+	return nil
+}
+
+// matchTextRegex matches a match block. The begin & end tags must be on
+// lines by themselves so that data can contain them elsewhere on a line.
+var matchTextRegex = regexp.MustCompile(`(?ms)^#bed:begin ([^\n]+)\n(.*?)\n#bed:end[ \t\r]*$`)
+
+// ParseMatches finds and parses all matches.
+// An error is returned if match header data is not a valid header.
+func ParseMatches(data []byte) ([]*Match, error) {
+	var matches []*Match
+	for _, buf := range matchTextRegex.FindAll(data, -1) {
+		var m Match
+		if err := m.UnmarshalText(buf); err != nil {
+			return nil, err
+		}
+		matches = append(matches, &m)
+	}
+	return matches, nil
+}
+
+// basePrefix begins the line at the top of a match file which records the
+// base directory that the paths of its matches are relative to.
+const basePrefix = "#bed:base "
+
+// ParseMatchBase returns the base directory recorded on the first line of a
+// match file, or a blank string if paths are not relative to a base.
+func ParseMatchBase(data []byte) string {
+	if !bytes.HasPrefix(data, []byte(basePrefix)) {
+		return ""
+	}
+	line := data[len(basePrefix):]
+	if i := bytes.IndexByte(line, '\n'); i != -1 {
+		line = line[:i]
+	}
+	return string(bytes.TrimRight(line, "\r"))
+}
+
+// WriteMatchBase writes the line recording the base directory that paths
+// are relative to. It must be written before any matches.
+func WriteMatchBase(w io.Writer, base string) error {
+	_, err := fmt.Fprintf(w, "%s%s\n\n", basePrefix, base)
+	return err
+}
+
+// ReadMatchFile reads the matches from the match file at path. If path is
+// "-" then the match file is read from STDIN.
+func ReadMatchFile(path string) ([]*Match, error) {
+	matches, _, err := ReadMatchFileBase(path)
+	return matches, err
+}
+
+// ReadMatchFileBase reads the matches from the match file at path along
+// with the base directory their paths are relative to, if recorded.
+func ReadMatchFileBase(path string) ([]*Match, string, error) {
+	var buf []byte
+	var err error
+	if path == "-" {
+		buf, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		buf, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	matches, err := ParseMatches(buf)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %s", path, err)
+	}
+	return matches, ParseMatchBase(buf), nil
+}
+
+// WriteMatchFile writes matches to w in the match file format.
+func WriteMatchFile(w io.Writer, matches []*Match) error {
+	return WriteMatchFileHeader(w, matches, HeaderJSON)
+}
+
+// WriteMatchFileHeader writes matches to w in the match file format with
+// headers in the given format.
+func WriteMatchFileHeader(w io.Writer, matches []*Match, format string) error {
+	return WriteMatchFileOptions(w, matches, WriteOptions{Header: format})
+}
+
+// WriteOptions control how matches are written to a match file.
+type WriteOptions struct {
+	// Format of the header of each match. Defaults to HeaderJSON.
+	Header string
+
+	// Encoding of match data which contains control characters, invalid
+	// UTF-8 or lines which look like bed tags. If blank, all data is written
+	// as text.
+	Encoding string
+}
+
+// WriteMatchFileOptions writes matches to w in the match file format using
+// the given options.
+func WriteMatchFileOptions(w io.Writer, matches []*Match, opt WriteOptions) error {
+	for _, m := range matches {
+		if buf, err := m.marshalText(opt); err != nil {
+			return err
+		} else if _, err := w.Write(buf); err != nil {
+			return err
+		} else if _, err := w.Write([]byte("\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package bed
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestFindApply checks that matches found in a file, edited & then applied
+// change only the edited text, whatever the file's line endings.
+func TestFindApply(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		data     string
+		pattern  string
+		template string // expanded into each match, if set
+		replace  string // replaces each match, if set
+		upper    bool   // uppercase each match, if set
+		text     string // text of the first match, as shown for editing
+		want     string
+	}{
+		{
+			name:     "CRLF",
+			data:     "foo\r\nbar\r\nbaz\r\n",
+			pattern:  `(\w+)\r\n(\w+)`,
+			template: "$2\n$1",
+			text:     "foo\nbar",
+			want:     "bar\r\nfoo\r\nbaz\r\n",
+		},
+		{
+			name:    "CRLF_AddLines",
+			data:    "a\r\nfoo\r\nb\r\n",
+			pattern: `foo`,
+			replace: "x\ny",
+			text:    "foo",
+			want:    "a\r\nx\r\ny\r\nb\r\n",
+		},
+		{
+			name:    "CRLF_TrailingCR",
+			data:    "foo\r\nbar\r\n",
+			pattern: `foo\r`,
+			upper:   true,
+			text:    "foo",
+			want:    "FOO\r\nbar\r\n",
+		},
+		{
+			name:    "Mixed",
+			data:    "foo\r\nbar\nbaz\r\n",
+			pattern: `(?s)foo.*baz`,
+			upper:   true,
+			text:    "foo\r\nbar\nbaz",
+			want:    "FOO\r\nBAR\nBAZ\r\n",
+		},
+		{
+			name:     "Mixed_AddLines",
+			data:     "foo\r\nbar\n",
+			pattern:  `bar`,
+			template: "x\ny",
+			text:     "bar",
+			want:     "foo\r\nx\ny\n",
+		},
+		{
+			name:    "BOM",
+			data:    "\xef\xbb\xbffoo bar\n",
+			pattern: `^foo`,
+			upper:   true,
+			text:    "foo",
+			want:    "\xef\xbb\xbfFOO bar\n",
+		},
+		{
+			name:    "BOM_ReplaceAll",
+			data:    "\xef\xbb\xbffoo",
+			pattern: `(?s).+`,
+			replace: "bar",
+			text:    "foo",
+			want:    "\xef\xbb\xbfbar",
+		},
+		{
+			name:     "BOM_CRLF",
+			data:     "\xef\xbb\xbffoo\r\nbar\r\n",
+			pattern:  `^(\w+)\r\n(\w+)`,
+			template: "$2\n$1",
+			text:     "foo\nbar",
+			want:     "\xef\xbb\xbfbar\r\nfoo\r\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a.txt")
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			re := regexp.MustCompile(tt.pattern)
+			matches, err := FindAllIndexPath(re, path, FindOptions{})
+			if err != nil {
+				t.Fatal(err)
+			} else if len(matches) == 0 {
+				t.Fatal("no matches found")
+			} else if string(matches[0].Data) != tt.text {
+				t.Fatalf("unexpected match text: %q", matches[0].Data)
+			}
+
+			for _, m := range matches {
+				switch {
+				case tt.template != "":
+					m.Expand(re, tt.template)
+				case tt.replace != "":
+					m.Data = []byte(tt.replace)
+				case tt.upper:
+					m.Data = bytes.ToUpper(m.Data)
+				}
+			}
+			if err := ApplyMatches(matches, ApplyOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf, err := ioutil.ReadFile(path); err != nil {
+				t.Fatal(err)
+			} else if string(buf) != tt.want {
+				t.Fatalf("unexpected contents: %q", buf)
+			}
+		})
+	}
+}
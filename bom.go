@@ -0,0 +1,41 @@
+package bed
+
+import "bytes"
+
+// Byte order marks which begin some text files. Positions of matches are
+// relative to the text after the byte order mark so that patterns anchored
+// to the start of the text match, & the mark is restored when changes are
+// applied. Files with a UTF-16 byte order mark are always decoded.
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// byteOrderMark returns the UTF-8 byte order mark at the start of data, or
+// nil if there is none.
+func byteOrderMark(data []byte) []byte {
+	if bytes.HasPrefix(data, utf8BOM) {
+		return data[:len(utf8BOM):len(utf8BOM)]
+	}
+	return nil
+}
+
+// bomCharset returns the character set indicated by a UTF-16 byte order
+// mark at the start of data, or a blank string if there is none.
+func bomCharset(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return CharsetUTF16LE
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return CharsetUTF16BE
+	default:
+		return ""
+	}
+}
+
+// TrimByteOrderMark returns text without a UTF-8 byte order mark at its
+// start, if any. Match positions are relative to the trimmed text.
+func TrimByteOrderMark(text []byte) []byte {
+	return text[len(byteOrderMark(text)):]
+}
@@ -0,0 +1,58 @@
+package bed
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrScanBudget is returned when a search stops because its scan budget
+// has been exhausted. Matches found before the budget ran out are returned
+// along with the error.
+var ErrScanBudget = errors.New("scan budget exceeded")
+
+// ScanBudget limits the total bytes read & the time spent by a search so
+// that an over-broad search cannot run unbounded.
+type ScanBudget struct {
+	// Maximum number of bytes to read in total. Zero means unlimited.
+	MaxBytes int64
+
+	// Time after which no more files are read. Zero means no deadline.
+	Deadline time.Time
+
+	bytes int64
+	files int
+}
+
+// Bytes returns the number of bytes scanned.
+func (b *ScanBudget) Bytes() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.bytes
+}
+
+// Files returns the number of files scanned.
+func (b *ScanBudget) Files() int {
+	if b == nil {
+		return 0
+	}
+	return b.files
+}
+
+// Expired returns true if the deadline has passed.
+func (b *ScanBudget) Expired() bool {
+	return b != nil && !b.Deadline.IsZero() && !time.Now().Before(b.Deadline)
+}
+
+// spend records a file of n bytes as scanned. Returns ErrScanBudget, without
+// recording the file, if it would exceed the maximum bytes.
+func (b *ScanBudget) spend(n int) error {
+	if b == nil {
+		return nil
+	} else if b.MaxBytes > 0 && b.bytes+int64(n) > b.MaxBytes {
+		return ErrScanBudget
+	}
+	b.bytes += int64(n)
+	b.files++
+	return nil
+}
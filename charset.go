@@ -0,0 +1,130 @@
+package bed
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Character sets that files can be transcoded from for matching & editing.
+// Match data, positions & lengths refer to the file's text decoded to UTF-8
+// & the text is encoded back to the file's character set when applied.
+const (
+	CharsetUTF16LE  = "utf-16le"
+	CharsetUTF16BE  = "utf-16be"
+	CharsetLatin1   = "latin1"
+	CharsetShiftJIS = "shiftjis"
+
+	// Detects the character set of each file. Files which are valid UTF-8
+	// are not transcoded.
+	CharsetAuto = "auto"
+)
+
+// charsets maps character set names to their encodings.
+var charsets = map[string]encoding.Encoding{
+	CharsetUTF16LE:  unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	CharsetUTF16BE:  unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	CharsetLatin1:   charmap.ISO8859_1,
+	CharsetShiftJIS: japanese.ShiftJIS,
+}
+
+// ValidCharset returns true if charset is blank, "utf-8", "auto" or a known
+// character set.
+func ValidCharset(charset string) bool {
+	if charset == "" || charset == "utf-8" || charset == CharsetAuto {
+		return true
+	}
+	_, ok := charsets[charset]
+	return ok
+}
+
+// DetectCharset returns the character set of data, or a blank string if it
+// is valid UTF-8. UTF-16 is detected from a byte order mark or from NUL
+// bytes alternating with text. Other data is Shift JIS if it decodes as
+// Shift JIS exactly, otherwise Latin-1.
+func DetectCharset(data []byte) string {
+	if charset := bomCharset(data); charset != "" {
+		return charset
+	}
+
+	// Count NUL bytes at even & odd positions, which is common for text in
+	// UTF-16 since most characters in source code are ASCII.
+	var even, odd int
+	for i, b := range data {
+		if b == 0 && i%2 == 0 {
+			even++
+		} else if b == 0 {
+			odd++
+		}
+	}
+	if len(data)%2 == 0 && len(data) > 0 {
+		if odd > len(data)/4 && even == 0 {
+			return CharsetUTF16LE
+		} else if even > len(data)/4 && odd == 0 {
+			return CharsetUTF16BE
+		}
+	}
+
+	if utf8.Valid(data) {
+		return ""
+	} else if _, err := DecodeCharset(data, CharsetShiftJIS); err == nil {
+		return CharsetShiftJIS
+	}
+	return CharsetLatin1
+}
+
+// DecodeCharset returns data decoded from charset to UTF-8. Returns an error
+// if the text cannot be encoded back to exactly the same data, such as when
+// data contains bytes which are invalid in charset, since applying changes
+// would then alter the rest of the file.
+func DecodeCharset(data []byte, charset string) ([]byte, error) {
+	enc, ok := charsets[charset]
+	if !ok {
+		if charset == "" || charset == "utf-8" {
+			return data, nil
+		}
+		return nil, fmt.Errorf("unknown charset: %q", charset)
+	}
+
+	text, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %s", charset, err)
+	} else if other, err := enc.NewEncoder().Bytes(text); err != nil || !bytes.Equal(other, data) {
+		return nil, fmt.Errorf("not valid %s text", charset)
+	}
+	return text, nil
+}
+
+// EncodeCharset returns text encoded from UTF-8 to charset. Returns an error
+// if text contains characters which charset cannot represent.
+func EncodeCharset(text []byte, charset string) ([]byte, error) {
+	enc, ok := charsets[charset]
+	if !ok {
+		if charset == "" || charset == "utf-8" {
+			return text, nil
+		}
+		return nil, fmt.Errorf("unknown charset: %q", charset)
+	}
+
+	data, err := enc.NewEncoder().Bytes(text)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode text as %s: %s", charset, err)
+	}
+	return data, nil
+}
+
+// matchesCharset returns the character set of the files' text that matches
+// refer to, or a blank string if they refer to the file's data as it is.
+func matchesCharset(matches []*Match) string {
+	for _, m := range matches {
+		if m.Charset != "" {
+			return m.Charset
+		}
+	}
+	return ""
+}
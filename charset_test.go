@@ -0,0 +1,89 @@
+package bed
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestDetectCharset(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		want string
+	}{
+		{data: "héllo", want: ""},
+		{data: "", want: ""},
+		{data: "\xff\xfeh\x00i\x00", want: CharsetUTF16LE},
+		{data: "\xfe\xff\x00h\x00i", want: CharsetUTF16BE},
+		{data: "h\x00i\x00!\x00", want: CharsetUTF16LE},
+		{data: "\x00h\x00i\x00!", want: CharsetUTF16BE},
+		{data: "\x82\xa0\x82\xa2", want: CharsetShiftJIS},
+		{data: "caf\xe9", want: CharsetLatin1},
+	} {
+		if got := DetectCharset([]byte(tt.data)); got != tt.want {
+			t.Fatalf("%q: unexpected charset: %q", tt.data, got)
+		}
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	if text, err := DecodeCharset([]byte("caf\xe9"), CharsetLatin1); err != nil {
+		t.Fatal(err)
+	} else if string(text) != "café" {
+		t.Fatalf("unexpected text: %q", text)
+	}
+
+	// Data which would not encode back to the same bytes is rejected.
+	if _, err := DecodeCharset([]byte("h\x00\x00\xd8"), CharsetUTF16LE); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := DecodeCharset(nil, "ebcdic"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestEncodeCharset_Unsupported(t *testing.T) {
+	if _, err := EncodeCharset([]byte("日本"), CharsetLatin1); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// TestFindApply_Charset checks that matches in transcoded files refer to the
+// decoded text & are encoded back to the file's character set when applied.
+func TestFindApply_Charset(t *testing.T) {
+	for _, tt := range []struct {
+		charset string
+		data    string
+		want    string
+	}{
+		{charset: CharsetLatin1, data: "caf\xe9 foo", want: "caf\xe9 na\xefve"},
+		{charset: CharsetAuto, data: "caf\xe9 foo", want: "caf\xe9 na\xefve"},
+		{charset: CharsetUTF16LE, data: "\xff\xfec\x00\xe9\x00 \x00f\x00o\x00o\x00", want: "\xff\xfec\x00\xe9\x00 \x00n\x00a\x00\xef\x00v\x00e\x00"},
+	} {
+		t.Run(tt.charset, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a.txt")
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			matches, err := FindAllIndexPath(regexp.MustCompile(`foo`), path, FindOptions{Charset: tt.charset})
+			if err != nil {
+				t.Fatal(err)
+			} else if len(matches) != 1 {
+				t.Fatalf("unexpected match count: %d", len(matches))
+			} else if matches[0].Charset == "" {
+				t.Fatal("expected match charset")
+			}
+
+			matches[0].Data = []byte("naïve")
+			if err := ApplyMatches(matches, ApplyOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if buf, err := ioutil.ReadFile(path); err != nil {
+				t.Fatal(err)
+			} else if string(buf) != tt.want {
+				t.Fatalf("unexpected contents: %q", buf)
+			}
+		})
+	}
+}
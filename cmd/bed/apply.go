@@ -0,0 +1,706 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// RunApply executes the "apply" command which applies the changes in
+// previously edited match files without searching or opening an editor.
+func RunApply(args []string) (err error) {
+	fs := flag.NewFlagSet("bed-apply", flag.ContinueOnError)
+	af := newApplyFlags(fs)
+	promptFD := fs.Int("prompt-fd", -1, "")
+	promptJSON := fs.Bool("prompt-json", false, "")
+	lf := newLogFlags(fs)
+	tracePath := fs.String("trace", "", "")
+	configPath := fs.String("config", "", "")
+	profile := fs.String("profile", "", "")
+	batch := fs.Bool("batch", false, "")
+	idempotencyKey := fs.String("idempotency-key", "", "")
+	journalPath := fs.String("journal-file", DefaultJournalFile, "")
+	plain := fs.Bool("plain", false, "")
+	fs.Usage = func() { writeUsage(os.Stderr, applyDoc) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch && !isFlagSet(fs, "log-format") {
+		*lf.format = "json"
+	}
+	if fs.NArg() == 0 {
+		return errors.New("match file required")
+	} else if *batch && *promptFD < 0 && *af.readOnly == ReadOnlyPrompt {
+		return errors.New("-batch cannot be used with -readonly prompt unless prompts are answered with -prompt-fd")
+	} else if err := af.validateFlags(); err != nil {
+		return err
+	} else if err := lf.validateFlags(); err != nil {
+		return err
+	}
+	closeLog, err := lf.open()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	if *batch {
+		defer func() {
+			if err == nil && warnCount > 0 {
+				err = &batchWarningError{n: warnCount}
+			}
+		}()
+	}
+
+	// Record per-file timings when debugging & write a trace, if specified.
+	stopTrace, err := startTrace(*tracePath)
+	if err != nil {
+		return err
+	}
+	defer stopTrace()
+	if lf.debug() {
+		af.timings = &bed.Timings{}
+		defer logTimings(af.timings)
+	}
+
+	config, err := ReadConfigFile(*configPath, *profile)
+	if err != nil {
+		return err
+	}
+	af.setSafe(fs, config)
+	af.plain, af.noProgress = *plain, *batch
+
+	// Read matches from each match file.
+	var matches []*bed.Match
+	for _, path := range fs.Args() {
+		a, err := readMatchFile(path)
+		if err != nil {
+			return err
+		}
+		matches = append(matches, a...)
+	}
+	matches = bed.RemoveSkipped(matches)
+	if len(matches) == 0 {
+		return ErrNoMatches
+	}
+
+	// Skip changes which were already applied with the same key, such as
+	// when automation retries after losing the result of an earlier apply.
+	if *idempotencyKey != "" {
+		if applied, err := checkIdempotencyKey(*journalPath, *idempotencyKey, matches); err != nil {
+			return err
+		} else if applied {
+			log.Printf("info: changes already applied with idempotency key %q, skipping", *idempotencyKey)
+			return nil
+		}
+	}
+	recorded := matches
+
+	// Record each file in the journal as it is completed so that a retry of
+	// an interrupted apply skips the files which were already changed.
+	if *idempotencyKey != "" && !af.emits() {
+		digest := matchesDigest(matches)
+		done, err := completedFiles(*journalPath, *idempotencyKey, digest)
+		if err != nil {
+			return err
+		} else if len(done) > 0 {
+			log.Printf("info: resuming interrupted apply with idempotency key %q, %d file(s) already completed", *idempotencyKey, len(done))
+			other := matches[:0:0]
+			for _, m := range matches {
+				if !done[m.Path] {
+					other = append(other, m)
+				}
+			}
+			if matches = other; len(matches) == 0 {
+				return recordJournalEntry(*journalPath, *idempotencyKey, recorded)
+			}
+		}
+
+		jw, err := openJournal(*journalPath, *idempotencyKey, digest)
+		if err != nil {
+			return err
+		}
+		defer jw.Close()
+		af.onApply = func(path string) {
+			if err := jw.recordFile(path); err != nil {
+				warnf("cannot record %s in journal: %s", path, err)
+			}
+		}
+	}
+
+	// Report files which cannot be written before any are written.
+	if err := af.checkPermissions(matches); err != nil {
+		return err
+	}
+
+	// Open prompter if asking about read-only files.
+	var p prompter
+	if *af.readOnly == ReadOnlyPrompt {
+		var closer io.Closer
+		if p, closer, err = openPrompter(*promptFD, *promptJSON); err != nil {
+			return err
+		}
+		defer closer.Close()
+	}
+
+	af.sources = fs.Args()
+	if matches, err = af.preflight(matches, config, p); err != nil {
+		return err
+	} else if err := af.apply(matches, config); err != nil {
+		return err
+	}
+
+	// Record the completed apply so retries with the same key are skipped.
+	if *idempotencyKey != "" && !af.emits() {
+		return recordJournalEntry(*journalPath, *idempotencyKey, recorded)
+	}
+	return nil
+}
+
+// applyFlags are the command line flags which control how changes are applied.
+type applyFlags struct {
+	readOnly         *string
+	emitScript       *string
+	emitSuggestions  *string
+	followSymlinks   *bool
+	noFollowSymlinks *bool
+	safe             *bool
+	backupDir        *string
+	drift            *string
+	maxChangedFiles  *int
+	canary           *string
+	validateCmd      *string
+	notify           *string
+	notifyAfter      *time.Duration
+	postApply        *string
+	verify           *string
+	stage            *bool
+	commit           *string
+	checkpoint       *bool
+
+	// Records per-file timings, if set.
+	timings *bed.Timings
+
+	// Progress is shown without redrawing in plain mode & not at all if
+	// noProgress is true.
+	plain, noProgress bool
+
+	// If set, called with the path of each file once its changes are written.
+	onApply func(path string)
+
+	// Pattern & match files that changes came from, recorded by -commit.
+	pattern string
+	sources []string
+
+	// Checksums of files when they were searched, used to detect drift.
+	checksums map[string]uint32
+}
+
+// newApplyFlags registers the apply flags on fs.
+func newApplyFlags(fs *flag.FlagSet) *applyFlags {
+	return &applyFlags{
+		readOnly:         fs.String("readonly", "", ""),
+		emitScript:       fs.String("emit-script", "", ""),
+		emitSuggestions:  fs.String("emit-suggestions", "", ""),
+		followSymlinks:   fs.Bool("follow-symlinks", true, ""),
+		noFollowSymlinks: fs.Bool("no-follow-symlinks", false, ""),
+		safe:             fs.Bool("safe", false, ""),
+		backupDir:        fs.String("backup-dir", "", ""),
+		drift:            fs.String("drift", DriftOff, ""),
+		maxChangedFiles:  fs.Int("max-changed-files", 0, ""),
+		canary:           fs.String("canary", "", ""),
+		validateCmd:      fs.String("validate", "", ""),
+		notify:           fs.String("notify", "", ""),
+		notifyAfter:      fs.Duration("notify-after", 0, ""),
+		postApply:        fs.String("post-apply", "", ""),
+		verify:           fs.String("verify", "", ""),
+		stage:            fs.Bool("stage", false, ""),
+		commit:           fs.String("commit", "", ""),
+		checkpoint:       fs.Bool("checkpoint", false, ""),
+	}
+}
+
+// validateFlags returns an error if any flag values are invalid.
+func (f *applyFlags) validateFlags() error {
+	if !validReadOnlyPolicy(*f.readOnly) {
+		return fmt.Errorf("unknown readonly policy: %q", *f.readOnly)
+	} else if !validDriftPolicy(*f.drift) {
+		return fmt.Errorf("unknown drift policy: %q", *f.drift)
+	} else if _, err := parsePercent(*f.canary); err != nil {
+		return fmt.Errorf("invalid canary: %s", err)
+	} else if *f.emitScript != "" && *f.emitSuggestions != "" {
+		return errors.New("-emit-script cannot be used with -emit-suggestions")
+	} else if *f.canary != "" && f.emits() {
+		return errors.New("-canary cannot be used with -emit-script or -emit-suggestions")
+	} else if *f.verify != "" && f.emits() {
+		return errors.New("-verify cannot be used with -emit-script or -emit-suggestions")
+	} else if (*f.stage || *f.commit != "") && f.emits() {
+		return errors.New("-stage & -commit cannot be used with -emit-script or -emit-suggestions")
+	} else if *f.checkpoint && f.emits() {
+		return errors.New("-checkpoint cannot be used with -emit-script or -emit-suggestions")
+	} else if *f.notifyAfter < 0 {
+		return errors.New("-notify-after cannot be negative")
+	}
+	return nil
+}
+
+// commitMessage returns the subject & body of the -commit message for n
+// matches applied to the given number of files. The subject is the -commit
+// template with "{pattern}", "{matches}" & "{files}" replaced. The body
+// records the pattern or match files the changes came from.
+func (f *applyFlags) commitMessage(n, files int) (subject, body string) {
+	subject = strings.NewReplacer(
+		"{pattern}", f.pattern,
+		"{matches}", strconv.Itoa(n),
+		"{files}", strconv.Itoa(files),
+	).Replace(*f.commit)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Applied %d change(s) to %d file(s) with bed.\n\n", n, files)
+	if f.pattern != "" {
+		fmt.Fprintf(&sb, "Pattern: %s\n", f.pattern)
+	}
+	if len(f.sources) > 0 {
+		fmt.Fprintf(&sb, "Match-Files: %s\n", strings.Join(f.sources, " "))
+	}
+	fmt.Fprintf(&sb, "Matches: %d\nFiles: %d\nRun: %s", n, files, runID)
+	return subject, sb.String()
+}
+
+// postApplyRules returns the post-apply commands from the config followed by
+// the -post-apply command, which is run on every modified file.
+func (f *applyFlags) postApplyRules(config *Config) []PostApplyRule {
+	rules := config.PostApply
+	if *f.postApply != "" {
+		rules = append(rules[:len(rules):len(rules)], PostApplyRule{Command: *f.postApply})
+	}
+	return rules
+}
+
+// validateCommand returns the command used to validate a canary.
+func (f *applyFlags) validateCommand(config *Config) string {
+	if *f.validateCmd != "" {
+		return *f.validateCmd
+	}
+	return config.Validate
+}
+
+// checkPermissions checks that files containing matches can be written, if
+// they will be written directly.
+func (f *applyFlags) checkPermissions(matches []*bed.Match) error {
+	if f.emits() {
+		return nil
+	}
+	return checkPermissions(matches, *f.readOnly, !*f.noFollowSymlinks && *f.followSymlinks)
+}
+
+// preflight checks files before any changes are written & returns the
+// matches which should be applied.
+func (f *applyFlags) preflight(matches []*bed.Match, config *Config, p prompter) ([]*bed.Match, error) {
+	if *f.canary != "" && f.validateCommand(config) == "" {
+		return nil, errCanaryValidate
+	}
+
+	matches, err := preflightProtected(matches, config.Protect, *f.safe)
+	if err != nil {
+		return nil, err
+	} else if matches, err = preflightReadOnly(matches, *f.readOnly, p); err != nil {
+		return nil, err
+	} else if matches, err = preflightDrift(matches, f.checksums, *f.drift); err != nil {
+		return nil, err
+	} else if err := checkMaxChangedFiles(matches, *f.maxChangedFiles); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// emits returns true if changes are written to a script or as suggestions
+// instead of being applied to files.
+func (f *applyFlags) emits() bool {
+	return *f.emitScript != "" || *f.emitSuggestions != ""
+}
+
+// apply writes matches to their files, or to a script or suggestions if
+// specified, & then runs any commands to regenerate derived files. If a
+// canary is specified, it is applied & validated before the remaining files
+// are changed. The -notify command is run once the apply completes or fails
+// & the apply is recorded as an "apply" span, if tracing.
+func (f *applyFlags) apply(matches []*bed.Match, config *Config) error {
+	if *f.emitScript != "" {
+		return writeScriptFile(*f.emitScript, matches)
+	} else if *f.emitSuggestions != "" {
+		return writeSuggestionsFile(*f.emitSuggestions, matches)
+	}
+
+	start, apply := time.Now(), tracing.start("apply")
+	err := f.applyChanges(matches, config)
+	apply.setMatches(bed.RemoveSkipped(matches))
+	apply.finish(err)
+	f.notifyEvent(newNotification(NotifyApply, bed.RemoveSkipped(matches), start, err))
+	return err
+}
+
+// applyChanges writes matches to their files & runs post-apply, verify &
+// regen commands.
+func (f *applyFlags) applyChanges(matches []*bed.Match, config *Config) error {
+	// Changes can only be staged & committed inside a git worktree, so check
+	// before any files are changed.
+	if *f.stage || *f.commit != "" || *f.checkpoint {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		} else if _, err := gitWorktreeRoot(wd); err != nil {
+			return fmt.Errorf("-stage, -commit & -checkpoint require a git worktree: %s", err)
+		}
+	}
+
+	// Back up files to a new directory for each run.
+	var backupDir string
+	if *f.backupDir != "" {
+		backupDir = filepath.Join(*f.backupDir, time.Now().UTC().Format("20060102T150405Z")+"-"+runID)
+	}
+
+	// Timings are always recorded for the summary of the apply.
+	timings := f.timings
+	if timings == nil {
+		timings = &bed.Timings{}
+	}
+	start, startRead, startWrite := time.Now(), totalReadTime(timings), totalWriteTime(timings)
+
+	modifiedPaths, pathMatches := bed.GroupMatchesByPath(bed.RemoveSkipped(matches))
+
+	// Record the original contents of every file to be changed in git so
+	// they can be restored with a single command.
+	if *f.checkpoint && len(modifiedPaths) > 0 {
+		paths := modifiedPaths
+		if !*f.noFollowSymlinks && *f.followSymlinks {
+			var err error
+			if paths, err = symlinkTargets(modifiedPaths, pathMatches); err != nil {
+				return fmt.Errorf("checkpoint: %s", err)
+			}
+		}
+
+		ref, err := gitCheckpoint(paths)
+		if err != nil {
+			return fmt.Errorf("checkpoint: %s", err)
+		}
+		log.Printf("info: checkpoint of %d file(s) saved to %s", len(modifiedPaths), ref)
+		fmt.Fprintf(os.Stderr, "Original files saved to %s. Restore them with:\n\n\tgit checkout %s -- :/\n\n", ref, ref)
+	}
+
+	var progress *applyProgress
+	if !f.noProgress {
+		progress = newApplyProgress(len(modifiedPaths), f.plain)
+	}
+
+	opt := bed.ApplyOptions{
+		Order:            config.Order,
+		ForceReadOnly:    *f.readOnly == ReadOnlyForce || *f.readOnly == ReadOnlyPrompt,
+		NoFollowSymlinks: *f.noFollowSymlinks || !*f.followSymlinks,
+		BackupDir:        backupDir,
+		Timings:          timings,
+		OnApply:          func(string) { progress.update() },
+	}
+
+	// Keep the original contents of every file to roll back to if the
+	// changes fail verification. Files are only completed once verified.
+	var originals []originalFile
+	var changes []verifyChange
+	if *f.verify != "" {
+		var err error
+		if originals, err = snapshotFiles(modifiedPaths); err != nil {
+			progress.finish()
+			return err
+		}
+		changes = verifyChanges(originals, pathMatches)
+	}
+	completed := func(path string) {
+		if *f.verify == "" {
+			f.completed(path)
+		}
+	}
+
+	// Apply a random subset of files first & only continue if it validates.
+	// Canary files are only completed once validation passes.
+	rest := matches
+	var validateTime time.Duration
+	if percent, _ := parsePercent(*f.canary); percent > 0 {
+		var canary []*bed.Match
+		if canary, rest = splitCanary(matches, percent); canary == nil {
+			warnf("too few files for a canary, applying changes to all files")
+		} else {
+			t := time.Now()
+			if err := applyCanary(canary, f.validateCommand(config), opt); err != nil {
+				progress.finish()
+				return err
+			}
+			validateTime = time.Since(t)
+
+			paths, _ := bed.GroupMatchesByPath(bed.RemoveSkipped(canary))
+			for _, path := range paths {
+				completed(path)
+			}
+		}
+	}
+
+	opt.OnApply = func(path string) {
+		progress.update()
+		completed(path)
+	}
+	err := bed.ApplyMatches(rest, opt)
+	progress.finish()
+	if err != nil {
+		return err
+	}
+	if backupDir != "" {
+		log.Printf("info: backed up original files to %s", backupDir)
+	}
+
+	// Record each modified file so runs can be audited from the log.
+	for i, path := range modifiedPaths {
+		log.Printf("info: applied %d match(es) to %s", len(pathMatches[i]), path)
+	}
+
+	// Run post-apply commands, such as formatters, on each modified file &
+	// then regenerate derived files from modified sources.
+	postApplyStart := time.Now()
+	postApply := f.postApplyRules(config)
+	if err := runPostApplyCommands(postApply, modifiedPaths); err != nil {
+		return err
+	}
+
+	// Verify the changes, rolling back every file if verification fails.
+	verifyStart := time.Now()
+	if *f.verify != "" {
+		if err := verifyApply(*f.verify, originals, changes, opt); err != nil {
+			return err
+		}
+		for _, path := range modifiedPaths {
+			f.completed(path)
+		}
+	}
+	regenStart := time.Now()
+	if err := runRegenCommands(config.Regen, modifiedPaths); err != nil {
+		return err
+	}
+
+	// Stage modified files, including deletions, in the git index & then
+	// commit them, if specified.
+	if *f.stage || *f.commit != "" {
+		if err := gitStage(modifiedPaths); err != nil {
+			return err
+		}
+		log.Printf("info: staged %d file(s)", len(modifiedPaths))
+	}
+	if *f.commit != "" {
+		n := len(bed.RemoveSkipped(matches))
+		subject, body := f.commitMessage(n, len(modifiedPaths))
+		if err := gitCommit(modifiedPaths, subject, body); err != nil {
+			return err
+		}
+		log.Printf("info: committed %d file(s): %s", len(modifiedPaths), subject)
+	}
+
+	// Summarize where the time was spent. Validation includes the time to
+	// apply the canary.
+	summary := fmt.Sprintf("read %s, write %s",
+		formatDuration(totalReadTime(timings)-startRead),
+		formatDuration(totalWriteTime(timings)-startWrite),
+	)
+	if validateTime > 0 {
+		summary += ", canary " + formatDuration(validateTime)
+	}
+	if len(postApply) > 0 {
+		summary += ", post-apply " + formatDuration(verifyStart.Sub(postApplyStart))
+	}
+	if *f.verify != "" {
+		summary += ", verify " + formatDuration(regenStart.Sub(verifyStart))
+	}
+	if len(config.Regen) > 0 {
+		summary += ", regen " + formatDuration(time.Since(regenStart))
+	}
+	log.Printf("info: run %s applied changes to %d file(s) in %s (%s)", runID, len(modifiedPaths), formatDuration(time.Since(start)), summary)
+	return nil
+}
+
+// symlinkTargets returns paths with each symlink replaced by the path of its
+// target, since changes are written through symlinks to their targets.
+// Symlinks deleted by their matches, in pathMatches, are kept since the
+// symlink itself is removed.
+func symlinkTargets(paths []string, pathMatches [][]*bed.Match) ([]string, error) {
+	other := make([]string, len(paths))
+	for i, path := range paths {
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		} else if fi.Mode()&os.ModeSymlink == 0 || bed.DeletesFile(pathMatches[i]) {
+			other[i] = path
+			continue
+		}
+
+		if other[i], err = filepath.EvalSymlinks(path); err != nil {
+			return nil, err
+		}
+	}
+	return other, nil
+}
+
+// completed records that changes to path have been written.
+func (f *applyFlags) completed(path string) {
+	if f.onApply != nil {
+		f.onApply(path)
+	}
+}
+
+var applyDoc = &commandDoc{
+	Name:  "bed apply",
+	Short: "apply edited match files",
+	Long: `Applies the changes in one or more edited match files without searching
+or opening an editor. Match files can be written by "bed search" & then
+reviewed & circulated before they are applied. Paths in the match file
+are resolved from the current directory, so the command should be run
+from the directory the matches were found in, unless the match file was
+written with -relative, in which case paths are resolved from the root
+of the current git worktree. If a path is "-" then matches are read
+from STDIN.
+
+Applies which take more than a second show the number of files applied
+& the estimated time remaining on a terminal. Once the apply finishes,
+the total time spent reading & writing files, validating a canary &
+regenerating files is logged.`,
+	Synopsis: []string{
+		"bed apply [arguments] matchfile [matchfiles]",
+	},
+	Flags: []docItem{
+		{Name: "-config PATH", Text: `Read configuration from PATH. Defaults to .bed.json in the
+current directory or in the home directory, if present.`},
+		{Name: "-profile NAME", Text: `Use the settings of profile NAME from the configuration
+file. See "bed -h" for details.`},
+		{Name: "-readonly POLICY", Text: `How to handle read-only files. Either "skip", "force" or
+"prompt". See "bed -h" for details.`},
+		{Name: "-emit-script FILE", Text: `Write a standalone POSIX shell script to FILE which applies
+the changes instead of applying them.`},
+		{Name: "-emit-suggestions FILE", Text: `Write the changes to FILE as GitHub "suggested change" review
+comments instead of applying them. See "bed -h" for details.`},
+		{Name: "-no-follow-symlinks", Text: `Replace symlinked files with regular files containing the
+changes instead of modifying their targets.`},
+		{Name: "-safe", Text: `Back up files to .bed/backups, enforce protected paths & apply
+no more than 50 files. See "bed -h" for details.`},
+		{Name: "-backup-dir DIR", Text: `Copy the original contents of each file to a new timestamped
+directory within DIR before changes are applied.`},
+		{Name: "-max-changed-files N", Text: `Apply no changes if more than N files would be changed.`},
+		{Name: "-canary N%", Text: `Apply changes to a random N% of files first & only apply the
+rest if the -validate command succeeds. See "bed -h" for
+details.`},
+		{Name: "-validate CMD", Text: `Run CMD to validate a canary. Overrides the "validate"
+configuration key.`},
+		{Name: "-notify CMD", Text: `Run CMD, or post to an http or https URL, with a JSON summary
+once changes are applied or fail. See "bed -h" for details.`},
+		{Name: "-notify-after DURATION", Text: `Only notify about applies which take at least DURATION.
+Failures are always notified.`},
+		{Name: "-post-apply CMD", Text: `Run CMD on each modified file after changes are applied,
+e.g. -post-apply "gofmt -w {}". See "bed -h" for details.`},
+		{Name: "-verify CMD", Text: `Run CMD after changes are applied & roll back every file if
+it fails, e.g. -verify "go build ./...". See "bed -h".`},
+		{Name: "-stage", Text: "Add every modified file to the git index once changes are applied."},
+		{Name: "-commit MESSAGE", Text: `Commit every modified file in a single git commit once changes
+are applied. See "bed -h" for details.`},
+		{Name: "-checkpoint", Text: `Save the original contents of every file to be changed in a git
+ref before changes are applied. See "bed -h" for details.`},
+		{Name: "-idempotency-key KEY", Text: `Record the apply under KEY in the journal once it completes.
+If changes were already applied with KEY then they are not
+applied again, so automation can safely retry an apply whose
+result was lost. Each file is recorded as soon as it is written
+so a retry of an interrupted apply only changes the remaining
+files. Reusing KEY for different changes is an error.`},
+		{Name: "-journal-file PATH", Text: `Record applies with an idempotency key to PATH. Defaults to
+.bed/applied.jsonl in the current directory.`},
+		{Name: "-plain", Text: `Report progress as a line at every 10% instead of redrawing a
+progress bar, for screen readers.`},
+		{Name: "-prompt-fd N", Text: `Read & write interactive prompts on file descriptor N
+instead of the terminal.`},
+		{Name: "-prompt-json", Text: "Write interactive prompts as JSON objects, one per line."},
+		{Name: "-v", Text: "Enable verbose logging, including per-file timings."},
+		{Name: "-log-level LEVEL", Text: `Log messages at or above LEVEL, which is "debug", "info" or
+"warn".`},
+		{Name: "-log-file FILE", Text: "Append log messages to FILE, with timestamps & the run ID."},
+		{Name: "-log-format FORMAT", Text: `Write log messages as "text" (default) or "json" objects,
+one per line.`},
+		{Name: "-batch", Text: `Run non-interactively, such as in CI. Logs are written as JSON
+& the run fails if any warnings are reported.`},
+		{Name: "-trace FILE", Text: "Write a Go runtime execution trace to FILE."},
+	},
+	Examples: []docExample{
+		{
+			Title: "Apply a reviewed match file",
+			Text:  "Apply changes from a match file that was edited & reviewed earlier.",
+			Args:  []string{"changes.bed"},
+			Files: []docFile{
+				{Path: "main.go", Data: "const timeout = 10\n"},
+				{Path: "changes.bed", Data: "#bed:begin {\"path\":\"main.go\",\"pos\":16,\"len\":2}\n30\n#bed:end\n"},
+			},
+			Want: []docFile{
+				{Path: "main.go", Data: "const timeout = 30\n"},
+			},
+		},
+	},
+}
+
+// WriteMatchFilePath writes matches to a match file at path, or to STDOUT if
+// path is "-". Paths are written relative to the checkout root if relative
+// is true.
+func WriteMatchFilePath(path string, matches []*bed.Match, opt bed.WriteOptions, relative bool) error {
+	if path == "-" {
+		return writeMatchFile(os.Stdout, matches, opt, relative)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeMatchFile(f, matches, opt, relative); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeFallbackMatchFile writes matches to a match file which is kept after
+// bed exits & prints instructions for applying it. Used when no editor can
+// be run, such as in automated or remote environments.
+func writeFallbackMatchFile(matches []*bed.Match, opt bed.WriteOptions, relative bool) error {
+	f, err := ioutil.TempFile("", "bed-"+runID+"-*.bed")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeMatchFile(f, matches, opt, relative); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "No editor is set & no terminal is available, so %d match(es) were written to:\n\n", len(matches))
+	fmt.Fprintf(os.Stderr, "\t%s\n\n", f.Name())
+	fmt.Fprintf(os.Stderr, "Edit the file & then apply the changes by running the following from %s:\n\n", wd)
+	fmt.Fprintf(os.Stderr, "\tbed apply %s\n\n", shellWord(f.Name()))
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// expandArgsFiles replaces each "@FILE" argument with the arguments listed
+// in FILE, one per line. Surrounding whitespace is trimmed & blank lines &
+// lines beginning with "#" are ignored, so invocations can be checked in &
+// commented. Arguments in the file are not expanded again. An argument
+// beginning with "@@" is passed on with the first "@" removed & arguments
+// after "--" are never expanded.
+func expandArgsFiles(args []string) ([]string, error) {
+	var other []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(other, args[i:]...), nil
+		} else if strings.HasPrefix(arg, "@@") {
+			other = append(other, arg[1:])
+			continue
+		} else if !strings.HasPrefix(arg, "@") || arg == "@" {
+			other = append(other, arg)
+			continue
+		}
+
+		a, err := readArgsFile(arg[1:])
+		if err != nil {
+			return nil, err
+		}
+		other = append(other, a...)
+	}
+	return other, nil
+}
+
+// readArgsFile returns the arguments listed in the file at path.
+func readArgsFile(path string) ([]string, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read arguments: %s", err)
+	}
+
+	var args []string
+	for _, line := range strings.Split(string(buf), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args = append(args, line)
+	}
+	return args, nil
+}
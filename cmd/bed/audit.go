@@ -0,0 +1,406 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// maxAuditTextSize is the most bytes of each match's text kept in an audit
+// report, so that reports of large matches stay readable.
+const maxAuditTextSize = 200
+
+// AuditRule is a named pattern reported by "bed audit".
+type AuditRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Engine  string `json:"engine,omitempty"`
+}
+
+// RunAudit executes the "audit" command which scans files for the patterns
+// configured in the "audit" configuration key & writes a timestamped report
+// of every match, signed if a key is given. The command only reads files &
+// never modifies them.
+func RunAudit(args []string) error {
+	fs := flag.NewFlagSet("bed-audit", flag.ContinueOnError)
+	outPath := fs.String("o", "-", "")
+	keyPath := fs.String("key", "", "")
+	verifyPath := fs.String("verify", "", "")
+	publicKeyPath := fs.String("public-key", "", "")
+	configPath := fs.String("config", "", "")
+	profile := fs.String("profile", "", "")
+	fs.Usage = func() { writeUsage(os.Stderr, auditDoc) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Verify an existing report instead, if specified.
+	if *verifyPath != "" {
+		if fs.NArg() > 0 {
+			return errors.New("-verify cannot be used with paths")
+		}
+		return verifyAuditReportFile(*verifyPath, *publicKeyPath)
+	}
+
+	config, err := ReadConfigFile(*configPath, *profile)
+	if err != nil {
+		return err
+	} else if len(config.Audit) == 0 {
+		return errors.New(`no audit rules configured, add them to the "audit" configuration key`)
+	}
+
+	var key ed25519.PrivateKey
+	if *keyPath != "" {
+		if key, err = readAuditKey(*keyPath); err != nil {
+			return err
+		}
+	}
+
+	// Scan the files tracked by git if no paths are given.
+	paths := fs.Args()
+	if len(paths) == 0 {
+		if paths, err = gitTrackedFiles("", nil, true); err != nil {
+			return errors.New("path required outside of a git worktree")
+		}
+	}
+
+	report, err := runAudit(config.Audit, paths)
+	if err != nil {
+		return err
+	} else if err := report.sign(key); err != nil {
+		return err
+	}
+
+	if err := writeAuditReportFile(*outPath, report); err != nil {
+		return err
+	}
+	return writeAuditSummary(os.Stderr, report)
+}
+
+// auditReport is the result of an audit. The digest & signature cover every
+// other field.
+type auditReport struct {
+	Version   string             `json:"version"`
+	Created   string             `json:"created"`
+	Run       string             `json:"run,omitempty"`
+	Dir       string             `json:"dir"`
+	Commit    string             `json:"commit,omitempty"`
+	Files     int                `json:"files_scanned"`
+	Rules     []auditRuleSummary `json:"rules"`
+	Matches   []auditMatch       `json:"matches"`
+	Digest    string             `json:"digest"`
+	PublicKey string             `json:"public_key,omitempty"`
+	Signature string             `json:"signature,omitempty"`
+}
+
+// auditRuleSummary is a rule & the number of matches it found.
+type auditRuleSummary struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Matches int    `json:"matches"`
+	Files   int    `json:"files"`
+}
+
+// auditMatch is a single match found by an audit.
+type auditMatch struct {
+	Rule string `json:"rule"`
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
+	Text string `json:"text"`
+}
+
+// runAudit scans each file in paths for every rule. Files are read once &
+// matched against each rule in turn.
+func runAudit(rules []AuditRule, paths []string) (*auditReport, error) {
+	matchers := make([]bed.Matcher, len(rules))
+	for i, rule := range rules {
+		engine := rule.Engine
+		if engine == "" {
+			engine = "re2"
+		}
+		if rule.Name == "" {
+			return nil, fmt.Errorf("audit rule %d: name required", i+1)
+		} else if err := validateEngine(engine); err != nil {
+			return nil, fmt.Errorf("audit rule %q: %s", rule.Name, err)
+		}
+
+		re, err := engines[engine](rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("audit rule %q: %s", rule.Name, err)
+		}
+		matchers[i] = re
+	}
+
+	report := &auditReport{
+		Version: bed.GetBuildInfo().Version,
+		Created: time.Now().UTC().Format(time.RFC3339),
+		Run:     runID,
+		Matches: []auditMatch{},
+	}
+	report.Dir, _ = os.Getwd()
+	if out, err := gitOutput("rev-parse", "HEAD"); err == nil {
+		report.Commit = strings.TrimSpace(string(out))
+	}
+	for _, rule := range rules {
+		report.Rules = append(report.Rules, auditRuleSummary{Name: rule.Name, Pattern: rule.Pattern})
+	}
+
+	for _, path := range paths {
+		if bed.IsStateFile(path) {
+			continue
+		}
+		data, err := bed.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		report.Files++
+
+		opt := bed.FindOptions{
+			ReadFile:    func(string) ([]byte, error) { return data, nil },
+			ReleaseFile: func([]byte) {},
+		}
+		for i, re := range matchers {
+			matches, err := bed.FindAllIndexPath(re, path, opt)
+			if err != nil {
+				bed.ReleaseBuffer(data)
+				return nil, err
+			}
+			if len(matches) > 0 {
+				report.Rules[i].Files++
+			}
+			for _, m := range matches {
+				text := m.Data
+				if len(text) > maxAuditTextSize {
+					text = text[:maxAuditTextSize]
+				}
+				report.Matches = append(report.Matches, auditMatch{
+					Rule: rules[i].Name,
+					Path: m.Path,
+					Line: m.Line,
+					Col:  m.Col,
+					Text: string(text),
+				})
+				report.Rules[i].Matches++
+			}
+		}
+		bed.ReleaseBuffer(data)
+	}
+	return report, nil
+}
+
+// signedData returns the encoding of the report which is signed, with the
+// digest & signature blank.
+func (r *auditReport) signedData() ([]byte, error) {
+	other := *r
+	other.Digest, other.Signature = "", ""
+	return json.Marshal(&other)
+}
+
+// sign sets the digest of the report & signs it with key, if set.
+func (r *auditReport) sign(key ed25519.PrivateKey) error {
+	if key != nil {
+		r.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	}
+
+	data, err := r.signedData()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	r.Digest = "sha256:" + hex.EncodeToString(sum[:])
+	if key != nil {
+		r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	}
+	return nil
+}
+
+// verify returns an error if the report's digest does not match its contents
+// or if it is not signed by its public key. If trusted is set then the
+// report must be signed by that key.
+func (r *auditReport) verify(trusted ed25519.PublicKey) error {
+	data, err := r.signedData()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if r.Digest != "sha256:"+hex.EncodeToString(sum[:]) {
+		return errors.New("report digest does not match its contents")
+	} else if r.Signature == "" {
+		return errors.New("report is not signed")
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(r.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New("report has an invalid public key")
+	} else if trusted != nil && !trusted.Equal(ed25519.PublicKey(pub)) {
+		return errors.New("report is not signed by the trusted key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || !ed25519.Verify(pub, data, sig) {
+		return errors.New("report signature is invalid")
+	}
+	return nil
+}
+
+// readAuditKey reads an Ed25519 private key from a PEM encoded PKCS #8
+// file, such as one created by "openssl genpkey -algorithm ed25519".
+func readAuditKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEMFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %s: %s", path, err)
+	} else if k, ok := key.(ed25519.PrivateKey); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("invalid key %s: not an Ed25519 key", path)
+}
+
+// readAuditPublicKey reads an Ed25519 public key from a PEM encoded PKIX
+// file, such as one created by "openssl pkey -pubout".
+func readAuditPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEMFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %s", path, err)
+	} else if k, ok := key.(ed25519.PublicKey); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("invalid public key %s: not an Ed25519 key", path)
+}
+
+// readPEMFile returns the first PEM block in the file at path.
+func readPEMFile(path string) (*pem.Block, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
+
+// verifyAuditReportFile verifies the report at path, optionally against the
+// trusted public key at publicKeyPath, & prints the result.
+func verifyAuditReportFile(path, publicKeyPath string) error {
+	var trusted ed25519.PublicKey
+	if publicKeyPath != "" {
+		var err error
+		if trusted, err = readAuditPublicKey(publicKeyPath); err != nil {
+			return err
+		}
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var report auditReport
+	if err := json.Unmarshal(buf, &report); err != nil {
+		return fmt.Errorf("invalid report %s: %s", path, err)
+	} else if err := report.verify(trusted); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	fmt.Printf("%s: valid signature, created %s\n", path, report.Created)
+	return nil
+}
+
+// writeAuditReportFile writes report as JSON to path, or to STDOUT if path
+// is "-".
+func writeAuditReportFile(path string, report *auditReport) error {
+	buf, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+
+	if path == "-" {
+		_, err := os.Stdout.Write(buf)
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0666)
+}
+
+// writeAuditSummary writes a human readable summary of report to w.
+func writeAuditSummary(w io.Writer, report *auditReport) error {
+	fmt.Fprintf(w, "audit %s of %s at %s", report.Run, report.Dir, report.Created)
+	if report.Commit != "" {
+		fmt.Fprintf(w, " (commit %.12s)", report.Commit)
+	}
+	fmt.Fprintf(w, "\n%d file(s) scanned, %d match(es)\n", report.Files, len(report.Matches))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, r := range report.Rules {
+		fmt.Fprintf(tw, "  %s\t%d match(es) in %d file(s)\n", r.Name, r.Matches, r.Files)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if report.Signature != "" {
+		fmt.Fprintf(w, "signed, digest %s\n", report.Digest)
+	} else {
+		fmt.Fprintf(w, "not signed, digest %s\n", report.Digest)
+	}
+	return nil
+}
+
+var auditDoc = &commandDoc{
+	Name:  "bed audit",
+	Short: "report matches of configured patterns without editing",
+	Long: `Scans files for each of the patterns configured in the "audit"
+configuration key, a list of {"name": NAME, "pattern": REGEX} rules
+with an optional "engine", & writes a timestamped JSON report of every
+match along with a summary to STDERR. The report records the bed
+version, directory, git commit & a SHA-256 digest of its contents & is
+signed with an Ed25519 key if -key is set, so compliance scans can use
+the same engine developers use. If no paths are given then the files
+tracked by git are scanned.`,
+	Synopsis: []string{
+		"bed audit [arguments] [paths]",
+		"bed audit -verify REPORT [-public-key FILE]",
+	},
+	Sections: []docSection{
+		{Text: `The audit command only reads files, apart from writing its report. For
+scans which must not be able to modify anything else, build bed with
+"go build -tags audit ./cmd/bed" to produce an executable which only
+runs audits, with every code path which modifies files, such as
+applying changes, renames, hooks & remote uploads, compiled out.`},
+	},
+	Flags: []docItem{
+		{Name: "-o FILE", Text: "Write the JSON report to FILE instead of STDOUT."},
+		{Name: "-key FILE", Text: `Sign the report with the Ed25519 private key in the PEM file
+FILE, e.g. created with "openssl genpkey -algorithm ed25519".`},
+		{Name: "-verify REPORT", Text: `Check that the digest & signature of REPORT are valid instead
+of scanning.`},
+		{Name: "-public-key FILE", Text: `With -verify, require that REPORT is signed by the Ed25519
+public key in the PEM file FILE, e.g. created with "openssl
+pkey -pubout".`},
+		{Name: "-config PATH", Text: "Read audit rules from the configuration at PATH."},
+		{Name: "-profile NAME", Text: `Use the settings of profile NAME from the configuration
+file. See "bed -h" for details.`},
+	},
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestAuditBuild checks that the audit build compiles, runs audits & leaves
+// out every function which modifies files.
+func TestAuditBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short mode")
+	}
+
+	for _, tt := range []struct {
+		dir   string
+		funcs []string
+	}{
+		{dir: "../..", funcs: []string{"ApplyMatches", "WriteFile", "writeFile", "RenamePaths", "backupFile"}},
+		{dir: ".", funcs: []string{"Run", "RunApply", "restoreFiles", "runRegenCommands", "runPostApplyCommands", "gitStage", "gitCommit", "gitCheckpoint", "remoteFiles.upload"}},
+	} {
+		declared, err := auditBuildFuncs(tt.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range tt.funcs {
+			if declared[name] {
+				t.Fatalf("%s: %s is included in the audit build", tt.dir, name)
+			}
+		}
+	}
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "bed")
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	if out, err := exec.Command("go", "build", "-tags", "audit", "-o", exe, ".").CombinedOutput(); err != nil {
+		t.Fatalf("cannot build bed: %s\n%s", err, out)
+	}
+
+	chdirTemp(t)
+	writeTestFile(t, ".bed.json", `{"audit": [{"name": "todo", "pattern": "TODO"}]}`)
+	writeTestFile(t, "a.txt", "foo\n// TODO\n")
+
+	out, err := exec.Command(exe, "a.txt").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report auditReport
+	if err := json.Unmarshal(out, &report); err != nil {
+		t.Fatal(err)
+	} else if len(report.Matches) != 1 || report.Matches[0].Line != 2 {
+		t.Fatalf("unexpected matches: %+v", report.Matches)
+	}
+
+	// Other commands are not available.
+	if err := exec.Command(exe, "-replace", "x", "foo", "a.txt").Run(); err == nil {
+		t.Fatal("expected error")
+	} else if s := readTestFile(t, "a.txt"); s != "foo\n// TODO\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+}
+
+// auditBuildFuncs returns the names of the functions & methods declared by
+// the package in dir when built with the audit tag.
+func auditBuildFuncs(dir string) (map[string]bool, error) {
+	ctx := build.Default
+	ctx.BuildTags = append(ctx.BuildTags, "audit")
+	pkg, err := ctx.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, name := range pkg.GoFiles {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, name, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			} else if fn.Recv == nil {
+				names[fn.Name.Name] = true
+				continue
+			}
+
+			typ := fn.Recv.List[0].Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			if ident, ok := typ.(*ast.Ident); ok {
+				names[ident.Name+"."+fn.Name.Name] = true
+			}
+		}
+	}
+	return names, nil
+}
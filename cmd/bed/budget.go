@@ -0,0 +1,98 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// estimatePathCount is the number of paths at which the size of a scan is
+// estimated before it starts.
+const estimatePathCount = 10000
+
+// parseScanBudget parses a comma-separated list of limits for -scan-budget.
+// Each limit is either a size, such as "500MB", or a duration, such as "30s".
+func parseScanBudget(s string) (maxBytes int64, maxTime time.Duration, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			maxTime = d
+		} else if n, err := parseSize(v); err == nil && n > 0 {
+			maxBytes = n
+		} else {
+			return 0, 0, fmt.Errorf("invalid scan budget: %q", v)
+		}
+	}
+	return maxBytes, maxTime, nil
+}
+
+// sizeUnits are the suffixes accepted by parseSize, largest first.
+var sizeUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a number of bytes with an optional binary unit suffix,
+// e.g. "64KB" or "1.5G".
+func parseSize(s string) (int64, error) {
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(strings.ToUpper(s), u.suffix) {
+			s, unit = s[:len(s)-len(u.suffix)], u.n
+			break
+		}
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return int64(f * float64(unit)), nil
+}
+
+// formatSize returns n as a human readable size, e.g. "1.5GB".
+func formatSize(n int64) string {
+	for _, u := range sizeUnits[:4] {
+		if n >= u.n {
+			return strconv.FormatFloat(float64(n)/float64(u.n), 'f', 1, 64) + u.suffix
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// estimateScan returns the total size of the files at paths. Paths which
+// cannot be stat'd are ignored as they are reported when they are read.
+// Returns an error if the budget's deadline passes while estimating.
+func estimateScan(paths []string, budget *bed.ScanBudget) (int64, error) {
+	var n int64
+	for _, path := range paths {
+		if budget.Expired() {
+			return 0, fmt.Errorf("scan budget exceeded while estimating the size of %d files", len(paths))
+		}
+		if fi, err := os.Stat(path); err == nil {
+			n += fi.Size()
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,260 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultCampaignFile is the path of the campaign history, relative to the
+// current directory, unless the -campaign-file flag is set.
+const DefaultCampaignFile = ".bed/campaigns.jsonl"
+
+// campaignBarWidth is the width of the longest bar in a campaign report.
+const campaignBarWidth = 30
+
+// campaignRun is a single run recorded in a campaign's history.
+type campaignRun struct {
+	Campaign      string    `json:"campaign"`
+	Time          time.Time `json:"time"`
+	Pattern       string    `json:"pattern"`
+	Matches       int       `json:"matches"`
+	FilesMatched  int       `json:"files_matched"`
+	MatchesEdited int       `json:"matches_edited"`
+	FilesEdited   int       `json:"files_edited"`
+}
+
+// Remaining returns the number of matches left after the run.
+func (r *campaignRun) Remaining() int {
+	return r.Matches - r.MatchesEdited
+}
+
+// recordCampaignRun appends a run with the statistics of the current run to
+// the campaign history at path, creating it if needed.
+func recordCampaignRun(path, name, pattern string, stats *runStats) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(&campaignRun{
+		Campaign:      name,
+		Time:          time.Now().UTC().Truncate(time.Second),
+		Pattern:       pattern,
+		Matches:       stats.Matches,
+		FilesMatched:  stats.FilesMatched,
+		MatchesEdited: stats.MatchesEdited,
+		FilesEdited:   stats.FilesEdited,
+	}); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readCampaignRuns reads all runs from the campaign history at path, in the
+// order they were recorded.
+func readCampaignRuns(path string) ([]*campaignRun, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []*campaignRun
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var run campaignRun
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid campaign run: %s", path, line, err)
+		}
+		runs = append(runs, &run)
+	}
+	return runs, scanner.Err()
+}
+
+// RunCampaign executes the "campaign" command which reports the progress of
+// campaigns recorded with -campaign.
+func RunCampaign(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "list":
+			return runCampaignList(args[1:])
+		case "report":
+			return runCampaignReport(args[1:])
+		}
+	}
+	usageCampaign()
+	return flag.ErrHelp
+}
+
+// runCampaignList writes the name, number of runs & remaining matches of
+// each campaign.
+func runCampaignList(args []string) error {
+	fs := flag.NewFlagSet("bed-campaign-list", flag.ContinueOnError)
+	historyPath := fs.String("campaign-file", DefaultCampaignFile, "")
+	fs.Usage = usageCampaign
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return errors.New("too many arguments")
+	}
+
+	runs, err := readCampaignRuns(*historyPath)
+	if err != nil {
+		return err
+	}
+
+	// Group runs by campaign. Runs are in the order they were recorded so
+	// the last run is the latest.
+	var names []string
+	counts := make(map[string]int)
+	latest := make(map[string]*campaignRun)
+	for _, run := range runs {
+		if counts[run.Campaign] == 0 {
+			names = append(names, run.Campaign)
+		}
+		counts[run.Campaign]++
+		latest[run.Campaign] = run
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		run := latest[name]
+		if _, err := fmt.Printf("%s\t%d run(s)\t%d remaining\tlast run %s\n", name, counts[name], run.Remaining(), run.Time.Local().Format("2006-01-02 15:04")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCampaignReport writes the history of a campaign & charts the number of
+// matches remaining after each run.
+func runCampaignReport(args []string) error {
+	fs := flag.NewFlagSet("bed-campaign-report", flag.ContinueOnError)
+	historyPath := fs.String("campaign-file", DefaultCampaignFile, "")
+	isJSON := fs.Bool("json", false, "")
+	plain := fs.Bool("plain", false, "")
+	fs.Usage = usageCampaign
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		return errors.New("campaign name required")
+	} else if fs.NArg() > 1 {
+		return errors.New("too many arguments")
+	}
+	name := fs.Arg(0)
+
+	runs, err := readCampaignRuns(*historyPath)
+	if err != nil {
+		return err
+	}
+	a := runs[:0:0]
+	for _, run := range runs {
+		if run.Campaign == name {
+			a = append(a, run)
+		}
+	}
+	if len(a) == 0 {
+		return fmt.Errorf("no runs recorded for campaign %q in %s", name, *historyPath)
+	}
+
+	if *isJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(a)
+	}
+	return writeCampaignReport(os.Stdout, name, a, *plain)
+}
+
+// writeCampaignReport writes a table of runs with a bar for the matches
+// remaining after each run, followed by a summary of the overall progress.
+// Plain reports draw bars with "#" instead of block characters.
+func writeCampaignReport(w io.Writer, name string, runs []*campaignRun, plain bool) error {
+	bar := "█"
+	if plain {
+		bar = "#"
+	}
+
+	var max int
+	for _, run := range runs {
+		if n := run.Remaining(); n > max {
+			max = n
+		}
+	}
+
+	fmt.Fprintf(w, "campaign: %s\n\n", name)
+	fmt.Fprintf(w, "%-16s  %7s  %7s  %7s  %9s\n", "DATE", "FOUND", "FIXED", "FILES", "REMAINING")
+	for _, run := range runs {
+		var n int
+		if max > 0 {
+			n = (run.Remaining()*campaignBarWidth + max - 1) / max
+		}
+		fmt.Fprintf(w, "%-16s  %7d  %7d  %7d  %9d  %s\n",
+			run.Time.Local().Format("2006-01-02 15:04"),
+			run.Matches, run.MatchesEdited, run.FilesEdited, run.Remaining(),
+			strings.Repeat(bar, n),
+		)
+	}
+
+	// Summarize progress since the first run. Matches may be added between
+	// runs so the fixed total is the sum of each run's fixes.
+	first, last := runs[0], runs[len(runs)-1]
+	var fixed int
+	for _, run := range runs {
+		fixed += run.MatchesEdited
+	}
+	_, err := fmt.Fprintf(w, "\n%d match(es) fixed over %d run(s), %d remaining (%d at the first run)\n", fixed, len(runs), last.Remaining(), first.Matches)
+	return err
+}
+
+func usageCampaign() {
+	writeUsage(os.Stderr, campaignDoc)
+}
+
+var campaignDoc = &commandDoc{
+	Name:  "bed campaign",
+	Short: "track the progress of migration campaigns",
+	Long: `Reports the progress of long-running migrations. Runs of bed with
+-campaign NAME record the pattern, the number of matches & files found
+and the number fixed to a history file so the matches remaining can be
+tracked over time.`,
+	Synopsis: []string{
+		"bed campaign list [arguments]",
+		"bed campaign report [arguments] NAME",
+	},
+	Sections: []docSection{
+		{Text: `The "list" command lists each campaign with its number of runs & the
+matches remaining after its latest run. The "report" command lists
+every run of a campaign with a chart of the matches remaining.`},
+		{Text: `Runs are recorded even if no matches are found or with -dry-run or
+-check-only so a campaign can be measured without editing, e.g.
+"bed -campaign old-api -check-only 'oldAPI\(' *.go" in CI.`},
+	},
+	Flags: []docItem{
+		{Name: "-campaign-file PATH", Text: `Read the campaign history from PATH. Defaults to
+.bed/campaigns.jsonl in the current directory.`},
+		{Name: "-json", Text: "Write the runs of the report as a JSON array."},
+		{Name: "-plain", Text: "Draw the report's chart without block characters."},
+	},
+}
@@ -0,0 +1,94 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// parsePercent parses a percentage between 1 & 100, with or without a
+// trailing "%". Returns zero if s is blank.
+func parsePercent(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || n < 1 || n > 100 {
+		return 0, fmt.Errorf("invalid percentage: %q", s)
+	}
+	return n, nil
+}
+
+// splitCanary selects a random percent of the files changed by matches as
+// the canary. Returns the matches in canary files & the remaining matches.
+// At least one file is selected & at least one is left for the remainder,
+// so a canary is only possible with two or more files.
+func splitCanary(matches []*bed.Match, percent int) (canary, rest []*bed.Match) {
+	paths, _ := bed.GroupMatchesByPath(bed.RemoveSkipped(matches))
+	if len(paths) < 2 {
+		return nil, matches
+	}
+
+	n := (len(paths)*percent + 99) / 100
+	if n >= len(paths) {
+		n = len(paths) - 1
+	}
+
+	selected := make(map[string]bool)
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for _, i := range r.Perm(len(paths))[:n] {
+		selected[paths[i]] = true
+	}
+
+	for _, m := range matches {
+		if selected[m.Path] {
+			canary = append(canary, m)
+		} else {
+			rest = append(rest, m)
+		}
+	}
+	return canary, rest
+}
+
+// applyCanary applies the canary matches & runs the validation command. If
+// validation fails then the canary files are restored & an error is
+// returned so the remaining matches are not applied.
+func applyCanary(canary []*bed.Match, command string, opt bed.ApplyOptions) error {
+	paths, _ := bed.GroupMatchesByPath(bed.RemoveSkipped(canary))
+
+	// Keep the original contents of each file to restore on failure.
+	files, err := snapshotFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("info: applying canary to %d file(s): %s", len(paths), strings.Join(paths, ", "))
+	if err := bed.ApplyMatches(canary, opt); err != nil {
+		return err
+	}
+
+	log.Printf("info: validating canary: %s", command)
+	if err = runCommand(command); err == nil {
+		log.Printf("info: canary passed validation")
+		return nil
+	}
+
+	// Restore the canary files.
+	if rerr := restoreFiles(files, opt); rerr != nil {
+		return fmt.Errorf("canary validation failed: %s; %s", err, rerr)
+	}
+	return fmt.Errorf("canary validation failed, no other files were changed & %d canary file(s) were restored: %s", len(files), err)
+}
+
+// errCanaryValidate is returned if a canary is requested without a command
+// to validate it.
+var errCanaryValidate = errors.New(`-canary requires a validation command, set with -validate or "validate" in the configuration`)
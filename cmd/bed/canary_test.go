@@ -0,0 +1,113 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestRun_Canary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("validation commands require a unix shell")
+	}
+
+	t.Run("Pass", func(t *testing.T) {
+		chdirTemp(t)
+		writeTestFile(t, "a.txt", "foo")
+		writeTestFile(t, "b.txt", "foo")
+
+		if err := Run([]string{"-canary", "50%", "-validate", "true", "-replace", "bar", "foo", "a.txt", "b.txt"}); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{"a.txt", "b.txt"} {
+			if s := readTestFile(t, path); s != "bar" {
+				t.Fatalf("unexpected contents of %s: %q", path, s)
+			}
+		}
+	})
+
+	// A failing validation restores the canary & changes no other files.
+	t.Run("Fail", func(t *testing.T) {
+		chdirTemp(t)
+		writeTestFile(t, "a.txt", "foo")
+		writeTestFile(t, "b.txt", "foo")
+
+		if err := Run([]string{"-canary", "50%", "-validate", "false", "-replace", "bar", "foo", "a.txt", "b.txt"}); err == nil || !strings.Contains(err.Error(), "canary validation failed") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, path := range []string{"a.txt", "b.txt"} {
+			if s := readTestFile(t, path); s != "foo" {
+				t.Fatalf("unexpected contents of %s: %q", path, s)
+			}
+		}
+	})
+
+	t.Run("NoValidate", func(t *testing.T) {
+		chdirTemp(t)
+		writeTestFile(t, "a.txt", "foo")
+		writeTestFile(t, "b.txt", "foo")
+
+		if err := Run([]string{"-canary", "50%", "-replace", "bar", "foo", "a.txt", "b.txt"}); err != errCanaryValidate {
+			t.Fatalf("unexpected error: %v", err)
+		} else if s := readTestFile(t, "a.txt"); s != "foo" {
+			t.Fatalf("unexpected contents: %q", s)
+		}
+	})
+}
+
+func TestParsePercent(t *testing.T) {
+	for _, tt := range []struct {
+		s   string
+		n   int
+		err bool
+	}{
+		{s: "", n: 0},
+		{s: "10", n: 10},
+		{s: "10%", n: 10},
+		{s: "100%", n: 100},
+		{s: "0%", err: true},
+		{s: "101%", err: true},
+		{s: "ten%", err: true},
+	} {
+		if n, err := parsePercent(tt.s); (err != nil) != tt.err {
+			t.Fatalf("%q: unexpected error: %v", tt.s, err)
+		} else if n != tt.n {
+			t.Fatalf("%q: unexpected percentage: %d", tt.s, n)
+		}
+	}
+}
+
+func TestSplitCanary(t *testing.T) {
+	matches := []*bed.Match{
+		{Path: "a.txt", Pos: 0}, {Path: "a.txt", Pos: 4},
+		{Path: "b.txt", Pos: 0},
+		{Path: "c.txt", Pos: 0},
+		{Path: "d.txt", Pos: 0},
+	}
+
+	canary, rest := splitCanary(matches, 50)
+	if len(canary)+len(rest) != len(matches) {
+		t.Fatalf("unexpected split: %d+%d", len(canary), len(rest))
+	}
+
+	// Matches in the same file must stay together.
+	paths := make(map[string]bool)
+	for _, m := range canary {
+		paths[m.Path] = true
+	}
+	for _, m := range rest {
+		if paths[m.Path] {
+			t.Fatalf("file split across canary & rest: %s", m.Path)
+		}
+	}
+	if len(paths) != 2 {
+		t.Fatalf("unexpected canary file count: %d", len(paths))
+	}
+
+	// A single file is too few for a canary.
+	if canary, rest := splitCanary(matches[:2], 50); canary != nil || len(rest) != 2 {
+		t.Fatalf("unexpected split: %d+%d", len(canary), len(rest))
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/benbjohnson/bed"
+)
+
+// DefaultConfigName is the name of the configuration file searched for in the
+// current directory and then in the user's home directory.
+const DefaultConfigName = ".bed.json"
+
+// Config represents the configuration file.
+type Config struct {
+	// Constraints on the order that files are written during apply.
+	Order []bed.OrderRule `json:"order"`
+
+	// Commands to run after apply when matching files are modified.
+	Regen []RegenRule `json:"regen"`
+
+	// Commands to run on each matching file modified by apply.
+	PostApply []PostApplyRule `json:"post_apply"`
+
+	// Replacement templates by file extension, used with -replace.
+	Replace map[string]string `json:"replace"`
+
+	// Globs of paths which must not be modified.
+	Protect []string `json:"protect"`
+
+	// Command run to validate changes applied to a canary with -canary.
+	Validate string `json:"validate"`
+
+	// If true, runs use the conservative options of -safe by default.
+	Safe bool `json:"safe"`
+
+	// Editor command used unless -editor is set.
+	Editor string `json:"editor"`
+
+	// Globs of paths to scan. Other paths are excluded, if set.
+	Include []string `json:"include"`
+
+	// Patterns reported by the "audit" command.
+	Audit []AuditRule `json:"audit"`
+
+	// Named sets of settings selected with -profile. Settings in a profile
+	// override the settings above.
+	Profiles map[string]*Config `json:"profiles"`
+}
+
+// RegenRule specifies a command to run after apply if any modified file
+// matches the Glob pattern.
+type RegenRule struct {
+	Glob    string `json:"glob"`
+	Command string `json:"command"`
+}
+
+// PostApplyRule specifies a command to run on each modified file which
+// matches the Glob pattern after apply, such as a formatter. A blank Glob
+// matches every file.
+type PostApplyRule struct {
+	Glob    string `json:"glob"`
+	Command string `json:"command"`
+}
+
+// ReadConfigFile reads the configuration from path & applies the named
+// profile, if any. If path is blank then the default configuration locations
+// are searched. An empty configuration is returned if no file is found in
+// the default locations.
+func ReadConfigFile(path, profile string) (*Config, error) {
+	if path == "" {
+		if path = findConfigFile(); path == "" && profile != "" {
+			return nil, fmt.Errorf("profile %q not found: no config file", profile)
+		} else if path == "" {
+			return &Config{}, nil
+		}
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(buf, &config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %s", path, err)
+	}
+	if profile == "" {
+		return &config, nil
+	}
+
+	p := config.Profiles[profile]
+	if p == nil {
+		return nil, fmt.Errorf("profile %q not found in %s", profile, path)
+	} else if len(p.Profiles) > 0 {
+		return nil, fmt.Errorf("invalid config %s: profile %q cannot contain profiles", path, profile)
+	}
+	return config.withProfile(p), nil
+}
+
+// withProfile returns a copy of c with the settings of profile p applied.
+// Lists & commands which are set in p replace those in c. Replacement
+// templates are merged by extension & safe mode is used if either enables
+// it.
+func (c *Config) withProfile(p *Config) *Config {
+	other := *c
+	other.Profiles = nil
+	if p.Order != nil {
+		other.Order = p.Order
+	}
+	if p.Regen != nil {
+		other.Regen = p.Regen
+	}
+	if p.PostApply != nil {
+		other.PostApply = p.PostApply
+	}
+	if p.Protect != nil {
+		other.Protect = p.Protect
+	}
+	if p.Include != nil {
+		other.Include = p.Include
+	}
+	if p.Audit != nil {
+		other.Audit = p.Audit
+	}
+	if p.Validate != "" {
+		other.Validate = p.Validate
+	}
+	if p.Editor != "" {
+		other.Editor = p.Editor
+	}
+	if p.Safe {
+		other.Safe = true
+	}
+	if len(p.Replace) > 0 {
+		other.Replace = make(map[string]string, len(c.Replace)+len(p.Replace))
+		for ext, tmpl := range c.Replace {
+			other.Replace[ext] = tmpl
+		}
+		for ext, tmpl := range p.Replace {
+			other.Replace[ext] = tmpl
+		}
+	}
+	return &other
+}
+
+// includesPath returns true if path matches one of the include globs, or if
+// no include globs are set.
+func (c *Config) includesPath(path string) bool {
+	if len(c.Include) == 0 {
+		return true
+	}
+	for _, glob := range c.Include {
+		if bed.MatchGlob(glob, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// findConfigFile returns the path to the default configuration file, if any.
+func findConfigFile() string {
+	dirs := []string{"."}
+	if home := os.Getenv("HOME"); home != "" {
+		dirs = append(dirs, home)
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, DefaultConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,543 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/benbjohnson/bed"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// histogramMaxCount is the number of times an element can occur before the
+// histogram algorithm no longer aligns on it.
+const histogramMaxCount = 64
+
+// ANSI color codes used for diff output.
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// Units which changes are shown in by diffs.
+const (
+	DiffUnitLine = "line" // whole lines are removed & added
+	DiffUnitWord = "word" // changed words are marked within lines
+	DiffUnitChar = "char" // changed characters are marked within lines
+)
+
+// Algorithms used to compute diffs.
+const (
+	DiffMyers     = "myers"     // shortest edit script
+	DiffHistogram = "histogram" // aligns on unique lines, which reads better for code
+)
+
+// validDiffUnit returns true if unit is a supported diff unit.
+func validDiffUnit(unit string) bool {
+	switch unit {
+	case DiffUnitLine, DiffUnitWord, DiffUnitChar:
+		return true
+	default:
+		return false
+	}
+}
+
+// validDiffAlgorithm returns true if algorithm is a supported diff algorithm.
+func validDiffAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case DiffMyers, DiffHistogram:
+		return true
+	default:
+		return false
+	}
+}
+
+// diffOptions represents options for writing diffs.
+type diffOptions struct {
+	Unit      string
+	Algorithm string
+	Color     bool
+}
+
+// diffOp represents a single line, or token within a line, in an edit script.
+type diffOp struct {
+	Kind byte // ' ' for unchanged, '-' for deleted, '+' for inserted
+	Text string
+}
+
+// writeMatchesDiff writes a unified diff of the changes that applying
+// matches would make to each file.
+func writeMatchesDiff(w io.Writer, matches []*bed.Match, opt diffOptions) error {
+	paths, pathMatches := bed.GroupMatchesByPath(matches)
+	for i, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		} else if err := bed.CheckMatchData(path, data, pathMatches[i]); err != nil {
+			return err
+		}
+
+		// Files which will be deleted are diffed against no data.
+		var newData []byte
+		if !bed.DeletesFile(pathMatches[i]) {
+			newData = bed.ApplyMatchData(data, pathMatches[i])
+		}
+		if err := writeUnifiedDiff(w, path, data, newData, opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeUnifiedDiff writes the line differences between a & b in unified
+// diff format. Nothing is written if the contents are identical. If the
+// diff unit is smaller than a line then the removed & added lines of each
+// change are shown merged, with the changed words or characters marked.
+// If b is nil then the file is shown as deleted.
+func writeUnifiedDiff(w io.Writer, path string, a, b []byte, opt diffOptions) error {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+
+	paint := func(code, s string) string {
+		if !opt.Color {
+			return s
+		}
+		return code + s + colorReset
+	}
+
+	newPath := "b/" + path
+	if b == nil {
+		newPath = "/dev/null"
+	}
+
+	ops := diff(splitLines(a), splitLines(b), opt.Algorithm)
+	if _, err := fmt.Fprintf(w, "%s\n%s\n", paint(colorBold, "--- a/"+path), paint(colorBold, "+++ "+newPath)); err != nil {
+		return err
+	}
+
+	for _, h := range diffHunks(ops) {
+		if _, err := fmt.Fprintln(w, paint(colorCyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.aStart, h.aLen, h.bStart, h.bLen))); err != nil {
+			return err
+		}
+
+		for i := h.start; i < h.end; i++ {
+			op := ops[i]
+
+			// Merge each run of removed & added lines into marked lines.
+			if op.Kind != ' ' && opt.Unit != "" && opt.Unit != DiffUnitLine {
+				j := i
+				for j < h.end && ops[j].Kind != ' ' {
+					j++
+				}
+				if err := writeInlineDiff(w, ops[i:j], opt, paint); err != nil {
+					return err
+				}
+				i = j - 1
+				continue
+			}
+
+			text := op.Text
+			noEOL := len(text) == 0 || text[len(text)-1] != '\n'
+			if !noEOL {
+				text = text[:len(text)-1]
+			}
+
+			line := string(op.Kind) + text
+			switch op.Kind {
+			case '-':
+				line = paint(colorRed, line)
+			case '+':
+				line = paint(colorGreen, line)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+			if noEOL {
+				if _, err := fmt.Fprintln(w, `\ No newline at end of file`); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeInlineDiff writes a run of removed & added lines as the added lines
+// with removed text marked by [-...-] & added text marked by {+...+}. If
+// color is enabled then changes are colored instead of marked.
+func writeInlineDiff(w io.Writer, ops []diffOp, opt diffOptions, paint func(code, s string) string) error {
+	var a, b string
+	for _, op := range ops {
+		if op.Kind == '-' {
+			a += op.Text
+		} else {
+			b += op.Text
+		}
+	}
+
+	split := splitDiffWords
+	if opt.Unit == DiffUnitChar {
+		split = splitDiffChars
+	}
+
+	// Join consecutive tokens with the same kind so they are marked once.
+	var tokens []diffOp
+	for _, op := range diff(split(a), split(b), opt.Algorithm) {
+		if n := len(tokens); n > 0 && tokens[n-1].Kind == op.Kind {
+			tokens[n-1].Text += op.Text
+		} else {
+			tokens = append(tokens, op)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, op := range tokens {
+		// Mark each line of a change separately so lines can be prefixed.
+		for _, text := range strings.SplitAfter(op.Text, "\n") {
+			nl := strings.HasSuffix(text, "\n")
+			text = strings.TrimSuffix(text, "\n")
+			switch {
+			case op.Kind == '-' && opt.Color:
+				buf.WriteString(paint(colorRed, text))
+			case op.Kind == '+' && opt.Color:
+				buf.WriteString(paint(colorGreen, text))
+			case op.Kind == '-' && text != "":
+				buf.WriteString("[-" + text + "-]")
+			case op.Kind == '+' && text != "":
+				buf.WriteString("{+" + text + "+}")
+			default:
+				buf.WriteString(text)
+			}
+			if nl {
+				buf.WriteString("\n")
+			}
+		}
+	}
+
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, "~"+strings.TrimSuffix(line, "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitDiffWords splits s into words, runs of spaces & single punctuation
+// characters. Newlines are always separate tokens.
+func splitDiffWords(s string) []string {
+	var tokens []string
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		n := size
+		switch {
+		case isWordRune(r):
+			for n < len(s) {
+				r, size := utf8.DecodeRuneInString(s[n:])
+				if !isWordRune(r) {
+					break
+				}
+				n += size
+			}
+		case r == ' ' || r == '\t':
+			for n < len(s) && (s[n] == ' ' || s[n] == '\t') {
+				n++
+			}
+		}
+		tokens, s = append(tokens, s[:n]), s[n:]
+	}
+	return tokens
+}
+
+// isWordRune returns true if r is part of a word.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// splitDiffChars splits s into characters.
+func splitDiffChars(s string) []string {
+	tokens := make([]string, 0, len(s))
+	for len(s) > 0 {
+		_, size := utf8.DecodeRuneInString(s)
+		tokens, s = append(tokens, s[:size]), s[size:]
+	}
+	return tokens
+}
+
+// splitLines splits data into lines, keeping their line endings.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines, data = append(lines, string(data[:i])), data[i:]
+	}
+	return lines
+}
+
+// diffHunk represents a range of operations displayed together with context.
+type diffHunk struct {
+	start, end   int // range of ops
+	aStart, aLen int // line range in a
+	bStart, bLen int // line range in b
+}
+
+// diffHunks groups changed operations into hunks with surrounding context.
+func diffHunks(ops []diffOp) []diffHunk {
+	var hunks []diffHunk
+	for i := 0; i < len(ops); i++ {
+		if ops[i].Kind == ' ' {
+			continue
+		}
+
+		// Start hunk with leading context & extend until the next change is
+		// further away than twice the context.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops) && j <= end+2*diffContext; j++ {
+			if ops[j].Kind != ' ' {
+				end = j
+			}
+		}
+		if end += diffContext + 1; end > len(ops) {
+			end = len(ops)
+		}
+
+		hunks = append(hunks, diffHunk{start: start, end: end})
+		i = end - 1
+	}
+
+	// Compute line numbers for each hunk.
+	var aLine, bLine, op int
+	for i := range hunks {
+		h := &hunks[i]
+		for ; op < h.start; op++ {
+			aLine, bLine = aLine+countA(ops[op]), bLine+countB(ops[op])
+		}
+		h.aStart, h.bStart = aLine+1, bLine+1
+		for ; op < h.end; op++ {
+			h.aLen, h.bLen = h.aLen+countA(ops[op]), h.bLen+countB(ops[op])
+			aLine, bLine = aLine+countA(ops[op]), bLine+countB(ops[op])
+		}
+		if h.aLen == 0 {
+			h.aStart--
+		}
+		if h.bLen == 0 {
+			h.bStart--
+		}
+	}
+	return hunks
+}
+
+func countA(op diffOp) int {
+	if op.Kind == '+' {
+		return 0
+	}
+	return 1
+}
+
+func countB(op diffOp) int {
+	if op.Kind == '-' {
+		return 0
+	}
+	return 1
+}
+
+// diff returns an edit script to transform a into b using the given
+// algorithm. Defaults to the Myers algorithm.
+func diff(a, b []string, algorithm string) []diffOp {
+	// Trim common prefix & suffix to reduce the work of the main algorithm.
+	var prefix, suffix []diffOp
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, diffOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]diffOp{{' ', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	ops := prefix
+	if algorithm == DiffHistogram {
+		ops = append(ops, histogramDiff(a, b)...)
+	} else {
+		ops = append(ops, myersDiff(a, b)...)
+	}
+	return append(ops, suffix...)
+}
+
+// histogramDiff implements the histogram diff algorithm, as used by git.
+// The two sequences are aligned on the longest common region around the
+// element which occurs least often in a & then each side of the region is
+// diffed recursively. Falls back to the Myers algorithm if there are no
+// common elements.
+func histogramDiff(a, b []string) []diffOp {
+	if len(a) == 0 || len(b) == 0 {
+		return myersDiff(a, b)
+	}
+
+	positions := make(map[string][]int)
+	for i, s := range a {
+		positions[s] = append(positions[s], i)
+	}
+
+	// Find the common region containing the least frequent element of a,
+	// preferring longer regions for elements which occur equally often.
+	var aStart, bStart, length int
+	count := -1
+	for j := 0; j < len(b); j++ {
+		pos := positions[b[j]]
+		if len(pos) == 0 || len(pos) > histogramMaxCount || (count != -1 && len(pos) > count) {
+			continue
+		}
+		for _, i := range pos {
+			s, t, e := i, j, 0
+			for s > 0 && t > 0 && a[s-1] == b[t-1] {
+				s, t = s-1, t-1
+			}
+			for s+e < len(a) && t+e < len(b) && a[s+e] == b[t+e] {
+				e++
+			}
+			if count == -1 || len(pos) < count || e > length {
+				aStart, bStart, length, count = s, t, e, len(pos)
+			}
+		}
+	}
+	if count == -1 {
+		return myersDiff(a, b)
+	}
+
+	ops := histogramDiff(a[:aStart], b[:bStart])
+	for _, s := range a[aStart : aStart+length] {
+		ops = append(ops, diffOp{' ', s})
+	}
+	return append(ops, histogramDiff(a[aStart+length:], b[bStart+length:])...)
+}
+
+// myersDiff implements the Myers O(ND) difference algorithm in linear space.
+// The middle of an optimal path is found by searching from both ends at once
+// & each side of it is then diffed recursively.
+func myersDiff(a, b []string) []diffOp {
+	return appendMyersDiff(nil, a, b)
+}
+
+// appendMyersDiff appends the edit script to transform a into b to ops.
+func appendMyersDiff(ops []diffOp, a, b []string) []diffOp {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		ops, a, b = append(ops, diffOp{' ', a[0]}), a[1:], b[1:]
+	}
+	var suffix int
+	for suffix < len(a) && suffix < len(b) && a[len(a)-suffix-1] == b[len(b)-suffix-1] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if x, y, ok := middleSnake(a, b); ok {
+		ops = appendMyersDiff(ops, a[:x], b[:y])
+		ops = appendMyersDiff(ops, a[x:], b[y:])
+	} else {
+		for _, s := range a {
+			ops = append(ops, diffOp{'-', s})
+		}
+		for _, s := range b {
+			ops = append(ops, diffOp{'+', s})
+		}
+	}
+	for _, s := range common {
+		ops = append(ops, diffOp{' ', s})
+	}
+	return ops
+}
+
+// middleSnake returns a point on an optimal path from the start to the end
+// of a & b which splits it into two shorter paths. Returns false if a & b
+// cannot be split because either is empty or they have nothing in common.
+// The first & last elements of a & b must differ.
+func middleSnake(a, b []string) (x, y int, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+
+	// vf & vr hold the furthest reaching x of the forward & reverse paths
+	// for each diagonal, where the reverse path counts back from the end.
+	max := (n + m + 1) / 2
+	offset := max + 1
+	vf, vr := make([]int, 2*offset+1), make([]int, 2*offset+1)
+	for i := range vf {
+		vf[i], vr[i] = -1, -1
+	}
+	vf[offset+1], vr[offset+1] = 0, 0
+
+	// Diagonals which run past the end of a or b are not searched again.
+	delta := n - m
+	odd := delta%2 != 0
+	var fStart, fEnd, rStart, rEnd int
+	for d := 0; d < max; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if i := offset + k; k == -d || (k != d && vf[i-1] < vf[i+1]) {
+				x = vf[i+1]
+			} else {
+				x = vf[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			vf[offset+k] = x
+
+			if x > n {
+				fEnd += 2
+			} else if y > m {
+				fStart += 2
+			} else if i := offset + delta - k; odd && i >= 0 && i < len(vr) && vr[i] != -1 && x >= n-vr[i] {
+				return x, y, true
+			}
+		}
+
+		for k := -d + rStart; k <= d-rEnd; k += 2 {
+			var x int
+			if i := offset + k; k == -d || (k != d && vr[i-1] < vr[i+1]) {
+				x = vr[i+1]
+			} else {
+				x = vr[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x, y = x+1, y+1
+			}
+			vr[offset+k] = x
+
+			if x > n {
+				rEnd += 2
+			} else if y > m {
+				rStart += 2
+			} else if i := offset + delta - k; !odd && i >= 0 && i < len(vf) && vf[i] != -1 && vf[i] >= n-x {
+				return vf[i], vf[i] - (delta - k), true
+			}
+		}
+	}
+	return 0, 0, false
+}
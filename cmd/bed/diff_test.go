@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		a, b string
+		want string // operation & element of each step
+	}{
+		{name: "Empty", a: "", b: "", want: ""},
+		{name: "Same", a: "abc", b: "abc", want: " a b c"},
+		{name: "Insert", a: "", b: "ab", want: "+a+b"},
+		{name: "Delete", a: "ab", b: "", want: "-a-b"},
+		{name: "Replace", a: "x", b: "y", want: "-x+y"},
+		{name: "Middle", a: "abc", b: "axc", want: " a-b+x c"},
+		{name: "InsertMiddle", a: "ac", b: "abc", want: " a+b c"},
+		{name: "DeleteMiddle", a: "abc", b: "ac", want: " a-b c"},
+		{name: "Disjoint", a: "abc", b: "xyz", want: "-a-b-c+x+y+z"},
+	} {
+		for _, algorithm := range []string{DiffMyers, DiffHistogram} {
+			t.Run(algorithm+"/"+tt.name, func(t *testing.T) {
+				ops := diff(strings.Split(tt.a, ""), strings.Split(tt.b, ""), algorithm)
+				var buf strings.Builder
+				for _, op := range ops {
+					buf.WriteByte(op.Kind)
+					buf.WriteString(op.Text)
+				}
+				if buf.String() != tt.want {
+					t.Fatalf("unexpected diff: %q", buf.String())
+				}
+			})
+		}
+	}
+}
+
+// TestMyersDiff_Random checks that diffs of random sequences transform one
+// into the other with the minimum number of insertions & deletions.
+func TestMyersDiff_Random(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		a, b := randomLines(rand), randomLines(rand)
+		ops := myersDiff(a, b)
+
+		var gotA, gotB []string
+		var edits int
+		for _, op := range ops {
+			if op.Kind != '+' {
+				gotA = append(gotA, op.Text)
+			}
+			if op.Kind != '-' {
+				gotB = append(gotB, op.Text)
+			}
+			if op.Kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diff of %q & %q does not transform them: %v", a, b, ops)
+		} else if want := len(a) + len(b) - 2*lcsLen(a, b); edits != want {
+			t.Fatalf("diff of %q & %q has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+// TestMyersDiff_Memory checks that the memory used by a diff with many
+// changes grows linearly with the size of the input.
+func TestMyersDiff_Memory(t *testing.T) {
+	a, b := make([]string, 5000), make([]string, 5000)
+	for i := range a {
+		a[i], b[i] = strconv.Itoa(i), strconv.Itoa(i)
+		if i%2 == 0 {
+			b[i] = "x" + b[i]
+		}
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	ops := myersDiff(a, b)
+	runtime.ReadMemStats(&after)
+
+	if len(ops) != 7500 {
+		t.Fatalf("unexpected number of operations: %d", len(ops))
+	} else if n := after.TotalAlloc - before.TotalAlloc; n > 16<<20 {
+		t.Fatalf("diff allocated %d bytes", n)
+	}
+}
+
+// randomLines returns up to 20 lines from a small alphabet so that random
+// sequences have elements in common.
+func randomLines(rand *rand.Rand) []string {
+	lines := make([]string, rand.Intn(20))
+	for i := range lines {
+		lines[i] = string(rune('a' + rand.Intn(4)))
+	}
+	return lines
+}
+
+// lcsLen returns the length of the longest common subsequence of a & b.
+func lcsLen(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else if prev[j+1] > cur[j] {
+				cur[j+1] = prev[j+1]
+			} else {
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// commandDoc describes a command for its usage message, man page & the
+// examples cookbook. Text is hard-wrapped as it is displayed in usage.
+type commandDoc struct {
+	Name     string // e.g. "bed upgrade"
+	Short    string // one line summary for the man page name
+	Long     string // description displayed before the synopsis
+	Synopsis []string
+	Sections []docSection
+	Flags    []docItem
+	Examples []docExample
+}
+
+// docSection is a paragraph of text optionally followed by a list of items.
+type docSection struct {
+	Text  string
+	Items []docItem
+}
+
+// docItem is a named entry in a list, such as a flag or directive.
+type docItem struct {
+	Name string
+	Text string
+}
+
+// docExample is an example usage of a command. Examples are executed by
+// "bed gen-docs" to ensure the documented output matches actual behavior.
+type docExample struct {
+	Title  string
+	Text   string
+	Env    []string  // environment variables, e.g. "EDITOR=..."
+	Args   []string  // command line arguments, excluding "bed"
+	Files  []docFile // files created before running
+	Output string    // expected STDOUT
+	Want   []docFile // expected file contents afterward
+	Fail   bool      // true if the command is expected to fail
+}
+
+// docFile is the path & contents of a file used in an example.
+type docFile struct {
+	Path string
+	Data string
+}
+
+// writeUsage writes the usage message for a command to w.
+func writeUsage(w io.Writer, doc *commandDoc) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\n%s\n\nUsage:\n\n", doc.Long)
+	for _, s := range doc.Synopsis {
+		fmt.Fprintf(&buf, "\t%s\n", s)
+	}
+	buf.WriteString("\n")
+
+	sections := doc.Sections
+	if len(doc.Flags) > 0 {
+		sections = append(sections, docSection{Text: "Available arguments:", Items: doc.Flags})
+	}
+	for _, sec := range sections {
+		fmt.Fprintf(&buf, "%s\n\n", sec.Text)
+		for _, item := range sec.Items {
+			fmt.Fprintf(&buf, "\t%s\n", item.Name)
+			for _, line := range strings.Split(item.Text, "\n") {
+				fmt.Fprintf(&buf, "\t\t%s\n", line)
+			}
+			buf.WriteString("\n")
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
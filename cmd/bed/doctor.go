@@ -0,0 +1,182 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// RunDoctor executes the "doctor" command which reports diagnostics about
+// the environment bed is running in. Returns an error if problems are found.
+func RunDoctor(args []string) error {
+	fs := flag.NewFlagSet("bed-doctor", flag.ContinueOnError)
+	isJSON := fs.Bool("json", false, "")
+	configPath := fs.String("config", "", "")
+	profile := fs.String("profile", "", "")
+	editorFlag := fs.String("editor", "", "")
+	fs.Usage = usageDoctor
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return errors.New("too many arguments")
+	}
+
+	checks := []doctorCheck{{Name: "version", Value: bed.GetBuildInfo().String()}}
+	config, configCheck := checkConfig(*configPath, *profile)
+	checks = append(checks, checkEditor(*editorFlag, config.Editor)...)
+	checks = append(checks, checkTerminal()...)
+	checks = append(checks, configCheck)
+	checks = append(checks, checkGit())
+
+	if err := writeDoctorChecks(os.Stdout, checks, *isJSON); err != nil {
+		return err
+	}
+
+	var n int
+	for _, c := range checks {
+		if c.Problem != "" {
+			n++
+		}
+	}
+	if n > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", n)
+	}
+	return nil
+}
+
+// doctorCheck represents a single diagnostic reported by "bed doctor".
+type doctorCheck struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Problem string `json:"problem,omitempty"`
+}
+
+// checkEditor reports how the editor command is resolved.
+func checkEditor(flag, configured string) []doctorCheck {
+	editor, source := lookupEditor(flag, configured)
+	if editor == "" {
+		return []doctorCheck{{Name: "editor", Value: "(none)", Problem: "BED_EDITOR, VISUAL, EDITOR or the config editor must be set unless using -editor, -tui, -replace or -dry-run"}}
+	}
+	checks := []doctorCheck{{Name: "editor", Value: fmt.Sprintf("%s (from %s)", editor, source)}}
+
+	name, args, err := parseEditor(editor, []string{"FILE"})
+	if err != nil {
+		checks[0].Problem = err.Error()
+		return checks
+	}
+	args = addWaitFlag(name, args, "")
+	checks = append(checks, doctorCheck{Name: "command", Value: strings.Join(editorCommand(name, args).Args, " ")})
+
+	if path, err := exec.LookPath(name); err != nil {
+		checks = append(checks, doctorCheck{Name: "path", Value: "(not found)", Problem: fmt.Sprintf("editor %q not found in PATH", name)})
+	} else {
+		checks = append(checks, doctorCheck{Name: "path", Value: path})
+	}
+	return checks
+}
+
+// checkTerminal reports whether standard streams are attached to a terminal
+// and whether the controlling terminal can be opened for the editor.
+func checkTerminal() []doctorCheck {
+	var checks []doctorCheck
+	for _, f := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		value := terminalKind(f)
+		if value == "" {
+			value = "not a terminal"
+		}
+		checks = append(checks, doctorCheck{Name: strings.TrimPrefix(f.Name(), "/dev/"), Value: value})
+	}
+
+	c := doctorCheck{Name: "tty", Value: ttyPath}
+	if f, err := os.OpenFile(ttyPath, os.O_RDWR, 0); err != nil {
+		c.Value, c.Problem = "(unavailable)", fmt.Sprintf("cannot open %s, terminal editors & prompts will not work: %s", ttyPath, err)
+	} else {
+		f.Close()
+	}
+	return append(checks, c)
+}
+
+// checkConfig reports which configuration file & profile is used & whether
+// it is valid. Returns the configuration, which is empty if it is invalid.
+func checkConfig(path, profile string) (*Config, doctorCheck) {
+	if path == "" {
+		path = findConfigFile()
+	}
+
+	c := doctorCheck{Name: "config", Value: path}
+	if path == "" {
+		c.Value = "(none)"
+	}
+	if profile != "" {
+		c.Value += fmt.Sprintf(" (profile %s)", profile)
+	}
+
+	config, err := ReadConfigFile(path, profile)
+	if err != nil {
+		c.Problem = err.Error()
+		return &Config{}, c
+	}
+	return config, c
+}
+
+// checkGit reports the git executable used by -rev, -cached & -worktree.
+func checkGit() doctorCheck {
+	path, err := exec.LookPath("git")
+	if err != nil {
+		return doctorCheck{Name: "git", Value: "(not found)"}
+	}
+	return doctorCheck{Name: "git", Value: path}
+}
+
+// writeDoctorChecks writes checks to w as aligned text or as a JSON array.
+func writeDoctorChecks(w io.Writer, checks []doctorCheck, isJSON bool) error {
+	if isJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(checks)
+	}
+
+	for _, c := range checks {
+		if _, err := fmt.Fprintf(w, "%-10s %s\n", c.Name+":", c.Value); err != nil {
+			return err
+		} else if c.Problem == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%-10s problem: %s\n", "", c.Problem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func usageDoctor() {
+	writeUsage(os.Stderr, doctorDoc)
+}
+
+var doctorDoc = &commandDoc{
+	Name:  "bed doctor",
+	Short: "report environment diagnostics",
+	Long: `Reports diagnostics about the environment bed is running in, such as how
+the editor is resolved, whether a terminal is available & which
+configuration file is used. Include this output when reporting issues.`,
+	Synopsis: []string{
+		"bed doctor [arguments]",
+	},
+	Flags: []docItem{
+		{Name: "-json", Text: "Write diagnostics as a JSON array."},
+		{Name: "-config PATH", Text: `Check the configuration file at PATH instead of the default
+locations.`},
+		{Name: "-profile NAME", Text: "Check the configuration with the settings of profile NAME."},
+		{Name: "-editor CMD", Text: "Check the editor command CMD instead of the environment's."},
+	},
+}
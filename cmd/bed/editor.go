@@ -0,0 +1,331 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// editOptions represents options for editing matches in an editor.
+type editOptions struct {
+	PerFile       bool              // write one temp file per source path
+	TmpExt        string            // temp file extension
+	TmpExtDefault string            // temp file extension when sources differ
+	WaitFlag      string            // flag to make GUI editors block
+	MatchFile     bed.WriteOptions  // how match files are written
+	Checksums     map[string]uint32 // checksums of source files when searched
+}
+
+// editMatches writes matches to temporary files, opens them in editor and
+// returns the matches parsed from the files once the editor exits.
+func editMatches(editor string, matches []*bed.Match, opt editOptions) ([]*bed.Match, error) {
+	// Write matches to temporary files. By default, all matches are written
+	// to a single file but they can be split into one file per source path.
+	groups := [][]*bed.Match{matches}
+	if opt.PerFile {
+		_, groups = bed.GroupMatchesByPath(matches)
+	}
+
+	var tmpPaths []string
+	var orig [][]byte
+	defer func() {
+		for _, tmpPath := range tmpPaths {
+			os.Remove(tmpPath)
+		}
+	}()
+	for _, a := range groups {
+		// Name the file with the extension of its source files so editors
+		// can apply syntax highlighting.
+		ext := tempFileExt(a, opt.TmpExt, opt.TmpExtDefault)
+		tmpPattern := "bed-" + runID + "-*" + ext
+		if opt.PerFile {
+			base := filepath.Base(a[0].Path)
+			tmpPattern = "bed-" + runID + "-*-" + strings.TrimSuffix(base, filepath.Ext(base)) + ext
+		}
+
+		tmpPath, err := writeTempMatchFile(tmpPattern, a, opt.MatchFile)
+		if err != nil {
+			return nil, err
+		}
+		tmpPaths = append(tmpPaths, tmpPath)
+
+		data, err := ioutil.ReadFile(tmpPath)
+		if err != nil {
+			return nil, err
+		}
+		orig = append(orig, data)
+	}
+
+	// Invoke editor. If it fails after matches were edited, such as when it
+	// crashes, the files are kept so the session can be recovered.
+	if err := runEditor(editor, tmpPaths, opt.WaitFlag); err != nil {
+		if e, ok := err.(*editorError); ok && e.exited && keepSession(os.Stderr, tmpPaths, orig, sourceChecksums(matches, opt.Checksums)) {
+			tmpPaths = nil
+		}
+		return nil, err
+	}
+
+	// Parse matches from files.
+	var newMatches []*bed.Match
+	for _, tmpPath := range tmpPaths {
+		a, err := bed.ReadMatchFile(tmpPath)
+		if err != nil {
+			return nil, err
+		}
+		newMatches = append(newMatches, a...)
+	}
+	return newMatches, nil
+}
+
+// lookupEditor returns the editor command along with where it was set. The
+// editor set with the -editor flag, if any, overrides the editor set in the
+// config, which overrides the environment, in which VISUAL takes precedence
+// over EDITOR as is conventional. Returns blank strings if no editor is set.
+func lookupEditor(flag, configured string) (editor, source string) {
+	if flag != "" {
+		return flag, "-editor"
+	} else if configured != "" {
+		return configured, "config"
+	}
+	for _, key := range []string{"BED_EDITOR", "VISUAL", "EDITOR"} {
+		if v := os.Getenv(key); v != "" {
+			return v, key
+		}
+	}
+	return "", ""
+}
+
+// runEditor opens paths in editor and waits for it to exit. The editor is
+// attached to the terminal even if STDIN or STDOUT has been redirected, such
+// as when bed is used as a filter with -stdin.
+func runEditor(editor string, paths []string, waitFlag string) error {
+	name, args, err := parseEditor(editor, paths)
+	if err != nil {
+		return err
+	}
+	args = addWaitFlag(name, args, waitFlag)
+
+	cmd := editorCommand(name, args)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if !isTerminal(os.Stdin) {
+		if tty, err := os.Open(ttyPath); err == nil {
+			defer tty.Close()
+			cmd.Stdin = tty
+		}
+	}
+	if !isTerminal(os.Stdout) {
+		if tty, err := os.OpenFile(ttyOutPath, os.O_WRONLY, 0); err == nil {
+			defer tty.Close()
+			cmd.Stdout = tty
+		}
+	}
+
+	if err := cmd.Run(); err != nil {
+		_, exited := err.(*exec.ExitError)
+		return &editorError{editor: editor, exited: exited}
+	}
+	return nil
+}
+
+// editorError is returned when the editor cannot be run or exits with a
+// non-zero exit code, which editors use to abort editing (e.g. ":cq" in vi).
+type editorError struct {
+	editor string
+	exited bool
+}
+
+func (e *editorError) Error() string {
+	return fmt.Sprintf("There was a problem with editor %q", e.editor)
+}
+
+// parseEditor returns the command & arguments to invoke the editor s on paths.
+// Any "{}" placeholder in the arguments is replaced by the paths. If no
+// placeholder is present then paths are appended to the end. The editor is
+// split into words using shell quoting rules, or the rules of command lines
+// on Windows.
+func parseEditor(s string, paths []string) (cmd string, args []string, err error) {
+	a, err := splitEditor(s)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid editor %q: %s", s, err)
+	} else if len(a) == 0 {
+		return "", nil, fmt.Errorf("invalid editor %q", s)
+	}
+
+	var found bool
+	for _, arg := range a[1:] {
+		if !strings.Contains(arg, "{}") {
+			args = append(args, arg)
+			continue
+		}
+
+		found = true
+		for _, path := range paths {
+			args = append(args, strings.Replace(arg, "{}", path, -1))
+		}
+	}
+	if !found {
+		args = append(args, paths...)
+	}
+	return a[0], args, nil
+}
+
+// splitWords splits s into words using POSIX shell quoting rules. Words are
+// separated by unquoted whitespace. Single quotes preserve their contents
+// literally while double quotes allow backslash escapes of '"', '\\', '$'
+// and '`'. Variable expansion and other shell features are not supported.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word []rune
+	var inWord bool
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				word = append(word, ch)
+			}
+
+		case quote == '"':
+			if ch == '"' {
+				quote = 0
+			} else if ch == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]) {
+				i++
+				word = append(word, runes[i])
+			} else {
+				word = append(word, ch)
+			}
+
+		case ch == '\'' || ch == '"':
+			quote, inWord = ch, true
+
+		case ch == '\\':
+			if i+1 >= len(runes) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			word, inWord = append(word, runes[i]), true
+
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inWord {
+				words, word, inWord = append(words, string(word)), word[:0], false
+			}
+
+		default:
+			word, inWord = append(word, ch), true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	} else if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
+// editorWaitFlags maps GUI editor commands to the flag which causes them to
+// block until the edited files are closed.
+var editorWaitFlags = map[string]string{
+	"atom":              "--wait",
+	"bbedit":            "--wait",
+	"code":              "--wait",
+	"code-insiders":     "--wait",
+	"code-oss":          "--wait",
+	"codium":            "--wait",
+	"gedit":             "--wait",
+	"gnome-text-editor": "--wait",
+	"goland":            "--wait",
+	"gvim":              "-f",
+	"idea":              "--wait",
+	"kate":              "--block",
+	"mate":              "-w",
+	"mvim":              "-f",
+	"notepad++":         "-multiInst",
+	"pluma":             "--wait",
+	"subl":              "--wait",
+	"sublime_text":      "--wait",
+	"vscodium":          "--wait",
+	"webstorm":          "--wait",
+	"zed":               "--wait",
+}
+
+// addWaitFlag returns args with a flag prepended which causes the editor cmd
+// to wait for files to be closed. If flag is blank then it is detected from
+// the editor name. Args are returned unchanged if no flag is known or if the
+// flag has already been specified.
+func addWaitFlag(cmd string, args []string, flag string) []string {
+	if flag == "" {
+		if flag = editorWaitFlags[editorName(cmd)]; flag == "" {
+			return args
+		}
+	}
+
+	for _, arg := range args {
+		if arg == flag || (flag == "--wait" && arg == "-w") {
+			return args
+		}
+	}
+	return append([]string{flag}, args...)
+}
+
+// editorName returns the name of the editor command without its directory
+// or the extension of a Windows executable or batch file, e.g. "code" for
+// "C:\Program Files\Microsoft VS Code\bin\code.cmd".
+func editorName(cmd string) string {
+	name := filepath.Base(cmd)
+	switch ext := filepath.Ext(name); strings.ToLower(ext) {
+	case ".exe", ".cmd", ".bat":
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// tempFileExt returns the file extension to use for a temp file containing
+// matches. If ext is specified then it is always used. Otherwise the extension
+// shared by all source paths is used or defaultExt if the extensions differ.
+func tempFileExt(matches []*bed.Match, ext, defaultExt string) string {
+	if ext == "" {
+		ext = defaultExt
+		for i, m := range matches {
+			if i == 0 {
+				ext = filepath.Ext(m.Path)
+			} else if filepath.Ext(m.Path) != ext {
+				ext = defaultExt
+				break
+			}
+		}
+	}
+
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+func writeTempMatchFile(pattern string, matches []*bed.Match, opt bed.WriteOptions) (string, error) {
+	f, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := bed.WriteMatchFileOptions(f, matches, opt); err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
@@ -0,0 +1,17 @@
+//go:build !windows && !audit
+// +build !windows,!audit
+
+package main
+
+import "os/exec"
+
+// splitEditor splits the editor command into words using POSIX shell
+// quoting rules.
+func splitEditor(s string) ([]string, error) {
+	return splitWords(s)
+}
+
+// editorCommand returns the command which runs the editor name with args.
+func editorCommand(name string, args []string) *exec.Cmd {
+	return exec.Command(name, args...)
+}
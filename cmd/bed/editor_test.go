@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+// TestWriteTempMatchFile_PerFile checks that each source path's matches are
+// written to their own temp file named after the source file.
+func TestWriteTempMatchFile_PerFile(t *testing.T) {
+	matches := []*bed.Match{
+		{Path: "x/a.go", Pos: 0, Len: 3, Data: []byte("foo")},
+		{Path: "x/b.go", Pos: 4, Len: 3, Data: []byte("bar")},
+	}
+	_, groups := bed.GroupMatchesByPath(matches)
+	for i, a := range groups {
+		path, err := writeTempMatchFile("bed-*-"+filepath.Base(a[0].Path), a, bed.WriteOptions{Header: bed.HeaderPlain})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(path)
+
+		if base := filepath.Base(path); !strings.HasPrefix(base, "bed-") || !strings.HasSuffix(base, "-"+filepath.Base(matches[i].Path)) {
+			t.Fatalf("unexpected temp file name: %s", base)
+		}
+
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := bed.ParseMatches(buf)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(other, a) {
+			t.Fatalf("unexpected matches: %#v", other)
+		}
+	}
+}
+
+func TestTempFileExt(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		paths      []string
+		ext        string
+		defaultExt string
+		want       string
+	}{
+		{name: "Shared", paths: []string{"a.go", "b/c.go"}, want: ".go"},
+		{name: "Mixed", paths: []string{"a.go", "b.txt"}, want: ""},
+		{name: "MixedDefault", paths: []string{"a.go", "b.txt"}, defaultExt: "txt", want: ".txt"},
+		{name: "NoExt", paths: []string{"Makefile"}, defaultExt: ".txt", want: ""},
+		{name: "Override", paths: []string{"a.go"}, ext: "md", want: ".md"},
+		{name: "OverrideDot", paths: []string{"a.go", "b.txt"}, ext: ".md", defaultExt: "txt", want: ".md"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var matches []*bed.Match
+			for _, path := range tt.paths {
+				matches = append(matches, &bed.Match{Path: path})
+			}
+			if got := tempFileExt(matches, tt.ext, tt.defaultExt); got != tt.want {
+				t.Fatalf("unexpected extension: %q", got)
+			}
+		})
+	}
+}
+
+func TestParseEditor(t *testing.T) {
+	paths := []string{"/tmp/a.go", "/tmp/b.go"}
+	for _, tt := range []struct {
+		editor string
+		want   string // command & arguments separated by "|"
+	}{
+		{editor: "vim", want: "vim|/tmp/a.go|/tmp/b.go"},
+		{editor: "code --wait", want: "code|--wait|/tmp/a.go|/tmp/b.go"},
+		{editor: "subl {} --wait", want: "subl|/tmp/a.go|/tmp/b.go|--wait"},
+		{editor: "ed --file={}", want: "ed|--file=/tmp/a.go|--file=/tmp/b.go"},
+		{editor: `"/Applications/My Editor" -w`, want: "/Applications/My Editor|-w|/tmp/a.go|/tmp/b.go"},
+	} {
+		cmd, args, err := parseEditor(tt.editor, paths)
+		if err != nil {
+			t.Fatal(err)
+		} else if got := strings.Join(append([]string{cmd}, args...), "|"); got != tt.want {
+			t.Fatalf("parseEditor(%q)=%q, want %q", tt.editor, got, tt.want)
+		}
+	}
+}
+
+func TestParseEditor_Invalid(t *testing.T) {
+	for _, editor := range []string{"", "  ", `vim "a`} {
+		if _, _, err := parseEditor(editor, nil); err == nil {
+			t.Fatalf("expected error for editor %q", editor)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want string // words separated by "|"
+		err  string
+	}{
+		{s: "vim -f", want: "vim|-f"},
+		{s: "  vim \t -f  ", want: "vim|-f"},
+		{s: `'a b' "c d"`, want: "a b|c d"},
+		{s: `'a\b' "c\"d\\e\f"`, want: `a\b|c"d\e\f`},
+		{s: `a\ b`, want: "a b"},
+		{s: `x''y ""`, want: "xy|"},
+		{s: `"a`, err: "unterminated quote"},
+		{s: `a\`, err: "trailing backslash"},
+	} {
+		words, err := splitWords(tt.s)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("splitWords(%q): unexpected error: %v", tt.s, err)
+			}
+		} else if err != nil {
+			t.Fatalf("splitWords(%q): %s", tt.s, err)
+		} else if got := strings.Join(words, "|"); got != tt.want {
+			t.Fatalf("splitWords(%q)=%q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
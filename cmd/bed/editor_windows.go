@@ -0,0 +1,91 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// splitEditor splits the editor command into words using the rules of
+// Windows command lines, so backslashes in paths such as
+// "C:\Program Files\Notepad++\notepad++.exe" are kept. Words are separated
+// by whitespace outside of double quotes. Backslashes are literal unless
+// they precede a double quote, in which case each pair is one backslash &
+// an odd one escapes the quote.
+func splitEditor(s string) ([]string, error) {
+	var words []string
+	var word []rune
+	var inWord, quoted bool
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch ch := runes[i]; {
+		case ch == '\\':
+			n := 1
+			for i+n < len(runes) && runes[i+n] == '\\' {
+				n++
+			}
+			if i+n < len(runes) && runes[i+n] == '"' {
+				word = append(word, []rune(strings.Repeat(`\`, n/2))...)
+				if n%2 == 1 {
+					word = append(word, '"')
+					n++
+				}
+				i += n - 1
+			} else {
+				word = append(word, []rune(strings.Repeat(`\`, n))...)
+				i += n - 1
+			}
+			inWord = true
+
+		case ch == '"':
+			quoted, inWord = !quoted, true
+
+		case !quoted && (ch == ' ' || ch == '\t' || ch == '\n'):
+			if inWord {
+				words, word, inWord = append(words, string(word)), word[:0], false
+			}
+
+		default:
+			word, inWord = append(word, ch), true
+		}
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
+// editorCommand returns the command which runs the editor name with args.
+// Batch files, such as the "code.cmd" wrapper installed by VS Code, &
+// commands which are not executables, such as "start", are run with
+// "cmd /C" since they can only be interpreted by the command prompt.
+func editorCommand(name string, args []string) *exec.Cmd {
+	path, err := exec.LookPath(name)
+	if ext := strings.ToLower(filepath.Ext(path)); err == nil && ext != ".cmd" && ext != ".bat" {
+		return exec.Command(path, args...)
+	}
+
+	comspec := os.Getenv("COMSPEC")
+	if comspec == "" {
+		comspec = "cmd.exe"
+	}
+
+	// Each word is quoted & the whole command is quoted again so "/S" only
+	// strips the outer quotes, which keeps paths with spaces intact.
+	words := make([]string, 0, len(args)+1)
+	for _, arg := range append([]string{name}, args...) {
+		words = append(words, `"`+arg+`"`)
+	}
+	cmd := exec.Command(comspec)
+	cmd.Args = append([]string{comspec, "/S", "/C"}, append([]string{name}, args...)...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: syscall.EscapeArg(comspec) + ` /S /C "` + strings.Join(words, " ") + `"`,
+	}
+	return cmd
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/benbjohnson/bed"
+)
+
+// engines maps the names of regular expression engines to functions which
+// compile patterns with them. Engines with extra dependencies are registered
+// by files which are only built with a build tag.
+var engines = map[string]func(pattern string) (bed.Matcher, error){
+	"re2": compileRE2,
+}
+
+// engineBuildTags maps engines which are not built by default to the build
+// tag which includes them.
+var engineBuildTags = map[string]string{
+	"pcre": "pcre",
+}
+
+// validateEngine returns an error if the named engine is not available.
+func validateEngine(name string) error {
+	if _, ok := engines[name]; ok {
+		return nil
+	} else if tag, ok := engineBuildTags[name]; ok {
+		return fmt.Errorf("regex engine %q is not available, rebuild bed with: go build -tags %s", name, tag)
+	}
+	return fmt.Errorf("unknown regex engine: %q", name)
+}
+
+// compileRE2 compiles pattern with Go's RE2 engine. RE2 does not support
+// lookarounds so they are emulated for patterns which begin with lookbehinds
+// or end with lookaheads.
+func compileRE2(pattern string) (bed.Matcher, error) {
+	if behind, core, ahead := splitLookarounds(pattern); len(behind) > 0 || len(ahead) > 0 {
+		m, err := compileLookaround(behind, core, ahead)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re, nil
+}
@@ -0,0 +1,133 @@
+//go:build pcre
+// +build pcre
+
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/benbjohnson/bed"
+	"github.com/dlclark/regexp2"
+)
+
+func init() {
+	engines["pcre"] = compilePCRE
+}
+
+// pcreMatcher matches patterns using a backtracking engine which supports
+// Perl & PCRE syntax such as backreferences & lookarounds.
+type pcreMatcher struct {
+	re   *regexp2.Regexp
+	nums []int // group numbers, in submatch index order
+}
+
+// compilePCRE compiles pattern with the PCRE-compatible engine.
+func compilePCRE(pattern string) (bed.Matcher, error) {
+	re, err := regexp2.Compile(pattern, regexp2.None)
+	if err != nil {
+		return nil, err
+	}
+	return &pcreMatcher{re: re, nums: re.GetGroupNumbers()}, nil
+}
+
+// FindAllSubmatchIndex returns the byte positions of up to n matches in b
+// & their submatches, in the same form as regexp.Regexp.
+func (m *pcreMatcher) FindAllSubmatchIndex(b []byte, n int) [][]int {
+	// The engine reports positions in runes so map each rune to its byte
+	// offset. Invalid UTF-8 bytes are decoded as single runes by both.
+	offsets := make([]int, 0, len(b)+1)
+	for i := 0; i < len(b); {
+		_, size := utf8.DecodeRune(b[i:])
+		offsets = append(offsets, i)
+		i += size
+	}
+	offsets = append(offsets, len(b))
+
+	var a [][]int
+	match, err := m.re.FindStringMatch(string(b))
+	for ; match != nil && err == nil && (n < 0 || len(a) < n); match, err = m.re.FindNextMatch(match) {
+		loc := make([]int, 2*len(m.nums))
+		for i, num := range m.nums {
+			loc[2*i], loc[2*i+1] = -1, -1
+			if g := match.GroupByNumber(num); g != nil && len(g.Captures) > 0 {
+				loc[2*i], loc[2*i+1] = offsets[g.Index], offsets[g.Index+g.Length]
+			}
+		}
+		a = append(a, loc)
+	}
+	return a
+}
+
+// Expand appends template to dst with $1, ${1}, $name & ${name} variables
+// replaced by the corresponding submatches of src, as regexp.Regexp does.
+func (m *pcreMatcher) Expand(dst []byte, template []byte, src []byte, match []int) []byte {
+	for len(template) > 0 {
+		i := bytes.IndexByte(template, '$')
+		if i == -1 {
+			break
+		}
+		dst = append(dst, template[:i]...)
+		template = template[i:]
+
+		if len(template) > 1 && template[1] == '$' {
+			dst, template = append(dst, '$'), template[2:]
+			continue
+		}
+
+		name, rest, ok := extractVar(template)
+		if !ok {
+			dst, template = append(dst, '$'), template[1:]
+			continue
+		}
+		template = rest
+
+		num, err := strconv.Atoi(name)
+		if err != nil {
+			num = m.re.GroupNumberFromName(name)
+		}
+		for i, n := range m.nums {
+			if n == num && 2*i+1 < len(match) && match[2*i] >= 0 {
+				dst = append(dst, src[match[2*i]:match[2*i+1]]...)
+			}
+		}
+	}
+	return append(dst, template...)
+}
+
+// extractVar returns the name of the variable at the start of template,
+// which begins with "$", & the remaining template.
+func extractVar(template []byte) (name string, rest []byte, ok bool) {
+	if len(template) < 2 {
+		return "", nil, false
+	}
+
+	braced := template[1] == '{'
+	i := 1
+	if braced {
+		i = 2
+	}
+
+	start := i
+	for i < len(template) && isVarByte(template[i]) {
+		i++
+	}
+	if i == start {
+		return "", nil, false
+	}
+	name = string(template[start:i])
+
+	if braced {
+		if i >= len(template) || template[i] != '}' {
+			return "", nil, false
+		}
+		i++
+	}
+	return name, template[i:], true
+}
+
+// isVarByte returns true if c can be part of a template variable name.
+func isVarByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
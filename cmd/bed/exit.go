@@ -0,0 +1,10 @@
+package main
+
+// Exit codes, similar to grep.
+const (
+	ExitOK      = 0 // matches were found or applied
+	ExitNoMatch = 1 // no matches were found or a check failed
+	ExitError   = 2 // an error occurred
+	ExitAborted = 3 // the user aborted editing or discarded changes
+	ExitNothing = 4 // there were no files to scan
+)
@@ -0,0 +1,288 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// validFormat returns true if format is a supported dry-run output format.
+func validFormat(format string) bool {
+	switch format {
+	case "text", "tree", "packages", "grep", "quickfix", "sarif":
+		return true
+	default:
+		return false
+	}
+}
+
+// reportOptions represents options for writing match reports.
+type reportOptions struct {
+	// If true, reports only use ASCII & indentation instead of box drawing
+	// characters so they can be read by screen readers.
+	Plain bool
+
+	// Compares paths when ordering reports. Defaults to byte-wise order.
+	Less func(a, b string) bool
+
+	// Pattern which was searched for, used to describe matches in reports.
+	Pattern string
+}
+
+// writeMatches writes a report of matches to w in the given format.
+func writeMatches(w io.Writer, format string, matches []*bed.Match, opt reportOptions) error {
+	switch format {
+	case "text":
+		return writeTextMatches(w, matches)
+	case "tree":
+		return writeTreeMatches(w, matches, opt)
+	case "packages":
+		return writePackageMatches(w, matches, opt)
+	case "grep":
+		return writeGrepMatches(w, matches)
+	case "quickfix":
+		return writeQuickfix(w, matchLocations(matches))
+	case "sarif":
+		return writeSARIFMatches(w, matches, opt)
+	default:
+		return fmt.Errorf("unknown format: %q", format)
+	}
+}
+
+// writeTextMatches writes each match's path & data on a separate line.
+func writeTextMatches(w io.Writer, matches []*bed.Match) error {
+	for _, m := range matches {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", m.Path, string(m.Data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGrepMatches writes the location & first line of each match as
+// "path:line:col:text", as written by "grep -Hn --column -o", so matches can
+// be read by tools which parse grep's output.
+func writeGrepMatches(w io.Writer, matches []*bed.Match) error {
+	for _, loc := range matchLocations(matches) {
+		if _, err := fmt.Fprintf(w, "%s:%d:%d:%s\n", loc.Path, loc.Line, loc.Col, strings.TrimRight(loc.Text, "\r")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTreeMatches writes matches as a directory tree with match counts
+// for every directory & file. Plain trees are drawn with indentation only.
+func writeTreeMatches(w io.Writer, matches []*bed.Match, opt reportOptions) error {
+	root := newTreeNode(".")
+	for _, m := range matches {
+		root.count++
+
+		node := root
+		for _, name := range splitPath(m.Path) {
+			node = node.child(name)
+			node.count++
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "%s (%d)\n", root.name, root.count); err != nil {
+		return err
+	}
+	less := opt.Less
+	if less == nil {
+		less = func(a, b string) bool { return a < b }
+	}
+	return root.writeChildren(w, "", opt.Plain, less)
+}
+
+// splitPath returns the cleaned components of path. Absolute paths
+// begin with a "/" component.
+func splitPath(path string) []string {
+	path = filepath.ToSlash(filepath.Clean(path))
+
+	var a []string
+	if strings.HasPrefix(path, "/") {
+		a, path = append(a, "/"), strings.TrimPrefix(path, "/")
+	}
+	if path != "" {
+		a = append(a, strings.Split(path, "/")...)
+	}
+	return a
+}
+
+// treeNode represents a directory or file in a tree report.
+type treeNode struct {
+	name     string
+	count    int
+	children map[string]*treeNode
+}
+
+func newTreeNode(name string) *treeNode {
+	return &treeNode{name: name, children: make(map[string]*treeNode)}
+}
+
+// child returns the child node with the given name, creating it if needed.
+func (n *treeNode) child(name string) *treeNode {
+	c := n.children[name]
+	if c == nil {
+		c = newTreeNode(name)
+		n.children[name] = c
+	}
+	return c
+}
+
+// writeChildren recursively writes child nodes, sorted by name, using prefix
+// to draw the branches of parent nodes.
+func (n *treeNode) writeChildren(w io.Writer, prefix string, plain bool, less func(a, b string) bool) error {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return less(names[i], names[j]) })
+
+	for i, name := range names {
+		branch, indent := "├── ", "│   "
+		if plain {
+			branch, indent = "  ", "  "
+		} else if i == len(names)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		c := n.children[name]
+		if _, err := fmt.Fprintf(w, "%s%s%s (%d)\n", prefix, branch, c.name, c.count); err != nil {
+			return err
+		}
+		if err := c.writeChildren(w, prefix+indent, plain, less); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePackageMatches writes match counts aggregated by Go package, sorted
+// by descending count. Packages are resolved using "go list".
+func writePackageMatches(w io.Writer, matches []*bed.Match, opt reportOptions) error {
+	// Collect the unique set of directories containing matches.
+	var dirs []string
+	dirCounts := make(map[string]int)
+	for _, m := range matches {
+		dir, err := filepath.Abs(filepath.Dir(m.Path))
+		if err != nil {
+			return err
+		}
+		if _, ok := dirCounts[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		dirCounts[dir]++
+	}
+
+	// Resolve the import path of each directory.
+	pkgs, err := goListPackages(dirs)
+	if err != nil {
+		return err
+	}
+
+	// Aggregate counts by package. Directories that cannot be resolved to a
+	// package are reported by their path.
+	var names []string
+	counts := make(map[string]int)
+	for _, dir := range dirs {
+		name := pkgs[dir]
+		if name == "" {
+			name = dir
+		}
+		if _, ok := counts[name]; !ok {
+			names = append(names, name)
+		}
+		counts[name] += dirCounts[dir]
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		} else if opt.Less != nil {
+			return opt.Less(names[i], names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%8d %s\n", counts[name], name); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "%8d total\n", len(matches))
+	return err
+}
+
+// goListPackages returns a mapping of directories, which must be absolute,
+// to Go import paths. Directories are grouped by the module containing them
+// & each module's directories are listed together from the module's root so
+// that directories from different modules can be listed without running
+// "go list" for each directory. Directories which are not part of a Go
+// package are omitted.
+func goListPackages(dirs []string) (map[string]string, error) {
+	var roots []string
+	modules := make(map[string][]string)
+	for _, dir := range dirs {
+		root := goModuleRoot(dir)
+		if _, ok := modules[root]; !ok {
+			roots = append(roots, root)
+		}
+		modules[root] = append(modules[root], dir)
+	}
+
+	// Map the directories reported by "go list" back to the directories
+	// given, since they may differ by symlinks.
+	given := make(map[string]string, len(dirs))
+	for _, dir := range dirs {
+		given[bed.ResolveDir(dir)] = dir
+	}
+
+	m := make(map[string]string)
+	for _, root := range roots {
+		args := append([]string{"list", "-e", "-f", "{{if not .Error}}{{.Dir}}\t{{.ImportPath}}{{end}}"}, modules[root]...)
+		cmd := exec.Command("go", args...)
+		cmd.Dir = root
+		out, err := cmd.Output()
+		if _, ok := err.(*exec.ExitError); ok {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("go list: %s", err)
+		}
+
+		for _, line := range strings.Split(string(out), "\n") {
+			if i := strings.LastIndexByte(line, '\t'); i != -1 {
+				if dir, ok := given[bed.ResolveDir(line[:i])]; ok {
+					m[dir] = line[i+1:]
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// goModuleRoot returns the directory of the go.mod file of the module
+// containing dir, or a blank string if it is not within a module, in which
+// case it is listed from the current directory.
+func goModuleRoot(dir string) string {
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !fi.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestWriteTreeMatches(t *testing.T) {
+	matches := []*bed.Match{
+		{Path: "b/c.go"},
+		{Path: "a.go"},
+		{Path: "b/c.go"},
+		{Path: "b/d/e.go"},
+		{Path: "./a.go"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeTreeMatches(&buf, matches, reportOptions{}); err != nil {
+		t.Fatal(err)
+	} else if got, want := buf.String(), ""+
+		". (5)\n"+
+		"├── a.go (2)\n"+
+		"└── b (3)\n"+
+		"    ├── c.go (2)\n"+
+		"    └── d (1)\n"+
+		"        └── e.go (1)\n"; got != want {
+		t.Fatalf("unexpected tree:\n%s", got)
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{path: "a.go", want: "a.go"},
+		{path: "./a/../b/c.go", want: "b|c.go"},
+		{path: "/a/b.go", want: "/|a|b.go"},
+	} {
+		if got := strings.Join(splitPath(tt.path), "|"); got != tt.want {
+			t.Fatalf("splitPath(%q)=%q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// commandDocs returns the documentation for every command.
+func commandDocs() []*commandDoc {
+	return []*commandDoc{mainDoc, searchDoc, applyDoc, resumeDoc, sessionsDoc, mergeDoc, splitDoc, auditDoc, doctorDoc, campaignDoc, upgradeDoc, genDocsDoc}
+}
+
+// RunGenDocs executes the "gen-docs" command which writes man pages & an
+// examples cookbook to a directory. Every example is run first so that the
+// documentation cannot drift from the actual behavior of bed.
+func RunGenDocs(args []string) error {
+	fs := flag.NewFlagSet("bed-gen-docs", flag.ContinueOnError)
+	fs.Usage = func() { writeUsage(os.Stderr, genDocsDoc) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		return errors.New("directory required")
+	} else if fs.NArg() > 1 {
+		return errors.New("too many arguments")
+	}
+	dir := fs.Arg(0)
+
+	// Verify examples against the running executable.
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	for _, doc := range commandDocs() {
+		for _, ex := range doc.Examples {
+			if err := runExample(exe, doc, ex); err != nil {
+				return fmt.Errorf("example %q: %s", ex.Title, err)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	// Write a man page for each command.
+	for _, doc := range commandDocs() {
+		var buf bytes.Buffer
+		if err := writeManPage(&buf, doc); err != nil {
+			return err
+		} else if err := ioutil.WriteFile(filepath.Join(dir, manName(doc)+".1"), buf.Bytes(), 0666); err != nil {
+			return err
+		}
+	}
+
+	// Write cookbook of all examples.
+	var buf bytes.Buffer
+	if err := writeCookbook(&buf, commandDocs()); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "cookbook.md"), buf.Bytes(), 0666)
+}
+
+// runExample executes an example in a temporary directory & returns an
+// error if its output or resulting files differ from the documentation.
+func runExample(exe string, doc *commandDoc, ex docExample) error {
+	dir, err := ioutil.TempDir("", "bed-example-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range ex.Files {
+		path := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return err
+		} else if err := ioutil.WriteFile(path, []byte(f.Data), 0666); err != nil {
+			return err
+		}
+	}
+
+	// Run with a clean editor environment & no user configuration.
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "BED_EDITOR=") && !strings.HasPrefix(kv, "VISUAL=") && !strings.HasPrefix(kv, "EDITOR=") && !strings.HasPrefix(kv, "HOME=") {
+			env = append(env, kv)
+		}
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(exe, append(strings.Fields(doc.Name)[1:], ex.Args...)...)
+	cmd.Dir, cmd.Stdout = dir, &stdout
+	cmd.Env = append(append(env, "HOME="+dir), ex.Env...)
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return err
+		} else if !ex.Fail {
+			return fmt.Errorf("unexpected failure: %s", err)
+		}
+	} else if ex.Fail {
+		return errors.New("expected command to fail")
+	}
+
+	if got := stdout.String(); got != ex.Output {
+		return fmt.Errorf("unexpected output:\n%s", got)
+	}
+	for _, f := range ex.Want {
+		if buf, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Path))); err != nil {
+			return err
+		} else if string(buf) != f.Data {
+			return fmt.Errorf("unexpected contents of %s:\n%s", f.Path, buf)
+		}
+	}
+	return nil
+}
+
+// writeManPage writes a command's documentation to w as a roff man page.
+func writeManPage(w io.Writer, doc *commandDoc) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, ".TH %s 1 \"\" \"bed\" \"User Commands\"\n", strings.ToUpper(manName(doc)))
+	fmt.Fprintf(&buf, ".SH NAME\n%s \\- %s\n", roffEscape(manName(doc)), roffEscape(doc.Short))
+
+	buf.WriteString(".SH SYNOPSIS\n.nf\n")
+	for _, s := range doc.Synopsis {
+		fmt.Fprintf(&buf, "%s\n", roffEscape(s))
+	}
+	buf.WriteString(".fi\n")
+
+	fmt.Fprintf(&buf, ".SH DESCRIPTION\n%s\n", roffEscape(doc.Long))
+	for _, sec := range doc.Sections {
+		fmt.Fprintf(&buf, ".PP\n%s\n", roffEscape(sec.Text))
+		writeManItems(&buf, sec.Items)
+	}
+
+	if len(doc.Flags) > 0 {
+		buf.WriteString(".SH OPTIONS\n")
+		writeManItems(&buf, doc.Flags)
+	}
+
+	if len(doc.Examples) > 0 {
+		buf.WriteString(".SH EXAMPLES\n")
+		for _, ex := range doc.Examples {
+			fmt.Fprintf(&buf, ".SS %s\n%s\n.PP\n.RS\n.nf\n", roffEscape(ex.Title), roffEscape(ex.Text))
+			fmt.Fprintf(&buf, "%s\n", roffEscape(exampleCommand(doc, ex)))
+			if ex.Output != "" {
+				fmt.Fprintf(&buf, "%s\n", roffEscape(strings.TrimSuffix(ex.Output, "\n")))
+			}
+			buf.WriteString(".fi\n.RE\n")
+		}
+	}
+
+	var seeAlso []string
+	for _, other := range commandDocs() {
+		if other != doc {
+			seeAlso = append(seeAlso, roffEscape(manName(other))+"(1)")
+		}
+	}
+	fmt.Fprintf(&buf, ".SH SEE ALSO\n%s\n", strings.Join(seeAlso, ", "))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeManItems(buf *bytes.Buffer, items []docItem) {
+	for _, item := range items {
+		fmt.Fprintf(buf, ".TP\n.B %s\n%s\n", roffEscape(item.Name), roffEscape(item.Text))
+	}
+}
+
+// manName returns the name of the man page for a command (e.g. "bed-upgrade").
+func manName(doc *commandDoc) string {
+	return strings.Replace(doc.Name, " ", "-", -1)
+}
+
+// roffEscape escapes text for use in a roff document.
+func roffEscape(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeCookbook writes the examples of all commands to w as Markdown.
+func writeCookbook(w io.Writer, docs []*commandDoc) error {
+	var buf bytes.Buffer
+	buf.WriteString("# bed cookbook\n\n")
+	buf.WriteString("These examples are generated by \"bed gen-docs\", which runs each one to\nverify its output.\n")
+
+	for _, doc := range docs {
+		for _, ex := range doc.Examples {
+			fmt.Fprintf(&buf, "\n## %s\n\n%s\n", ex.Title, ex.Text)
+			for _, f := range ex.Files {
+				fmt.Fprintf(&buf, "\nGiven `%s`:\n\n```\n%s```\n", f.Path, f.Data)
+			}
+
+			fmt.Fprintf(&buf, "\n```sh\n$ %s\n%s```\n", exampleCommand(doc, ex), ex.Output)
+
+			for _, f := range ex.Want {
+				fmt.Fprintf(&buf, "\nAfterward, `%s` contains:\n\n```\n%s```\n", f.Path, f.Data)
+			}
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// exampleCommand returns the shell command line for an example.
+func exampleCommand(doc *commandDoc, ex docExample) string {
+	var words []string
+	for _, env := range ex.Env {
+		kv := strings.SplitN(env, "=", 2)
+		words = append(words, kv[0]+"="+shellWord(kv[1]))
+	}
+	words = append(words, doc.Name)
+	for _, arg := range ex.Args {
+		words = append(words, shellWord(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// shellWord returns s quoted for a POSIX shell, if necessary.
+func shellWord(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+", r))
+	}) == -1 {
+		return s
+	}
+	return shellQuote(s)
+}
+
+var genDocsDoc = &commandDoc{
+	Name:  "bed gen-docs",
+	Short: "generate man pages & an examples cookbook",
+	Long: `Writes a man page for each command & a Markdown cookbook of examples to
+DIR. Every example is run before anything is written & the command fails
+if an example's output differs from its documentation.`,
+	Synopsis: []string{
+		"bed gen-docs DIR",
+	},
+}
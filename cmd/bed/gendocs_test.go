@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestExamples runs every documented example against a freshly built
+// executable, the same as "bed gen-docs", so that drift fails go test.
+func TestExamples(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short mode")
+	}
+	dir, err := ioutil.TempDir("", "bed-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exe := filepath.Join(dir, "bed")
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	if out, err := exec.Command("go", "build", "-o", exe, ".").CombinedOutput(); err != nil {
+		t.Fatalf("cannot build bed: %s\n%s", err, out)
+	}
+
+	for _, doc := range commandDocs() {
+		for _, ex := range doc.Examples {
+			doc, ex := doc, ex
+			t.Run(doc.Name+"/"+ex.Title, func(t *testing.T) {
+				if err := runExample(exe, doc, ex); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	}
+}
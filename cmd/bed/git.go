@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitRevReader returns a function that reads file contents from the git
+// revision rev instead of from the working directory. If rev is blank then
+// the staged contents are read from the index.
+func gitRevReader(rev string) func(path string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		object, err := gitObjectPath(path)
+		if err != nil {
+			return nil, err
+		}
+		return gitOutput("cat-file", "blob", rev+":"+object)
+	}
+}
+
+// gitObjectPath returns path in a form usable in a git "<rev>:<path>"
+// expression. Paths are made relative to the current directory.
+func gitObjectPath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		} else if path, err = filepath.Rel(wd, path); err != nil {
+			return "", err
+		}
+	}
+	return "./" + filepath.ToSlash(filepath.Clean(path)), nil
+}
+
+// gitOutput executes git with args and returns its standard output.
+// On failure, the error includes git's standard error output.
+func gitOutput(args ...string) ([]byte, error) {
+	return gitOutputInput(nil, args...)
+}
+
+// gitOutputInput executes git with args & stdin as its standard input and
+// returns its standard output.
+func gitOutputInput(stdin []byte, args ...string) ([]byte, error) {
+	return gitOutputEnv(nil, stdin, args...)
+}
+
+// gitOutputEnv executes git with args, stdin as its standard input & env
+// added to its environment and returns its standard output.
+func gitOutputEnv(env []string, stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// gitTrackedFiles returns the paths of files tracked by git in the index,
+// or in rev if specified, relative to the current directory. Only files
+// matching pathspecs are returned, if any are specified. If exist is true
+// then files missing from the working directory, such as deleted files, &
+// submodules are excluded.
+func gitTrackedFiles(rev string, pathspecs []string, exist bool) ([]string, error) {
+	args := []string{"ls-files", "-z", "--"}
+	if rev != "" {
+		args = []string{"ls-tree", "-r", "-z", "--name-only", rev, "--"}
+	}
+	out, err := gitOutput(append(args, pathspecs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmerged files are listed once for each stage, one after another.
+	var paths []string
+	var prev string
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path == "" || path == prev {
+			continue
+		}
+		prev = path
+
+		if exist {
+			if fi, err := os.Lstat(path); err != nil || fi.IsDir() {
+				continue
+			}
+		}
+		paths = append(paths, filepath.FromSlash(path))
+	}
+	return paths, nil
+}
+
+// gitWorktreeRoot returns the top-level directory of the git worktree
+// containing dir. Returns an error if dir is not inside a worktree.
+func gitWorktreeRoot(dir string) (string, error) {
+	out, err := gitOutput("-C", dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not a git worktree: %s", dir)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// initGitRepo changes to a new git repository in a temporary directory.
+// Skips the test if git is not installed.
+func initGitRepo(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	chdirTemp(t)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.name", "bed"},
+		{"config", "user.email", "bed@example.com"},
+	} {
+		if _, err := gitOutput(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// gitStagedFiles returns the paths of the files with staged changes.
+func gitStagedFiles(t *testing.T) string {
+	t.Helper()
+	out, err := gitOutput("diff", "--cached", "--name-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestGitStage_Literal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file names cannot contain colons on Windows")
+	}
+	initGitRepo(t)
+	writeTestFile(t, ":a.txt", "foo\n")
+	writeTestFile(t, "a.txt", "foo\n")
+
+	// The path is not read as a pathspec with magic, which matches a.txt.
+	if err := gitStage([]string{":a.txt"}); err != nil {
+		t.Fatal(err)
+	} else if s := gitStagedFiles(t); s != ":a.txt" {
+		t.Fatalf("unexpected staged files: %q", s)
+	}
+}
+
+func TestGitCommit_Literal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file names cannot contain colons on Windows")
+	}
+	initGitRepo(t)
+	writeTestFile(t, ":a.txt", "foo\n")
+	writeTestFile(t, "a.txt", "foo\n")
+	if _, err := gitOutput("add", "--all"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the path itself is committed & a.txt is left staged.
+	if err := gitCommit([]string{":a.txt"}, "subject", "body"); err != nil {
+		t.Fatal(err)
+	} else if s := gitStagedFiles(t); s != "a.txt" {
+		t.Fatalf("unexpected staged files: %q", s)
+	}
+}
+
+func TestRun_CheckpointSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		want string // ls-tree of the checkpoint
+	}{
+		{name: "Follow", want: "100644 blob 257cc5642cb1a054f08cc83f2d943e56fd3ebe99\ttarget.txt"},
+		{name: "NoFollow", args: []string{"-no-follow-symlinks"}, want: "120000 blob 4cbb553f3f4ac2ee7b01ff6c951d6bf583c39c15\tlink.txt"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			initGitRepo(t)
+			writeTestFile(t, "target.txt", "foo\n")
+			if err := os.Symlink("target.txt", "link.txt"); err != nil {
+				t.Fatal(err)
+			}
+
+			args := append([]string{"-checkpoint", "-replace", "bar"}, tt.args...)
+			if err := Run(append(args, "foo", "link.txt")); err != nil {
+				t.Fatal(err)
+			}
+
+			// The original contents of the file which was changed are saved.
+			out, err := gitOutput("ls-tree", gitCheckpointRefPrefix+runID)
+			if err != nil {
+				t.Fatal(err)
+			} else if s := strings.TrimSpace(string(out)); s != tt.want {
+				t.Fatalf("unexpected checkpoint: %q", s)
+			}
+		})
+	}
+}
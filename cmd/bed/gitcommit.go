@@ -0,0 +1,85 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// gitStageBatchSize is the most paths passed to a single "git add" so that
+// staging many files does not exceed the command line length limit.
+const gitStageBatchSize = 500
+
+// gitLiteralPathspecs is the environment which makes git treat pathspecs as
+// literal paths, so that paths beginning with ":" or containing glob
+// characters, such as "[a].txt", only match themselves.
+var gitLiteralPathspecs = []string{"GIT_LITERAL_PATHSPECS=1"}
+
+// gitStage adds the current contents of paths to the git index. Paths which
+// were deleted are removed from the index.
+func gitStage(paths []string) error {
+	for len(paths) > 0 {
+		n := len(paths)
+		if n > gitStageBatchSize {
+			n = gitStageBatchSize
+		}
+		if _, err := gitOutputEnv(gitLiteralPathspecs, nil, append([]string{"add", "--all", "--"}, paths[:n]...)...); err != nil {
+			return err
+		}
+		paths = paths[n:]
+	}
+	return nil
+}
+
+// gitCommit commits the staged changes to paths, & no other changes, with
+// the given subject & body. Paths are passed on STDIN so that any number of
+// files can be committed.
+func gitCommit(paths []string, subject, body string) error {
+	_, err := gitOutputEnv(gitLiteralPathspecs, []byte(strings.Join(paths, "\x00")),
+		"commit", "-q", "-m", subject, "-m", body, "--pathspec-from-file=-", "--pathspec-file-nul")
+	return err
+}
+
+// gitCheckpointRefPrefix is the prefix of the refs created by gitCheckpoint.
+const gitCheckpointRefPrefix = "refs/bed/checkpoints/"
+
+// gitCheckpoint records the current contents of paths in a commit, without
+// changing the index or HEAD, & points the ref for the run at it. The commit
+// only contains paths so checking it out restores them & no other files.
+// Returns the name of the ref.
+func gitCheckpoint(paths []string) (string, error) {
+	// Build the tree in a temporary index so the real index is untouched.
+	// Git creates the index file itself, so only its name is reserved.
+	f, err := ioutil.TempFile("", "bed-"+runID+"-*.index")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	os.Remove(f.Name())
+	defer os.Remove(f.Name())
+	env := []string{"GIT_INDEX_FILE=" + f.Name()}
+
+	if _, err := gitOutputEnv(env, []byte(strings.Join(paths, "\x00")), "update-index", "--add", "-z", "--stdin"); err != nil {
+		return "", err
+	}
+	tree, err := gitOutputEnv(env, nil, "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	msg := fmt.Sprintf("bed checkpoint of %d file(s) before run %s", len(paths), runID)
+	commit, err := gitOutput("commit-tree", "-m", msg, strings.TrimSpace(string(tree)))
+	if err != nil {
+		return "", err
+	}
+
+	ref := gitCheckpointRefPrefix + runID
+	if _, err := gitOutput("update-ref", "-m", msg, ref, strings.TrimSpace(string(commit))); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
@@ -0,0 +1,101 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// runRegenCommands runs the command of each rule that matches at least one
+// of the modified paths. Each command is run once, in the order of rules.
+func runRegenCommands(rules []RegenRule, paths []string) error {
+	for _, rule := range rules {
+		for _, path := range paths {
+			if !bed.MatchGlob(rule.Glob, path) {
+				continue
+			}
+
+			log.Printf("regen: %s (matched %s)", rule.Command, path)
+			if err := runCommand(rule.Command); err != nil {
+				return fmt.Errorf("regen %q: %s", rule.Command, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// runPostApplyCommands runs the command of each rule on each modified path
+// that it matches, in the order of rules. Any "{}" placeholder in a command
+// is replaced by the path, otherwise the path is appended. Files which no
+// longer exist, such as deleted files, are skipped.
+func runPostApplyCommands(rules []PostApplyRule, paths []string) error {
+	for _, rule := range rules {
+		for _, path := range paths {
+			if rule.Glob != "" && !bed.MatchGlob(rule.Glob, path) {
+				continue
+			} else if _, err := os.Lstat(path); os.IsNotExist(err) {
+				continue
+			}
+
+			args, err := expandCommand(rule.Command, path)
+			if err != nil {
+				return fmt.Errorf("post-apply %q: %s", rule.Command, err)
+			}
+			log.Printf("post-apply: %s", strings.Join(args, " "))
+
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("post-apply %q on %s: %s", rule.Command, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// expandCommand splits command into words & replaces any "{}" placeholder
+// in them with path. If there is no placeholder then path is appended.
+func expandCommand(command, path string) ([]string, error) {
+	words, err := splitWords(command)
+	if err != nil {
+		return nil, err
+	} else if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	args := []string{words[0]}
+	var found bool
+	for _, word := range words[1:] {
+		if strings.Contains(word, "{}") {
+			word, found = strings.Replace(word, "{}", path, -1), true
+		}
+		args = append(args, word)
+	}
+	if !found {
+		args = append(args, path)
+	}
+	return args, nil
+}
+
+// runCommand splits command into words and executes it with the standard
+// output & error of the current process.
+func runCommand(command string) error {
+	args, err := splitWords(command)
+	if err != nil {
+		return err
+	} else if len(args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestRun_PostApply(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("post-apply commands require a unix shell")
+	}
+	chdirTemp(t)
+	t.Setenv("HOME", t.TempDir())
+	writeTestFile(t, "a.txt", "foo\n")
+	writeTestFile(t, "b.txt", "bar\n")
+
+	if err := Run([]string{"-post-apply", "sh -c 'echo formatted >> {}'", "-replace", "baz", "foo", "a.txt", "b.txt"}); err != nil {
+		t.Fatal(err)
+	} else if s := readTestFile(t, "a.txt"); s != "baz\nformatted\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	} else if s := readTestFile(t, "b.txt"); s != "bar\n" {
+		t.Fatalf("unmodified file changed: %q", s)
+	}
+}
+
+func TestRunPostApplyCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("post-apply commands require a unix shell")
+	}
+	chdirTemp(t)
+	writeTestFile(t, "a.go", "")
+	writeTestFile(t, "b.txt", "")
+
+	rules := []PostApplyRule{
+		{Glob: "*.go", Command: "sh -c 'echo go >> {}'"},
+		{Command: "sh -c 'echo all >> {}'"},
+	}
+	if err := runPostApplyCommands(rules, []string{"a.go", "b.txt", "deleted.go"}); err != nil {
+		t.Fatal(err)
+	} else if s := readTestFile(t, "a.go"); s != "go\nall\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	} else if s := readTestFile(t, "b.txt"); s != "all\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+
+	// A failing command stops the remaining commands.
+	if err := runPostApplyCommands([]PostApplyRule{{Command: "false"}}, []string{"a.go"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestExpandCommand(t *testing.T) {
+	for _, tt := range []struct {
+		command string
+		want    []string
+	}{
+		{command: "gofmt -w", want: []string{"gofmt", "-w", "dir/a b.go"}},
+		{command: "gofmt -w {}", want: []string{"gofmt", "-w", "dir/a b.go"}},
+		{command: "cp {} {}.orig", want: []string{"cp", "dir/a b.go", "dir/a b.go.orig"}},
+	} {
+		if args, err := expandCommand(tt.command, "dir/a b.go"); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(args, tt.want) {
+			t.Fatalf("%q: unexpected args: %q", tt.command, args)
+		}
+	}
+
+	if _, err := expandCommand(" ", "a.go"); err == nil {
+		t.Fatal("expected error")
+	}
+}
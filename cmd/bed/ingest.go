@@ -0,0 +1,328 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// externalMatch is a match found by another search tool, such as ripgrep.
+// Matches reported by line, such as by grep, are found within their line.
+type externalMatch struct {
+	Pos  int    // byte offset of the match in the file
+	Line int    // line number of the match, numbered from 1, if Pos is unknown
+	Col  int    // column of the match in bytes, numbered from 1, if known
+	Text []byte // text of the match, checked against the file
+
+	// Text including the digits read as the column, in case they were part
+	// of the text instead, e.g. "10:30" on line 5 is written as "5:10:30".
+	ColText []byte
+}
+
+// externalMatcher is a bed.Matcher which finds the matches reported by
+// another search tool instead of matching a pattern, so bed can be used to
+// edit & apply matches found by faster or more specialized tools. The
+// matches of the file currently being searched are returned, so path must
+// be set before each file is searched.
+type externalMatcher struct {
+	matches map[string][]externalMatch
+	path    string
+
+	// Set if a match does not match the file's contents, such as when the
+	// file changed since it was searched.
+	err error
+}
+
+// literalRegexp expands templates for matches without submatches so that
+// only $0 refers to the text of the match.
+var literalRegexp = regexp.MustCompile(``)
+
+// FindAllSubmatchIndex returns the positions of up to n matches of the
+// current file in b, if n is non-negative. Positions may count a byte order
+// mark at the start of the file, which is not included in b.
+func (m *externalMatcher) FindAllSubmatchIndex(b []byte, n int) [][]int {
+	var a [][]int
+	var lines []int
+	next := make(map[int]int) // position to find the next match on a line from
+	for _, em := range m.matches[m.path] {
+		// Find matches reported by line after any earlier matches on the same
+		// line, so each of several matches of a line is found in turn.
+		if em.Line > 0 {
+			if lines == nil {
+				lines = lineStarts(b)
+			}
+			pos, text := findLineMatch(b, lines, em, next[em.Line])
+			if pos == -1 {
+				m.fail(fmt.Errorf("%s:%d: match does not match the file, which may have changed since it was searched", m.path, em.Line))
+				return nil
+			}
+			next[em.Line] = pos + len(text)
+			a = append(a, []int{pos, pos + len(text)})
+			continue
+		}
+
+		pos := em.Pos
+		if !bytesAt(b, pos, em.Text) {
+			if pos -= len(utf8BOM); !bytesAt(b, pos, em.Text) {
+				m.fail(fmt.Errorf("%s: match at byte %d does not match the file, which may have changed since it was searched", m.path, em.Pos))
+				return nil
+			}
+		}
+		a = append(a, []int{pos, pos + len(em.Text)})
+	}
+
+	// Matches must be in order & cannot overlap.
+	sort.Slice(a, func(i, j int) bool { return a[i][0] < a[j][0] })
+	for i := 1; i < len(a); i++ {
+		if a[i][0] < a[i-1][1] {
+			m.fail(fmt.Errorf("%s: matches at bytes %d & %d overlap", m.path, a[i-1][0], a[i][0]))
+			return nil
+		}
+	}
+	if n >= 0 && len(a) > n {
+		a = a[:n]
+	}
+	return a
+}
+
+// findLineMatch returns the position & text of a match reported by line,
+// searching from from. The text is expected at its column, if reported, or
+// else it is found within the line. Returns -1 if the match is not found.
+func findLineMatch(b []byte, lines []int, em externalMatch, from int) (int, []byte) {
+	if em.Col > 0 && em.Line <= len(lines) {
+		if pos := lines[em.Line-1] + em.Col - 1; pos >= from && indexLine(b, lines, em.Line, pos, em.Text) == pos {
+			return pos, em.Text
+		}
+	}
+	if em.ColText != nil {
+		if pos := indexLine(b, lines, em.Line, from, em.ColText); pos != -1 {
+			return pos, em.ColText
+		}
+	}
+	return indexLine(b, lines, em.Line, from, em.Text), em.Text
+}
+
+// fail records err unless an earlier error was recorded.
+func (m *externalMatcher) fail(err error) {
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+// Expand appends template to dst with $0 replaced by the text of the match.
+func (m *externalMatcher) Expand(dst []byte, template []byte, src []byte, match []int) []byte {
+	return literalRegexp.Expand(dst, template, src, match[:2])
+}
+
+// utf8BOM is the UTF-8 byte order mark, which bed does not count in match
+// positions but other tools may.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// bytesAt returns true if b contains text at pos.
+func bytesAt(b []byte, pos int, text []byte) bool {
+	return pos >= 0 && pos+len(text) <= len(b) && bytes.Equal(b[pos:pos+len(text)], text)
+}
+
+// lineStarts returns the position of the start of each line of b.
+func lineStarts(b []byte) []int {
+	a := []int{0}
+	for i, c := range b {
+		if c == '\n' {
+			a = append(a, i+1)
+		}
+	}
+	return a
+}
+
+// indexLine returns the position of the first instance of text in line n of
+// b, numbered from 1, at or after from. Returns -1 if there is none.
+func indexLine(b []byte, lines []int, n, from int, text []byte) int {
+	if n > len(lines) {
+		return -1
+	}
+	start, end := lines[n-1], len(b)
+	if n < len(lines) {
+		end = lines[n] - 1
+	}
+	if from < start {
+		from = start
+	} else if from > end {
+		return -1
+	}
+	if i := bytes.Index(b[from:end], text); i != -1 {
+		return from + i
+	}
+	return -1
+}
+
+// readRipgrepMatches reads the output of "rg --json" from r & returns the
+// paths of files with matches, in the order they were reported, & a matcher
+// which finds the reported matches.
+func readRipgrepMatches(r io.Reader) ([]string, *externalMatcher, error) {
+	m := &externalMatcher{matches: make(map[string][]externalMatch)}
+	var paths []string
+	for dec := json.NewDecoder(r); ; {
+		var msg rgMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("cannot read ripgrep output: %s", err)
+		} else if msg.Type != "match" {
+			continue
+		}
+
+		path, err := msg.Data.Path.bytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		lines, err := msg.Data.Lines.bytes()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Submatch positions are relative to the start of the matching lines.
+		for _, sub := range msg.Data.Submatches {
+			if sub.Start < 0 || sub.End < sub.Start || sub.End > len(lines) {
+				return nil, nil, fmt.Errorf("%s: invalid ripgrep match at byte %d", path, msg.Data.AbsoluteOffset+sub.Start)
+			}
+			if _, ok := m.matches[string(path)]; !ok {
+				paths = append(paths, string(path))
+			}
+			m.matches[string(path)] = append(m.matches[string(path)], externalMatch{
+				Pos:  msg.Data.AbsoluteOffset + sub.Start,
+				Text: lines[sub.Start:sub.End],
+			})
+		}
+	}
+	return paths, m, nil
+}
+
+// rgMessage is a message written by "rg --json". Only "match" messages are
+// used.
+type rgMessage struct {
+	Type string `json:"type"`
+	Data struct {
+		Path           rgData `json:"path"`
+		Lines          rgData `json:"lines"`
+		AbsoluteOffset int    `json:"absolute_offset"`
+		Submatches     []struct {
+			Start int `json:"start"`
+			End   int `json:"end"`
+		} `json:"submatches"`
+	} `json:"data"`
+}
+
+// rgData is text written by ripgrep, which is base64 encoded if it is not
+// valid UTF-8.
+type rgData struct {
+	Text  *string `json:"text"`
+	Bytes string  `json:"bytes"`
+}
+
+// bytes returns the decoded data.
+func (d rgData) bytes() ([]byte, error) {
+	if d.Text != nil {
+		return []byte(*d.Text), nil
+	}
+	return base64.StdEncoding.DecodeString(d.Bytes)
+}
+
+// grepLineRegexp matches the "path:line:" prefix of a line written by grep
+// -Hn & similar tools, along with the column, if written with --column.
+// Paths end at a NUL byte if written with -Z or -z, or else at the first
+// colon followed by a line number.
+var grepLineRegexp = regexp.MustCompile(`^(?:([^\x00]*)\x00|(.*?):)([0-9]+)[:\x00](?:([0-9]+)[:\x00])?`)
+
+// grepContextRegexp matches the "path-line-" prefix of a context line written
+// by grep with -A, -B or -C.
+var grepContextRegexp = regexp.MustCompile(`^(?:([^\x00]*)\x00|(.*?)-)([0-9]+)-`)
+
+// readGrepMatches reads "path:line:text" lines, as written by "grep -Hn" or
+// "git grep -n", from r & returns the paths of files with matches, in the
+// order they were reported, & a matcher which finds the reported matches.
+// The text is found within its line, so it can be the whole line or, as
+// written by "grep -o", each match in the line. Context lines & separators
+// between groups of them are ignored.
+func readGrepMatches(r io.Reader) ([]string, *externalMatcher, error) {
+	m := &externalMatcher{matches: make(map[string][]externalMatch)}
+	var paths []string
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		} else if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		if string(line) == "--" {
+			continue
+		}
+
+		a := grepLineRegexp.FindSubmatchIndex(line)
+		if isGrepContextLine(line, a) {
+			continue
+		} else if a == nil {
+			return nil, nil, fmt.Errorf("line %d: expected path:line:text, such as from grep -Hn: %q", n, line)
+		}
+		path := grepPath(line, a)
+		lineNumber, err := strconv.Atoi(string(line[a[6]:a[7]]))
+		if err != nil || lineNumber == 0 {
+			return nil, nil, fmt.Errorf("line %d: invalid line number: %q", n, line[a[6]:a[7]])
+		}
+
+		// Grep writes the byte order mark of a file as part of its first line
+		// but bed does not include it in the file's text.
+		em := externalMatch{Line: lineNumber, Text: line[a[1]:]}
+		if a[8] != -1 {
+			em.Col, _ = strconv.Atoi(string(line[a[8]:a[9]]))
+			em.ColText = line[a[8]:]
+		}
+		if lineNumber == 1 {
+			em.Text, em.ColText = bytes.TrimPrefix(em.Text, utf8BOM), bytes.TrimPrefix(em.ColText, utf8BOM)
+		}
+
+		if _, ok := m.matches[path]; !ok {
+			paths = append(paths, path)
+		}
+		m.matches[path] = append(m.matches[path], em)
+	}
+	return paths, m, nil
+}
+
+// grepPath returns the path of a line matched by grepLineRegexp or
+// grepContextRegexp with the submatch indexes a.
+func grepPath(line []byte, a []int) string {
+	if a[2] != -1 {
+		return string(line[a[2]:a[3]])
+	}
+	return string(line[a[4]:a[5]])
+}
+
+// isGrepContextLine returns true if line is a context line, given the indexes
+// a of its match by grepLineRegexp, if any. Lines such as "a-1-b.txt:2:foo"
+// can be read as either, in which case the line is a context line only if
+// its path exists & the path of the match does not.
+func isGrepContextLine(line []byte, a []int) bool {
+	c := grepContextRegexp.FindSubmatchIndex(line)
+	if c == nil {
+		return false
+	} else if a == nil {
+		return true
+	}
+	if _, err := os.Stat(grepPath(line, a)); err == nil {
+		return false
+	}
+	_, err := os.Stat(grepPath(line, c))
+	return err == nil
+}
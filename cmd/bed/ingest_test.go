@@ -0,0 +1,248 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ingestTestData is the contents of ingestTestPath. Lines start at bytes 0,
+// 2, 14 & 16.
+const ingestTestData = "a\nfoo bar foo\nb\n10:30 foo\n"
+
+// ingestTestPath contains dashes & digits so it can be mistaken for the
+// prefix of a context line.
+const ingestTestPath = "x-1-y.txt"
+
+func TestReadGrepMatches(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		want  [][]int
+	}{
+		{
+			name:  "Lines",
+			input: "x-1-y.txt:2:foo bar foo\nx-1-y.txt:4:10:30 foo\n",
+			want:  [][]int{{2, 13}, {16, 25}},
+		},
+		{
+			name:  "CRLF",
+			input: "x-1-y.txt:2:foo bar foo\r\nx-1-y.txt:4:10:30 foo\r\n",
+			want:  [][]int{{2, 13}, {16, 25}},
+		},
+		{
+			name:  "Context",
+			input: "x-1-y.txt-1-a\nx-1-y.txt:2:foo bar foo\nx-1-y.txt-3-b\nx-1-y.txt:4:10:30 foo\n--\n",
+			want:  [][]int{{2, 13}, {16, 25}},
+		},
+		{
+			name:  "ContextNUL",
+			input: "x-1-y.txt\x002:foo bar foo\nx-1-y.txt\x003-b\nx-1-y.txt\x004:10:30 foo\n",
+			want:  [][]int{{2, 13}, {16, 25}},
+		},
+		{
+			name:  "OnlyMatching",
+			input: "x-1-y.txt:2:foo\nx-1-y.txt:2:foo\nx-1-y.txt:4:foo\n",
+			want:  [][]int{{2, 5}, {10, 13}, {22, 25}},
+		},
+		{
+			name:  "Column",
+			input: "x-1-y.txt:2:1:foo bar foo\nx-1-y.txt:4:7:10:30 foo\n",
+			want:  [][]int{{2, 13}, {16, 25}},
+		},
+		{
+			name:  "ColumnOnlyMatching",
+			input: "x-1-y.txt:2:9:foo\nx-1-y.txt:4:7:foo\n",
+			want:  [][]int{{10, 13}, {22, 25}},
+		},
+		{
+			// Columns after the first match of a line are not always from the
+			// start of the line, so matches are found in the line instead.
+			name:  "GitColumnOnlyMatching",
+			input: "x-1-y.txt:2:1:foo\nx-1-y.txt:2:4:foo\nx-1-y.txt:4:7:foo\n",
+			want:  [][]int{{2, 5}, {10, 13}, {22, 25}},
+		},
+		{
+			name:  "ColumnNUL",
+			input: "x-1-y.txt\x002\x001\x00foo bar foo\nx-1-y.txt\x004\x007\x0010:30 foo\n",
+			want:  [][]int{{2, 13}, {16, 25}},
+		},
+		{
+			name:  "TextLikeColumn",
+			input: "x-1-y.txt:4:10:30\n",
+			want:  [][]int{{16, 21}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirIngestTest(t)
+			paths, m, err := readGrepMatches(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(paths, []string{ingestTestPath}) {
+				t.Fatalf("unexpected paths: %q", paths)
+			}
+
+			m.path = ingestTestPath
+			if a := m.FindAllSubmatchIndex([]byte(ingestTestData), -1); m.err != nil {
+				t.Fatal(m.err)
+			} else if !reflect.DeepEqual(a, tt.want) {
+				t.Fatalf("unexpected matches: %v", a)
+			}
+		})
+	}
+}
+
+func TestReadGrepMatches_Error(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{name: "NoLineNumber", input: "foo bar\n", err: `line 1: expected path:line:text, such as from grep -Hn: "foo bar"`},
+		{name: "LineZero", input: "x-1-y.txt:0:a\n", err: `line 1: invalid line number: "0"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := readGrepMatches(strings.NewReader(tt.input)); err == nil || err.Error() != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestExternalMatcher_Stale(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{name: "Text", input: "x-1-y.txt:2:baz\n", err: "x-1-y.txt:2: match does not match the file"},
+		{name: "Line", input: "x-1-y.txt:9:foo\n", err: "x-1-y.txt:9: match does not match the file"},
+		{name: "OverlapOnLine", input: "x-1-y.txt:2:1:foo bar\nx-1-y.txt:2:5:bar foo\n", err: "x-1-y.txt:2: match does not match the file"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirIngestTest(t)
+			_, m, err := readGrepMatches(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.path = ingestTestPath
+			if a := m.FindAllSubmatchIndex([]byte(ingestTestData), -1); a != nil {
+				t.Fatalf("unexpected matches: %v", a)
+			} else if m.err == nil || !strings.HasPrefix(m.err.Error(), tt.err) {
+				t.Fatalf("unexpected error: %v", m.err)
+			}
+		})
+	}
+}
+
+func TestReadRipgrepMatches(t *testing.T) {
+	input := `{"type":"begin","data":{"path":{"text":"x-1-y.txt"}}}
+{"type":"match","data":{"path":{"text":"x-1-y.txt"},"lines":{"text":"foo bar foo\n"},"line_number":2,"absolute_offset":2,"submatches":[{"match":{"text":"foo"},"start":0,"end":3},{"match":{"text":"foo"},"start":8,"end":11}]}}
+{"type":"match","data":{"path":{"bytes":"eC0xLXkudHh0"},"lines":{"bytes":"MTA6MzAgZm9vCg=="},"line_number":4,"absolute_offset":16,"submatches":[{"match":{"text":"foo"},"start":6,"end":9}]}}
+{"type":"end","data":{"path":{"text":"x-1-y.txt"}}}
+`
+	paths, m, err := readRipgrepMatches(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(paths, []string{ingestTestPath}) {
+		t.Fatalf("unexpected paths: %q", paths)
+	}
+
+	m.path = ingestTestPath
+	if a := m.FindAllSubmatchIndex([]byte(ingestTestData), -1); m.err != nil {
+		t.Fatal(m.err)
+	} else if !reflect.DeepEqual(a, [][]int{{2, 5}, {10, 13}, {22, 25}}) {
+		t.Fatalf("unexpected matches: %v", a)
+	}
+}
+
+func TestReadRipgrepMatches_Offsets(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		err   string
+		want  [][]int
+	}{
+		{
+			// Offsets which count a byte order mark are adjusted.
+			name:  "ByteOrderMark",
+			input: `{"type":"match","data":{"path":{"text":"x-1-y.txt"},"lines":{"text":"foo bar foo\n"},"absolute_offset":5,"submatches":[{"start":8,"end":11}]}}`,
+			want:  [][]int{{10, 13}},
+		},
+		{
+			name:  "Stale",
+			input: `{"type":"match","data":{"path":{"text":"x-1-y.txt"},"lines":{"text":"foo bar foo\n"},"absolute_offset":7,"submatches":[{"start":0,"end":3}]}}`,
+			err:   "x-1-y.txt: match at byte 7 does not match the file",
+		},
+		{
+			name: "Overlap",
+			input: `{"type":"match","data":{"path":{"text":"x-1-y.txt"},"lines":{"text":"foo bar foo\n"},"absolute_offset":2,"submatches":[{"start":0,"end":7}]}}
+{"type":"match","data":{"path":{"text":"x-1-y.txt"},"lines":{"text":"foo bar foo\n"},"absolute_offset":2,"submatches":[{"start":4,"end":11}]}}`,
+			err: "x-1-y.txt: matches at bytes 2 & 6 overlap",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, m, err := readRipgrepMatches(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.path = ingestTestPath
+			a := m.FindAllSubmatchIndex([]byte(ingestTestData), -1)
+			if tt.err != "" {
+				if m.err == nil || !strings.HasPrefix(m.err.Error(), tt.err) {
+					t.Fatalf("unexpected error: %v", m.err)
+				}
+			} else if m.err != nil {
+				t.Fatal(m.err)
+			} else if !reflect.DeepEqual(a, tt.want) {
+				t.Fatalf("unexpected matches: %v", a)
+			}
+		})
+	}
+}
+
+func TestReadRipgrepMatches_Error(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{name: "InvalidJSON", input: "{", err: "cannot read ripgrep output: unexpected EOF"},
+		{
+			name:  "InvalidSubmatch",
+			input: `{"type":"match","data":{"path":{"text":"a.txt"},"lines":{"text":"foo\n"},"absolute_offset":10,"submatches":[{"start":2,"end":9}]}}`,
+			err:   "a.txt: invalid ripgrep match at byte 12",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := readRipgrepMatches(strings.NewReader(tt.input)); err == nil || err.Error() != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// chdirIngestTest changes to a new temporary directory containing the test
+// file for the test.
+func chdirIngestTest(t *testing.T) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "bed-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+	if err := ioutil.WriteFile(ingestTestPath, []byte(ingestTestData), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/benbjohnson/bed"
+)
+
+// inlineMaxMatches is the most matches that can be edited with -inline.
+// Editing more one at a time is slower than using an editor.
+const inlineMaxMatches = 20
+
+// runInline edits the text of each match in turn on the current line of the
+// terminal, without an external editor or a full screen interface. Each
+// match is shown with its location & line before its text is edited. Enter
+// accepts the text, Escape leaves the match unchanged & Ctrl-C discards
+// every change. Returns the changed matches.
+func runInline(matches []*bed.Match) ([]*bed.Match, error) {
+	if len(matches) > inlineMaxMatches {
+		return nil, fmt.Errorf("-inline is limited to %d matches, found %d; use an editor or -tui instead", inlineMaxMatches, len(matches))
+	}
+
+	f, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot edit inline without a terminal: %s", err)
+	}
+	defer f.Close()
+
+	width := 80
+	if w, _, err := terminalSize(int(f.Fd())); err == nil && w > 0 {
+		width = w
+	}
+
+	state, err := makeRaw(int(f.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	defer restoreTerminal(int(f.Fd()), state)
+
+	w := bufio.NewWriter(f)
+	defer w.Flush()
+	e := &lineEditor{keys: newKeyReader(f), w: w, width: width, interrupt: true}
+
+	files := make(map[string][]byte)
+	var changed []*bed.Match
+	for i, m := range matches {
+		// Raw mode does not translate newlines so carriage returns are
+		// written explicitly.
+		line, col, text := inlineContext(files, m)
+		fmt.Fprintf(w, "[%d/%d] %s:%d:%d\r\n", i+1, len(matches), m.Path, line, col)
+		fmt.Fprintf(w, "  %s\r\n", truncateWidth(text, width-2))
+
+		s, ok, err := e.Edit("> ", string(m.Data))
+		fmt.Fprint(w, "\r\n")
+		if err != nil {
+			return nil, err
+		} else if ok && s != string(m.Data) {
+			m.Data = []byte(s)
+			changed = append(changed, m)
+		}
+	}
+	return changed, nil
+}
+
+// inlineContext returns the line & column of m & the text of the line it
+// starts on. Files are read once & cached in files.
+func inlineContext(files map[string][]byte, m *bed.Match) (line, col int, text string) {
+	data, ok := files[m.Path]
+	if !ok {
+		data, _ = ioutil.ReadFile(m.Path)
+		if text, err := bed.DecodeCharset(data, m.Charset); err == nil {
+			data = bed.TrimByteOrderMark(text)
+		}
+		files[m.Path] = data
+	}
+	if m.Pos > len(data) {
+		return m.Line, m.Col, ""
+	}
+
+	start := bytes.LastIndexByte(data[:m.Pos], '\n') + 1
+	end := bytes.IndexByte(data[m.Pos:], '\n')
+	if end < 0 {
+		end = len(data)
+	} else {
+		end += m.Pos
+	}
+	line = bytes.Count(data[:start], []byte("\n")) + 1
+	return line, m.Pos - start + 1, string(bytes.TrimRight(data[start:end], "\r"))
+}
+
+// truncateWidth shortens s to at most n characters.
+func truncateWidth(s string, n int) string {
+	if r := []rune(s); n >= 0 && len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
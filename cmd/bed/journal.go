@@ -0,0 +1,186 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// DefaultJournalFile is the path of the journal of applies completed with an
+// idempotency key, relative to the current directory.
+const DefaultJournalFile = bed.StateDir + "/applied.jsonl"
+
+// journalEntry records an apply completed with an idempotency key. Each
+// file is also recorded as it is completed, with File set, so that an
+// interrupted apply can be resumed without applying changes twice.
+type journalEntry struct {
+	Key     string    `json:"key"`
+	Time    time.Time `json:"time"`
+	Run     string    `json:"run,omitempty"`
+	Digest  string    `json:"digest"` // digest of the changes applied
+	Matches int       `json:"matches,omitempty"`
+	Files   []string  `json:"files,omitempty"`
+	File    string    `json:"file,omitempty"`
+}
+
+// matchesDigest returns a digest of the changes in matches so that retries
+// can be told apart from different changes reusing a key.
+func matchesDigest(matches []*bed.Match) string {
+	h := sha256.New()
+	for _, m := range matches {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%s\x00%d\x00", m.Path, m.Pos, m.Len, m.Directive, len(m.Data))
+		h.Write(m.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// findJournalEntry returns the entry for key in the journal at path, or nil
+// if no apply has been completed with key.
+func findJournalEntry(path, key string) (*journalEntry, error) {
+	entries, err := readJournal(path, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.File == "" {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// completedFiles returns the files recorded as completed in the journal at
+// path by an apply of the changes with digest & key which was interrupted.
+func completedFiles(path, key, digest string) (map[string]bool, error) {
+	entries, err := readJournal(path, key)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.File != "" && entry.Digest == digest {
+			files[entry.File] = true
+		}
+	}
+	return files, nil
+}
+
+// readJournal returns the entries for key in the journal at path.
+func readJournal(path, key string) ([]*journalEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*journalEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid journal entry: %s", path, line, err)
+		} else if entry.Key == key {
+			entries = append(entries, &entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// journalWriter records each file completed by an apply with an idempotency
+// key as soon as it is written.
+type journalWriter struct {
+	f      *os.File
+	key    string
+	digest string
+}
+
+// openJournal opens the journal at path to record the files completed by an
+// apply of the changes with digest & key, creating it if needed.
+func openJournal(path, key, digest string) (*journalWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &journalWriter{f: f, key: key, digest: digest}, nil
+}
+
+// recordFile appends an entry for a completed file. Entries are written
+// immediately so they are kept if bed is interrupted.
+func (w *journalWriter) recordFile(path string) error {
+	buf, err := json.Marshal(&journalEntry{
+		Key:    w.key,
+		Time:   time.Now().UTC().Truncate(time.Second),
+		Run:    runID,
+		Digest: w.digest,
+		File:   path,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.f.Write(append(buf, '\n'))
+	return err
+}
+
+// Close closes the journal.
+func (w *journalWriter) Close() error {
+	return w.f.Close()
+}
+
+// recordJournalEntry appends an entry for an apply completed with key to the
+// journal at path, creating it if needed.
+func recordJournalEntry(path, key string, matches []*bed.Match) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	files, _ := bed.GroupMatchesByPath(matches)
+	if err := json.NewEncoder(f).Encode(&journalEntry{
+		Key:     key,
+		Time:    time.Now().UTC().Truncate(time.Second),
+		Run:     runID,
+		Digest:  matchesDigest(matches),
+		Matches: len(matches),
+		Files:   files,
+	}); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// checkIdempotencyKey returns true if the changes in matches were already
+// applied with key, so they must not be applied again since their positions
+// are no longer valid. Returns an error if key was used for other changes.
+func checkIdempotencyKey(path, key string, matches []*bed.Match) (bool, error) {
+	entry, err := findJournalEntry(path, key)
+	if err != nil || entry == nil {
+		return false, err
+	} else if entry.Digest != matchesDigest(matches) {
+		return false, fmt.Errorf("idempotency key %q was already used at %s for different changes", key, entry.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	return true, nil
+}
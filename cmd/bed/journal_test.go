@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+// writeTestMatchFile writes matches to a match file at path.
+func writeTestMatchFile(t *testing.T, path string, matches []*bed.Match) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := bed.WriteMatchFile(f, matches); err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunApply_IdempotencyKey(t *testing.T) {
+	chdirTemp(t)
+	t.Setenv("HOME", t.TempDir())
+	writeTestFile(t, "a.txt", "foo foo")
+	writeTestMatchFile(t, "m.bed", []*bed.Match{
+		{Path: "a.txt", Pos: 0, Len: 3, Data: []byte("barbaz")},
+	})
+
+	if err := RunApply([]string{"-idempotency-key", "k1", "m.bed"}); err != nil {
+		t.Fatal(err)
+	} else if s := readTestFile(t, "a.txt"); s != "barbaz foo" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+
+	// A retry is skipped since the positions are no longer valid.
+	if err := RunApply([]string{"-idempotency-key", "k1", "m.bed"}); err != nil {
+		t.Fatal(err)
+	} else if s := readTestFile(t, "a.txt"); s != "barbaz foo" {
+		t.Fatalf("unexpected contents after retry: %q", s)
+	}
+
+	// Reusing the key for other changes is an error.
+	writeTestMatchFile(t, "m2.bed", []*bed.Match{
+		{Path: "a.txt", Pos: 7, Len: 3, Data: []byte("qux")},
+	})
+	if err := RunApply([]string{"-idempotency-key", "k1", "m2.bed"}); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("unexpected error: %v", err)
+	} else if s := readTestFile(t, "a.txt"); s != "barbaz foo" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+}
+
+func TestCheckIdempotencyKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "applied.jsonl")
+	matches := []*bed.Match{{Path: "a.txt", Pos: 1, Len: 2, Data: []byte("x")}}
+
+	if applied, err := checkIdempotencyKey(path, "k", matches); err != nil || applied {
+		t.Fatalf("unexpected result: %v, %v", applied, err)
+	} else if err := recordJournalEntry(path, "k", matches); err != nil {
+		t.Fatal(err)
+	} else if applied, err := checkIdempotencyKey(path, "k", matches); err != nil || !applied {
+		t.Fatalf("unexpected result: %v, %v", applied, err)
+	} else if applied, err := checkIdempotencyKey(path, "other", matches); err != nil || applied {
+		t.Fatalf("unexpected result for other key: %v, %v", applied, err)
+	}
+
+	entry, err := findJournalEntry(path, "k")
+	if err != nil {
+		t.Fatal(err)
+	} else if entry.Matches != 1 || len(entry.Files) != 1 || entry.Files[0] != "a.txt" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+}
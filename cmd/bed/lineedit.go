@@ -0,0 +1,203 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Special keys returned by keyReader. Regular keys are returned as runes.
+const (
+	keyUp = -(iota + 1)
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyPageUp
+	keyPageDown
+	keyEscape
+)
+
+// Control characters sent by a raw mode terminal.
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyBackspace = 0x08
+	keyCtrlJ     = 0x0a
+	keyCtrlK     = 0x0b
+	keyEnter     = 0x0d
+	keyCtrlU     = 0x15
+	keyDel       = 0x7f
+)
+
+// keyReader decodes key presses from a raw mode terminal.
+type keyReader struct {
+	r *bufio.Reader
+}
+
+func newKeyReader(r io.Reader) *keyReader {
+	return &keyReader{r: bufio.NewReader(r)}
+}
+
+// ReadKey returns the next key press. Escape sequences for arrow & editing
+// keys are translated into their key constants.
+func (kr *keyReader) ReadKey() (rune, error) {
+	ch, _, err := kr.r.ReadRune()
+	if err != nil {
+		return 0, err
+	} else if ch != 0x1b {
+		return ch, nil
+	}
+
+	// A lone escape is not followed by the rest of a sequence in the same read.
+	if kr.r.Buffered() == 0 {
+		return keyEscape, nil
+	}
+	if b, err := kr.r.ReadByte(); err != nil {
+		return 0, err
+	} else if b != '[' && b != 'O' {
+		return keyEscape, nil
+	}
+
+	// Read sequence parameters until the final byte.
+	var seq []byte
+	for {
+		b, err := kr.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		seq = append(seq, b)
+		if b >= 0x40 && b <= 0x7e {
+			break
+		}
+	}
+
+	switch string(seq) {
+	case "A":
+		return keyUp, nil
+	case "B":
+		return keyDown, nil
+	case "C":
+		return keyRight, nil
+	case "D":
+		return keyLeft, nil
+	case "H", "1~", "7~":
+		return keyHome, nil
+	case "F", "4~", "8~":
+		return keyEnd, nil
+	case "3~":
+		return keyDelete, nil
+	case "5~":
+		return keyPageUp, nil
+	case "6~":
+		return keyPageDown, nil
+	default:
+		return keyEscape, nil
+	}
+}
+
+// lineEditor edits text on the current row of a raw mode terminal. Text may
+// contain newlines which are displayed as "↵" and inserted with Ctrl-J.
+type lineEditor struct {
+	keys  *keyReader
+	w     io.Writer
+	width int // terminal width, in columns
+
+	// If true, Ctrl-C returns ErrAborted instead of cancelling the edit.
+	interrupt bool
+}
+
+// Edit displays prompt followed by s and allows the user to edit s. Returns
+// the edited text once Enter is pressed or ok as false if the user cancels
+// with Escape or Ctrl-C.
+func (e *lineEditor) Edit(prompt, s string) (text string, ok bool, err error) {
+	buf := []rune(s)
+	pos := len(buf)
+	for {
+		e.draw(prompt, buf, pos)
+
+		key, err := e.keys.ReadKey()
+		if err != nil {
+			return s, false, err
+		}
+
+		switch key {
+		case keyEnter:
+			return string(buf), true, nil
+		case keyCtrlC:
+			if e.interrupt {
+				return s, false, ErrAborted
+			}
+			return s, false, nil
+		case keyEscape:
+			return s, false, nil
+		case keyLeft, keyCtrlB:
+			if pos > 0 {
+				pos--
+			}
+		case keyRight, keyCtrlF:
+			if pos < len(buf) {
+				pos++
+			}
+		case keyHome, keyCtrlA:
+			pos = 0
+		case keyEnd, keyCtrlE:
+			pos = len(buf)
+		case keyDel, keyBackspace:
+			if pos > 0 {
+				buf, pos = append(buf[:pos-1], buf[pos:]...), pos-1
+			}
+		case keyDelete, keyCtrlD:
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyCtrlU:
+			buf, pos = buf[pos:], 0
+		case keyCtrlK:
+			buf = buf[:pos]
+		default:
+			if key == keyCtrlJ || key >= ' ' {
+				buf = append(buf[:pos], append([]rune{key}, buf[pos:]...)...)
+				pos++
+			}
+		}
+	}
+}
+
+// draw redraws the current row with the prompt & text. The text scrolls
+// horizontally to keep the cursor visible.
+func (e *lineEditor) draw(prompt string, buf []rune, pos int) {
+	avail := e.width - utf8.RuneCountInString(prompt) - 1
+	if avail < 1 {
+		avail = 1
+	}
+
+	start := 0
+	if pos > avail {
+		start = pos - avail
+	}
+	end := start + avail
+	if end > len(buf) {
+		end = len(buf)
+	}
+
+	visible := strings.Replace(string(buf[start:end]), "\n", "↵", -1)
+	fmt.Fprintf(e.w, "\r\x1b[K%s%s\r", prompt, visible)
+	if col := utf8.RuneCountInString(prompt) + pos - start; col > 0 {
+		fmt.Fprintf(e.w, "\x1b[%dC", col)
+	}
+	if f, ok := e.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+}
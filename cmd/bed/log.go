@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// runID identifies this invocation of bed. It is included in log messages,
+// temporary file names, journal entries, reports & summaries so that every
+// artifact of a single run can be correlated, even when runs overlap.
+var runID = newRunID()
+
+// newRunID returns a random 8 character hex ID.
+func newRunID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Log levels. Log messages are tagged with their level by prefixing them
+// with the level's name, e.g. "debug: ". Untagged messages, such as those
+// logged by the bed package, are info messages.
+const (
+	LogDebug = iota
+	LogInfo
+	LogWarn
+)
+
+var logLevelNames = []string{"debug", "info", "warn"}
+
+// parseLogLevel returns the log level with the given name.
+func parseLogLevel(name string) (int, error) {
+	for level, s := range logLevelNames {
+		if s == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level: %q", name)
+}
+
+// logFlags are the command line flags which control logging.
+type logFlags struct {
+	verbose *bool
+	level   *string
+	file    *string
+	format  *string
+}
+
+// newLogFlags registers the logging flags on fs.
+func newLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		verbose: fs.Bool("v", false, ""),
+		level:   fs.String("log-level", "", ""),
+		file:    fs.String("log-file", "", ""),
+		format:  fs.String("log-format", "text", ""),
+	}
+}
+
+// validateFlags returns an error if the log level or format is unknown.
+func (f *logFlags) validateFlags() error {
+	if *f.format != "text" && *f.format != "json" {
+		return fmt.Errorf("unknown log format: %q", *f.format)
+	} else if *f.level == "" {
+		return nil
+	}
+	_, err := parseLogLevel(*f.level)
+	return err
+}
+
+// minLevel returns the minimum level of messages to log. The -v flag is
+// shorthand for the debug level. Otherwise, info messages are logged to
+// log files so runs can be audited & only warnings are logged to STDERR.
+func (f *logFlags) minLevel() int {
+	if *f.verbose {
+		return LogDebug
+	} else if *f.level != "" {
+		level, _ := parseLogLevel(*f.level)
+		return level
+	} else if *f.file != "" {
+		return LogInfo
+	}
+	return LogWarn
+}
+
+// debug returns true if debug messages are logged.
+func (f *logFlags) debug() bool {
+	return f.minLevel() == LogDebug
+}
+
+// open directs log output to STDERR or to the end of the log file, if
+// specified. The returned function closes the log file.
+func (f *logFlags) open() (closeLog func(), err error) {
+	log.SetFlags(0)
+
+	w := &logWriter{w: os.Stderr, min: f.minLevel(), json: *f.format == "json"}
+	logJSON = w.json
+	closeLog = func() {}
+	if *f.file != "" {
+		file, err := os.OpenFile(*f.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, err
+		}
+		w.w, w.timestamps = file, true
+		closeLog = func() {
+			log.SetOutput(os.Stderr)
+			file.Close()
+		}
+	}
+	log.SetOutput(w)
+
+	if wd, err := os.Getwd(); err == nil {
+		log.Printf("info: run %s: %s (in %s)", runID, strings.Join(os.Args, " "), wd)
+	}
+	return closeLog, nil
+}
+
+// logJSON is true if log messages are written as JSON objects, in which
+// case warnings are logged instead of written to STDERR as text.
+var logJSON bool
+
+// warnCount is the number of warnings reported by warnf during the run.
+var warnCount int
+
+// warnf reports a warning to the user on STDERR, or to the log if logging
+// JSON, & counts it.
+func warnf(format string, args ...interface{}) {
+	warnCount++
+	if logJSON {
+		log.Printf("warn: "+format, args...)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+}
+
+// logWriter writes log messages at or above a minimum level to w. Each
+// message is prefixed with its level & optionally a timestamp & the run ID,
+// or written as a JSON object with "time", "run", "level" & "msg" keys.
+type logWriter struct {
+	w          io.Writer
+	min        int
+	timestamps bool
+	json       bool
+}
+
+// Write writes a single log message. The log package calls Write once for
+// each message.
+func (w *logWriter) Write(p []byte) (int, error) {
+	level, msg := LogInfo, p
+	for i, name := range logLevelNames {
+		if bytes.HasPrefix(p, []byte(name+": ")) {
+			level, msg = i, p[len(name)+2:]
+			break
+		}
+	}
+	if level < w.min {
+		return len(p), nil
+	}
+
+	var buf bytes.Buffer
+	if w.json {
+		if err := json.NewEncoder(&buf).Encode(logEntryJSON{
+			Time:  time.Now().Format(time.RFC3339),
+			Run:   runID,
+			Level: logLevelNames[level],
+			Msg:   string(bytes.TrimSuffix(msg, []byte("\n"))),
+		}); err != nil {
+			return 0, err
+		} else if _, err := w.w.Write(buf.Bytes()); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if w.timestamps {
+		buf.WriteString(time.Now().Format(time.RFC3339) + " " + runID + " ")
+	}
+	buf.WriteString(logLevelNames[level] + ": ")
+	buf.Write(msg)
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logEntryJSON is a log message written with -log-format json.
+type logEntryJSON struct {
+	Time  string `json:"time"`
+	Run   string `json:"run"`
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// lookaround is a zero-width assertion at the start or end of a pattern,
+// such as the "(?=\()" in "foo(?=\()".
+type lookaround struct {
+	behind  bool   // lookbehind, if true, or lookahead
+	negated bool   // (?<! or (?! instead of (?<= or (?=
+	pattern string // asserted pattern
+}
+
+// String returns the lookaround in pattern syntax.
+func (l lookaround) String() string {
+	prefix := "(?"
+	if l.behind {
+		prefix += "<"
+	}
+	if l.negated {
+		prefix += "!"
+	} else {
+		prefix += "="
+	}
+	return prefix + l.pattern + ")"
+}
+
+// splitLookarounds returns the lookbehinds at the start of pattern, the
+// pattern between them & the lookaheads at the end of pattern. Lookarounds
+// elsewhere in the pattern are left in place & rejected by RE2. Inline flags
+// at the start of pattern, such as "(?i)", apply to the whole pattern so
+// they are added to each part.
+func splitLookarounds(pattern string) (behind []lookaround, core string, ahead []lookaround) {
+	groups, alternation := topLevelGroups(pattern)
+	if alternation {
+		return nil, pattern, nil
+	}
+
+	var flags string
+	start, end := 0, len(pattern)
+	for len(groups) > 0 && groups[0][0] == start && isFlagGroup(pattern[groups[0][0]:groups[0][1]]) {
+		flags += pattern[groups[0][0]:groups[0][1]]
+		start, groups = groups[0][1], groups[1:]
+	}
+	for _, g := range groups {
+		if g[0] != start {
+			break
+		}
+		l, ok := parseLookaround(pattern[g[0]:g[1]])
+		if !ok || !l.behind {
+			break
+		}
+		behind, start = append(behind, l), g[1]
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		g := groups[i]
+		if g[1] != end || g[0] < start {
+			break
+		}
+		l, ok := parseLookaround(pattern[g[0]:g[1]])
+		if !ok || l.behind {
+			break
+		}
+		ahead, end = append([]lookaround{l}, ahead...), g[0]
+	}
+
+	if len(behind) == 0 && len(ahead) == 0 {
+		return nil, pattern, nil
+	}
+	for i := range behind {
+		behind[i].pattern = flags + behind[i].pattern
+	}
+	for i := range ahead {
+		ahead[i].pattern = flags + ahead[i].pattern
+	}
+	return behind, flags + pattern[start:end], ahead
+}
+
+// isFlagGroup returns true if group sets inline flags for the rest of the
+// pattern, such as "(?i)" or "(?s-m)".
+func isFlagGroup(group string) bool {
+	if len(group) < 4 || !strings.HasPrefix(group, "(?") || !strings.HasSuffix(group, ")") {
+		return false
+	}
+	for _, c := range group[2 : len(group)-1] {
+		if !strings.ContainsRune("imsU-", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// joinLookarounds returns the pattern split by splitLookarounds.
+func joinLookarounds(behind []lookaround, core string, ahead []lookaround) string {
+	var buf strings.Builder
+	for _, l := range behind {
+		buf.WriteString(l.String())
+	}
+	buf.WriteString(core)
+	for _, l := range ahead {
+		buf.WriteString(l.String())
+	}
+	return buf.String()
+}
+
+// parseLookaround parses group as a lookaround, if it is one.
+func parseLookaround(group string) (lookaround, bool) {
+	for _, prefix := range []string{"(?<=", "(?<!", "(?=", "(?!"} {
+		if strings.HasPrefix(group, prefix) {
+			return lookaround{
+				behind:  strings.HasPrefix(prefix, "(?<"),
+				negated: strings.HasSuffix(prefix, "!"),
+				pattern: group[len(prefix) : len(group)-1],
+			}, true
+		}
+	}
+	return lookaround{}, false
+}
+
+// topLevelGroups returns the start & end positions of the parenthesized
+// groups in pattern which are not nested in another group. Also returns
+// true if pattern contains a top-level alternation.
+func topLevelGroups(pattern string) (groups [][2]int, alternation bool) {
+	var depth, start int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++ // skip escaped character
+		case '[':
+			i = classEnd(pattern, i)
+		case '(':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				groups = append(groups, [2]int{start, i + 1})
+			}
+		case '|':
+			if depth == 0 {
+				alternation = true
+			}
+		}
+	}
+	return groups, alternation
+}
+
+// classEnd returns the position of the "]" which closes the character class
+// starting at pattern[i].
+func classEnd(pattern string, i int) int {
+	i++
+	if i < len(pattern) && pattern[i] == '^' {
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		i++ // a leading "]" is a literal
+	}
+	for ; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\':
+			i++
+		case strings.HasPrefix(pattern[i:], "[:"):
+			if j := strings.Index(pattern[i+2:], ":]"); j != -1 {
+				i += j + 3
+			}
+		case pattern[i] == ']':
+			return i
+		}
+	}
+	return len(pattern)
+}
+
+// lookaroundMatcher supports lookbehinds at the start & lookaheads at the end
+// of a pattern, which RE2 does not, so that only the text between them is
+// matched. Each match is searched for with the first positive lookahead so
+// that the pattern is not extended into the text the lookahead requires.
+// Every lookaround is then checked separately against the text before &
+// after the match. If the lookaheads are not satisfied then shorter matches
+// at the same position are tried, longest first, as a backtracking engine
+// would for a greedy pattern. Searching continues from the end of each
+// match, excluding its lookahead, so lookarounds may overlap other matches.
+type lookaroundMatcher struct {
+	core      *regexp.Regexp       // pattern between the lookarounds
+	first     *regexp.Regexp       // search from the start of the text
+	next      *regexp.Regexp       // search after the character before a position
+	exact     [2][2]*regexp.Regexp // match exactly, with or without the characters around
+	behind    []lookbehind
+	ahead     []*regexp.Regexp
+	notBehind []lookbehind
+	notAhead  []*regexp.Regexp
+}
+
+// compileLookaround compiles a pattern split by splitLookarounds.
+func compileLookaround(behind []lookaround, core string, ahead []lookaround) (*lookaroundMatcher, error) {
+	m := &lookaroundMatcher{}
+	for _, l := range behind {
+		if err := validateLookaround(l); err != nil {
+			return nil, err
+		}
+		lb := compileLookbehind(l.pattern)
+		if l.negated {
+			m.notBehind = append(m.notBehind, lb)
+		} else {
+			m.behind = append(m.behind, lb)
+		}
+	}
+
+	// Flags set in the middle of the pattern would also apply to lookaheads
+	// after it, which are matched separately.
+	if len(ahead) > 0 {
+		groups, _ := topLevelGroups(core)
+		for _, g := range groups {
+			if g[0] > 0 && isFlagGroup(core[g[0]:g[1]]) {
+				return nil, fmt.Errorf("inline flags %s are not supported before a lookahead, move them to the start of the pattern or use (?flags:...) instead", core[g[0]:g[1]])
+			}
+		}
+	}
+
+	// Surround the pattern with empty groups to mark its start & end. These
+	// are removed from the results so submatches are numbered as in core.
+	pattern := `()(?:` + core + `)()`
+	for _, l := range ahead {
+		if err := validateLookaround(l); err != nil {
+			return nil, err
+		}
+		re := regexp.MustCompile(`\A(?:` + l.pattern + `)`)
+		if l.negated {
+			m.notAhead = append(m.notAhead, re)
+			continue
+		} else if len(m.ahead) == 0 {
+			pattern += `(?:` + l.pattern + `)`
+		}
+		m.ahead = append(m.ahead, re)
+	}
+
+	// Searches are anchored to the start of the text & skip ahead lazily so
+	// they can begin at any position. Searches after the start include the
+	// preceding character so that anchors & word boundaries see it.
+	var err error
+	if m.core, err = regexp.Compile(core); err != nil {
+		return nil, err
+	} else if m.first, err = regexp.Compile(`\A(?s:.*?)` + pattern); err != nil {
+		return nil, err
+	} else if m.next, err = regexp.Compile(`\A(?s:.)(?s:.*?)` + pattern); err != nil {
+		return nil, err
+	}
+
+	// Shorter matches are checked against the text between two positions,
+	// along with the characters on either side, if any, so that anchors &
+	// word boundaries see them.
+	for i, prefix := range []string{`\A`, `\A(?s:.)`} {
+		for j, suffix := range []string{`\z`, `(?s:.)\z`} {
+			if m.exact[i][j], err = regexp.Compile(prefix + `()(?:` + core + `)()` + suffix); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// validateLookaround returns an error if the lookaround's pattern is invalid
+// or contains capture groups, which would change the submatch numbers.
+func validateLookaround(l lookaround) error {
+	re, err := regexp.Compile(l.pattern)
+	if err != nil {
+		return err
+	} else if re.NumSubexp() > 0 {
+		return fmt.Errorf("capture groups are not supported in %s, use (?:...) instead", l)
+	}
+	return nil
+}
+
+// FindAllSubmatchIndex returns the positions of up to n matches in b, if n
+// is non-negative, excluding their lookarounds.
+func (m *lookaroundMatcher) FindAllSubmatchIndex(b []byte, n int) [][]int {
+	var a [][]int
+	for pos, prev := 0, -1; pos <= len(b) && (n < 0 || len(a) < n); {
+		loc := m.find(b, pos)
+		if loc == nil {
+			break
+		}
+
+		// Replace the overall match with the positions of the marker groups.
+		// Try shorter matches if the lookaheads are not satisfied.
+		start, end := loc[2], loc[len(loc)-2]
+		if m.assertedBehind(b, start) && !m.assertedAhead(b, end) {
+			if other := m.shorter(b, start, end); other != nil {
+				loc, end = other, other[len(other)-2]
+			}
+		}
+
+		// Retry from the next character if the lookarounds are not satisfied
+		// or if the match is empty & adjacent to the previous match.
+		if (start == end && start == prev) || !m.assertedBehind(b, start) || !m.assertedAhead(b, end) {
+			_, size := utf8.DecodeRune(b[start:])
+			pos = start + size
+			if start == len(b) {
+				break
+			}
+			continue
+		}
+		a = append(a, append([]int{start, end}, loc[4:len(loc)-2]...))
+
+		if pos, prev = end, end; start == end {
+			_, size := utf8.DecodeRune(b[end:])
+			if pos += size; end == len(b) {
+				break
+			}
+		}
+	}
+	return a
+}
+
+// find returns the submatch positions of the first match in b which starts
+// at or after pos.
+func (m *lookaroundMatcher) find(b []byte, pos int) []int {
+	if pos == 0 {
+		return m.first.FindSubmatchIndex(b)
+	}
+
+	_, size := utf8.DecodeLastRune(b[:pos])
+	offset := pos - size
+	loc := m.next.FindSubmatchIndex(b[offset:])
+	for i := range loc {
+		if loc[i] >= 0 {
+			loc[i] += offset
+		}
+	}
+	return loc
+}
+
+// Expand expands template using the submatches of the pattern between the
+// lookarounds.
+func (m *lookaroundMatcher) Expand(dst []byte, template []byte, src []byte, match []int) []byte {
+	return m.core.Expand(dst, template, src, match)
+}
+
+// shorter returns the submatch positions of the longest match of the pattern
+// between the lookarounds which starts at start, ends before end & satisfies
+// the lookaheads. Returns nil if there is none.
+func (m *lookaroundMatcher) shorter(b []byte, start, end int) []int {
+	for end > start {
+		_, size := utf8.DecodeLastRune(b[start:end])
+		end -= size
+
+		if !m.assertedAhead(b, end) {
+			continue
+		} else if loc := m.exactMatch(b, start, end); loc != nil {
+			return loc
+		}
+	}
+	return nil
+}
+
+// exactMatch returns the submatch positions of a match of the pattern between
+// the lookarounds which spans exactly b[start:end], or nil if there is none.
+func (m *lookaroundMatcher) exactMatch(b []byte, start, end int) []int {
+	var i, j, offset int
+	if start > 0 {
+		_, size := utf8.DecodeLastRune(b[:start])
+		i, offset = 1, start-size
+	}
+	limit := end
+	if end < len(b) {
+		_, size := utf8.DecodeRune(b[end:])
+		j, limit = 1, end+size
+	}
+
+	loc := m.exact[i][j].FindSubmatchIndex(b[offset:limit])
+	for k := range loc {
+		if loc[k] >= 0 {
+			loc[k] += offset
+		}
+	}
+	return loc
+}
+
+// assertedBehind returns true if the text before b[start] satisfies the
+// lookbehinds.
+func (m *lookaroundMatcher) assertedBehind(b []byte, start int) bool {
+	for _, lb := range m.behind {
+		if !lb.match(b, start) {
+			return false
+		}
+	}
+	for _, lb := range m.notBehind {
+		if lb.match(b, start) {
+			return false
+		}
+	}
+	return true
+}
+
+// assertedAhead returns true if the text after b[end] satisfies the
+// lookaheads.
+func (m *lookaroundMatcher) assertedAhead(b []byte, end int) bool {
+	for _, re := range m.ahead {
+		if !re.Match(b[end:]) {
+			return false
+		}
+	}
+	for _, re := range m.notAhead {
+		if re.Match(b[end:]) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookbehind is a compiled lookbehind pattern which is matched against the
+// text ending at a position.
+type lookbehind struct {
+	re    *regexp.Regexp
+	width int // maximum length of a match in bytes, or -1 if unbounded
+}
+
+// compileLookbehind compiles a lookbehind pattern which has been validated.
+func compileLookbehind(pattern string) lookbehind {
+	lb := lookbehind{re: regexp.MustCompile(`(?:` + pattern + `)\z`), width: -1}
+	if re, err := syntax.Parse(pattern, syntax.Perl); err == nil {
+		lb.width = maxWidth(re.Simplify())
+	}
+	return lb
+}
+
+// match returns true if the lookbehind matches the text before b[pos]. Only
+// the text which a match can span is searched, along with the character
+// before it so that anchors & word boundaries see it.
+func (lb lookbehind) match(b []byte, pos int) bool {
+	start := 0
+	if lb.width >= 0 && pos > lb.width {
+		_, size := utf8.DecodeLastRune(b[:pos-lb.width])
+		start = pos - lb.width - size
+	}
+	return lb.re.Match(b[start:pos])
+}
+
+// maxWidth returns the maximum number of bytes matched by re, or -1 if it
+// is unbounded.
+func maxWidth(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return len(re.Rune) * utf8.UTFMax
+		}
+		var n int
+		for _, r := range re.Rune {
+			n += utf8.RuneLen(r)
+		}
+		return n
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return 0
+		}
+		return utf8.RuneLen(re.Rune[len(re.Rune)-1])
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return utf8.UTFMax
+	case syntax.OpCapture, syntax.OpQuest:
+		return maxWidth(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpRepeat:
+		n := maxWidth(re.Sub[0])
+		if n <= 0 {
+			return n
+		} else if re.Op != syntax.OpRepeat || re.Max == -1 {
+			return -1
+		}
+		return n * re.Max
+	case syntax.OpConcat, syntax.OpAlternate:
+		var n int
+		for _, sub := range re.Sub {
+			w := maxWidth(sub)
+			if w == -1 {
+				return -1
+			} else if re.Op == syntax.OpConcat {
+				n += w
+			} else if w > n {
+				n = w
+			}
+		}
+		return n
+	default:
+		return 0 // empty-width assertions
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookaroundMatcher(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		s       string
+		want    [][]int
+	}{
+		{pattern: `foo(?=\()`, s: "foo foo() foo(", want: [][]int{{4, 7}, {10, 13}}},
+		{pattern: `(?<=\$)\w+`, s: "a $b $cd", want: [][]int{{3, 4}, {6, 8}}},
+		{pattern: `(?<=a)\w+`, s: "xab", want: [][]int{{2, 3}}},
+		{pattern: `\w+(?=\d)`, s: "ab1", want: [][]int{{0, 2}}},
+		{pattern: `(?<!\$)\b\w+`, s: "a $b cd", want: [][]int{{0, 1}, {5, 7}}},
+		{pattern: `\w+(?!\()`, s: "f( g", want: [][]int{{3, 4}}},
+
+		// Stacked lookarounds are each checked at the same position.
+		{pattern: `(?<=a)(?<=b)x`, s: "abx ax bx", want: nil},
+		{pattern: `(?<=a)(?<=a)x`, s: "ax aax", want: [][]int{{1, 2}, {5, 6}}},
+		{pattern: `(?<=\w)(?<=b)x`, s: "bx ax", want: [][]int{{1, 2}}},
+		{pattern: `(?<=b)(?<!ab)x`, s: "bx abx", want: [][]int{{1, 2}}},
+		{pattern: `x(?=a)(?=\w)`, s: "xa x! xa", want: [][]int{{0, 1}, {6, 7}}},
+		{pattern: `x(?=ab)(?=a)`, s: "xab xa", want: [][]int{{0, 1}}},
+		{pattern: `x(?=a)(?=b)`, s: "xa xb xab", want: nil},
+
+		// Lookarounds may overlap other matches.
+		{pattern: `a(?=a)`, s: "aaa", want: [][]int{{0, 1}, {1, 2}}},
+		{pattern: `(?<=a)a`, s: "aaa", want: [][]int{{1, 2}, {2, 3}}},
+		{pattern: `(?<=a)a(?=a)`, s: "aaaa", want: [][]int{{1, 2}, {2, 3}}},
+
+		// Anchors & word boundaries see the text before each search.
+		{pattern: `\bfoo(?=\()`, s: "foo(xfoo( foo(", want: [][]int{{0, 3}, {10, 13}}},
+		{pattern: `(?m)^a(?=a)`, s: "aa\naa", want: [][]int{{0, 1}, {3, 4}}},
+		{pattern: `\Aa(?=a)`, s: "aaa", want: [][]int{{0, 1}}},
+		{pattern: `(?<=\bfo)o`, s: "foo xfoo fo", want: [][]int{{2, 3}}},
+		{pattern: `(?<=(?m)^a)b`, s: "ab\nab cab", want: [][]int{{1, 2}, {4, 5}}},
+		{pattern: `(?<=\Aa)b`, s: "abab", want: [][]int{{1, 2}}},
+		{pattern: `(?<=a+)b`, s: "b aab", want: [][]int{{4, 5}}},
+		{pattern: `(?<=é{2})b`, s: "éb ééb", want: [][]int{{8, 9}}},
+
+		// Empty matches are found between characters.
+		{pattern: `(?<=a)`, s: "aaé", want: [][]int{{1, 1}, {2, 2}}},
+		{pattern: `(?=é)`, s: "aéé", want: [][]int{{1, 1}, {3, 3}}},
+
+		// Submatches are numbered as in the pattern between the lookarounds.
+		{pattern: `(?<=\.)(\w+)\((\w*)\)`, s: "x.f(a) .g()", want: [][]int{{2, 6, 2, 3, 4, 5}, {8, 11, 8, 9, 10, 10}}},
+
+		// Flags at the start of the pattern also apply to the lookarounds.
+		{pattern: `(?i)(?<=x)foo`, s: "Xfoo xFOO foo", want: [][]int{{1, 4}, {6, 9}}},
+		{pattern: `(?i)foo(?=bar)`, s: "FOObar fooBAR foo", want: [][]int{{0, 3}, {7, 10}}},
+		{pattern: `(?i)(?<=x)foo(?=bar)`, s: "xFooBar", want: [][]int{{1, 4}}},
+
+		// Shorter matches are tried if the lookaheads are not satisfied.
+		{pattern: `\w+(?!;)`, s: "abc;", want: [][]int{{0, 2}}},
+		{pattern: `\w+(?!;)`, s: "abc; d", want: [][]int{{0, 2}, {5, 6}}},
+		{pattern: `a+(?!b)`, s: "ab aab", want: [][]int{{3, 4}}},
+		{pattern: `(\w+)(\d)(?!x)`, s: "ab12x", want: [][]int{{0, 3, 0, 2, 2, 3}}},
+		{pattern: `é+(?!x)`, s: "ééx", want: [][]int{{0, 2}}},
+		{pattern: `\w+\b(?!;)`, s: "abc;", want: nil},
+		{pattern: `(?<=\$)\w+(?!;)`, s: "$abc;", want: [][]int{{1, 3}}},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			m, err := compileRE2(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			} else if _, ok := m.(*lookaroundMatcher); !ok {
+				t.Fatalf("unexpected matcher: %T", m)
+			}
+			if a := m.FindAllSubmatchIndex([]byte(tt.s), -1); !reflect.DeepEqual(a, tt.want) {
+				t.Fatalf("unexpected matches: %v", a)
+			}
+		})
+	}
+}
+
+func TestLookaroundMatcher_Limit(t *testing.T) {
+	m, err := compileRE2(`a(?=a)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := m.FindAllSubmatchIndex([]byte("aaaa"), 2); !reflect.DeepEqual(a, [][]int{{0, 1}, {1, 2}}) {
+		t.Fatalf("unexpected matches: %v", a)
+	}
+}
+
+func TestMaxWidth(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		width   int
+	}{
+		{pattern: `abc`, width: 3},
+		{pattern: `é`, width: 2},
+		{pattern: `(?i)k`, width: 4},
+		{pattern: `[a-z]`, width: 1},
+		{pattern: `[^a]`, width: 4},
+		{pattern: `.`, width: 4},
+		{pattern: `a?b`, width: 2},
+		{pattern: `a{2,3}`, width: 3},
+		{pattern: `(?:ab|c)\b$`, width: 2},
+		{pattern: `a*`, width: -1},
+		{pattern: `a{2,}`, width: -1},
+		{pattern: `x|a+`, width: -1},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if w := compileLookbehind(tt.pattern).width; w != tt.width {
+				t.Fatalf("unexpected width: %d", w)
+			}
+		})
+	}
+}
+
+func TestSplitLookarounds(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		behind  int
+		core    string
+		ahead   int
+	}{
+		{pattern: `foo`, core: `foo`},
+		{pattern: `(?<=a)(?<!b)foo(?=c)(?!d)`, behind: 2, core: `foo`, ahead: 2},
+		{pattern: `(?<=a)foo|bar`, core: `(?<=a)foo|bar`},
+		{pattern: `foo(?<=a)`, core: `foo(?<=a)`},
+		{pattern: `(?=a)foo`, core: `(?=a)foo`},
+		{pattern: `(?<=[)])foo(?=[(])`, behind: 1, core: `foo`, ahead: 1},
+		{pattern: `(?<=\()foo`, behind: 1, core: `foo`},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			behind, core, ahead := splitLookarounds(tt.pattern)
+			if len(behind) != tt.behind || core != tt.core || len(ahead) != tt.ahead {
+				t.Fatalf("unexpected split: %v %q %v", behind, core, ahead)
+			} else if s := joinLookarounds(behind, core, ahead); s != tt.pattern {
+				t.Fatalf("unexpected join: %q", s)
+			}
+		})
+	}
+}
+
+func TestSplitLookarounds_Flags(t *testing.T) {
+	behind, core, ahead := splitLookarounds(`(?i)(?s-m)(?<=a)foo(?=b)`)
+	if len(behind) != 1 || behind[0].pattern != `(?i)(?s-m)a` {
+		t.Fatalf("unexpected lookbehinds: %v", behind)
+	} else if core != `(?i)(?s-m)foo` {
+		t.Fatalf("unexpected core: %q", core)
+	} else if len(ahead) != 1 || ahead[0].pattern != `(?i)(?s-m)b` {
+		t.Fatalf("unexpected lookaheads: %v", ahead)
+	}
+
+	// Patterns without lookarounds are unchanged.
+	if behind, core, ahead := splitLookarounds(`(?i)foo`); behind != nil || core != `(?i)foo` || ahead != nil {
+		t.Fatalf("unexpected split: %v %q %v", behind, core, ahead)
+	}
+}
+
+func TestCompileLookaround_Error(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		err     string
+	}{
+		{pattern: `(?<=(a))x`, err: "capture groups are not supported in (?<=(a)), use (?:...) instead"},
+		{pattern: "x(?=a**)", err: "error parsing regexp: invalid nested repetition operator: `**`"},
+		{pattern: `x(?i)y(?=a)`, err: "inline flags (?i) are not supported before a lookahead, move them to the start of the pattern or use (?flags:...) instead"},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if _, err := compileRE2(tt.pattern); err == nil || err.Error() != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
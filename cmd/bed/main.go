@@ -0,0 +1,1274 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// ErrAborted is returned when the user discards changes instead of applying them.
+var ErrAborted = errors.New("changes discarded")
+
+// ErrNoMatches is returned when no matches are found.
+var ErrNoMatches = errors.New("no matches found")
+
+// checkError is returned when -check-only finds too many matches.
+type checkError struct {
+	n, threshold int
+}
+
+func (e *checkError) Error() string {
+	return fmt.Sprintf("check failed: %d matches found, %d allowed", e.n, e.threshold)
+}
+
+// batchWarningError is returned by an otherwise successful run in batch
+// mode if any warnings were reported, so they cannot go unnoticed.
+type batchWarningError struct {
+	n int
+}
+
+func (e *batchWarningError) Error() string {
+	return fmt.Sprintf("failed in batch mode: %d warning(s) reported", e.n)
+}
+
+// nothingToScanError is returned when a path list is empty or every path
+// is excluded or empty, so there is nothing to scan.
+type nothingToScanError struct {
+	paths, excluded, empty int
+}
+
+func (e *nothingToScanError) Error() string {
+	if e.paths == 0 {
+		return "nothing to scan: path list is empty"
+	}
+	return fmt.Sprintf("nothing to scan: %d path(s) given, %d excluded & %d empty", e.paths, e.excluded, e.empty)
+}
+
+// exitCode returns the process exit code for an error returned by Run.
+func exitCode(err error) int {
+	switch err := err.(type) {
+	case nil:
+		return ExitOK
+	case *checkError:
+		return ExitNoMatch
+	case *nothingToScanError:
+		return ExitNothing
+	case *editorError:
+		if err.exited {
+			return ExitAborted
+		}
+	}
+
+	switch err {
+	case ErrNoMatches:
+		return ExitNoMatch
+	case ErrAborted:
+		return ExitAborted
+	default:
+		return ExitError
+	}
+}
+
+func Run(args []string) (err error) {
+	// Read arguments from argument files, e.g. "bed @rename.args".
+	if args, err = expandArgsFiles(args); err != nil {
+		return err
+	}
+
+	// Export spans of the run to an OTLP endpoint, if configured.
+	if tracing, err = startTracing(commandName(args)); err != nil {
+		return err
+	}
+	defer func() { tracing.finish(err) }()
+
+	// Execute subcommand, if specified. Otherwise search & edit matches.
+	if len(args) > 0 {
+		switch args[0] {
+		case "search":
+			return RunSearch(args[1:])
+		case "apply":
+			return RunApply(args[1:])
+		case "upgrade":
+			return RunUpgrade(args[1:])
+		case "doctor":
+			return RunDoctor(args[1:])
+		case "campaign":
+			return RunCampaign(args[1:])
+		case "resume":
+			return RunResume(args[1:])
+		case "sessions":
+			return RunSessions(args[1:])
+		case "merge":
+			return RunMerge(args[1:])
+		case "split":
+			return RunSplit(args[1:])
+		case "audit":
+			return RunAudit(args[1:])
+		case "gen-docs":
+			return RunGenDocs(args[1:])
+		}
+	}
+	return RunEdit(args)
+}
+
+// RunEdit executes the default command which finds matches, opens them in
+// an editor & applies the changes once the editor exits.
+func RunEdit(args []string) (err error) {
+	// Parse command line flags.
+	fs := flag.NewFlagSet("bed", flag.ContinueOnError)
+	sf := newSearchFlags(fs)
+	af := newApplyFlags(fs)
+	ef := newEditFlags(fs)
+	lf := newLogFlags(fs)
+	tracePath := fs.String("trace", "", "")
+	configPath := fs.String("config", "", "")
+	profile := fs.String("profile", "", "")
+	showVersion := fs.Bool("version", false, "")
+	jsonOutput := fs.Bool("json", false, "")
+	stats := newRunStats()
+	fs.Usage = usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if *showVersion {
+		return writeVersion(os.Stdout, *jsonOutput)
+	} else if fs.NArg() == 0 && !sf.ingests() {
+		fs.Usage()
+		return flag.ErrHelp
+	} else if fs.NArg() > 0 && sf.ingests() {
+		return fmt.Errorf("%s reads matches from STDIN & takes no pattern or paths", sf.ingestFlag())
+	} else if *ef.stdinMode && fs.NArg() != 1 {
+		return errors.New("-stdin reads text from STDIN & takes a pattern but no paths")
+	}
+
+	ef.resolve(fs, lf)
+	reportOpt := reportOptions{Plain: *ef.plain, Less: pathLess(*sf.sort), Pattern: fs.Arg(0)}
+
+	if err := ef.validateFlags(sf, af); err != nil {
+		return err
+	} else if err := af.validateFlags(); err != nil {
+		return err
+	} else if err := sf.validateFlags(*ef.dryRun); err != nil {
+		return err
+	} else if err := lf.validateFlags(); err != nil {
+		return err
+	}
+
+	// Open the log & then operate on another git worktree, if specified. The
+	// log is opened first so its path is relative to the working directory.
+	closeLog, err := lf.open()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	if *ef.batch {
+		defer func() {
+			if err == nil && warnCount > 0 {
+				err = &batchWarningError{n: warnCount}
+			}
+		}()
+	}
+	if err := sf.chdir(); err != nil {
+		return err
+	}
+
+	// Record per-file timings when debugging & write a trace, if specified.
+	stopTrace, err := startTrace(*tracePath)
+	if err != nil {
+		return err
+	}
+	defer stopTrace()
+	if lf.debug() || *ef.statsFormat != "" {
+		timings := &bed.Timings{}
+		sf.timings, af.timings = timings, timings
+		if lf.debug() {
+			defer logTimings(timings)
+		}
+	}
+
+	// Show apply progress for screen readers in plain mode & never in batch
+	// mode, where output is read by other programs.
+	af.plain, af.noProgress = *ef.plain, *ef.batch
+
+	// Read configuration file.
+	config, err := ReadConfigFile(*configPath, *profile)
+	if err != nil {
+		return err
+	}
+	sf.config = config
+
+	// Use conservative options in safe mode, including confirming changes
+	// unless they cannot be confirmed in batch mode.
+	if af.setSafe(fs, config) && !isFlagSet(fs, "confirm") && (!*ef.batch || *ef.promptFD >= 0) {
+		*ef.confirm = true
+	}
+
+	// Record checksums of searched files to detect changes before apply &
+	// before a kept editing session is resumed.
+	sf.checksums = make(map[string]uint32)
+	af.checksums = sf.checksums
+
+	// Ensure an editor is set. If there is no terminal to run an editor in
+	// anyway then fall back to writing a match file which can be edited &
+	// applied later.
+	editor, _ := lookupEditor(*ef.editor, config.Editor)
+	fallback, err := ef.fallback(editor)
+	if err != nil {
+		return err
+	}
+
+	// Remind about stale editing sessions before starting another one.
+	if editor != "" && !*ef.batch && !*ef.dryRun && !ef.replaceMode && !*ef.mark && *ef.output == "" {
+		if wd, err := os.Getwd(); err == nil {
+			remindSessions(os.Stderr, wd)
+		}
+	}
+
+	// Watch the paths & start an edit session whenever new matches appear,
+	// if specified. Sessions run bed again, without watching.
+	if *ef.watch && os.Getenv(watchSessionEnv) == "" {
+		if fallback {
+			return errors.New("EDITOR must be set")
+		}
+		return runWatch(fs, sf, af, args, *ef.watchInterval)
+	}
+
+	// Rename files whose paths match instead of editing their contents, if
+	// specified.
+	if *ef.names {
+		return ef.runNames(fs, sf, editor)
+	}
+
+	// Read the text to edit from STDIN into a temporary file, if specified.
+	// The text is written to STDOUT, with any changes, once the run is
+	// complete, even if there were no matches, unless the run fails.
+	pattern, paths := searchArgs(fs)
+	if *ef.stdinMode {
+		stdinPath, e := readStdinFile(*ef.tmpExt)
+		if e != nil {
+			return e
+		}
+		defer os.RemoveAll(filepath.Dir(stdinPath))
+		if !*ef.dryRun {
+			defer func() {
+				if err == nil || err == ErrNoMatches {
+					if e := writeStdinFile(os.Stdout, stdinPath); e != nil {
+						err = e
+					}
+				}
+			}()
+		}
+		paths = []string{stdinPath}
+	}
+
+	// Find all matches & notify once a long scan finishes, if specified.
+	// Remote files are downloaded to a local mirror, which is removed once
+	// the run is complete.
+	remote := &remoteFiles{}
+	defer remote.close()
+	sf.remote = remote
+	scanStart := time.Now()
+	re, matches, err := sf.search(pattern, paths)
+	af.notifyEvent(newNotification(NotifyScan, matches, scanStart, err))
+	if err != nil {
+		return err
+	} else if remote.used() && (*ef.mark || *ef.output != "" || fallback || *af.stage || *af.commit != "" || *af.checkpoint || af.emits()) {
+		return errors.New("remote paths cannot be used with -q, -o, -stage, -commit, -checkpoint, -emit-script or -emit-suggestions or without an editor")
+	}
+
+	// Record the run in the campaign's history once it is complete, if
+	// specified. Runs which fail or are aborted are not recorded.
+	if *ef.campaign != "" {
+		defer func() {
+			if _, ok := err.(*checkError); ok || err == nil || err == ErrNoMatches {
+				if err := recordCampaignRun(*ef.campaignFile, *ef.campaign, fs.Arg(0), stats); err != nil {
+					warnf("cannot record campaign run: %s", err)
+				}
+			}
+		}()
+	}
+
+	// Write a summary of the run to STDERR once it is complete, if requested.
+	stats.found(matches, sf.timings, sf.emptyFiles)
+	if *ef.statsFormat != "" {
+		defer stats.write(os.Stderr, *ef.statsFormat)
+	}
+
+	// Show & edit the matches of remote files with their remote paths.
+	remote.display(matches)
+
+	// If a dry run, simply print out matches to STDOUT.
+	if *ef.dryRun {
+		return ef.report(matches, reportOpt)
+	} else if len(matches) == 0 {
+		return ErrNoMatches
+	}
+
+	// Open the locations of matches in the editor to be edited in place, if
+	// marking. Changes are never applied by bed in this mode.
+	if *ef.mark {
+		return markMatches(editor, *ef.markServer, *ef.waitFlag, matches)
+	}
+
+	// Replace matches using the template for each file's extension, if
+	// configured, or the template specified on the command line.
+	if ef.replaceMode {
+		replaceMatches(re, matches, *ef.replace, config)
+	}
+
+	// Write matches to a match file instead of editing, if requested or if
+	// no editor is available.
+	matchFileOpt := bed.WriteOptions{Header: *ef.header, Encoding: *ef.encode}
+	if *ef.output != "" {
+		return WriteMatchFilePath(*ef.output, matches, matchFileOpt, *ef.relative)
+	} else if fallback {
+		return writeFallbackMatchFile(matches, matchFileOpt, *ef.relative)
+	}
+
+	// Report files which cannot be written before spending time editing.
+	if err := af.checkPermissions(remote.localMatches(matches)); err != nil {
+		return err
+	}
+
+	// Open prompter if any questions will be asked.
+	var p prompter
+	if *ef.patch || *ef.confirm || *af.readOnly == ReadOnlyPrompt {
+		var closer io.Closer
+		if p, closer, err = openPrompter(*ef.promptFD, *ef.promptJSON); err != nil {
+			return err
+		}
+		defer closer.Close()
+	}
+
+	// Edit matches & then skip matches which were left unchanged. Changes to
+	// remote files are applied to their local mirrors.
+	newMatches, err := ef.edit(editor, matches, p, editOptions{
+		PerFile:       *ef.perFile,
+		TmpExt:        *ef.tmpExt,
+		TmpExtDefault: *ef.tmpExtDefault,
+		WaitFlag:      *ef.waitFlag,
+		MatchFile:     matchFileOpt,
+		Checksums:     sf.checksums,
+	})
+	if err != nil {
+		return err
+	}
+	newMatches = bed.RemoveSkipped(newMatches)
+	remote.localize(newMatches)
+
+	// Check files before any are written & confirm the changes, if specified.
+	if newMatches, err = af.preflight(newMatches, config, p); err != nil {
+		return err
+	} else if err := ef.confirmChanges(p, newMatches); err != nil {
+		return err
+	}
+
+	// Apply changes, recording the pattern for -commit.
+	af.pattern = fs.Arg(0)
+	if *ef.statsFormat != "" || *ef.campaign != "" {
+		if err := stats.applied(newMatches); err != nil {
+			return err
+		}
+	}
+	if err := af.apply(newMatches, config); err != nil {
+		return err
+	}
+	return remote.upload(newMatches)
+}
+
+// runWatch watches the paths searched by the default command & starts an
+// edit session with args whenever new matches appear.
+func runWatch(fs *flag.FlagSet, sf *searchFlags, af *applyFlags, args []string, interval time.Duration) error {
+	pattern, paths := searchArgs(fs)
+	for _, path := range paths {
+		if _, _, ok := parseRemotePath(path); ok {
+			return fmt.Errorf("-watch cannot watch remote path: %s", path)
+		}
+	}
+	return watchMatches(sf, pattern, paths, watchOptions{Args: args, Interval: interval, Notify: af.notifyEvent})
+}
+
+// editFlags are the command line flags of the default command which are not
+// shared with the search & apply commands.
+type editFlags struct {
+	dryRun         *bool
+	format         *string
+	checkOnly      *bool
+	checkThreshold *int
+	perFile        *bool
+	tmpExt         *string
+	tmpExtDefault  *string
+	replace        *string
+	waitFlag       *string
+	editor         *string
+	header         *string
+	encode         *string
+	relative       *bool
+	mark           *bool
+	names          *bool
+	stdinMode      *bool
+	watch          *bool
+	watchInterval  *time.Duration
+	batch          *bool
+	markServer     *string
+	patch          *bool
+	tuiMode        *bool
+	inline         *bool
+	confirm        *bool
+	diffUnit       *string
+	diffAlgorithm  *string
+	promptFD       *int
+	promptJSON     *bool
+	output         *string
+	plain          *bool
+	statsFormat    *string
+	campaign       *string
+	campaignFile   *string
+
+	// Set if -replace was specified, since the replacement may be blank.
+	replaceMode bool
+}
+
+// newEditFlags registers the flags of the default command on fs.
+func newEditFlags(fs *flag.FlagSet) *editFlags {
+	f := &editFlags{
+		dryRun:         fs.Bool("dry-run", false, ""),
+		format:         fs.String("format", "text", ""),
+		checkOnly:      fs.Bool("check-only", false, ""),
+		checkThreshold: fs.Int("check-threshold", 0, ""),
+		perFile:        fs.Bool("per-file", false, ""),
+		tmpExt:         fs.String("tmp-ext", "", ""),
+		tmpExtDefault:  fs.String("tmp-ext-default", "", ""),
+		replace:        fs.String("replace", "", ""),
+		waitFlag:       fs.String("wait-flag", "", ""),
+		editor:         fs.String("editor", "", ""),
+		header:         fs.String("header", bed.HeaderJSON, ""),
+		encode:         fs.String("encode", "", ""),
+		relative:       fs.Bool("relative", false, ""),
+		mark:           fs.Bool("q", false, ""),
+		names:          fs.Bool("names", false, ""),
+		stdinMode:      fs.Bool("stdin", false, ""),
+		watch:          fs.Bool("watch", false, ""),
+		watchInterval:  fs.Duration("watch-interval", time.Second, ""),
+		batch:          fs.Bool("batch", false, ""),
+		markServer:     fs.String("q-server", "", ""),
+		patch:          fs.Bool("patch", false, ""),
+		tuiMode:        fs.Bool("tui", false, ""),
+		inline:         fs.Bool("inline", false, ""),
+		confirm:        fs.Bool("confirm", false, ""),
+		diffUnit:       fs.String("diff-unit", DiffUnitLine, ""),
+		diffAlgorithm:  fs.String("diff-algorithm", DiffMyers, ""),
+		promptFD:       fs.Int("prompt-fd", -1, ""),
+		promptJSON:     fs.Bool("prompt-json", false, ""),
+		output:         fs.String("o", "", ""),
+		plain:          fs.Bool("plain", false, ""),
+		statsFormat:    fs.String("stats", "", ""),
+		campaign:       fs.String("campaign", "", ""),
+		campaignFile:   fs.String("campaign-file", DefaultCampaignFile, ""),
+	}
+	fs.BoolVar(f.patch, "p", false, "")
+	return f
+}
+
+// resolve sets flags which are implied by other flags once fs is parsed.
+func (f *editFlags) resolve(fs *flag.FlagSet, lf *logFlags) {
+	f.replaceMode = isFlagSet(fs, "replace")
+
+	// The full screen interface cannot be used in plain mode so matches are
+	// reviewed one at a time instead.
+	if *f.plain && *f.tuiMode {
+		*f.tuiMode, *f.patch = false, true
+	}
+
+	// Log JSON in batch mode so logs can be parsed, unless specified.
+	if *f.batch && !isFlagSet(fs, "log-format") {
+		*lf.format = "json"
+	}
+
+	// Loading matches into a Vim server only marks them.
+	if *f.markServer != "" {
+		*f.mark = true
+	}
+
+	// Any output format other than the default implies a dry run, as does
+	// checking for matches.
+	if *f.format != "text" || *f.checkOnly {
+		*f.dryRun = true
+	}
+}
+
+// validateFlags returns an error if any flag values are invalid or conflict
+// with each other or with the search & apply flags.
+func (f *editFlags) validateFlags(sf *searchFlags, af *applyFlags) error {
+	if !validFormat(*f.format) {
+		return fmt.Errorf("unknown format: %q", *f.format)
+	} else if !validStatsFormat(*f.statsFormat) {
+		return fmt.Errorf("unknown stats format: %q", *f.statsFormat)
+	} else if !bed.ValidHeaderFormat(*f.header) {
+		return fmt.Errorf("unknown header format: %q", *f.header)
+	} else if !bed.ValidEncoding(*f.encode) {
+		return fmt.Errorf("unknown encoding: %q", *f.encode)
+	} else if !validDiffUnit(*f.diffUnit) {
+		return fmt.Errorf("unknown diff unit: %q", *f.diffUnit)
+	} else if !validDiffAlgorithm(*f.diffAlgorithm) {
+		return fmt.Errorf("unknown diff algorithm: %q", *f.diffAlgorithm)
+	} else if *f.watchInterval <= 0 {
+		return errors.New("-watch-interval must be positive")
+	}
+
+	// Check modes which replace editing or require a terminal.
+	if *f.mark && (f.replaceMode || *f.tuiMode || *f.patch || *f.output != "") {
+		return errors.New("-q cannot be used with -replace, -tui, -patch or -o")
+	} else if *f.names && (*f.mark || *f.tuiMode || *f.patch || *f.output != "") {
+		return errors.New("-names cannot be used with -q, -tui, -patch or -o")
+	} else if *f.names && sf.ingests() {
+		return errors.New("-names cannot be used with -from-rg or -from-grep")
+	} else if *f.inline && (*f.mark || *f.names || *f.tuiMode || *f.patch || f.replaceMode || *f.output != "") {
+		return errors.New("-inline cannot be used with -q, -names, -tui, -patch, -replace or -o")
+	} else if *f.batch && (*f.tuiMode || *f.inline || *f.mark) {
+		return errors.New("-batch cannot be used with -tui, -inline or -q, which require a terminal")
+	} else if *f.batch && *f.promptFD < 0 && (*f.patch || *f.confirm || *af.readOnly == ReadOnlyPrompt) {
+		return errors.New("-batch cannot be used with -patch, -confirm or -readonly prompt unless prompts are answered with -prompt-fd")
+	}
+
+	// Check modes which read their input differently.
+	if *f.stdinMode && (*sf.pathsFile != "" || *sf.legacyStdin || sf.ingests() || *sf.git || *sf.rev != "" || *sf.cached || *f.names || *f.mark || *f.output != "") {
+		return errors.New("-stdin cannot be used with -paths, -legacy-stdin, -from-rg, -from-grep, -git, -rev, -cached, -names, -q or -o")
+	} else if *f.stdinMode && (*af.stage || *af.commit != "" || *af.checkpoint || af.emits()) {
+		return errors.New("-stdin cannot be used with -stage, -commit, -checkpoint, -emit-script or -emit-suggestions")
+	} else if *f.watch && (*f.stdinMode || *sf.pathsFile == "-" || *sf.legacyStdin || sf.ingests() || *sf.rev != "" || *sf.cached || *f.names || *f.mark || *f.output != "") {
+		return errors.New("-watch cannot be used with -stdin, -paths -, -legacy-stdin, -from-rg, -from-grep, -rev, -cached, -names, -q or -o")
+	}
+	return nil
+}
+
+// fallback returns true if a match file should be written instead of
+// editing because no editor is set & there is no terminal to run one in.
+func (f *editFlags) fallback(editor string) (bool, error) {
+	if editor != "" || *f.dryRun || *f.tuiMode || *f.inline || f.replaceMode || *f.mark || *f.output != "" {
+		return false, nil
+	} else if *f.batch {
+		return false, errors.New("-batch requires -replace, -dry-run, -o or a non-interactive editor command")
+	} else if *f.names || *f.stdinMode || hasTTY() {
+		return false, errors.New("EDITOR must be set")
+	}
+	return true, nil
+}
+
+// runNames renames files whose paths match instead of editing their contents.
+func (f *editFlags) runNames(fs *flag.FlagSet, sf *searchFlags, editor string) error {
+	opt := nameOptions{Editor: editor, WaitFlag: *f.waitFlag, Template: *f.replace, Replace: f.replaceMode, DryRun: *f.dryRun}
+	if *f.confirm {
+		p, closer, err := openPrompter(*f.promptFD, *f.promptJSON)
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		opt.Confirm = p
+	}
+	return renameFiles(sf, fs.Arg(0), fs.Args()[1:], opt)
+}
+
+// report writes matches to STDOUT for a dry run. When checking, an error is
+// returned if there are more matches than the threshold allows.
+func (f *editFlags) report(matches []*bed.Match, opt reportOptions) error {
+	if err := writeMatches(os.Stdout, *f.format, matches, opt); err != nil {
+		return err
+	} else if *f.checkOnly && len(matches) > *f.checkThreshold {
+		return &checkError{n: len(matches), threshold: *f.checkThreshold}
+	} else if len(matches) == 0 && !*f.checkOnly {
+		return ErrNoMatches
+	}
+	return nil
+}
+
+// edit edits matches in the terminal interface, one at a time, or all at
+// once in the editor & returns the edited matches. Replaced matches are
+// returned unchanged.
+func (f *editFlags) edit(editor string, matches []*bed.Match, p prompter, opt editOptions) (newMatches []*bed.Match, err error) {
+	var edit *span
+	if !f.replaceMode {
+		edit = tracing.start("session")
+	}
+	switch {
+	case *f.tuiMode:
+		if newMatches, err = runTUI(matches); err == nil && newMatches == nil {
+			err = ErrAborted
+		}
+	case *f.inline:
+		newMatches, err = runInline(matches)
+	case *f.patch:
+		newMatches, err = patchMatches(p, os.Stderr, matches, func(m *bed.Match) ([]*bed.Match, error) {
+			return editMatches(editor, []*bed.Match{m}, opt)
+		})
+	case f.replaceMode:
+		newMatches = matches
+	default:
+		newMatches, err = editMatches(editor, matches, opt)
+	}
+	edit.setMatches(bed.RemoveSkipped(newMatches))
+	edit.finish(err)
+	return newMatches, err
+}
+
+// confirmChanges shows a diff of the pending changes & asks for confirmation,
+// if specified. The diff is written to STDERR with -stdin since the text is
+// written to STDOUT.
+func (f *editFlags) confirmChanges(p prompter, matches []*bed.Match) error {
+	if !*f.confirm {
+		return nil
+	}
+
+	w := os.Stdout
+	if *f.stdinMode {
+		w = os.Stderr
+	}
+	if err := writeMatchesDiff(w, matches, diffOptions{
+		Unit:      *f.diffUnit,
+		Algorithm: *f.diffAlgorithm,
+		Color:     !*f.plain && useColor(w),
+	}); err != nil {
+		return err
+	}
+
+	if answer, err := p.Prompt(&Prompt{
+		Message: "Apply these changes",
+		Choices: []string{"y", "n"},
+		Help:    "y - apply changes\nn - discard changes\n",
+	}); err != nil {
+		return err
+	} else if answer != "y" {
+		return ErrAborted
+	}
+	return nil
+}
+
+// commandName returns the name of the command run with args, e.g.
+// "bed apply" or "bed" for a search.
+func commandName(args []string) string {
+	if len(args) > 0 {
+		for _, doc := range commandDocs() {
+			if doc.Name == "bed "+args[0] {
+				return doc.Name
+			}
+		}
+	}
+	return "bed"
+}
+
+// readPathList returns the newline-separated list of paths in the file at
+// path. If path is "-" then the list is read from STDIN. Blank lines are ignored.
+func readPathList(path string) ([]string, error) {
+	var buf []byte
+	var err error
+	if path == "-" {
+		buf, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		buf, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(buf), "\n") {
+		if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+func usage() {
+	writeUsage(os.Stderr, mainDoc)
+}
+
+var mainDoc = &commandDoc{
+	Name:  "bed",
+	Short: "bulk command line text editor",
+	Long:  "bed is a bulk command line text editor.",
+	Synopsis: []string{
+		"bed [arguments] pattern path [paths]",
+		"bed [arguments] -paths FILE pattern [paths]",
+		"rg --json pattern [paths] | bed [arguments] -from-rg",
+		"grep -Hn pattern paths | bed [arguments] -from-grep",
+		"command | bed [arguments] -stdin pattern | command",
+		"bed [arguments] -watch pattern path [paths]",
+		"bed -version [-json]",
+		"bed search [arguments] pattern path [paths] > matchfile",
+		"bed apply [arguments] matchfile [matchfiles]",
+		"bed merge [arguments] matchfile [matchfiles]",
+		"bed split [arguments] matchfile",
+		"bed doctor [arguments]",
+		"bed resume [arguments] [ID]",
+		"bed sessions [arguments]",
+		"bed campaign list|report [arguments]",
+		"bed audit [arguments] [paths]",
+		"bed upgrade [arguments]",
+		"bed gen-docs DIR",
+	},
+	Sections: []docSection{
+		{Text: `The command will match pattern against all provided paths and output
+a series of files which contain matches. This list of matches can be
+passed to an interactive editor such as vi for edits. If the editor
+is closed with a 0 exit code then all changes to the matches are
+applied to the original files.`},
+		{Text: `Bed's own files, such as match files in the temp directory & files
+written while applying changes, are never scanned or edited so a scan
+of the temp directory cannot corrupt an editing session in progress.`},
+		{Text: `If the editor fails after matches were edited, such as when it crashes,
+the match files are kept along with any swap files left by the editor
+& the "resume" command reopens them & applies the changes. The
+"sessions" command lists kept sessions, which expire after 7 days.`},
+		{Text: `The search, edit & apply stages can also be run separately. The
+"search" command writes matches to a match file which can be edited at
+leisure & the "apply" command applies the changes in edited match files
+without searching or opening an editor.`},
+		{Text: `The "doctor" command reports diagnostics about the environment, such as
+how the editor is resolved, the "campaign" command reports the progress
+of runs recorded with -campaign, the "merge" & "split" commands combine
+& divide match files, the "audit" command writes a signed report of the
+matches of configured patterns without editing, the "upgrade" command
+replaces bed with the latest release & the "gen-docs" command writes
+man pages & examples.
+To search for a pattern with the same name as a command, place "--"
+before the pattern.`},
+		{Text: `An argument of the form @FILE is replaced by the arguments listed in
+FILE, one per line, so long or complex invocations can be kept in a
+file & shared, e.g. "bed @rename.args". Surrounding whitespace is
+trimmed & blank lines & lines beginning with "#" are ignored. Paths
+are relative to the current directory. Arguments are not split on
+spaces, so a line such as "-replace" is followed by its value on the
+next line. To pass an argument beginning with "@", write "@@" instead
+or place it after "--".`},
+		{Text: `Paths of the form [user@]host:/path, such as
+"root@web1:/etc/nginx/nginx.conf", refer to files on other hosts, so
+config files across servers can be edited in one session with the
+local editor. Remote files are downloaded with the sftp command, using
+the SSH configuration & keys as ssh does, & changed files are uploaded
+once changes are applied, to a temporary file which is given the mode
+of the original & renamed over it. Uploaded files are owned by the SSH
+user since their ownership cannot be kept. Files which changed on their
+host since they were downloaded are not overwritten. Authentication must not require a
+password. Remote paths cannot be used with -q, -o, -stage, -commit,
+-checkpoint, -emit-script or -emit-suggestions.`},
+		{Text: `The editor is set with -editor or the "editor" configuration key or
+read from the BED_EDITOR, VISUAL or EDITOR environment variables, in
+that order. Temporary file paths are appended to the editor command
+unless it contains a "{}" placeholder, in which case the placeholder is
+replaced by the paths (e.g. BED_EDITOR="code --wait {} --reuse-window").
+On Windows, the editor is split into words like a command line, so
+backslashes in paths are kept, & batch files such as code.cmd are run
+with "cmd /C".`},
+		{Text: `GUI editors usually return immediately unless they are passed a flag to
+wait for the file to be closed. This flag is added automatically for
+common editors (e.g. code, subl, atom, gvim) or can be set with the
+-wait-flag argument.`},
+		{Text: `Lookbehinds at the start of the pattern, such as "(?<=x)" or "(?<!x)",
+& lookaheads at the end, such as "(?=x)" or "(?!x)", are supported by
+the default engine so text can be matched by its context without
+including the context in the match (e.g. "foo(?=\()" only matches foo
+when it is called). Flags at the start of the pattern, such as "(?i)",
+also apply to its lookarounds. If the lookaheads fail, shorter matches
+at the same position are tried, longest first, as for a greedy pattern
+(e.g. "\w+(?!;)" matches "ab" in "abc;"). Flags set before a lookahead
+elsewhere in the pattern & lookarounds elsewhere require -engine pcre.`},
+		{Text: `If the OTEL_EXPORTER_OTLP_ENDPOINT or
+OTEL_EXPORTER_OTLP_TRACES_ENDPOINT environment variable is set, every
+command records OpenTelemetry spans for its scan, editing session &
+apply, with file counts & byte sizes as attributes, & exports them as
+OTLP/HTTP JSON once it completes. OTEL_EXPORTER_OTLP_HEADERS,
+OTEL_SERVICE_NAME & OTEL_SDK_DISABLED are also supported. Spans join
+the trace in the TRACEPARENT environment variable, if set, so runs
+started by a traced program appear within its traces.`},
+		{
+			Text: `A match block can be replaced by a directive on a line by itself to
+perform an action other than a text replacement:`,
+			Items: []docItem{
+				{Name: "#bed:delete", Text: "Remove the matched text."},
+				{Name: "#bed:delete-line", Text: "Remove every line containing the matched text."},
+				{Name: "#bed:skip", Text: "Leave the matched text unchanged, regardless of edits."},
+				{Name: "#bed:delete-file", Text: "Delete the file containing the match when changes are applied."},
+			},
+		},
+		{Text: `The text of a match is every line between the #bed:begin & #bed:end
+lines, excluding the newline before #bed:end, so a match which ends
+with a newline has a blank last line. Lines of matched text which begin
+with "#bed:", such as a line containing "#bed:end", are written with a
+"#bed:\" prefix which is removed when changes are applied, so the
+text is preserved exactly.`},
+		{Text: `Matches in files which only use CRLF line endings are edited with LF
+line endings, so editors on any platform show them the same way, &
+CRLF line endings are restored when changes are applied. Files with
+mixed line endings are edited as they are.`},
+		{Text: `A UTF-8 or UTF-16 byte order mark at the start of a file is removed
+before matching, so patterns anchored with ^ match the first line &
+positions start at the first character, & is restored when changes are
+applied. Files with a UTF-16 byte order mark are decoded to UTF-8, as
+with -encoding.`},
+		{
+			Text: `The configuration file is a JSON object which supports the following
+keys:`,
+			Items: []docItem{
+				{Name: "order", Text: `A list of {"before": GLOB, "after": GLOB} rules. Files
+matching "before" are written before files matching "after".
+Globs without a "/" match against the file's base name.`},
+				{Name: "replace", Text: `A map of file extensions to templates used by -replace for
+files with that extension (e.g. {".py": "# $0"}).`},
+				{Name: "regen", Text: `A list of {"glob": GLOB, "command": CMD} rules. After
+changes are applied, CMD is run once if any modified file
+matches GLOB (e.g. "go generate ./...").`},
+				{Name: "post_apply", Text: `A list of {"glob": GLOB, "command": CMD} rules. After
+changes are applied, CMD is run on each modified file which
+matches GLOB, or on every modified file if GLOB is blank,
+before regen commands (e.g. {"glob": "*.go", "command":
+"gofmt -w {}"}). See -post-apply.`},
+				{Name: "protect", Text: `A list of globs of paths which must not be modified, such as
+"vendor" or "*.lock". Globs also match the directories which
+contain a path. Changes to protected files are skipped with a
+warning, or cause an error with -safe.`},
+				{Name: "validate", Text: `A command run to validate the changes applied to a canary
+with -canary (e.g. "go test ./...").`},
+				{Name: "safe", Text: `If true, every run uses the options of -safe.`},
+				{Name: "editor", Text: `The editor command used unless -editor is set. Overrides
+BED_EDITOR, VISUAL & EDITOR.`},
+				{Name: "include", Text: `A list of globs of paths to scan. Other paths are excluded,
+e.g. ["*.md", "docs"] to only edit documentation.`},
+				{Name: "audit", Text: `A list of {"name": NAME, "pattern": REGEX} rules reported
+by the "audit" command.`},
+				{Name: "profiles", Text: `A map of profile names to objects with any of the keys above,
+selected with -profile NAME. Keys set in the profile override
+the keys above, except "replace" templates which are merged &
+"safe" which is used if either sets it. For example:
+{"profiles": {"docs": {"editor": "code --wait",
+"include": ["*.md"]}}}`},
+			},
+		},
+		{
+			Text: `The exit code is one of the following, similar to grep:`,
+			Items: []docItem{
+				{Name: "0", Text: "Matches were found & changes, if any, were applied."},
+				{Name: "1", Text: "No matches were found or a -check-only check failed."},
+				{Name: "2", Text: "An error occurred."},
+				{Name: "3", Text: `Editing was aborted, such as when the editor exits with a
+non-zero code (e.g. ":cq" in vi) or changes are discarded.`},
+				{Name: "4", Text: `There was nothing to scan because the path list was empty
+or every path was excluded or an empty file.`},
+			},
+		},
+	},
+	Flags: []docItem{
+		{Name: "-paths FILE", Text: `Read additional newline-separated paths from FILE. If FILE
+is "-" then paths are read from STDIN.`},
+		{Name: "-legacy-stdin", Text: `Read paths from STDIN whenever it is not a terminal, as in
+earlier versions of bed. Prefer "-paths -" instead.`},
+		{Name: "-stdin", Text: `Search & edit the text read from STDIN instead of files & write
+it to STDOUT with any changes, so bed can be used as a filter in
+the middle of a pipeline, e.g. "curl URL | bed -stdin -replace
+bar foo | jq". The text is written unchanged if there are no
+matches & nothing is written if editing is aborted or fails.
+The editor is attached to the terminal. Use -tmp-ext to set the
+extension of the text for syntax highlighting. Diffs shown by
+-confirm are written to STDERR.`},
+		{Name: "-watch", Text: `Keep running & scan the paths again whenever a file changes,
+starting an edit session each time new matches appear, so a
+pattern can be stamped out while a codebase is migrated. Files
+are checked for changes by their size & modification time.
+Matches left unchanged in a session are not edited again until
+more matches of the same text appear in their file. The -notify
+command is sent a "watch" event when new matches appear. Files
+added to a path list or tracked by git with -git are watched as
+well. Press Ctrl-C to stop watching.`},
+		{Name: "-watch-interval DURATION", Text: `How often -watch checks files for changes. Defaults to "1s".`},
+		{Name: "-config PATH", Text: `Read configuration from PATH. Defaults to .bed.json in the
+current directory or in the home directory, if present.`},
+		{Name: "-profile NAME", Text: `Use the settings of profile NAME from the configuration
+file, such as a different editor, include globs & regen
+commands. See "profiles" above.`},
+		{Name: "-v", Text: `Enable verbose logging. Shorthand for -log-level debug.`},
+		{Name: "-log-level LEVEL", Text: `Log messages at or above LEVEL, which is "debug", "info" or
+"warn". Debug logs the time spent reading, matching & writing
+each file. Info logs each file changed & files which are much
+slower than the rest, such as huge files or slow network mounts.
+Defaults to "info" when logging to a file & "warn" otherwise.`},
+		{Name: "-log-file FILE", Text: `Append log messages to FILE, with timestamps, instead of
+writing them to STDERR so long runs can be audited afterward.
+Each message includes the random ID of the run, which is also
+used in temporary file names, journal entries, notifications,
+audit reports & the -stats summary to correlate them.`},
+		{Name: "-log-format FORMAT", Text: `Write log messages as "text" (default) or "json" objects with
+"time", "run", "level" & "msg" keys, one per line. Warnings are
+also logged, instead of written to STDERR, when logging JSON.`},
+		{Name: "-trace FILE", Text: `Write a Go runtime execution trace to FILE with a region for
+each file read, match & write. View it with "go tool trace".`},
+		{Name: "-version", Text: `Print the version, commit & build date and exit. Use with
+-json to print them as a JSON object.`},
+		{Name: "-stats FORMAT", Text: `Write a summary of the run to STDERR once it is complete,
+including the number of files scanned & matched, matches edited
+& skipped, bytes added & removed and the elapsed time. FORMAT is
+either "text" or "json".`},
+		{Name: "-campaign NAME", Text: `Record the pattern & the number of matches found & fixed by
+this run in the history of campaign NAME. View the progress of
+campaigns with "bed campaign report NAME".`},
+		{Name: "-campaign-file PATH", Text: `Record campaign runs in PATH instead of
+.bed/campaigns.jsonl in the current directory.`},
+		{Name: "-plain", Text: `Produce plain, line-oriented output for screen readers. Disables
+color & box drawing characters in reports & diffs. The -tui
+interface is replaced by reviewing matches one at a time, as
+with -p, & apply progress is written as a line at every 10%
+instead of redrawing a progress bar.`},
+		{Name: "-dry-run", Text: "Only show matches without outputting to files."},
+		{Name: "-o FILE", Text: `Write matches to FILE as a match file instead of opening an
+editor. The file can be edited & then applied with "bed apply".
+If FILE is "-" then matches are written to STDOUT. This is done
+automatically, using a temporary file, if no editor is set & no
+terminal is available.`},
+		{Name: "-q", Text: `Open the locations of matches in the editor to be edited in
+place instead of in a match file, such as in the quickfix list
+with vim -q or with code --goto. Changes are not applied by bed.
+For other editors, or without an editor, the locations are
+written to STDOUT as "path:line:col: text" lines.`},
+		{Name: "-q-server NAME", Text: `Load the locations of matches into the quickfix list of the
+running Vim server NAME (see vim --servername). Implies -q.`},
+		{Name: "-names", Text: `Match pattern against file paths instead of file contents &
+rename files. Matching paths are written to the editor, one per
+line, & each file is renamed to its edited line. With -replace,
+files are renamed by replacing matches in their path instead.
+No files are renamed if two would get the same name or a name
+already exists. Parent directories are created as needed.`},
+		{Name: "-check-only", Text: `Report matches like -dry-run but exit with a non-zero code if
+any matches are found. Useful for enforcing banned patterns
+in CI.`},
+		{Name: "-check-threshold N", Text: "Only fail -check-only if more than N matches are found."},
+		{Name: "-format FORMAT", Text: `Output format for matches in a dry run. Available formats
+are "text" (default), "tree", "packages", "grep", which writes
+"path:line:col:text" lines with the first line of each match
+for tools which read grep's output, such as fzf, "quickfix",
+which writes "path:line:col: text" lines which can be loaded
+into Vim's quickfix list with ":cfile FILE" to review matches
+before editing them, & "sarif", which writes a SARIF 2.1.0 log
+for code scanning services, such as GitHub code scanning, with
+a result for each match. Formats other than "text" imply
+-dry-run.`},
+		{Name: "-w", Text: `Only match the pattern as a whole word, as if it were wrapped
+in \b...\b, e.g. to rename an identifier without matching
+longer identifiers which contain it.`},
+		{Name: "-engine NAME", Text: `Match the pattern with the regex engine NAME. Defaults to
+"re2", Go's linear-time engine. The "pcre" engine supports
+backreferences & lookarounds but can take exponential time on
+some patterns. It is only available if bed was built with
+"go build -tags pcre".`},
+		{Name: "-encoding CHARSET", Text: `Decode files from CHARSET to UTF-8 for matching & editing &
+encode changes back to CHARSET when they are applied. CHARSET
+is "utf-16le", "utf-16be", "latin1", "shiftjis" or "auto" to
+detect it for each file, in which case UTF-8 files are left as
+they are. Positions in the headers of transcoded matches refer
+to the decoded text & "charset" is set. Files which cannot be
+decoded & encoded back exactly are reported as errors.`},
+		{Name: "-not RE", Text: "Exclude matches whose text also matches the pattern RE."},
+		{Name: "-path-regex RE", Text: `Only scan paths matching RE, e.g. "^services/[^/]+/api/".
+Paths are matched with "/" as the separator on all platforms.`},
+		{Name: "-lines START:END", Text: `Ignore matches which do not start within lines START to END.
+Either line can be omitted, e.g. "100:" for line 100 onward. A
+range can also be given for a single path with the suffix
+":START-END", e.g. "config.yml:100-250", unless a file with that
+name exists.`},
+		{Name: "-max-count N", Text: "Only use the first N matches from each file."},
+		{Name: "-replace TEMPLATE", Text: `Replace each match with TEMPLATE instead of opening an
+editor. Submatches can be referenced with $1 or ${name}.
+Templates for specific file extensions can be set in the
+configuration file. Can be combined with -p or -confirm to
+review replacements before they are applied.`},
+		{Name: "-limit N", Text: `Stop searching once N matches have been found in total and
+warn that the results were truncated.`},
+		{Name: "-scan-budget LIMITS", Text: `Stop scanning once the total bytes read or the time spent
+reaches a limit & warn that the results are partial. LIMITS is a
+comma-separated size and/or duration, e.g. "500MB,30s". When
+scanning 10,000 or more files, their total size is estimated
+first & bed fails immediately if it exceeds the size limit.`},
+		{Name: "-sort ORDER", Text: `Sort matches by path in reports & the match file. ORDER is
+either "bytes" for a reproducible byte-wise order, such as for
+golden files, or "locale" to collate paths for humans using the
+locale set by LC_ALL, LC_COLLATE or LANG. By default, matches are
+kept in the order their paths were given.`},
+		{Name: "-rev REF", Text: `Scan file contents at the git revision REF instead of the
+working directory. Requires -dry-run or -format.`},
+		{Name: "-git", Text: `Scan exactly the files tracked by git, as listed by "git
+ls-files", instead of the paths given. Any paths given are used
+as pathspecs to limit the files, e.g. "bed -git foo src" scans
+the tracked files under src. Build artifacts & other untracked
+files are never scanned & no directories are walked. With -rev,
+the files in that revision are scanned.`},
+		{Name: "-from-rg", Text: `Read the matches found by ripgrep from the output of "rg
+--json" on STDIN instead of searching for a pattern, e.g. "rg
+--json -t go foo | bed -from-rg", so ripgrep's speed & filtering
+can be used to find matches which are then edited & applied by
+bed. No pattern or paths are given. Each match is checked
+against its file & an error is reported if the file changed
+since it was searched. With -replace, "$0" refers to the text
+of the match, since there are no submatches. Use "rg
+--multiline" for matches which span lines.`},
+		{Name: "-from-grep", Text: `Read matches from "path:line:text" lines on STDIN, as
+written by "grep -Hn", "git grep -n", ag or ack, instead of
+searching for a pattern, e.g. "git grep -n foo | bed
+-from-grep". Each line of text is found in its file, so the
+whole line is edited, or each match with "grep -o". Columns
+written with --column, as by "git grep --column" or ag, are
+used to find each match. Context lines written with -A, -B or
+-C are ignored. Paths can be separated by a NUL byte, as with
+"grep -Z" or "git grep -z", if they contain colons, although
+"git grep -z" cannot be used with context lines since they are
+written like matches. Otherwise, as with -from-rg.`},
+		{Name: "-cached", Text: `Scan the staged contents of files in the git index instead
+of the working directory. Requires -dry-run or -format.`},
+		{Name: "-worktree DIR", Text: `Scan & edit files in the git worktree at DIR instead of the
+current directory. Relative paths are resolved from DIR.`},
+		{Name: "-header FORMAT", Text: `Write the header on the #bed:begin line of each match as
+"json" (default), e.g. {"path":"main.go","pos":120,"len":14},
+"plain", e.g. path=main.go pos=120 len=14, or "yaml", a YAML
+flow mapping, e.g. {path: main.go, pos: 120, len: 14}. Plain
+values are double-quoted, with Go escapes, if they are empty or
+contain spaces, quotes, "=" or unprintable characters. YAML
+paths are double-quoted if they could be read as another type,
+such as a number. Match files are read in any format.`},
+		{Name: "-encode ENCODING", Text: `Write the text of matches which contain control characters,
+such as NUL bytes, invalid UTF-8 or lines which look like bed
+tags as "base64" in match files, wrapped at 76 columns, so
+mixed text & binary files can be edited safely. Such matches
+have "enc" set in their header & are decoded when changes are
+applied.`},
+		{Name: "-relative", Text: `Write paths in match files written with -o relative to the
+root of the git worktree, or the current directory outside of
+a worktree, & record the root at the top of the file. Such
+files can be applied from any directory of another checkout
+of the same repository.`},
+		{Name: "-editor CMD", Text: `Edit matches with the editor command CMD instead of the
+editor set in the environment, e.g. -editor "code --wait".`},
+		{Name: "-wait-flag FLAG", Text: `Pass FLAG to the editor so that it waits for files to be
+closed before returning. Detected automatically for common
+GUI editors.`},
+		{Name: "-p, -patch", Text: `Interactively walk through each match and choose to accept,
+skip or edit it before any changes are written.`},
+		{Name: "-tui", Text: `Review & edit matches in a built-in terminal interface
+instead of an external editor. Does not require EDITOR.`},
+		{Name: "-inline", Text: `Edit the text of each match in turn on a single line of the
+terminal instead of opening an editor, for quick fixes to a
+few matches. Each match is shown with its location & line.
+Press Enter to accept the text, Escape to leave the match
+unchanged or Ctrl-C to discard all changes. Ctrl-J inserts
+a newline. Limited to 20 matches. Does not require EDITOR.`},
+		{Name: "-confirm", Text: `Show a diff of all pending changes once editing is done and
+ask for confirmation before applying them.`},
+		{Name: "-diff-unit UNIT", Text: `Show changes in the -confirm diff by "line" (default), "word"
+or "char". Word & character diffs show each change as merged
+lines prefixed by "~", with removed text marked by [-...-] &
+added text by {+...+}, or in color on a terminal unless the
+NO_COLOR environment variable is set or TERM is "dumb".`},
+		{Name: "-diff-algorithm NAME", Text: `Compute the -confirm diff with the "myers" (default) or
+"histogram" algorithm. Histogram diffs align on lines which
+occur rarely, which often reads better for code.`},
+		{Name: "-prompt-fd N", Text: `Read & write interactive prompts on file descriptor N
+instead of the terminal.`},
+		{Name: "-prompt-json", Text: `Write interactive prompts as JSON objects, one per line,
+and read answers as {"answer":"..."} objects. Allows
+wrapper programs to answer prompts programmatically.`},
+		{Name: "-per-file", Text: `Write matches to one temporary file per source path and
+pass all of them to the editor.`},
+		{Name: "-readonly POLICY", Text: `How to handle read-only files. All files are checked before
+the editor is opened & read-only files cause an error unless
+POLICY is set to "skip" to leave them unchanged, "force" to
+make them writable while changes are applied & restore their
+mode afterward, or "prompt" to ask for each. Files which
+cannot be read & files to be deleted from read-only
+directories are always reported before editing. Other files
+in read-only directories are rewritten in place.`},
+		{Name: "-batch", Text: `Run non-interactively, such as in CI. Requires -replace,
+-dry-run, -o or an editor command which edits files without
+user input. Flags which require a terminal, such as -tui, or
+prompts, such as -confirm, are rejected unless prompts are
+answered with -prompt-fd. Logs are written as JSON & the run
+fails with exit code 2 if any warnings are reported.`},
+		{Name: "-safe", Text: `Use conservative options: changes are confirmed with a diff,
+except in -batch mode without -prompt-fd, files are backed up
+to .bed/backups, -drift is strict, protected paths cause an
+error & no more than 50 files can be changed. Options which are
+set explicitly are not overridden. Safe mode can be made the
+default with the "safe" configuration key.`},
+		{Name: "-backup-dir DIR", Text: `Copy the original contents of each file to a new timestamped
+directory within DIR before changes are applied.`},
+		{Name: "-drift POLICY", Text: `How to handle files which changed after they were searched,
+such as while matches were being edited. POLICY is "off"
+(default) to apply changes anyway, "skip" to leave changed
+files unchanged or "strict" to apply no changes at all.`},
+		{Name: "-max-changed-files N", Text: `Apply no changes if more than N files would be changed.`},
+		{Name: "-canary N%", Text: `Apply changes to a random N% of the changed files first, at
+least one, & run the -validate command. The remaining files
+are only changed if it succeeds. Otherwise the canary files
+are restored & no other files are changed. Useful for large,
+risky edits.`},
+		{Name: "-validate CMD", Text: `Run CMD to validate a canary, e.g. "go test ./...".
+Overrides the "validate" configuration key.`},
+		{Name: "-notify CMD", Text: `Run CMD once the scan finishes & once changes are applied or
+fail, so long runs can notify you, e.g. -notify "notify-send
+bed". A JSON summary with the "event" ("scan", "apply" or
+"watch"), "run", "status" ("ok" or "failed"), "error", "dir",
+"files", "matches" & "elapsed_seconds" is written to its STDIN
+& the event & status are set in BED_NOTIFY_EVENT &
+BED_NOTIFY_STATUS. If CMD is an http or https URL then the
+summary is posted to it as a webhook instead.`},
+		{Name: "-notify-after DURATION", Text: `Only notify about scans & applies which take at least
+DURATION, e.g. "30s". Failures are always notified.`},
+		{Name: "-post-apply CMD", Text: `Run CMD on each modified file after changes are applied,
+such as a formatter, e.g. -post-apply "gofmt -w {}". Any "{}"
+is replaced by the file's path, otherwise the path is
+appended. Runs after the "post_apply" configuration rules &
+before regen commands. Deleted files are skipped.`},
+		{Name: "-verify CMD", Text: `Run CMD after changes are applied & post-apply commands have
+run, e.g. -verify "go build ./...". If CMD fails then every
+changed file is rolled back to its original contents & the
+changes at the locations CMD reported, such as "main.go:12",
+are listed. Regen commands only run once changes are
+verified.`},
+		{Name: "-stage", Text: `Add every file bed modifies to the git index once changes are
+applied, so they can be reviewed with "git diff --cached".
+Deleted files are removed from the index. Files changed by
+regen commands are not staged.`},
+		{Name: "-commit MESSAGE", Text: `Stage & commit every file bed modifies in a single git commit
+once changes are applied, e.g. -commit "rename {pattern}".
+Other staged changes are not included. The message body
+records the pattern, or the match files applied, & the number
+of matches & files. "{pattern}", "{matches}" & "{files}" in
+MESSAGE are replaced by the same. Requires git 2.25 or later.`},
+		{Name: "-checkpoint", Text: `Save the original contents of every file bed is about to
+change in a commit referenced by refs/bed/checkpoints/ID, where
+ID is the ID of the run, before changes are applied. The index,
+HEAD & other files are unaffected. The files can be restored
+with "git checkout refs/bed/checkpoints/ID -- :/", which is
+printed once the checkpoint is saved & also stages them, & the
+ref can be deleted with "git update-ref -d". The targets of
+symlinks are saved, rather than the symlinks, unless
+-no-follow-symlinks is set. Requires a git worktree.`},
+		{Name: "-emit-script FILE", Text: `Write a standalone POSIX shell script to FILE which applies
+the changes instead of applying them. The script checks that
+files are unchanged before modifying them & only requires
+standard utilities, so it can be reviewed & run on machines
+without bed. If FILE is "-" then the script is written to
+STDOUT.`},
+		{Name: "-emit-suggestions FILE", Text: `Write the changes to FILE as a GitHub pull request review
+with a "suggested change" comment for each group of changed
+lines, instead of applying them, so they can be proposed on
+an existing pull request, e.g. with "gh api
+repos/OWNER/REPO/pulls/N/reviews --input FILE". Paths are
+relative to the root of the git worktree & suggestions can
+only be made on lines which are part of the pull request's
+diff. Deleted files & files which are not UTF-8 are skipped.
+If FILE is "-" then the review is written to STDOUT.`},
+		{Name: "-follow-symlinks", Text: `Write changes to symlinked files through to their targets,
+leaving the symlinks in place. This is the default.`},
+		{Name: "-no-follow-symlinks", Text: `Replace symlinked files with regular files containing the
+changes instead of modifying their targets.`},
+		{Name: "-tmp-ext EXT", Text: `Use EXT as the temporary file extension. By default, the
+extension of the source files is used so that editors can
+apply syntax highlighting.`},
+		{Name: "-tmp-ext-default EXT", Text: "Extension to use when matches span multiple extensions."},
+	},
+	Examples: []docExample{
+		{
+			Title: "Preview matches",
+			Text:  "List every match without opening an editor.",
+			Args:  []string{"-dry-run", `fmt\.Print\w*`, "main.go"},
+			Files: []docFile{
+				{Path: "main.go", Data: "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n\tfmt.Printf(\"%d\\n\", 1)\n}\n"},
+			},
+			Output: "main.go: fmt.Println\nmain.go: fmt.Printf\n",
+		},
+		{
+			Title: "Match by context",
+			Text:  "Rename calls to a function without changing other uses of its name.",
+			Args:  []string{"-replace", "start", `run(?=\()`, "main.go"},
+			Files: []docFile{
+				{Path: "main.go", Data: "var run = true\n\nfunc main() {\n\trun()\n}\n"},
+			},
+			Want: []docFile{
+				{Path: "main.go", Data: "var run = true\n\nfunc main() {\n\tstart()\n}\n"},
+			},
+		},
+		{
+			Title: "Count matches by directory",
+			Text:  "Summarize where matches occur across a tree of files.",
+			Args:  []string{"-format", "tree", "TODO", "cmd/main.go", "lib/a.go", "lib/b.go"},
+			Files: []docFile{
+				{Path: "cmd/main.go", Data: "// TODO: parse flags\n"},
+				{Path: "lib/a.go", Data: "// TODO: validate\n// TODO: cache\n"},
+				{Path: "lib/b.go", Data: "// TODO: document\n"},
+			},
+			Output: ". (4)\n├── cmd (1)\n│   └── main.go (1)\n└── lib (3)\n    ├── a.go (2)\n    └── b.go (1)\n",
+		},
+		{
+			Title: "Replace using submatches",
+			Text:  "Rewrite matches with a template instead of editing them by hand.",
+			Args:  []string{"-replace", "log.Printf($1)", `fmt\.Printf\((.*)\)`, "main.go"},
+			Files: []docFile{
+				{Path: "main.go", Data: "fmt.Printf(\"starting %s\", name)\n"},
+			},
+			Want: []docFile{
+				{Path: "main.go", Data: "log.Printf(\"starting %s\", name)\n"},
+			},
+		},
+		{
+			Title: "Rename files",
+			Text:  "Match file paths instead of contents to rename files in bulk.",
+			Args:  []string{"-names", "-replace", "$1.md", `(.*)\.txt$`, "notes.txt", "todo.txt"},
+			Files: []docFile{
+				{Path: "notes.txt", Data: "notes\n"},
+				{Path: "todo.txt", Data: "todo\n"},
+			},
+			Want: []docFile{
+				{Path: "notes.md", Data: "notes\n"},
+				{Path: "todo.md", Data: "todo\n"},
+			},
+		},
+		{
+			Title: "Edit with a script",
+			Text:  "Any command which edits files in place can be used as the editor.",
+			Env:   []string{"EDITOR=sed -i s/^TODO:/DONE:/"},
+			Args:  []string{`(?m)^TODO: call .*$`, "todo.txt"},
+			Files: []docFile{
+				{Path: "todo.txt", Data: "TODO: call alice\nTODO: fix bike\nTODO: call bob\n"},
+			},
+			Want: []docFile{
+				{Path: "todo.txt", Data: "DONE: call alice\nTODO: fix bike\nDONE: call bob\n"},
+			},
+		},
+		{
+			Title: "Delete lines with a directive",
+			Text:  "Replace a match block with #bed:delete-line to remove the lines it is on.",
+			Env:   []string{"EDITOR=sed -i s/^debugger;$/#bed:delete-line/"},
+			Args:  []string{`debugger;`, "app.js"},
+			Files: []docFile{
+				{Path: "app.js", Data: "function run() {\n  debugger;\n  start();\n}\n"},
+			},
+			Want: []docFile{
+				{Path: "app.js", Data: "function run() {\n  start();\n}\n"},
+			},
+		},
+		{
+			Title:  "Ban patterns in CI",
+			Text:   "Fail the build if any matches are found.",
+			Args:   []string{"-check-only", `console\.log`, "app.js"},
+			Files:  []docFile{{Path: "app.js", Data: "console.log(\"debug\");\n"}},
+			Output: "app.js: console.log\n",
+			Fail:   true,
+		},
+	},
+}
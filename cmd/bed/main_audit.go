@@ -0,0 +1,29 @@
+//go:build audit
+// +build audit
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// main only runs audits when built with the audit tag. Every other file
+// which can modify files, such as applying changes, renames, hooks & remote
+// uploads, is excluded from that build so that it cannot be run.
+func main() {
+	args, err := expandArgsFiles(os.Args[1:])
+	if err == nil {
+		if len(args) > 0 && args[0] == "audit" {
+			args = args[1:]
+		}
+		err = RunAudit(args)
+	}
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(ExitError)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	err := Run(os.Args[1:])
+	if err != nil && err != flag.ErrHelp && err != ErrNoMatches {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(exitCode(err))
+}
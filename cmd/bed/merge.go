@@ -0,0 +1,193 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// RunMerge executes the "merge" command which combines match files into a
+// single match file so they can be reviewed & applied together.
+func RunMerge(args []string) error {
+	fs := flag.NewFlagSet("bed-merge", flag.ContinueOnError)
+	outPath := fs.String("o", "-", "")
+	header := fs.String("header", bed.HeaderJSON, "")
+	encode := fs.String("encode", "", "")
+	relative := fs.Bool("relative", false, "")
+	fs.Usage = usageMerge
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		return errors.New("match file required")
+	} else if !bed.ValidHeaderFormat(*header) {
+		return fmt.Errorf("unknown header format: %q", *header)
+	} else if !bed.ValidEncoding(*encode) {
+		return fmt.Errorf("unknown encoding: %q", *encode)
+	}
+
+	// Read matches from each match file, keeping track of their source.
+	var sources []mergeSource
+	for _, path := range fs.Args() {
+		matches, err := readMatchFile(path)
+		if err != nil {
+			return err
+		}
+		for _, m := range bed.RemoveSkipped(matches) {
+			sources = append(sources, mergeSource{path: path, match: m})
+		}
+	}
+
+	matches, err := mergeMatches(sources)
+	if err != nil {
+		return err
+	} else if len(matches) == 0 {
+		return ErrNoMatches
+	}
+
+	opt := bed.WriteOptions{Header: *header, Encoding: *encode}
+	return WriteMatchFilePath(*outPath, matches, opt, *relative)
+}
+
+// mergeSource is a match along with the match file it was read from.
+type mergeSource struct {
+	path  string
+	match *bed.Match
+}
+
+// String returns the match file & the location of the match for errors.
+func (s mergeSource) String() string {
+	m := s.match
+	if m.Line > 0 {
+		return fmt.Sprintf("%s (%s:%d:%d)", s.path, m.Path, m.Line, m.Col)
+	}
+	return fmt.Sprintf("%s (%s at %d)", s.path, m.Path, m.Pos)
+}
+
+// mergeMatches returns the matches from each source grouped by path, in the
+// order paths first appear, & sorted by position. Paths which refer to the
+// same file, such as "./a.go" & "a.go", are grouped together & written as
+// they first appear. Identical matches are only included once. Returns an
+// error listing every pair of matches which change overlapping text, since
+// they cannot both be applied.
+func mergeMatches(sources []mergeSource) ([]*bed.Match, error) {
+	var paths []string
+	byPath := make(map[string][]mergeSource)
+	names := make(map[string]string)
+	for _, s := range sources {
+		key := mergePathKey(s.match.Path)
+		if _, ok := byPath[key]; !ok {
+			paths, names[key] = append(paths, key), s.match.Path
+		}
+		byPath[key] = append(byPath[key], s)
+	}
+
+	var matches []*bed.Match
+	var conflicts []string
+	for _, path := range paths {
+		a := byPath[path]
+		sort.SliceStable(a, func(i, j int) bool { return a[i].match.Pos < a[j].match.Pos })
+
+		var kept []mergeSource
+	next:
+		for _, s := range a {
+			for _, other := range kept {
+				if sameMatch(other.match, s.match) {
+					continue next
+				}
+			}
+			for _, other := range kept {
+				if matchesOverlap(other.match, s.match) {
+					conflicts = append(conflicts, fmt.Sprintf("%s overlaps %s", s, other))
+				}
+			}
+			kept = append(kept, s)
+		}
+		for _, s := range kept {
+			cp := *s.match
+			cp.Path = names[path]
+			matches = append(matches, &cp)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("match files contain conflicting changes:\n\t%s", strings.Join(conflicts, "\n\t"))
+	}
+	return matches, nil
+}
+
+// mergePathKey returns the absolute, cleaned form of path so that different
+// paths to the same file can be compared.
+func mergePathKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// sameMatch returns true if a & b make the same change.
+func sameMatch(a, b *bed.Match) bool {
+	return mergePathKey(a.Path) == mergePathKey(b.Path) && a.Pos == b.Pos && a.Len == b.Len &&
+		a.Directive == b.Directive && a.Charset == b.Charset && bytes.Equal(a.Data, b.Data)
+}
+
+// matchesOverlap returns true if a & b, in the same file, change the same
+// text. Insertions at the same position overlap since their order is
+// ambiguous. Deleting the file overlaps every other change.
+func matchesOverlap(a, b *bed.Match) bool {
+	if a.Directive == bed.DirectiveDeleteFile || b.Directive == bed.DirectiveDeleteFile {
+		return true
+	} else if a.Len == 0 && b.Len == 0 {
+		return a.Pos == b.Pos
+	}
+	return a.Pos < b.Pos+b.Len && b.Pos < a.Pos+a.Len
+}
+
+func usageMerge() {
+	writeUsage(os.Stderr, mergeDoc)
+}
+
+var mergeDoc = &commandDoc{
+	Name:  "bed merge",
+	Short: "combine match files",
+	Long: `Combines match files written by different runs or different people into
+a single match file so that a large edit prepared in parts can be
+reviewed & applied at once. Matches are grouped by file & sorted by
+position. Identical matches are only written once & skipped matches are
+dropped. If matches from any of the files change overlapping text then
+every conflict is reported & nothing is written.`,
+	Synopsis: []string{
+		"bed merge [arguments] matchfile [matchfiles]",
+	},
+	Flags: []docItem{
+		{Name: "-o FILE", Text: `Write the merged match file to FILE instead of STDOUT.`},
+		{Name: "-header FORMAT", Text: `Write match headers as "json" (default), "plain" key=value
+pairs or a "yaml" flow mapping. See "bed -h" for details.`},
+		{Name: "-encode ENCODING", Text: `Write the text of matches which cannot be edited safely as
+text as "base64". See "bed -h" for details.`},
+		{Name: "-relative", Text: `Write paths relative to the root of the git worktree so the
+merged file can be applied to another checkout.`},
+	},
+	Examples: []docExample{
+		{
+			Title: "Merge match files",
+			Text:  "Combine changes prepared separately into one match file.",
+			Args:  []string{"a.bed", "b.bed"},
+			Files: []docFile{
+				{Path: "main.go", Data: "const timeout = 10\n"},
+				{Path: "a.bed", Data: "#bed:begin {\"path\":\"main.go\",\"pos\":16,\"len\":2}\n30\n#bed:end\n"},
+				{Path: "b.bed", Data: "#bed:begin {\"path\":\"main.go\",\"pos\":6,\"len\":7}\ndelay\n#bed:end\n"},
+			},
+			Output: "#bed:begin {\"path\":\"main.go\",\"pos\":6,\"len\":7}\ndelay\n#bed:end\n\n#bed:begin {\"path\":\"main.go\",\"pos\":16,\"len\":2}\n30\n#bed:end\n\n",
+		},
+	},
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestMergeMatches(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		sources []mergeSource
+		want    []string // path:pos:len of each merged match
+	}{
+		{
+			name: "Disjoint",
+			sources: []mergeSource{
+				{path: "a.bed", match: &bed.Match{Path: "main.go", Pos: 16, Len: 2, Data: []byte("30")}},
+				{path: "b.bed", match: &bed.Match{Path: "main.go", Pos: 6, Len: 7, Data: []byte("delay")}},
+				{path: "b.bed", match: &bed.Match{Path: "other.go", Pos: 0, Len: 1, Data: []byte("x")}},
+			},
+			want: []string{"main.go:6:7", "main.go:16:2", "other.go:0:1"},
+		},
+		{
+			name: "Identical",
+			sources: []mergeSource{
+				{path: "a.bed", match: &bed.Match{Path: "main.go", Pos: 6, Len: 7, Data: []byte("delay")}},
+				{path: "b.bed", match: &bed.Match{Path: "main.go", Pos: 6, Len: 7, Data: []byte("delay")}},
+			},
+			want: []string{"main.go:6:7"},
+		},
+		{
+			name: "IdenticalOtherPath",
+			sources: []mergeSource{
+				{path: "a.bed", match: &bed.Match{Path: "./main.go", Pos: 6, Len: 7, Data: []byte("delay")}},
+				{path: "b.bed", match: &bed.Match{Path: "main.go", Pos: 6, Len: 7, Data: []byte("delay")}},
+				{path: "b.bed", match: &bed.Match{Path: "cmd/../main.go", Pos: 16, Len: 2, Data: []byte("30")}},
+			},
+			want: []string{"./main.go:6:7", "./main.go:16:2"},
+		},
+		{
+			name: "Adjacent",
+			sources: []mergeSource{
+				{path: "a.bed", match: &bed.Match{Path: "main.go", Pos: 0, Len: 5, Data: []byte("x")}},
+				{path: "b.bed", match: &bed.Match{Path: "main.go", Pos: 5, Len: 5, Data: []byte("y")}},
+			},
+			want: []string{"main.go:0:5", "main.go:5:5"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := mergeMatches(tt.sources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range matches {
+				got = append(got, fmt.Sprintf("%s:%d:%d", m.Path, m.Pos, m.Len))
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Fatalf("unexpected matches: %q", got)
+			}
+		})
+	}
+}
+
+func TestMergeMatches_Conflict(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		sources []mergeSource
+		err     string
+	}{
+		{
+			name: "Overlap",
+			sources: []mergeSource{
+				{path: "a.bed", match: &bed.Match{Path: "main.go", Pos: 6, Len: 7, Data: []byte("delay")}},
+				{path: "b.bed", match: &bed.Match{Path: "main.go", Pos: 10, Len: 5, Data: []byte("x")}},
+			},
+			err: "b.bed (main.go at 10) overlaps a.bed (main.go at 6)",
+		},
+		{
+			name: "OverlapOtherPath",
+			sources: []mergeSource{
+				{path: "a.bed", match: &bed.Match{Path: "./main.go", Pos: 6, Len: 7, Data: []byte("delay")}},
+				{path: "b.bed", match: &bed.Match{Path: "main.go", Pos: 6, Len: 7, Data: []byte("wait")}},
+			},
+			err: "b.bed (main.go at 6) overlaps a.bed (./main.go at 6)",
+		},
+		{
+			name: "Insertions",
+			sources: []mergeSource{
+				{path: "a.bed", match: &bed.Match{Path: "main.go", Pos: 3, Data: []byte("x")}},
+				{path: "b.bed", match: &bed.Match{Path: "main.go", Pos: 3, Data: []byte("y")}},
+			},
+			err: "b.bed (main.go at 3) overlaps a.bed (main.go at 3)",
+		},
+		{
+			name: "DeleteFile",
+			sources: []mergeSource{
+				{path: "a.bed", match: &bed.Match{Path: "main.go", Pos: 0, Len: 1, Directive: bed.DirectiveDeleteFile}},
+				{path: "b.bed", match: &bed.Match{Path: "main.go", Pos: 20, Len: 1, Data: []byte("y")}},
+			},
+			err: "b.bed (main.go at 20) overlaps a.bed (main.go at 0)",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mergeMatches(tt.sources)
+			if err == nil || !strings.Contains(err.Error(), "\n\t"+tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
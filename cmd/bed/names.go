@@ -0,0 +1,193 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// nameOptions represents options for renaming files with -names.
+type nameOptions struct {
+	Editor   string
+	WaitFlag string
+
+	// If Replace is true, files are renamed by expanding Template for
+	// each match in their path instead of by editing their names.
+	Template string
+	Replace  bool
+
+	// If true, renames are only printed.
+	DryRun bool
+
+	// If set, renames are listed & confirmed before any file is moved.
+	Confirm prompter
+}
+
+// renameFiles finds paths which match pattern & renames them either to the
+// names edited in the editor, one per line in the same order, or to the
+// names produced by a replacement template.
+func renameFiles(sf *searchFlags, pattern string, paths []string, opt nameOptions) error {
+	re, paths, err := sf.searchNames(pattern, paths)
+	if err != nil {
+		return err
+	} else if len(paths) == 0 {
+		return ErrNoMatches
+	}
+
+	// Determine the new names.
+	var names []string
+	if opt.Replace {
+		for _, path := range paths {
+			names = append(names, replaceName(re, path, opt.Template))
+		}
+	} else if opt.DryRun {
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		return nil
+	} else if names, err = editNames(opt.Editor, paths, opt.WaitFlag); err != nil {
+		return err
+	}
+
+	var renames []bed.Rename
+	for i, path := range paths {
+		if names[i] != path {
+			renames = append(renames, bed.Rename{From: path, To: names[i]})
+		}
+	}
+	if len(renames) == 0 {
+		return nil
+	} else if err := bed.CheckRenames(renames); err != nil {
+		return err
+	}
+
+	// Print the renames without moving files, if a dry run, or ask for
+	// confirmation first, if requested.
+	if opt.DryRun || opt.Confirm != nil {
+		for _, r := range renames {
+			fmt.Printf("%s -> %s\n", r.From, r.To)
+		}
+	}
+	if opt.DryRun {
+		return nil
+	} else if opt.Confirm != nil {
+		if answer, err := opt.Confirm.Prompt(&Prompt{
+			Message: fmt.Sprintf("Rename %d file(s)", len(renames)),
+			Choices: []string{"y", "n"},
+			Help:    "y - rename files\nn - discard changes\n",
+		}); err != nil {
+			return err
+		} else if answer != "y" {
+			return ErrAborted
+		}
+	}
+
+	return bed.RenamePaths(renames)
+}
+
+// searchNames returns the paths which match pattern. Paths are matched with
+// forward slashes on all platforms.
+func (f *searchFlags) searchNames(pattern string, paths []string) (bed.Matcher, []string, error) {
+	paths, err := f.readPaths(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	re, err := engines[*f.engine](pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var a []string
+	for _, path := range paths {
+		if bed.IsStateFile(path) {
+			warnf("skipping bed state file: %s", path)
+			continue
+		} else if len(re.FindAllSubmatchIndex([]byte(filepath.ToSlash(path)), 1)) == 0 {
+			continue
+		}
+		a = append(a, path)
+	}
+
+	sortPaths(a, pathLess(*f.sort))
+	return re, a, nil
+}
+
+// replaceName returns path with each match of re replaced by template.
+func replaceName(re bed.Matcher, path, template string) string {
+	src := []byte(filepath.ToSlash(path))
+
+	var dst []byte
+	var prev int
+	for _, loc := range re.FindAllSubmatchIndex(src, -1) {
+		dst = append(dst, src[prev:loc[0]]...)
+		dst = re.Expand(dst, []byte(template), src, loc)
+		prev = loc[1]
+	}
+	dst = append(dst, src[prev:]...)
+	return filepath.FromSlash(string(dst))
+}
+
+// editNames writes paths to a temporary file, one per line, opens it in
+// editor & returns the edited lines once the editor exits. Returns an error
+// if lines were added or removed since each line is renamed in order.
+func editNames(editor string, paths []string, waitFlag string) ([]string, error) {
+	f, err := ioutil.TempFile("", "bed-"+runID+"-*.names")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	for _, path := range paths {
+		if strings.ContainsAny(path, "\r\n") {
+			return nil, fmt.Errorf("%q: cannot rename path containing a newline", path)
+		} else if _, err := fmt.Fprintln(f, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := runEditor(editor, []string{f.Name()}, waitFlag); err != nil {
+		return nil, err
+	}
+
+	// Read the edited names. Trailing blank lines are ignored.
+	r, err := os.Open(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		names = append(names, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for len(names) > 0 && names[len(names)-1] == "" {
+		names = names[:len(names)-1]
+	}
+
+	if len(names) != len(paths) {
+		return nil, fmt.Errorf("expected %d file name(s) but found %d, lines cannot be added or removed", len(paths), len(names))
+	}
+	for i, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("line %d: blank file name for %s, files cannot be deleted", i+1, paths[i])
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRun_Names(t *testing.T) {
+	chdirTemp(t)
+	writeTestFile(t, "old_a.txt", "a")
+	writeTestFile(t, "old_b.txt", "b")
+	writeTestFile(t, "other.txt", "c")
+
+	if err := Run([]string{"-names", "-replace", "new/${1}.md", `old_(\w+)\.txt`, "old_a.txt", "old_b.txt", "other.txt"}); err != nil {
+		t.Fatal(err)
+	} else if s := readTestFile(t, "new/a.md"); s != "a" {
+		t.Fatalf("unexpected contents: %q", s)
+	} else if s := readTestFile(t, "new/b.md"); s != "b" {
+		t.Fatalf("unexpected contents: %q", s)
+	} else if _, err := os.Stat("old_a.txt"); !os.IsNotExist(err) {
+		t.Fatalf("expected old_a.txt to be renamed: %v", err)
+	} else if s := readTestFile(t, "other.txt"); s != "c" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+}
+
+// TestRun_NamesCollision checks that no file is renamed if any new name
+// collides with another file.
+func TestRun_NamesCollision(t *testing.T) {
+	chdirTemp(t)
+	writeTestFile(t, "a1.txt", "a")
+	writeTestFile(t, "a2.txt", "b")
+
+	if err := Run([]string{"-names", "-replace", "a.txt", `a\d\.txt`, "a1.txt", "a2.txt"}); err == nil || !strings.Contains(err.Error(), "rename collision(s)") {
+		t.Fatalf("unexpected error: %v", err)
+	} else if s := readTestFile(t, "a1.txt"); s != "a" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+}
+
+func TestReplaceName(t *testing.T) {
+	re, err := compileRE2(`(\w+)_test`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := replaceName(re, "pkg/foo_test.go", "${1}_spec"); got != "pkg/foo_spec.go" {
+		t.Fatalf("unexpected name: %q", got)
+	}
+}
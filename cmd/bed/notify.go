@@ -0,0 +1,110 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// Events reported to the -notify command.
+const (
+	NotifyScan  = "scan"
+	NotifyApply = "apply"
+	NotifyWatch = "watch"
+)
+
+// notifyTimeout is the longest a -notify webhook may take to respond.
+const notifyTimeout = 10 * time.Second
+
+// notification is the JSON payload sent to the -notify command or webhook.
+type notification struct {
+	Event   string  `json:"event"`
+	Run     string  `json:"run"`
+	Status  string  `json:"status"`
+	Error   string  `json:"error,omitempty"`
+	Dir     string  `json:"dir"`
+	Files   int     `json:"files"`
+	Matches int     `json:"matches"`
+	Elapsed float64 `json:"elapsed_seconds"`
+}
+
+// newNotification returns a notification of event for matches, which
+// started at start & failed with err, if set.
+func newNotification(event string, matches []*bed.Match, start time.Time, err error) *notification {
+	paths, _ := bed.GroupMatchesByPath(matches)
+	n := &notification{
+		Event:   event,
+		Run:     runID,
+		Status:  "ok",
+		Files:   len(paths),
+		Matches: len(matches),
+		Elapsed: time.Since(start).Seconds(),
+	}
+	n.Dir, _ = os.Getwd()
+	if err != nil {
+		n.Status, n.Error = "failed", err.Error()
+	}
+	return n
+}
+
+// notifyEvent sends n to the -notify command, if set. Successful events
+// which took less than -notify-after are not sent, so that only long runs
+// interrupt the user, but failures & new matches found by -watch always
+// are. Failing to notify is only reported as a warning since the run itself
+// is unaffected.
+func (f *applyFlags) notifyEvent(n *notification) {
+	if *f.notify == "" {
+		return
+	} else if n.Status == "ok" && n.Event != NotifyWatch && n.Elapsed < f.notifyAfter.Seconds() {
+		return
+	}
+	if err := sendNotification(*f.notify, n); err != nil {
+		warnf("cannot send %s notification: %s", n.Event, err)
+	}
+}
+
+// sendNotification sends n as JSON to target. If target is an http or https
+// URL then the payload is posted to it. Otherwise target is run as a command
+// with the payload on STDIN & the event & status in the BED_NOTIFY_EVENT &
+// BED_NOTIFY_STATUS environment variables.
+func sendNotification(target string, n *notification) error {
+	buf, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		client := &http.Client{Timeout: notifyTimeout}
+		resp, err := client.Post(target, "application/json", bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned %s", resp.Status)
+		}
+		return nil
+	}
+
+	args, err := splitWords(target)
+	if err != nil {
+		return err
+	} else if len(args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(buf)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	cmd.Env = append(os.Environ(), "BED_NOTIFY_EVENT="+n.Event, "BED_NOTIFY_STATUS="+n.Status)
+	return cmd.Run()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRun_Notify(t *testing.T) {
+	var events []notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		events = append(events, n)
+	}))
+	defer srv.Close()
+
+	chdirTemp(t)
+	t.Setenv("HOME", t.TempDir())
+	writeTestFile(t, "a.txt", "foo foo\n")
+	writeTestFile(t, "b.txt", "foo\n")
+
+	if err := Run([]string{"-notify", srv.URL, "-replace", "bar", "foo", "a.txt", "b.txt"}); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 2 {
+		t.Fatalf("unexpected notifications: %+v", events)
+	}
+	for i, event := range []string{NotifyScan, NotifyApply} {
+		if n := events[i]; n.Event != event || n.Status != "ok" || n.Files != 2 || n.Matches != 3 {
+			t.Fatalf("unexpected %s notification: %+v", event, n)
+		}
+	}
+
+	// Quick runs are not notified with -notify-after.
+	events = nil
+	if err := Run([]string{"-notify", srv.URL, "-notify-after", "1h", "-replace", "foo", "bar", "a.txt"}); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 0 {
+		t.Fatalf("unexpected notifications: %+v", events)
+	}
+}
+
+func TestSendNotification(t *testing.T) {
+	n := &notification{Event: NotifyApply, Status: "failed", Error: "marker"}
+
+	t.Run("WebhookError", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		if err := sendNotification(srv.URL, n); err == nil || err.Error() != "webhook returned 503 Service Unavailable" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Command", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("notify commands require a unix shell")
+		}
+		chdirTemp(t)
+
+		if err := sendNotification(`sh -c 'echo "$BED_NOTIFY_EVENT $BED_NOTIFY_STATUS" > out.txt; cat >> out.txt'`, n); err != nil {
+			t.Fatal(err)
+		}
+		want := "apply failed\n" + `{"event":"apply","run":"","status":"failed","error":"marker","dir":"","files":0,"matches":0,"elapsed_seconds":0}`
+		if s := readTestFile(t, "out.txt"); s != want {
+			t.Fatalf("unexpected output: %q", s)
+		}
+	})
+}
+
+func TestNewNotification_Error(t *testing.T) {
+	n := newNotification(NotifyScan, nil, time.Now(), errors.New("marker"))
+	if n.Status != "failed" || n.Error != "marker" {
+		t.Fatalf("unexpected notification: %+v", n)
+	}
+}
@@ -0,0 +1,352 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// otelTimeout is the longest the OTLP endpoint may take to accept spans.
+const otelTimeout = 10 * time.Second
+
+// tracing records OpenTelemetry spans for the scan, editing session & apply
+// operations of the run, if an OTLP endpoint is configured. It is nil
+// otherwise, in which case spans are not recorded.
+var tracing *tracer
+
+// tracer records spans & exports them to an OTLP/HTTP endpoint as JSON once
+// the run is complete. Spans are children of a root span for the run, which
+// joins the trace in the TRACEPARENT environment variable, if set, so that
+// runs started by a traced program appear within its own traces.
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	traceID  string
+	root     *span
+	spans    []*span
+}
+
+// span is a single timed operation of a trace.
+type span struct {
+	id     string
+	parent string
+	name   string
+	start  time.Time
+	end    time.Time
+	attrs  []otlpKeyValue
+	err    error
+	tracer *tracer
+}
+
+// startTracing returns a tracer with a root span named name if an OTLP
+// endpoint is configured by the standard OpenTelemetry environment
+// variables. Returns nil if tracing is not configured or is disabled.
+func startTracing(name string) (*tracer, error) {
+	if v, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); v {
+		return nil, nil
+	}
+
+	// The traces endpoint is used as-is while the general endpoint is the
+	// base URL of every signal.
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, only http/json is supported", protocol)
+	}
+
+	headers, err := parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tracer{
+		endpoint: endpoint,
+		headers:  headers,
+		service:  os.Getenv("OTEL_SERVICE_NAME"),
+	}
+	if t.service == "" {
+		t.service = "bed"
+	}
+
+	// Join the caller's trace, if any, or start a new one.
+	traceID, parentID, ok := parseTraceparent(os.Getenv("TRACEPARENT"))
+	if !ok {
+		traceID = randomHex(16)
+	}
+	t.traceID = traceID
+	t.root = t.newSpan(name, parentID)
+	t.root.setString("bed.run_id", runID)
+	return t, nil
+}
+
+// start starts a span for the operation name as a child of the run's span.
+// Returns nil if t is nil.
+func (t *tracer) start(name string) *span {
+	if t == nil {
+		return nil
+	}
+	return t.newSpan(name, t.root.id)
+}
+
+// newSpan starts a span for the operation name as a child of parent.
+func (t *tracer) newSpan(name, parent string) *span {
+	return &span{id: randomHex(8), parent: parent, name: name, start: time.Now(), tracer: t}
+}
+
+// finish ends the run's span with err & exports all ended spans. Failing to
+// export is only reported as a warning since the run itself is unaffected.
+func (t *tracer) finish(err error) {
+	if t == nil {
+		return
+	} else if err == flag.ErrHelp || err == ErrNoMatches {
+		err = nil
+	}
+	t.root.finish(err)
+
+	if err := t.export(); err != nil {
+		warnf("cannot export spans: %s", err)
+	}
+}
+
+// export posts the ended spans to the OTLP endpoint.
+func (t *tracer) export() error {
+	var spans []otlpSpan
+	for _, s := range t.spans {
+		spans = append(spans, s.otlp(t.traceID))
+	}
+	buf, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: []otlpKeyValue{
+				otlpString("service.name", t.service),
+				otlpString("service.version", bed.GetBuildInfo().Version),
+			}},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/benbjohnson/bed"},
+				Spans: spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: otelTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// setString sets the attribute key to a string value.
+func (s *span) setString(key, value string) {
+	if s != nil {
+		s.attrs = append(s.attrs, otlpString(key, value))
+	}
+}
+
+// setInt sets the attribute key to an integer value.
+func (s *span) setInt(key string, value int64) {
+	if s != nil {
+		s.attrs = append(s.attrs, otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: strconv.FormatInt(value, 10)}})
+	}
+}
+
+// setMatches sets the number of files & matches of matches, along with the
+// number of bytes the matches span & the number of bytes of their text.
+func (s *span) setMatches(matches []*bed.Match) {
+	if s == nil {
+		return
+	}
+	paths, _ := bed.GroupMatchesByPath(matches)
+	var n, data int64
+	for _, m := range matches {
+		n, data = n+int64(m.Len), data+int64(len(m.Data))
+	}
+	s.setInt("bed.files", int64(len(paths)))
+	s.setInt("bed.matches", int64(len(matches)))
+	s.setInt("bed.match_bytes", n)
+	s.setInt("bed.data_bytes", data)
+}
+
+// finish ends the span, marking it as failed if err is set, & records it
+// for export.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+// otlp returns the span in the OTLP JSON encoding.
+func (s *span) otlp(traceID string) otlpSpan {
+	o := otlpSpan{
+		TraceID:      traceID,
+		SpanID:       s.id,
+		ParentSpanID: s.parent,
+		Name:         s.name,
+		Kind:         otlpSpanKindInternal,
+		Start:        strconv.FormatInt(s.start.UnixNano(), 10),
+		End:          strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:   s.attrs,
+	}
+	if s.err != nil {
+		o.Status = &otlpStatus{Code: otlpStatusError, Message: s.err.Error()}
+	}
+	return o
+}
+
+// parseTraceparent returns the trace & parent span IDs of a W3C traceparent
+// header value, e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func parseTraceparent(s string) (traceID, parentID string, ok bool) {
+	a := strings.Split(strings.TrimSpace(s), "-")
+	if len(a) < 4 || len(a[0]) != 2 || a[0] == "ff" || len(a[1]) != 32 || len(a[2]) != 16 || len(a[3]) != 2 {
+		return "", "", false
+	} else if (len(a) > 4 && a[0] == "00") || !isHex(a[0]) || !isHex(a[3]) {
+		return "", "", false
+	} else if !isHex(a[1]) || strings.Trim(a[1], "0") == "" || !isHex(a[2]) || strings.Trim(a[2], "0") == "" {
+		return "", "", false
+	}
+	return a[1], a[2], true
+}
+
+// parseOTLPHeaders parses the comma-separated key=value pairs of the
+// OTEL_EXPORTER_OTLP_HEADERS environment variable. Values are URL encoded.
+func parseOTLPHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("invalid OTLP header, expected key=value: %q", kv)
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(kv[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header value: %q", kv)
+		}
+		headers[strings.TrimSpace(kv[:i])] = value
+	}
+	return headers, nil
+}
+
+// isHex returns true if s is a lowercase hexadecimal string.
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// randomHex returns n random bytes encoded as hexadecimal.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// OTLP span kinds & status codes.
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+// otlpRequest is an OTLP ExportTraceServiceRequest in the JSON encoding.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	Name         string         `json:"name"`
+	Kind         int            `json:"kind"`
+	Start        string         `json:"startTimeUnixNano"`
+	End          string         `json:"endTimeUnixNano"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	Status       *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpAnyValue is an attribute value. 64-bit integers are encoded as strings.
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    string  `json:"intValue,omitempty"`
+}
+
+// otlpString returns a string attribute.
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
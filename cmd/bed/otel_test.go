@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRun_Tracing(t *testing.T) {
+	var requests []otlpRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests, auth = append(requests, req), r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	chdirTemp(t)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL+"/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20xyz")
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	writeTestFile(t, "a.txt", "foo foo\n")
+	writeTestFile(t, "b.txt", "bar\n")
+
+	if err := Run([]string{"-replace", "baz", "foo", "a.txt", "b.txt"}); err != nil {
+		t.Fatal(err)
+	} else if s := readTestFile(t, "a.txt"); s != "baz baz\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	} else if len(requests) != 1 {
+		t.Fatalf("unexpected number of requests: %d", len(requests))
+	} else if auth != "Bearer xyz" {
+		t.Fatalf("unexpected authorization header: %q", auth)
+	}
+
+	spans := make(map[string]otlpSpan)
+	for _, s := range requests[0].ResourceSpans[0].ScopeSpans[0].Spans {
+		if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Fatalf("unexpected trace ID: %s", s.TraceID)
+		}
+		spans[s.Name] = s
+	}
+	if len(spans) != 3 {
+		t.Fatalf("unexpected spans: %v", spans)
+	} else if root := spans["bed"]; root.ParentSpanID != "00f067aa0ba902b7" || root.Status != nil {
+		t.Fatalf("unexpected root span: %+v", root)
+	}
+
+	for name, want := range map[string]map[string]string{
+		"scan":  {"bed.files_scanned": "2", "bed.bytes_scanned": "12", "bed.files": "1", "bed.matches": "2", "bed.match_bytes": "6"},
+		"apply": {"bed.files": "1", "bed.matches": "2", "bed.match_bytes": "6", "bed.data_bytes": "6"},
+	} {
+		s := spans[name]
+		if s.ParentSpanID != spans["bed"].SpanID {
+			t.Fatalf("%s: unexpected parent: %s", name, s.ParentSpanID)
+		}
+		attrs := make(map[string]string)
+		for _, kv := range s.Attributes {
+			attrs[kv.Key] = kv.Value.IntValue
+		}
+		for k, v := range want {
+			if attrs[k] != v {
+				t.Errorf("%s: unexpected %s: %q", name, k, attrs[k])
+			}
+		}
+	}
+}
+
+func TestRun_TracingDisabled(t *testing.T) {
+	chdirTemp(t)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:1")
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	writeTestFile(t, "a.txt", "foo\n")
+
+	if err := Run([]string{"-dry-run", "foo", "a.txt"}); err != nil {
+		t.Fatal(err)
+	} else if tracing != nil {
+		t.Fatal("expected tracing to be disabled")
+	}
+}
+
+func TestStartTracing_Error(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	if _, err := startTracing("bed"); err == nil || err.Error() != `unsupported OTLP protocol "grpc", only http/json is supported` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for _, tt := range []struct {
+		s        string
+		traceID  string
+		parentID string
+	}{
+		{s: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceID: "4bf92f3577b34da6a3ce929d0e0e4736", parentID: "00f067aa0ba902b7"},
+		{s: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra", traceID: "4bf92f3577b34da6a3ce929d0e0e4736", parentID: "00f067aa0ba902b7"},
+		{s: ""},
+		{s: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{s: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{s: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{s: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{s: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{s: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1"},
+	} {
+		traceID, parentID, ok := parseTraceparent(tt.s)
+		if traceID != tt.traceID || parentID != tt.parentID || ok != (tt.traceID != "") {
+			t.Errorf("parseTraceparent(%q)=%q, %q, %v", tt.s, traceID, parentID, ok)
+		}
+	}
+}
+
+func TestParseOTLPHeaders(t *testing.T) {
+	if headers, err := parseOTLPHeaders("api-key=abc, x-tenant = a%2Cb ,"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(headers, map[string]string{"api-key": "abc", "x-tenant": "a,b"}) {
+		t.Fatalf("unexpected headers: %v", headers)
+	}
+	if _, err := parseOTLPHeaders("api-key"); err == nil {
+		t.Fatal("expected error")
+	}
+}
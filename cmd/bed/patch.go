@@ -0,0 +1,56 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/benbjohnson/bed"
+)
+
+// patchHelp describes the answers to a patch prompt.
+const patchHelp = `y - accept this match
+n - skip this match
+e - edit this match in the editor
+a - accept this match & all remaining matches
+q - skip this match & all remaining matches
+`
+
+// patchMatches walks through matches one at a time and asks whether each
+// one should be accepted, skipped or edited. Matches are displayed to w and
+// edit is used to edit an individual match. Returns the accepted matches.
+func patchMatches(p prompter, w io.Writer, matches []*bed.Match, edit func(m *bed.Match) ([]*bed.Match, error)) ([]*bed.Match, error) {
+	var accepted []*bed.Match
+	for i, m := range matches {
+		fmt.Fprintf(w, "\n%s @ %d (%d/%d)\n", m.Path, m.Pos, i+1, len(matches))
+		fmt.Fprintf(w, "%s\n", m.Data)
+
+		answer, err := p.Prompt(&Prompt{
+			Message: "Accept this match",
+			Choices: []string{"y", "n", "e", "a", "q"},
+			Help:    patchHelp,
+			Match:   m,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		switch answer {
+		case "y":
+			accepted = append(accepted, m)
+		case "e":
+			a, err := edit(m)
+			if err != nil {
+				return nil, err
+			}
+			accepted = append(accepted, a...)
+		case "a":
+			return append(accepted, matches[i:]...), nil
+		case "q":
+			return accepted, nil
+		}
+	}
+	return accepted, nil
+}
@@ -0,0 +1,96 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// progressDelay is how long an apply runs before progress is shown, so
+// that applies which finish quickly do not draw a progress bar at all.
+const progressDelay = 1 * time.Second
+
+// progressInterval is the minimum time between redraws of the progress bar.
+const progressInterval = 100 * time.Millisecond
+
+// progressBarWidth is the width of the progress bar, in characters.
+const progressBarWidth = 30
+
+// applyProgress reports the number of files applied & the estimated time
+// remaining. The bar is redrawn in place on a terminal. Plain progress is
+// written as a line at every 10% instead so it can be read by screen
+// readers. A nil *applyProgress reports nothing.
+type applyProgress struct {
+	w     io.Writer
+	plain bool
+	total int
+	done  int
+	start time.Time
+
+	drawn   time.Time // time of the last redraw
+	percent int       // percentage last written in plain mode, or -1
+}
+
+// newApplyProgress returns progress for applying changes to total files.
+// Returns nil if stderr is not a terminal.
+func newApplyProgress(total int, plain bool) *applyProgress {
+	if !isTerminal(os.Stderr) {
+		return nil
+	}
+	return &applyProgress{w: os.Stderr, plain: plain, total: total, start: time.Now(), percent: -1}
+}
+
+// update records that a file has been applied & redraws the progress.
+func (p *applyProgress) update() {
+	if p == nil {
+		return
+	}
+	p.done++
+
+	now := time.Now()
+	if now.Sub(p.start) < progressDelay {
+		return
+	}
+
+	percent := p.done * 100 / p.total
+	if p.plain {
+		if p.percent < 0 || percent/10 > p.percent/10 {
+			fmt.Fprintf(p.w, "applied %d of %d files (%d%%)%s\n", p.done, p.total, percent, p.eta(now, ", about %s remaining"))
+			p.percent = percent
+		}
+		return
+	} else if now.Sub(p.drawn) < progressInterval && p.done < p.total {
+		return
+	}
+	p.drawn = now
+
+	n := p.done * progressBarWidth / p.total
+	fmt.Fprintf(p.w, "\r\x1b[K[%s%s] %d/%d files %3d%%%s",
+		strings.Repeat("=", n), strings.Repeat(" ", progressBarWidth-n),
+		p.done, p.total, percent, p.eta(now, " ETA %s"),
+	)
+}
+
+// eta returns the estimated time remaining formatted with format, or a
+// blank string once every file has been applied.
+func (p *applyProgress) eta(now time.Time, format string) string {
+	if p.done >= p.total {
+		return ""
+	}
+	elapsed := now.Sub(p.start)
+	remaining := elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)
+	return fmt.Sprintf(format, remaining.Round(time.Second))
+}
+
+// finish clears the progress bar so that later output starts on a new line.
+func (p *applyProgress) finish() {
+	if p == nil || p.plain || p.drawn.IsZero() {
+		return
+	}
+	fmt.Fprint(p.w, "\r\x1b[K")
+}
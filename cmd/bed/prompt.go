@@ -0,0 +1,190 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// ttyPath is the path to the controlling terminal.
+var ttyPath = func() string {
+	if runtime.GOOS == "windows" {
+		return "CONIN$"
+	}
+	return "/dev/tty"
+}()
+
+// ttyOutPath is the path used to write to the controlling terminal.
+var ttyOutPath = func() string {
+	if runtime.GOOS == "windows" {
+		return "CONOUT$"
+	}
+	return "/dev/tty"
+}()
+
+// hasTTY returns true if the controlling terminal can be opened.
+func hasTTY() bool {
+	f, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// Prompt represents a question asked of the user.
+type Prompt struct {
+	Message string     // question text
+	Choices []string   // valid answers
+	Help    string     // description of each answer
+	Match   *bed.Match // match the question refers to, if any
+}
+
+// prompter asks the user questions & returns their answers.
+type prompter interface {
+	Prompt(p *Prompt) (string, error)
+}
+
+// openPrompter returns a prompter which communicates over the file
+// descriptor fd, if non-negative, or the controlling terminal otherwise.
+// If isJSON is true then prompts & answers are encoded as JSON.
+func openPrompter(fd int, isJSON bool) (prompter, io.Closer, error) {
+	var r io.Reader
+	var w io.Writer
+	var f *os.File
+	if fd >= 0 {
+		f = os.NewFile(uintptr(fd), "prompt")
+		r, w = f, f
+	} else {
+		var err error
+		if f, err = os.Open(ttyPath); err != nil {
+			return nil, nil, fmt.Errorf("cannot prompt without a terminal: %s", err)
+		}
+		r, w = f, os.Stderr
+	}
+
+	if isJSON {
+		return &jsonPrompter{r: bufio.NewReader(r), w: w}, f, nil
+	}
+	return &textPrompter{r: bufio.NewReader(r), w: w}, f, nil
+}
+
+// textPrompter asks questions as human-readable text.
+type textPrompter struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// Prompt asks the question until a valid answer is given.
+func (p *textPrompter) Prompt(prompt *Prompt) (string, error) {
+	for {
+		fmt.Fprintf(p.w, "%s [%s]? ", prompt.Message, strings.Join(append(prompt.Choices, "?"), ","))
+
+		line, err := p.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return "", io.ErrUnexpectedEOF
+		} else if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		answer := strings.TrimSpace(line)
+		for _, choice := range prompt.Choices {
+			if answer == choice {
+				return answer, nil
+			}
+		}
+		fmt.Fprint(p.w, prompt.Help)
+	}
+}
+
+// jsonPrompter asks questions as JSON objects, one per line, so prompts
+// can be answered programmatically by wrapper programs.
+//
+// Each prompt is written as an object with the following format:
+//
+//	{"type":"prompt","message":"...","choices":["y","n"],"match":{...}}
+//
+// And each answer is read as a single line in the format:
+//
+//	{"answer":"y"}
+//
+// An object with an "error" type is written if the answer is invalid and
+// the prompt is then repeated.
+type jsonPrompter struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+type promptJSON struct {
+	Type    string           `json:"type"`
+	Message string           `json:"message"`
+	Choices []string         `json:"choices,omitempty"`
+	Match   *promptMatchJSON `json:"match,omitempty"`
+}
+
+type promptMatchJSON struct {
+	Path string `json:"path"`
+	Pos  int    `json:"pos"`
+	Len  int    `json:"len"`
+	Data string `json:"data"`
+}
+
+type answerJSON struct {
+	Answer string `json:"answer"`
+}
+
+// Prompt writes the question & reads answers until a valid answer is given.
+func (p *jsonPrompter) Prompt(prompt *Prompt) (string, error) {
+	msg := promptJSON{Type: "prompt", Message: prompt.Message, Choices: prompt.Choices}
+	if m := prompt.Match; m != nil {
+		msg.Match = &promptMatchJSON{Path: m.Path, Pos: m.Pos, Len: m.Len, Data: string(m.Data)}
+	}
+
+	for {
+		if err := p.write(msg); err != nil {
+			return "", err
+		}
+
+		line, err := p.r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return "", io.ErrUnexpectedEOF
+		} else if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		var answer answerJSON
+		if err := json.Unmarshal(line, &answer); err != nil {
+			if err := p.write(promptJSON{Type: "error", Message: "invalid answer: " + err.Error()}); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		for _, choice := range prompt.Choices {
+			if answer.Answer == choice {
+				return answer.Answer, nil
+			}
+		}
+		if err := p.write(promptJSON{Type: "error", Message: fmt.Sprintf("invalid answer: %q", answer.Answer)}); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (p *jsonPrompter) write(v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = p.w.Write(append(buf, '\n'))
+	return err
+}
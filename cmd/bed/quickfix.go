@@ -0,0 +1,166 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// location is the line & column of the start of a match, numbered from 1.
+// Columns are counted in bytes, as editors such as Vim expect.
+type location struct {
+	Path string
+	Line int
+	Col  int
+	Text string // first line of the match
+}
+
+// matchLocations returns the location of each match.
+func matchLocations(matches []*bed.Match) []location {
+	locs := make([]location, 0, len(matches))
+	for _, m := range matches {
+		text := string(m.Data)
+		if i := strings.IndexByte(text, '\n'); i != -1 {
+			text = text[:i]
+		}
+		locs = append(locs, location{Path: m.Path, Line: m.Line, Col: m.Col, Text: text})
+	}
+	return locs
+}
+
+// writeQuickfix writes locations in the "path:line:col: text" format used by
+// Vim's quickfix list & compilers' error messages.
+func writeQuickfix(w io.Writer, locs []location) error {
+	for _, loc := range locs {
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: %s\n", loc.Path, loc.Line, loc.Col, strings.TrimRight(loc.Text, "\r")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Kinds of editors which can open a list of locations.
+const (
+	editorKindVim  = "vim"
+	editorKindCode = "code"
+)
+
+// editorKinds maps editor commands to the way they open location lists.
+var editorKinds = map[string]string{
+	"vi":            editorKindVim,
+	"vim":           editorKindVim,
+	"view":          editorKindVim,
+	"nvim":          editorKindVim,
+	"gvim":          editorKindVim,
+	"mvim":          editorKindVim,
+	"code":          editorKindCode,
+	"code-insiders": editorKindCode,
+	"code-oss":      editorKindCode,
+	"codium":        editorKindCode,
+	"vscodium":      editorKindCode,
+}
+
+// editorKind returns the kind of the editor command, if known.
+func editorKind(editor string) string {
+	a, err := splitEditor(editor)
+	if err != nil || len(a) == 0 {
+		return ""
+	}
+	return editorKinds[editorName(a[0])]
+}
+
+// markMatches opens the locations of matches in the editor, such as in
+// Vim's quickfix list, so they can be edited in place instead of in a match
+// file. If server is set then the list is loaded into the Vim server with
+// that name instead. If the editor cannot open location lists then they are
+// written to STDOUT.
+func markMatches(editor, server, waitFlag string, matches []*bed.Match) error {
+	locs := matchLocations(matches)
+
+	kind := editorKind(editor)
+	if server != "" {
+		kind = editorKindVim
+	}
+
+	switch kind {
+	case editorKindVim:
+		// A server may be running in another directory so use absolute paths.
+		if server != "" {
+			for i := range locs {
+				var err error
+				if locs[i].Path, err = filepath.Abs(locs[i].Path); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Write the quickfix file. It is kept for a server since it is loaded
+		// after bed exits.
+		f, err := ioutil.TempFile("", "bed-"+runID+"-*.qf")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if server == "" {
+			defer os.Remove(f.Name())
+		}
+
+		if err := writeQuickfix(f, locs); err != nil {
+			return err
+		} else if err := f.Close(); err != nil {
+			return err
+		}
+
+		if server != "" {
+			return sendVimServer(editor, server, fmt.Sprintf(`<C-\><C-N>:cfile %s<CR>`, vimEscape(f.Name())))
+		}
+		return runEditor(editor, []string{"-q", f.Name()}, waitFlag)
+
+	case editorKindCode:
+		args := []string{"--goto"}
+		for _, loc := range locs {
+			args = append(args, fmt.Sprintf("%s:%d:%d", loc.Path, loc.Line, loc.Col))
+		}
+		return runEditor(editor, args, waitFlag)
+
+	default:
+		return writeQuickfix(os.Stdout, locs)
+	}
+}
+
+// sendVimServer sends keys to the Vim server with the given name. Uses the
+// editor's command if it is a Vim, otherwise "vim".
+func sendVimServer(editor, server, keys string) error {
+	name := "vim"
+	if a, err := splitEditor(editor); err == nil && len(a) > 0 && editorKind(editor) == editorKindVim {
+		name = a[0]
+	}
+
+	cmd := exec.Command(name, "--servername", server, "--remote-send", keys)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("send to vim server %q: %s", server, err)
+	}
+	return nil
+}
+
+// vimEscape escapes spaces & special characters in a path for an Ex command.
+func vimEscape(path string) string {
+	var buf strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(` \|"%#<`, r) {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
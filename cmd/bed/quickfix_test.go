@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestWriteMatches_Quickfix(t *testing.T) {
+	matches := []*bed.Match{
+		{Path: "a.go", Line: 3, Col: 5, Data: []byte("foo\r\nbar")},
+		{Path: "b/c.go", Line: 10, Col: 1, Data: []byte("baz")},
+	}
+
+	var buf bytes.Buffer
+	if err := writeMatches(&buf, "quickfix", matches, reportOptions{}); err != nil {
+		t.Fatal(err)
+	} else if got, want := buf.String(), "a.go:3:5: foo\nb/c.go:10:1: baz\n"; got != want {
+		t.Fatalf("unexpected output:\n%s", got)
+	}
+}
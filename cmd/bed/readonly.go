@@ -0,0 +1,154 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// Policies for handling read-only files during apply.
+const (
+	ReadOnlySkip   = "skip"   // leave read-only files unchanged
+	ReadOnlyForce  = "force"  // temporarily make read-only files writable
+	ReadOnlyPrompt = "prompt" // ask whether to skip or force each file
+)
+
+// validReadOnlyPolicy returns true if policy is blank or a known policy.
+func validReadOnlyPolicy(policy string) bool {
+	switch policy {
+	case "", ReadOnlySkip, ReadOnlyForce, ReadOnlyPrompt:
+		return true
+	default:
+		return false
+	}
+}
+
+// preflightReadOnly checks every file that will be modified before any
+// changes are applied so that an apply does not fail midway. Matches in
+// read-only files are removed or kept based on policy. If policy is blank
+// then an error listing the read-only files is returned.
+func preflightReadOnly(matches []*bed.Match, policy string, p prompter) ([]*bed.Match, error) {
+	paths, _ := bed.GroupMatchesByPath(matches)
+
+	var readOnly []string
+	for _, path := range paths {
+		if ok, err := isReadOnly(path); err != nil {
+			return nil, err
+		} else if ok {
+			readOnly = append(readOnly, path)
+		}
+	}
+	if len(readOnly) == 0 {
+		return matches, nil
+	}
+
+	// Determine which read-only files to leave unchanged.
+	skip := make(map[string]bool)
+	switch policy {
+	case "":
+		return nil, fmt.Errorf("cannot modify read-only file(s), use -readonly=skip|force|prompt:\n\t%s", strings.Join(readOnly, "\n\t"))
+	case ReadOnlySkip:
+		for _, path := range readOnly {
+			skip[path] = true
+		}
+	case ReadOnlyPrompt:
+		for _, path := range readOnly {
+			answer, err := p.Prompt(&Prompt{
+				Message: fmt.Sprintf("Modify read-only file %s", path),
+				Choices: []string{"y", "n"},
+				Help:    "y - make the file writable while applying changes\nn - leave the file unchanged\n",
+			})
+			if err != nil {
+				return nil, err
+			}
+			skip[path] = answer != "y"
+		}
+	}
+
+	a := make([]*bed.Match, 0, len(matches))
+	for _, m := range matches {
+		if skip[m.Path] {
+			log.Printf("skipping read-only file: %s", m.Path)
+			continue
+		}
+		a = append(a, m)
+	}
+	return a, nil
+}
+
+// checkPermissions checks that every file containing matches can be read &
+// written before any editing is done so permission problems are reported
+// upfront instead of after the matches have been edited. Read-only files are
+// only reported if policy is blank since other policies handle them when
+// changes are applied. Files in read-only directories are rewritten in place
+// instead of atomically so they only cause a warning, unless they are being
+// deleted.
+func checkPermissions(matches []*bed.Match, policy string, followSymlinks bool) error {
+	paths, pathMatches := bed.GroupMatchesByPath(matches)
+
+	var unreadable, readOnly, noDelete, inPlace []string
+	dirs := make(map[string]bool)
+	for i, path := range paths {
+		if ok, err := isUnreadable(path); err != nil {
+			return err
+		} else if ok {
+			unreadable = append(unreadable, path)
+		}
+
+		if ok, err := isReadOnly(path); err != nil {
+			return err
+		} else if ok && policy == "" {
+			readOnly = append(readOnly, path)
+		}
+
+		// Deleting a file removes its link from its own directory while
+		// rewriting it replaces the file which a symlink points to.
+		deletes := bed.DeletesFile(pathMatches[i])
+		target := path
+		if followSymlinks && !deletes {
+			if s, err := filepath.EvalSymlinks(path); err == nil {
+				target = s
+			}
+		}
+
+		dir := filepath.Dir(target)
+		writable, ok := dirs[dir]
+		if !ok {
+			writable = isDirWritable(dir)
+			dirs[dir] = writable
+		}
+		if writable {
+			continue
+		} else if deletes {
+			noDelete = append(noDelete, path)
+		} else {
+			inPlace = append(inPlace, path)
+		}
+	}
+
+	if len(inPlace) > 0 {
+		warnf("file(s) in read-only directories will be rewritten in place instead of atomically:\n\t%s", strings.Join(inPlace, "\n\t"))
+	}
+
+	var msgs []string
+	if len(unreadable) > 0 {
+		msgs = append(msgs, fmt.Sprintf("cannot read file(s):\n\t%s", strings.Join(unreadable, "\n\t")))
+	}
+	if len(readOnly) > 0 {
+		msgs = append(msgs, fmt.Sprintf("cannot modify read-only file(s), use -readonly=skip|force|prompt:\n\t%s", strings.Join(readOnly, "\n\t")))
+	}
+	if len(noDelete) > 0 {
+		msgs = append(msgs, fmt.Sprintf("cannot delete file(s) in read-only directories:\n\t%s", strings.Join(noDelete, "\n\t")))
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !audit
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!audit
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// isReadOnly returns true if the file at path has no owner write permission
+// or cannot be opened for writing by the current user.
+func isReadOnly(path string) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	} else if fi.Mode().Perm()&0200 == 0 {
+		return true, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsPermission(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, f.Close()
+}
+
+// isUnreadable returns true if the file at path cannot be opened for reading
+// by the current user.
+func isUnreadable(path string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsPermission(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, f.Close()
+}
+
+// isDirWritable returns true if a file can be created in dir.
+func isDirWritable(dir string) bool {
+	f, err := ioutil.TempFile(dir, ".bed-check-")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
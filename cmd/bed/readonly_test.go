@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestRun_Permissions checks that files which cannot be read or written are
+// all reported before any file is changed. Files in read-only directories
+// can still be changed.
+func TestRun_Permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires unix file permissions")
+	} else if os.Geteuid() == 0 {
+		t.Skip("file permissions do not apply to root")
+	}
+
+	for _, tt := range []struct {
+		name  string
+		setup func(t *testing.T)
+		err   string
+	}{
+		{
+			name:  "ReadOnly",
+			setup: func(t *testing.T) { chmodTest(t, "b.txt", 0444) },
+			err:   "cannot modify read-only file(s), use -readonly=skip|force|prompt:\n\tb.txt",
+		},
+		{
+			name:  "Unreadable",
+			setup: func(t *testing.T) { chmodTest(t, "b.txt", 0200) },
+			err:   "cannot read file(s):\n\tb.txt",
+		},
+		{
+			name:  "ReadOnlyDir",
+			setup: func(t *testing.T) { chmodTest(t, "dir", 0555) },
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirTemp(t)
+			writeTestFile(t, "a.txt", "foo\n")
+			writeTestFile(t, "b.txt", "foo\n")
+			if err := os.Mkdir("dir", 0755); err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, "dir/c.txt", "foo\n")
+			tt.setup(t)
+
+			err := Run([]string{"-replace", "bar", "foo", "a.txt", "b.txt", "dir/c.txt"})
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				} else if s := readTestFile(t, "dir/c.txt"); s != "bar\n" {
+					t.Fatalf("unexpected contents: %q", s)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			} else if s := readTestFile(t, "a.txt"); s != "foo\n" {
+				t.Fatalf("unexpected contents: %q", s)
+			}
+		})
+	}
+}
+
+// chmodTest changes the mode of path & restores it once the test is done so
+// the temporary directory can be removed.
+func chmodTest(t *testing.T, path string, mode os.FileMode) {
+	t.Helper()
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(path, 0755) })
+}
@@ -0,0 +1,44 @@
+//go:build (aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris) && !audit
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+// +build !audit
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// isReadOnly returns true if the current user cannot write to the file at
+// path. access(2) is used instead of the mode bits since root can write to
+// files without write permission & ACLs can grant or deny access.
+func isReadOnly(path string) (bool, error) {
+	ok, err := access(path, unix.W_OK)
+	return !ok && err == nil, err
+}
+
+// isUnreadable returns true if the current user cannot read the file at path.
+func isUnreadable(path string) (bool, error) {
+	ok, err := access(path, unix.R_OK)
+	return !ok && err == nil, err
+}
+
+// isDirWritable returns true if files can be created & removed in dir.
+func isDirWritable(dir string) bool {
+	ok, _ := access(dir, unix.W_OK|unix.X_OK)
+	return ok
+}
+
+// access returns true if the current user has mode access to path. Errors
+// other than a lack of permission are returned.
+func access(path string, mode uint32) (bool, error) {
+	switch err := unix.Access(path, mode); err {
+	case nil:
+		return true, nil
+	case unix.EACCES, unix.EPERM, unix.EROFS:
+		return false, nil
+	default:
+		return false, &os.PathError{Op: "access", Path: path, Err: err}
+	}
+}
@@ -0,0 +1,69 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestIsReadOnly(t *testing.T) {
+	chdirTemp(t)
+	writeTestFile(t, "a.txt", "foo")
+	if err := os.Chmod("a.txt", 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	// Root can write to files without write permission.
+	if ok, err := isReadOnly("a.txt"); err != nil {
+		t.Fatal(err)
+	} else if want := os.Geteuid() != 0; ok != want {
+		t.Fatalf("isReadOnly()=%v, want %v", ok, want)
+	}
+	if _, err := isReadOnly("missing.txt"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions do not apply to root")
+	}
+	chdirTemp(t)
+	writeTestFile(t, "a.txt", "foo")
+	writeTestFile(t, "b.txt", "foo")
+	if err := os.Mkdir("ro", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, "ro/c.txt", "foo")
+	if err := os.Chmod("b.txt", 0200); err != nil {
+		t.Fatal(err)
+	} else if err := os.Chmod("ro", 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod("ro", 0755)
+
+	for _, tt := range []struct {
+		name    string
+		matches []*bed.Match
+		err     string
+	}{
+		{name: "OK", matches: []*bed.Match{{Path: "a.txt"}}},
+		{name: "Unreadable", matches: []*bed.Match{{Path: "a.txt"}, {Path: "b.txt"}}, err: "cannot read file(s):\n\tb.txt"},
+		{name: "ReadOnlyDir", matches: []*bed.Match{{Path: "ro/c.txt"}}},
+		{name: "DeleteInReadOnlyDir", matches: []*bed.Match{{Path: "ro/c.txt", Directive: bed.DirectiveDeleteFile}}, err: "cannot delete file(s) in read-only directories:\n\tro/c.txt"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPermissions(tt.matches, "", true)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
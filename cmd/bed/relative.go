@@ -0,0 +1,98 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// writeMatchFile writes matches to w using the given options. If
+// relative is true then paths are written relative to the root of the
+// current checkout, which is recorded at the top of the file, so that the
+// match file can be applied to another checkout of the same repository.
+func writeMatchFile(w io.Writer, matches []*bed.Match, opt bed.WriteOptions, relative bool) error {
+	if relative {
+		base, err := checkoutRoot("")
+		if err != nil {
+			return err
+		} else if matches, err = relativeMatches(matches, base); err != nil {
+			return err
+		} else if err := bed.WriteMatchBase(w, base); err != nil {
+			return err
+		}
+	}
+	return bed.WriteMatchFileOptions(w, matches, opt)
+}
+
+// checkoutRoot returns the top-level directory of the git worktree
+// containing the current directory. Outside of a worktree, base is returned
+// if it is an existing directory, otherwise the current directory.
+func checkoutRoot(base string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	} else if root, err := gitWorktreeRoot(wd); err == nil {
+		return root, nil
+	}
+	if base != "" {
+		if fi, err := os.Stat(base); err == nil && fi.IsDir() {
+			return base, nil
+		}
+	}
+	return wd, nil
+}
+
+// relativeMatches returns copies of matches with paths relative to base,
+// using forward slashes. Returns an error if a path is outside of base.
+func relativeMatches(matches []*bed.Match, base string) ([]*bed.Match, error) {
+	other := make([]*bed.Match, len(matches))
+	for i, m := range matches {
+		abs, err := filepath.Abs(m.Path)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(bed.ResolveDir(base), bed.ResolveDir(filepath.Dir(abs)))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s: path is outside of base directory %s", m.Path, base)
+		}
+
+		cp := *m
+		cp.Path = filepath.ToSlash(filepath.Join(rel, filepath.Base(abs)))
+		other[i] = &cp
+	}
+	return other, nil
+}
+
+// readMatchFile reads the matches from the match file at path. Paths which
+// were written relative to a base directory are resolved from the root of
+// the current checkout & made relative to the current directory.
+func readMatchFile(path string) ([]*bed.Match, error) {
+	matches, base, err := bed.ReadMatchFileBase(path)
+	if err != nil || base == "" {
+		return matches, err
+	}
+
+	root, err := checkoutRoot(base)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		p := filepath.Join(root, filepath.FromSlash(m.Path))
+		if rel, err := filepath.Rel(bed.ResolveDir(wd), bed.ResolveDir(filepath.Dir(p))); err == nil {
+			p = filepath.Join(rel, filepath.Base(p))
+		}
+		m.Path = p
+	}
+	return matches, nil
+}
@@ -0,0 +1,267 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// remotePathRegexp matches paths of files on other hosts, such as
+// "user@host:/etc/nginx/nginx.conf". The path on the host must be absolute
+// & the host at least two characters so that Windows paths, such as
+// "C:/foo", & relative paths containing colons are not mistaken for them.
+// Neither the user nor the host may begin with "-" so they cannot be read
+// as options by sftp.
+var remotePathRegexp = regexp.MustCompile(`^((?:[^@/:\s-][^@/:\s]*@)?(?:[A-Za-z0-9][A-Za-z0-9.-]+|\[[0-9A-Fa-f:.]+\])):(/.*)$`)
+
+// parseRemotePath returns the host, including any user, & the path on the
+// host of a remote path. Existing local files are never remote.
+func parseRemotePath(path string) (host, file string, ok bool) {
+	a := remotePathRegexp.FindStringSubmatch(path)
+	if a == nil {
+		return "", "", false
+	} else if _, err := os.Lstat(path); err == nil {
+		return "", "", false
+	}
+	return a[1], a[2], true
+}
+
+// remoteFiles are files on other hosts which are edited over SFTP. Each
+// file is downloaded to a local mirror, which is searched & changed like
+// any other file, & changed files are uploaded once changes are applied.
+// The "sftp" command is used so the SSH configuration, keys & agent are
+// used as they are by ssh.
+type remoteFiles struct {
+	dir    string            // local mirror of remote files
+	local  map[string]string // mirror paths by remote path
+	remote map[string]string // remote paths by mirror path
+	sums   map[string]uint32 // checksums of mirror files when downloaded
+}
+
+// used returns true if any remote files were downloaded.
+func (r *remoteFiles) used() bool {
+	return len(r.local) > 0
+}
+
+// fetch downloads the remote files in paths to the mirror, with one SFTP
+// session per host. Paths which are not remote are ignored.
+func (r *remoteFiles) fetch(paths []string) error {
+	hosts := make(map[string][]string)
+	for _, path := range paths {
+		if host, _, ok := parseRemotePath(path); ok && r.local[path] == "" {
+			hosts[host] = append(hosts[host], path)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	if r.dir == "" {
+		dir, err := ioutil.TempDir("", "bed-"+runID+"-remote-")
+		if err != nil {
+			return err
+		}
+		r.dir = dir
+		r.local, r.remote, r.sums = make(map[string]string), make(map[string]string), make(map[string]uint32)
+	}
+
+	for _, host := range sortedKeys(hosts) {
+		var batch strings.Builder
+		for _, path := range hosts[host] {
+			_, file, _ := parseRemotePath(path)
+			local := filepath.Join(r.dir, host, filepath.FromSlash(file))
+			if err := os.MkdirAll(filepath.Dir(local), 0700); err != nil {
+				return err
+			}
+			fmt.Fprintf(&batch, "get %s %s\n", sftpQuote(file), sftpQuote(local))
+			r.local[path], r.remote[local] = local, path
+		}
+		if err := runSFTP(host, batch.String()); err != nil {
+			return err
+		}
+
+		for _, path := range hosts[host] {
+			data, err := ioutil.ReadFile(r.local[path])
+			if err != nil {
+				return err
+			}
+			r.sums[r.local[path]] = checksum(data)
+		}
+		log.Printf("info: downloaded %d file(s) from %s", len(hosts[host]), host)
+	}
+	return nil
+}
+
+// display sets the path of matches of mirrored files to their remote path
+// so they are shown & edited as the remote file.
+func (r *remoteFiles) display(matches []*bed.Match) {
+	for _, m := range matches {
+		if path, ok := r.remote[m.Path]; ok {
+			m.Path = path
+		}
+	}
+}
+
+// localize sets the path of matches of remote files to the path of their
+// local mirror so changes can be applied to it.
+func (r *remoteFiles) localize(matches []*bed.Match) {
+	for _, m := range matches {
+		if path, ok := r.local[m.Path]; ok {
+			m.Path = path
+		}
+	}
+}
+
+// localMatches returns copies of matches with the paths of their local
+// mirrors instead of their remote paths.
+func (r *remoteFiles) localMatches(matches []*bed.Match) []*bed.Match {
+	other := make([]*bed.Match, len(matches))
+	for i, m := range matches {
+		cp := *m
+		other[i] = &cp
+	}
+	r.localize(other)
+	return other
+}
+
+// upload writes the mirrors of the remote files changed by matches back to
+// their hosts. Every file is first checked to be unchanged on its host since
+// it was downloaded so that concurrent changes are not overwritten. Files
+// are uploaded to a temporary file which is given the mode of the original
+// & then renamed over it, & files deleted by changes are removed. Ownership
+// cannot be kept, so uploaded files are owned by the SSH user.
+func (r *remoteFiles) upload(matches []*bed.Match) error {
+	paths, _ := bed.GroupMatchesByPath(matches)
+	hosts := make(map[string][]string)
+	for _, local := range paths {
+		if path, ok := r.remote[local]; ok {
+			host, _, _ := parseRemotePath(path)
+			hosts[host] = append(hosts[host], local)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	// Download each file again, with its mode, & compare it to the original
+	// download.
+	checkDir, err := ioutil.TempDir(r.dir, ".check-")
+	if err != nil {
+		return err
+	}
+	modes := make(map[string]os.FileMode)
+	for _, host := range sortedKeys(hosts) {
+		var batch strings.Builder
+		for i, local := range hosts[host] {
+			_, file, _ := parseRemotePath(r.remote[local])
+			fmt.Fprintf(&batch, "get -p %s %s\n", sftpQuote(file), sftpQuote(filepath.Join(checkDir, fmt.Sprint(i))))
+		}
+		if err := runSFTP(host, batch.String()); err != nil {
+			return err
+		}
+		for i, local := range hosts[host] {
+			path := filepath.Join(checkDir, fmt.Sprint(i))
+			if data, err := ioutil.ReadFile(path); err != nil {
+				return err
+			} else if checksum(data) != r.sums[local] {
+				return fmt.Errorf("%s: file changed on its host since it was downloaded, no changes were uploaded", r.remote[local])
+			}
+
+			fi, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			modes[local] = fi.Mode().Perm()
+		}
+	}
+
+	for _, host := range sortedKeys(hosts) {
+		if err := runSFTP(host, r.uploadBatch(hosts[host], modes)); err != nil {
+			return err
+		}
+		for _, local := range hosts[host] {
+			log.Printf("info: uploaded %s", r.remote[local])
+		}
+	}
+	return nil
+}
+
+// uploadBatch returns the sftp batch commands which replace the remote file
+// of each mirror in locals, giving it the mode in modes, or which remove the
+// remote file if its mirror was deleted.
+func (r *remoteFiles) uploadBatch(locals []string, modes map[string]os.FileMode) string {
+	var batch strings.Builder
+	for _, local := range locals {
+		_, file, _ := parseRemotePath(r.remote[local])
+		if _, err := os.Stat(local); os.IsNotExist(err) {
+			fmt.Fprintf(&batch, "rm %s\n", sftpQuote(file))
+			continue
+		}
+		tmp := file + ".bed-" + runID
+		fmt.Fprintf(&batch, "put %s %s\n", sftpQuote(local), sftpQuote(tmp))
+		fmt.Fprintf(&batch, "chmod %04o %s\n", modes[local], sftpQuote(tmp))
+		fmt.Fprintf(&batch, "rename %s %s\n", sftpQuote(tmp), sftpQuote(file))
+	}
+	return batch.String()
+}
+
+// close removes the local mirror.
+func (r *remoteFiles) close() error {
+	if r.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(r.dir)
+}
+
+// runSFTP runs the sftp batch commands on host. Batches stop at the first
+// command which fails.
+func runSFTP(host, batch string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("sftp", "-q", "-b", "-", "--", host)
+	cmd.Stdin = strings.NewReader(batch)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("sftp %s: %s", host, msg)
+		}
+		return fmt.Errorf("sftp %s: %s", host, err)
+	}
+	return nil
+}
+
+// sftpQuote quotes s as an argument of an sftp batch command. Glob
+// characters are escaped so paths are used literally.
+func sftpQuote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, c := range s {
+		if strings.ContainsRune(`"\*?[]`, c) {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(c)
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRemotePath(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		host string
+		file string
+		ok   bool
+	}{
+		{path: "web1:/etc/nginx/nginx.conf", host: "web1", file: "/etc/nginx/nginx.conf", ok: true},
+		{path: "root@web1:/etc/hosts", host: "root@web1", file: "/etc/hosts", ok: true},
+		{path: "[::1]:/tmp/x", host: "[::1]", file: "/tmp/x", ok: true},
+		{path: "C:/foo", ok: false},
+		{path: "a:b", ok: false},
+		{path: "web1:relative", ok: false},
+		{path: "-oProxyCommand=sh@h:/x", ok: false},
+		{path: "-oProxyCommand=sh:/x", ok: false},
+		{path: "u@-host:/x", ok: false},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			host, file, ok := parseRemotePath(tt.path)
+			if ok != tt.ok || host != tt.host || file != tt.file {
+				t.Fatalf("unexpected result: %q %q %v", host, file, ok)
+			}
+		})
+	}
+}
+
+func TestRemoteFiles_UploadBatch(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeTestFile(t, a, "foo\n")
+	r := &remoteFiles{remote: map[string]string{a: "web1:/etc/a.conf", b: "web1:/etc/b *.conf"}}
+
+	// Changed files keep the mode of the file they replace & deleted files
+	// are removed.
+	batch := r.uploadBatch([]string{a, b}, map[string]os.FileMode{a: 0640})
+	if want := `put ` + sftpQuote(a) + ` "/etc/a.conf.bed-` + runID + `"` + "\n" +
+		`chmod 0640 "/etc/a.conf.bed-` + runID + `"` + "\n" +
+		`rename "/etc/a.conf.bed-` + runID + `" "/etc/a.conf"` + "\n" +
+		`rm "/etc/b \*.conf"` + "\n"; batch != want {
+		t.Fatalf("unexpected batch:\n%s", batch)
+	}
+}
@@ -0,0 +1,170 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// Policies for handling files which changed between searching & applying.
+const (
+	DriftOff    = "off"    // apply changes without checking files
+	DriftSkip   = "skip"   // leave changed files unchanged
+	DriftStrict = "strict" // apply no changes if any file changed
+)
+
+// validDriftPolicy returns true if policy is a known drift policy.
+func validDriftPolicy(policy string) bool {
+	switch policy {
+	case DriftOff, DriftSkip, DriftStrict:
+		return true
+	default:
+		return false
+	}
+}
+
+// Options used by -safe unless they are set explicitly.
+const (
+	DefaultBackupDir       = bed.StateDir + "/backups"
+	DefaultMaxChangedFiles = 50
+)
+
+// setSafe enables the conservative apply options of -safe, if specified by
+// the flag or the configuration, for any which were not set explicitly.
+// Returns true if safe mode is enabled.
+func (f *applyFlags) setSafe(fs *flag.FlagSet, config *Config) bool {
+	if !*f.safe && !config.Safe {
+		return false
+	}
+	*f.safe = true
+
+	if !isFlagSet(fs, "backup-dir") {
+		*f.backupDir = DefaultBackupDir
+	}
+	if !isFlagSet(fs, "drift") {
+		*f.drift = DriftStrict
+	}
+	if !isFlagSet(fs, "max-changed-files") {
+		*f.maxChangedFiles = DefaultMaxChangedFiles
+	}
+	return true
+}
+
+// checksum returns the checksum of a file's contents used to detect drift.
+func checksum(data []byte) uint32 {
+	return crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+}
+
+// preflightDrift checks that files are unchanged since they were searched,
+// based on their checksums at the time. Changes to files which have drifted
+// are dropped or rejected based on policy since their match positions may
+// no longer be valid. Files without a checksum are not checked.
+func preflightDrift(matches []*bed.Match, checksums map[string]uint32, policy string) ([]*bed.Match, error) {
+	if policy == DriftOff || len(checksums) == 0 {
+		return matches, nil
+	}
+
+	paths, _ := bed.GroupMatchesByPath(matches)
+	drifted := make(map[string]bool)
+	var a []string
+	for _, path := range paths {
+		sum, ok := checksums[path]
+		if !ok {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		} else if checksum(data) != sum {
+			drifted[path] = true
+			a = append(a, path)
+		}
+	}
+	if len(a) == 0 {
+		return matches, nil
+	} else if policy == DriftStrict {
+		return nil, fmt.Errorf("file(s) changed since they were searched, no changes applied:\n\t%s", strings.Join(a, "\n\t"))
+	}
+
+	other := make([]*bed.Match, 0, len(matches))
+	for _, m := range matches {
+		if drifted[m.Path] {
+			continue
+		}
+		other = append(other, m)
+	}
+	for _, path := range a {
+		warnf("skipping file changed since it was searched: %s", path)
+	}
+	return other, nil
+}
+
+// preflightProtected removes matches in paths matching the protected globs,
+// with a warning, or returns an error if enforce is true. Globs also match
+// the directories containing a path, e.g. "vendor" protects every file in
+// the vendor directory.
+func preflightProtected(matches []*bed.Match, globs []string, enforce bool) ([]*bed.Match, error) {
+	if len(globs) == 0 {
+		return matches, nil
+	}
+
+	paths, _ := bed.GroupMatchesByPath(matches)
+	var protected []string
+	for _, path := range paths {
+		if isProtected(path, globs) {
+			protected = append(protected, path)
+		}
+	}
+	if len(protected) == 0 {
+		return matches, nil
+	} else if enforce {
+		return nil, fmt.Errorf("cannot modify protected file(s):\n\t%s", strings.Join(protected, "\n\t"))
+	}
+
+	other := make([]*bed.Match, 0, len(matches))
+	for _, m := range matches {
+		if isProtected(m.Path, globs) {
+			continue
+		}
+		other = append(other, m)
+	}
+	for _, path := range protected {
+		warnf("skipping protected file: %s", path)
+	}
+	return other, nil
+}
+
+// isProtected returns true if path or one of its parent directories matches
+// any of globs.
+func isProtected(path string, globs []string) bool {
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		for _, glob := range globs {
+			if bed.MatchGlob(glob, p) {
+				return true
+			}
+		}
+		if dir := filepath.Dir(p); dir == p || dir == "." {
+			return false
+		}
+	}
+}
+
+// checkMaxChangedFiles returns an error if matches would change more than
+// max files. There is no limit if max is zero.
+func checkMaxChangedFiles(matches []*bed.Match, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	if paths, _ := bed.GroupMatchesByPath(matches); len(paths) > max {
+		return fmt.Errorf("%d files would be changed, more than the limit of %d, use -max-changed-files to raise it", len(paths), max)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	"github.com/benbjohnson/bed"
+)
+
+// sarifRuleID is the ID of the single rule which every match is reported
+// under: the pattern.
+const sarifRuleID = "pattern"
+
+// writeSARIFMatches writes matches as a SARIF 2.1.0 log, the format used to
+// upload code scanning results such as to GitHub, so bed can be used to
+// audit patterns in CI. Each match is a result of a rule for the pattern.
+// Columns are not reported since SARIF counts them in UTF-16 code units &
+// bed counts them in bytes.
+func writeSARIFMatches(w io.Writer, matches []*bed.Match, opt reportOptions) error {
+	rule := sarifRule{ID: sarifRuleID, ShortDescription: sarifMessage{Text: "Matches found by bed"}}
+	if opt.Pattern != "" {
+		rule.ShortDescription.Text = "Matches of " + opt.Pattern
+		rule.FullDescription = &sarifMessage{Text: "Text matching the regular expression " + opt.Pattern + "."}
+	}
+
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver = sarifDriver{
+		Name:           "bed",
+		InformationURI: "https://github.com/benbjohnson/bed",
+		Version:        bed.GetBuildInfo().Version,
+		Rules:          []sarifRule{rule},
+	}
+	for i, loc := range matchLocations(matches) {
+		m := matches[i]
+		text := loc.Text
+		if text == "" {
+			text = "empty match"
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:  sarifRuleID,
+			Level:   "warning",
+			Message: sarifMessage{Text: text},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation(m.Path),
+				Region: sarifRegion{
+					StartLine: loc.Line,
+					EndLine:   loc.Line + bytes.Count(m.Data, []byte("\n")),
+					Snippet:   &sarifMessage{Text: string(m.Data)},
+				},
+			}}},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// sarifArtifactLocation returns the location of the file at path. Relative
+// paths are relative to the root of the source, as code scanning expects
+// when bed is run from the root of a repository.
+func sarifArtifactLocation(path string) sarifArtifact {
+	if filepath.IsAbs(path) {
+		return sarifArtifact{URI: (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()}
+	}
+	return sarifArtifact{
+		URI:       (&url.URL{Path: filepath.ToSlash(filepath.Clean(path))}).String(),
+		URIBaseID: "%SRCROOT%",
+	}
+}
+
+// sarifLog is the root object of a SARIF log. Only the properties used by
+// bed are defined.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun is the results of a single run of a tool.
+type sarifRun struct {
+	Tool struct {
+		Driver sarifDriver `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+// sarifDriver describes the tool & the rules it checks.
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Version        string      `json:"version,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+// sarifRule describes a rule which results are reported under.
+type sarifRule struct {
+	ID               string        `json:"id"`
+	ShortDescription sarifMessage  `json:"shortDescription"`
+	FullDescription  *sarifMessage `json:"fullDescription,omitempty"`
+}
+
+// sarifResult is a single match reported under a rule.
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+// sarifMessage is text shown to the user.
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+// sarifLocation is the location of a result.
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+// sarifPhysicalLocation is a range of lines in a file.
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+// sarifArtifact is the location of a file, relative to uriBaseId if set.
+type sarifArtifact struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// sarifRegion is a range of lines, numbered from 1, & their text.
+type sarifRegion struct {
+	StartLine int           `json:"startLine"`
+	EndLine   int           `json:"endLine"`
+	Snippet   *sarifMessage `json:"snippet,omitempty"`
+}
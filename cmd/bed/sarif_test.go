@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestWriteSARIFMatches(t *testing.T) {
+	matches := []*bed.Match{
+		{Path: "a/b.go", Line: 3, Col: 5, Data: []byte("foo\nbar")},
+		{Path: "c d.go", Line: 1, Col: 1, Data: []byte("")},
+	}
+
+	var buf bytes.Buffer
+	if err := writeSARIFMatches(&buf, matches, reportOptions{Pattern: `fo+`}); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	} else if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+	run := log.Runs[0]
+	if rules := run.Tool.Driver.Rules; len(rules) != 1 || rules[0].ShortDescription.Text != "Matches of fo+" {
+		t.Fatalf("unexpected rules: %+v", rules)
+	} else if len(run.Results) != 2 {
+		t.Fatalf("unexpected results: %+v", run.Results)
+	}
+
+	for i, want := range []struct {
+		text, uri          string
+		startLine, endLine int
+	}{
+		{text: "foo", uri: "a/b.go", startLine: 3, endLine: 4},
+		{text: "empty match", uri: "c%20d.go", startLine: 1, endLine: 1},
+	} {
+		r := run.Results[i]
+		loc := r.Locations[0].PhysicalLocation
+		if r.RuleID != sarifRuleID || r.Message.Text != want.text {
+			t.Fatalf("%d: unexpected result: %+v", i, r)
+		} else if loc.ArtifactLocation.URI != want.uri || loc.ArtifactLocation.URIBaseID != "%SRCROOT%" {
+			t.Fatalf("%d: unexpected artifact: %+v", i, loc.ArtifactLocation)
+		} else if loc.Region.StartLine != want.startLine || loc.Region.EndLine != want.endLine {
+			t.Fatalf("%d: unexpected region: %+v", i, loc.Region)
+		}
+	}
+}
+
+// TestWriteSARIFMatches_NoMatches checks that results are an empty array,
+// not null, so code scanning clears previous results.
+func TestWriteSARIFMatches_NoMatches(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSARIFMatches(&buf, nil, reportOptions{}); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Contains(buf.Bytes(), []byte(`"results": []`)) {
+		t.Fatalf("expected empty results:\n%s", buf.String())
+	}
+}
+
+func TestSARIFArtifactLocation_Abs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix paths")
+	}
+	if a := sarifArtifactLocation(filepath.FromSlash("/src/a b.go")); a.URI != "file:///src/a%20b.go" || a.URIBaseID != "" {
+		t.Fatalf("unexpected artifact: %+v", a)
+	}
+}
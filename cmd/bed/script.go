@@ -0,0 +1,183 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// scriptHeader is written at the start of scripts generated by writeScript.
+// The copy function copies N bytes from STDIN to STDOUT using full blocks
+// where possible since dd with a block size of 1 is slow for large files.
+const scriptHeader = `#!/bin/sh
+#
+# Generated by bed. Applies %d change(s) to %d file(s). Files are checked
+# against their original checksums before any are modified. Relative paths
+# are resolved from the current directory.
+#
+set -eu
+
+copy() {
+	q=$(($1 / 4096)) r=$(($1 %% 4096))
+	if [ "$q" -gt 0 ]; then dd bs=4096 count="$q" 2>/dev/null; fi
+	if [ "$r" -gt 0 ]; then dd bs=1 count="$r" 2>/dev/null; fi
+	return 0
+}
+
+skip() {
+	copy "$1" >/dev/null
+}
+
+check() {
+	if [ "$(cksum < "$1")" != "$2" ]; then
+		echo "$1: file has changed since this script was generated" >&2
+		exit 1
+	fi
+}
+
+apply() {
+	cat "$1.bed-tmp" > "$1"
+	rm -f "$1.bed-tmp"
+}
+`
+
+// writeScript writes a standalone POSIX shell script to w which applies
+// matches to their files. The script only depends on standard utilities
+// (dd, cksum, cat) so it can be reviewed & run where bed is not installed.
+func writeScript(w io.Writer, matches []*bed.Match) error {
+	paths, pathMatches := bed.GroupMatchesByPath(bed.RemoveSkipped(matches))
+
+	// Compute the edits for each file before writing anything.
+	checksums := make([]uint32, len(paths))
+	sizes := make([]int, len(paths))
+	edits := make([][]bed.Edit, len(paths))
+	for i, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		} else if err := bed.CheckMatchData(path, data, pathMatches[i]); err != nil {
+			return err
+		}
+		checksums[i], sizes[i] = cksum(data), len(data)
+		edits[i] = bed.MatchEdits(data, pathMatches[i])
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, scriptHeader, len(bed.RemoveSkipped(matches)), len(paths))
+
+	buf.WriteString("\n# Verify files are unchanged.\n")
+	for i, path := range paths {
+		fmt.Fprintf(&buf, "check %s '%d %d'\n", shellQuote(path), checksums[i], sizes[i])
+	}
+
+	for i, path := range paths {
+		if bed.DeletesFile(pathMatches[i]) {
+			fmt.Fprintf(&buf, "\n# %s\nrm -f %s\n", strconv.Quote(path), shellQuote(path))
+			continue
+		}
+
+		fmt.Fprintf(&buf, "\n# %s\n{\n", strconv.Quote(path))
+		var pos int
+		for _, e := range edits[i] {
+			if n := e.Pos - pos; n > 0 {
+				fmt.Fprintf(&buf, "\tcopy %d\n", n)
+			}
+			if e.Len > 0 {
+				fmt.Fprintf(&buf, "\tskip %d\n", e.Len)
+			}
+			for _, line := range splitLines(e.Data) {
+				fmt.Fprintf(&buf, "\tprintf -- '%s'\n", printfEscape([]byte(line)))
+			}
+			pos = e.Pos + e.Len
+		}
+		if pos < sizes[i] {
+			buf.WriteString("\tcat\n")
+		}
+		fmt.Fprintf(&buf, "} < %s > %s\napply %s\n", shellQuote(path), shellQuote(path+".bed-tmp"), shellQuote(path))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// shellQuote returns s quoted for use as a single word in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// printfEscape returns data escaped for use as a single-quoted printf format.
+// Bytes other than printable ASCII are written as octal escapes.
+func printfEscape(data []byte) string {
+	var buf bytes.Buffer
+	for _, b := range data {
+		switch {
+		case b == '\'':
+			buf.WriteString(`'\''`)
+		case b == '\\':
+			buf.WriteString(`\\`)
+		case b == '%':
+			buf.WriteString("%%")
+		case b >= ' ' && b <= '~':
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(&buf, `\%03o`, b)
+		}
+	}
+	return buf.String()
+}
+
+// cksumTable is the CRC table for the polynomial used by POSIX cksum.
+var cksumTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// cksum returns the checksum of data as computed by the POSIX cksum utility.
+func cksum(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ cksumTable[byte(crc>>24)^b]
+	}
+	for n := len(data); n > 0; n >>= 8 {
+		crc = crc<<8 ^ cksumTable[byte(crc>>24)^byte(n)]
+	}
+	return ^crc
+}
+
+// writeScriptFile writes a script applying matches to path, or to STDOUT if
+// path is "-". The file is created as executable.
+func writeScriptFile(path string, matches []*bed.Match) error {
+	if path == "-" {
+		return writeScript(os.Stdout, matches)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeScript(f, matches); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestWriteScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	for _, tt := range []struct {
+		name string
+		data string
+		pos  int
+		len  int
+		repl string
+		want string
+	}{
+		{name: "Replace", data: "Hello World\n", pos: 6, len: 5, repl: "There", want: "Hello There\n"},
+		{name: "Insert", data: "a\nc\n", pos: 2, repl: "b\n", want: "a\nb\nc\n"},
+		{name: "Delete", data: "a\nb\nc\n", pos: 2, len: 2, want: "a\nc\n"},
+		{name: "LeadingDash", data: "items:\nx\n", pos: 7, len: 1, repl: "- a\n-x\n--\n", want: "items:\n- a\n-x\n--\n\n"},
+		{name: "Quote", data: "x\n", pos: 0, len: 1, repl: "it's", want: "it's\n"},
+		{name: "Percent", data: "x\n", pos: 0, len: 1, repl: "100%d %s %%", want: "100%d %s %%\n"},
+		{name: "Backslash", data: "x\n", pos: 0, len: 1, repl: `C:\new\tab\\`, want: "C:\\new\\tab\\\\\n"},
+		{name: "Binary", data: "x\n", pos: 0, len: 1, repl: "\x00\xff\té", want: "\x00\xff\té\n"},
+		{name: "End", data: "abc", pos: 3, repl: "\n-d", want: "abc\n-d"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a -b.txt")
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0666); err != nil {
+				t.Fatal(err)
+			}
+			m := &bed.Match{Path: path, Pos: tt.pos, Len: tt.len, Data: []byte(tt.repl)}
+
+			if out, err := runScript(t, []*bed.Match{m}); err != nil {
+				t.Fatalf("script failed: %s\n%s", err, out)
+			} else if buf, err := ioutil.ReadFile(path); err != nil {
+				t.Fatal(err)
+			} else if string(buf) != tt.want {
+				t.Fatalf("unexpected data: %q", buf)
+			} else if _, err := os.Stat(path + ".bed-tmp"); !os.IsNotExist(err) {
+				t.Fatalf("temporary file left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestWriteScript_Changed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	if err := ioutil.WriteFile(a, []byte("foo\n"), 0666); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(b, []byte("bar\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	matches := []*bed.Match{
+		{Path: a, Pos: 0, Len: 3, Data: []byte("baz")},
+		{Path: b, Pos: 0, Len: 3, Data: []byte("baz")},
+	}
+
+	var buf bytes.Buffer
+	if err := writeScript(&buf, matches); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(b, []byte("BAR\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// No file is modified if any has changed since the script was written.
+	cmd := exec.Command("sh")
+	cmd.Stdin = &buf
+	if out, err := cmd.CombinedOutput(); err == nil {
+		t.Fatal("expected script to fail")
+	} else if !bytes.Contains(out, []byte("b.txt: file has changed")) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if buf, err := ioutil.ReadFile(a); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != "foo\n" {
+		t.Fatalf("a.txt written: %q", buf)
+	}
+}
+
+// TestWriteScript_NewlineInPath checks that a path containing a newline
+// cannot end a comment & run the rest of its name as a command.
+func TestWriteScript_NewlineInPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	chdirTemp(t)
+	writeTestFile(t, "a\ntouch pwned-a\n.txt", "foo\n")
+	writeTestFile(t, "b\ntouch pwned-b\n.txt", "foo\n")
+	matches := []*bed.Match{
+		{Path: "a\ntouch pwned-a\n.txt", Pos: 0, Len: 3, Data: []byte("bar")},
+		{Path: "b\ntouch pwned-b\n.txt", Pos: 0, Len: 3, Directive: bed.DirectiveDeleteFile},
+	}
+
+	if out, err := runScript(t, matches); err != nil {
+		t.Fatalf("script failed: %s\n%s", err, out)
+	}
+	for _, name := range []string{"pwned-a", "pwned-b"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("path ran as a command: %v", err)
+		}
+	}
+	if got := readTestFile(t, "a\ntouch pwned-a\n.txt"); got != "bar\n" {
+		t.Fatalf("unexpected data: %q", got)
+	} else if _, err := os.Stat("b\ntouch pwned-b\n.txt"); !os.IsNotExist(err) {
+		t.Fatalf("expected file to be deleted: %v", err)
+	}
+}
+
+func TestCksum(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		sum  uint32
+	}{
+		{data: "", sum: 4294967295},
+		{data: "a", sum: 1220704766},
+		{data: "hello world\n", sum: 3733384285},
+	} {
+		if sum := cksum([]byte(tt.data)); sum != tt.sum {
+			t.Errorf("cksum(%q)=%d, want %d", tt.data, sum, tt.sum)
+		}
+	}
+}
+
+// runScript writes a script applying matches & runs it with sh.
+func runScript(t *testing.T, matches []*bed.Match) ([]byte, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeScript(&buf, matches); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sh")
+	cmd.Stdin = &buf
+	return cmd.CombinedOutput()
+}
@@ -0,0 +1,629 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// RunSearch executes the "search" command which finds matches & writes them
+// to STDOUT as a match file. The match file can be edited at leisure & then
+// applied with the "apply" command.
+func RunSearch(args []string) error {
+	fs := flag.NewFlagSet("bed-search", flag.ContinueOnError)
+	sf := newSearchFlags(fs)
+	replace := fs.String("replace", "", "")
+	header := fs.String("header", bed.HeaderJSON, "")
+	encode := fs.String("encode", "", "")
+	relative := fs.Bool("relative", false, "")
+	lf := newLogFlags(fs)
+	tracePath := fs.String("trace", "", "")
+	configPath := fs.String("config", "", "")
+	profile := fs.String("profile", "", "")
+	fs.Usage = func() { writeUsage(os.Stderr, searchDoc) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 && !sf.ingests() {
+		fs.Usage()
+		return flag.ErrHelp
+	} else if fs.NArg() > 0 && sf.ingests() {
+		return fmt.Errorf("%s reads matches from STDIN & takes no pattern or paths", sf.ingestFlag())
+	} else if !bed.ValidHeaderFormat(*header) {
+		return fmt.Errorf("unknown header format: %q", *header)
+	} else if !bed.ValidEncoding(*encode) {
+		return fmt.Errorf("unknown encoding: %q", *encode)
+	} else if err := sf.validateFlags(true); err != nil {
+		return err
+	} else if err := lf.validateFlags(); err != nil {
+		return err
+	}
+
+	// Open the log & then operate on another git worktree, if specified. The
+	// log is opened first so its path is relative to the working directory.
+	closeLog, err := lf.open()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	if err := sf.chdir(); err != nil {
+		return err
+	}
+
+	// Record per-file timings when debugging & write a trace, if specified.
+	stopTrace, err := startTrace(*tracePath)
+	if err != nil {
+		return err
+	}
+	defer stopTrace()
+	if lf.debug() {
+		sf.timings = &bed.Timings{}
+		defer logTimings(sf.timings)
+	}
+
+	config, err := ReadConfigFile(*configPath, *profile)
+	if err != nil {
+		return err
+	}
+	sf.config = config
+
+	re, matches, err := sf.search(searchArgs(fs))
+	if err != nil {
+		return err
+	}
+
+	// Propose replacements in the match file, if specified.
+	if isFlagSet(fs, "replace") {
+		replaceMatches(re, matches, *replace, config)
+	}
+
+	if len(matches) == 0 {
+		return ErrNoMatches
+	}
+	return writeMatchFile(os.Stdout, matches, bed.WriteOptions{Header: *header, Encoding: *encode}, *relative)
+}
+
+// searchFlags are the command line flags which control how matches are found.
+type searchFlags struct {
+	pathsFile   *string
+	legacyStdin *bool
+	not         *string
+	maxCount    *int
+	limit       *int
+	rev         *string
+	cached      *bool
+	worktree    *string
+	sort        *string
+	scanBudget  *string
+	word        *bool
+	engine      *string
+	lines       *string
+	pathRegex   *string
+	charset     *string
+	git         *bool
+	fromRG      *bool
+	fromGrep    *bool
+
+	// Number of files & bytes read by the last search.
+	scannedFiles int
+	scannedBytes int64
+
+	// Records per-file timings, if set.
+	timings *bed.Timings
+
+	// Number of empty files skipped by the last search.
+	emptyFiles int
+
+	// Records the checksum of each file read, if set.
+	checksums map[string]uint32
+
+	// Restricts scanned paths to the config's include globs, if set.
+	config *Config
+
+	// Downloads remote paths, such as "host:/etc/hosts", to be scanned, if
+	// set. Otherwise, remote paths are read as local paths.
+	remote *remoteFiles
+}
+
+// newSearchFlags registers the search flags on fs.
+func newSearchFlags(fs *flag.FlagSet) *searchFlags {
+	return &searchFlags{
+		pathsFile:   fs.String("paths", "", ""),
+		legacyStdin: fs.Bool("legacy-stdin", false, ""),
+		not:         fs.String("not", "", ""),
+		maxCount:    fs.Int("max-count", 0, ""),
+		limit:       fs.Int("limit", 0, ""),
+		rev:         fs.String("rev", "", ""),
+		cached:      fs.Bool("cached", false, ""),
+		worktree:    fs.String("worktree", "", ""),
+		sort:        fs.String("sort", "", ""),
+		scanBudget:  fs.String("scan-budget", "", ""),
+		word:        fs.Bool("w", false, ""),
+		engine:      fs.String("engine", "re2", ""),
+		lines:       fs.String("lines", "", ""),
+		pathRegex:   fs.String("path-regex", "", ""),
+		charset:     fs.String("encoding", "", ""),
+		git:         fs.Bool("git", false, ""),
+		fromRG:      fs.Bool("from-rg", false, ""),
+		fromGrep:    fs.Bool("from-grep", false, ""),
+	}
+}
+
+// validateFlags returns an error if the flags conflict. Scanning a git revision
+// or the index is only supported if readOnly is true.
+func (f *searchFlags) validateFlags(readOnly bool) error {
+	if !validSortOrder(*f.sort) {
+		return fmt.Errorf("unknown sort order: %q", *f.sort)
+	} else if _, _, err := parseScanBudget(*f.scanBudget); err != nil {
+		return err
+	} else if err := validateEngine(*f.engine); err != nil {
+		return err
+	} else if _, err := parseLineRange(*f.lines, ":"); *f.lines != "" && err != nil {
+		return err
+	} else if _, err := regexp.Compile(*f.pathRegex); err != nil {
+		return fmt.Errorf("invalid path regex: %s", err)
+	} else if !bed.ValidCharset(*f.charset) {
+		return fmt.Errorf("unknown encoding: %q", *f.charset)
+	} else if *f.rev != "" && *f.cached {
+		return errors.New("-rev and -cached cannot be used together")
+	} else if *f.rev != "" && !readOnly {
+		return errors.New("-rev requires -dry-run or -format")
+	} else if *f.cached && !readOnly {
+		return errors.New("-cached requires -dry-run or -format")
+	} else if *f.fromRG && *f.fromGrep {
+		return errors.New("-from-rg and -from-grep cannot be used together")
+	} else if f.ingests() && (*f.pathsFile != "" || *f.legacyStdin || *f.git || *f.rev != "" || *f.cached || *f.word) {
+		return fmt.Errorf("%s cannot be used with -paths, -legacy-stdin, -git, -rev, -cached or -w", f.ingestFlag())
+	}
+	return nil
+}
+
+// ingests returns true if matches are read from another search tool instead
+// of searching for a pattern.
+func (f *searchFlags) ingests() bool {
+	return f.ingestFlag() != ""
+}
+
+// ingestFlag returns the name of the flag which reads matches from another
+// search tool, if set.
+func (f *searchFlags) ingestFlag() string {
+	if *f.fromRG {
+		return "-from-rg"
+	} else if *f.fromGrep {
+		return "-from-grep"
+	}
+	return ""
+}
+
+// chdir changes to the git worktree directory, if specified. Relative paths
+// are then resolved from the worktree's directory.
+func (f *searchFlags) chdir() error {
+	if *f.worktree == "" {
+		return nil
+	} else if _, err := gitWorktreeRoot(*f.worktree); err != nil {
+		return err
+	}
+	return os.Chdir(*f.worktree)
+}
+
+// search compiles pattern & finds all matches in paths as well as any paths
+// read from a path list. With -from-rg or -from-grep, the matches reported by
+// ripgrep or grep on STDIN are found instead. The search is recorded as a
+// "scan" span, if tracing.
+func (f *searchFlags) search(pattern string, paths []string) (bed.Matcher, []*bed.Match, error) {
+	scan := tracing.start("scan")
+	re, matches, err := f.searchPaths(pattern, paths)
+	scan.setInt("bed.files_scanned", int64(f.scannedFiles))
+	scan.setInt("bed.bytes_scanned", f.scannedBytes)
+	scan.setMatches(matches)
+	scan.finish(err)
+	return re, matches, err
+}
+
+// searchPaths finds all matches of pattern for search.
+func (f *searchFlags) searchPaths(pattern string, paths []string) (bed.Matcher, []*bed.Match, error) {
+	var ext *externalMatcher
+	var err error
+	if f.ingests() {
+		read := readRipgrepMatches
+		if *f.fromGrep {
+			read = readGrepMatches
+		}
+		if paths, ext, err = read(os.Stdin); err != nil {
+			return nil, nil, err
+		} else if len(paths) == 0 {
+			return ext, nil, nil
+		}
+	} else if paths, err = f.readPaths(paths); err != nil {
+		return nil, nil, err
+	}
+
+	// Restrict matches to a range of lines for paths with a line range
+	// suffix, e.g. "config.yml:100-250", or for all paths, if specified.
+	ranges := make(map[string]bed.LineRange)
+	for i, path := range paths {
+		if p, r, ok := splitPathLineRange(path); ok {
+			paths[i], ranges[p] = p, r
+		}
+	}
+	defaultRange, rangeErr := parseLineRange(*f.lines, ":")
+	hasDefaultRange := rangeErr == nil
+
+	// Only scan paths matching the path regex, if specified. Paths are
+	// matched with forward slashes on all platforms.
+	total, excluded := len(paths), 0
+	if *f.pathRegex != "" {
+		pathRe := regexp.MustCompile(*f.pathRegex)
+		a := paths[:0:0]
+		for _, path := range paths {
+			if pathRe.MatchString(filepath.ToSlash(path)) {
+				a = append(a, path)
+			}
+		}
+		excluded, paths = len(paths)-len(a), a
+	}
+
+	// Only scan paths matching the include globs of the config, if any.
+	if f.config != nil && len(f.config.Include) > 0 {
+		a := paths[:0:0]
+		for _, path := range paths {
+			if f.config.includesPath(path) {
+				a = append(a, path)
+			}
+		}
+		excluded, paths = excluded+len(paths)-len(a), a
+	}
+
+	// Warn about bed's own files, such as match files currently open in an
+	// editor, which are skipped so they cannot be corrupted.
+	for _, path := range paths {
+		if bed.IsStateFile(path) {
+			warnf("skipping bed state file: %s", path)
+			excluded++
+		}
+	}
+
+	// Download remote files & scan their local mirrors instead.
+	if f.remote != nil {
+		if err := f.remote.fetch(paths); err != nil {
+			return nil, nil, err
+		}
+		for i, path := range paths {
+			if local, ok := f.remote.local[path]; ok {
+				if r, ok := ranges[path]; ok {
+					ranges[local] = r
+				}
+				paths[i] = local
+			}
+		}
+	}
+
+	// Parse regex with the selected engine. Only match whole words, if
+	// specified. The pattern, excluding any lookarounds at its start & end,
+	// is wrapped in a non-capturing group so submatch numbers are unchanged.
+	var re bed.Matcher = ext
+	if ext == nil {
+		if *f.word {
+			behind, core, ahead := splitLookarounds(pattern)
+			pattern = joinLookarounds(behind, `\b(?:`+core+`)\b`, ahead)
+		}
+		if re, err = engines[*f.engine](pattern); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Exclude matches matching the negative pattern & read file contents
+	// from a git revision, if specified.
+	opt := bed.FindOptions{MaxCount: *f.maxCount, Timings: f.timings, Charset: *f.charset}
+	f.emptyFiles = 0
+	opt.Lines = func(path string) (bed.LineRange, bool) {
+		if r, ok := ranges[path]; ok {
+			return r, true
+		}
+		return defaultRange, hasDefaultRange
+	}
+	if *f.limit > 0 {
+		opt.Limit = *f.limit + 1 // find one extra to detect truncation
+	}
+	if *f.not != "" {
+		if opt.Not, err = regexp.Compile(*f.not); err != nil {
+			return nil, nil, err
+		}
+	}
+	if *f.rev != "" || *f.cached {
+		opt.ReadFile = gitRevReader(*f.rev)
+	}
+
+	// Limit the bytes & time spent scanning, if specified.
+	maxBytes, maxTime, _ := parseScanBudget(*f.scanBudget)
+	if maxBytes > 0 || maxTime > 0 {
+		opt.Budget = &bed.ScanBudget{MaxBytes: maxBytes}
+		if maxTime > 0 {
+			opt.Budget.Deadline = time.Now().Add(maxTime)
+		}
+	}
+
+	// Estimate the size of enormous scans upfront so they fail fast if they
+	// would exceed the budget.
+	if len(paths) >= estimatePathCount && opt.ReadFile == nil {
+		n, err := estimateScan(paths, opt.Budget)
+		if err != nil {
+			return nil, nil, err
+		} else if maxBytes > 0 && n > maxBytes {
+			return nil, nil, fmt.Errorf("scan of %d files (%s) would exceed the scan budget of %s", len(paths), formatSize(n), formatSize(maxBytes))
+		}
+		warnf("scanning %d files (%s)", len(paths), formatSize(n))
+	}
+
+	// Collect files which cannot be read so they are all reported at once
+	// instead of failing at the first one.
+	var unreadable []string
+	if opt.ReadFile == nil {
+		opt.ReadFile = func(path string) ([]byte, error) {
+			data, err := bed.ReadFile(path)
+			if os.IsPermission(err) {
+				unreadable = append(unreadable, path)
+				return nil, nil
+			} else if err == nil && f.checksums != nil {
+				f.checksums[path] = checksum(data)
+			}
+			return data, err
+		}
+		opt.ReleaseFile = bed.ReleaseBuffer
+	}
+	if ext != nil {
+		readFile := opt.ReadFile
+		opt.ReadFile = func(path string) ([]byte, error) {
+			ext.path = path
+			return readFile(path)
+		}
+	}
+
+	// Count the files & bytes read for the scan span.
+	readFile := opt.ReadFile
+	f.scannedFiles, f.scannedBytes = 0, 0
+	opt.ReadFile = func(path string) ([]byte, error) {
+		data, err := readFile(path)
+		f.scannedFiles, f.scannedBytes = f.scannedFiles+1, f.scannedBytes+int64(len(data))
+		return data, err
+	}
+	opt.OnEmptyFile = func(path string) {
+		if n := len(unreadable); n == 0 || unreadable[n-1] != path {
+			f.emptyFiles++
+		}
+	}
+
+	// Find all matches. Partial results are used if the scan budget runs out.
+	matches, err := bed.FindAllIndexPaths(re, paths, opt)
+	if err == bed.ErrScanBudget {
+		warnf("scan budget exceeded, results are partial: scanned %s in %d of %d files", formatSize(opt.Budget.Bytes()), opt.Budget.Files(), len(paths))
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if len(unreadable) > 0 {
+		return nil, nil, fmt.Errorf("cannot read file(s):\n\t%s", strings.Join(unreadable, "\n\t"))
+	} else if ext != nil && ext.err != nil {
+		return nil, nil, ext.err
+	}
+
+	// Report when every path was skipped so it is not mistaken for a scan
+	// which found no matches.
+	if len(matches) == 0 && excluded+f.emptyFiles == total {
+		return nil, nil, &nothingToScanError{paths: total, excluded: excluded, empty: f.emptyFiles}
+	} else if f.emptyFiles > 0 {
+		log.Printf("info: skipped %d empty file(s)", f.emptyFiles)
+	}
+
+	// Warn if matches exceeded the limit.
+	if *f.limit > 0 && len(matches) > *f.limit {
+		matches = matches[:*f.limit]
+		warnf("results truncated to the first %d matches", *f.limit)
+	}
+
+	// Order matches by path, if specified, so reports & match files are
+	// written in the same order.
+	sortMatches(matches, pathLess(*f.sort))
+
+	return re, matches, nil
+}
+
+// readPaths returns paths along with any paths read from a path list.
+func (f *searchFlags) readPaths(paths []string) ([]string, error) {
+	// Read paths from a list file or STDIN as well. Previously, paths were
+	// always read from STDIN when it was not a terminal. That behavior is
+	// available with the -legacy-stdin flag.
+	pathsFile := *f.pathsFile
+	if pathsFile == "" && *f.legacyStdin && !isTerminal(os.Stdin) {
+		pathsFile = "-"
+	}
+	if pathsFile != "" {
+		a, err := readPathList(pathsFile)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, a...)
+	}
+
+	// Scan the files tracked by git, limited to the paths as pathspecs, if
+	// specified. Files are listed from the revision with -rev.
+	if *f.git {
+		a, err := gitTrackedFiles(*f.rev, paths, *f.rev == "" && !*f.cached)
+		if err != nil {
+			return nil, err
+		} else if len(a) == 0 {
+			return nil, &nothingToScanError{}
+		}
+		return a, nil
+	}
+
+	// Ensure either args or a path list specify paths. An empty path list,
+	// such as from a filter which excluded every file, is not a usage error.
+	if len(paths) == 0 && pathsFile != "" {
+		return nil, &nothingToScanError{}
+	} else if len(paths) == 0 {
+		return nil, errors.New("path required")
+	}
+	return paths, nil
+}
+
+// replaceMatches replaces each match using the template for its file's
+// extension, if configured, or the given template.
+func replaceMatches(re bed.Matcher, matches []*bed.Match, template string, config *Config) {
+	for _, m := range matches {
+		if t, ok := config.Replace[filepath.Ext(m.Path)]; ok {
+			m.Expand(re, t)
+		} else {
+			m.Expand(re, template)
+		}
+	}
+}
+
+// searchArgs returns the pattern & paths given as arguments, if any.
+func searchArgs(fs *flag.FlagSet) (pattern string, paths []string) {
+	if fs.NArg() == 0 {
+		return "", nil
+	}
+	return fs.Arg(0), fs.Args()[1:]
+}
+
+// isFlagSet returns true if the named flag was specified on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	var ok bool
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			ok = true
+		}
+	})
+	return ok
+}
+
+var searchDoc = &commandDoc{
+	Name:  "bed search",
+	Short: "write matches to a match file",
+	Long: `Finds matches of pattern in the provided paths & writes them to STDOUT
+as a match file instead of opening an editor. The match file can be
+edited at leisure & then applied with "bed apply".`,
+	Synopsis: []string{
+		"bed search [arguments] pattern path [paths] > matchfile",
+		"rg --json pattern [paths] | bed search [arguments] -from-rg > matchfile",
+		"grep -Hn pattern paths | bed search [arguments] -from-grep > matchfile",
+	},
+	Sections: []docSection{
+		{Text: `Each match begins with a "#bed:begin" header containing the path, byte
+position & length of the match, which are used to apply changes, and
+its line & column, numbered from 1, so editors & scripts can jump to
+the match. Columns are counted in bytes.`},
+	},
+	Flags: []docItem{
+		{Name: "-paths FILE", Text: `Read additional newline-separated paths from FILE. If FILE
+is "-" then paths are read from STDIN.`},
+		{Name: "-legacy-stdin", Text: "Read paths from STDIN whenever it is not a terminal."},
+		{Name: "-config PATH", Text: "Read configuration from PATH."},
+		{Name: "-profile NAME", Text: `Use the settings of profile NAME from the configuration
+file. See "bed -h" for details.`},
+		{Name: "-w", Text: "Only match the pattern as a whole word."},
+		{Name: "-header FORMAT", Text: `Write match headers as "json" (default), "plain" key=value
+pairs or a "yaml" flow mapping. See "bed -h" for details.`},
+		{Name: "-encode ENCODING", Text: `Write the text of matches which cannot be edited safely as
+text as "base64". See "bed -h" for details.`},
+		{Name: "-relative", Text: `Write paths relative to the root of the git worktree, which
+is recorded at the top of the match file, so it can be applied
+to another checkout of the same repository.`},
+		{Name: "-engine NAME", Text: `Use the regex engine NAME, either "re2" or "pcre". See "bed -h"
+for details.`},
+		{Name: "-encoding CHARSET", Text: `Decode files from CHARSET to UTF-8 for matching & editing.
+See "bed -h" for details.`},
+		{Name: "-not RE", Text: "Exclude matches whose text also matches the pattern RE."},
+		{Name: "-path-regex RE", Text: "Only scan paths matching RE."},
+		{Name: "-lines START:END", Text: `Ignore matches which do not start within lines START to END.
+See "bed -h" for details.`},
+		{Name: "-max-count N", Text: "Only use the first N matches from each file."},
+		{Name: "-limit N", Text: "Stop searching once N matches have been found in total."},
+		{Name: "-replace TEMPLATE", Text: `Write each match replaced with TEMPLATE so the match file
+contains proposed changes.`},
+		{Name: "-rev REF", Text: "Scan file contents at the git revision REF."},
+		{Name: "-git", Text: `Scan the files tracked by git, limited to any paths given. See
+"bed -h" for details.`},
+		{Name: "-from-rg", Text: `Read the matches found by ripgrep from the output of "rg
+--json" on STDIN instead of searching. See "bed -h" for details.`},
+		{Name: "-from-grep", Text: `Read matches from "path:line:text" lines, as written by "grep
+-Hn", on STDIN instead of searching. See "bed -h" for details.`},
+		{Name: "-cached", Text: "Scan the staged contents of files in the git index."},
+		{Name: "-scan-budget LIMITS", Text: `Stop scanning once a limit is reached & use the partial
+results. LIMITS is a comma-separated size and/or duration, e.g.
+"500MB,30s".`},
+		{Name: "-sort ORDER", Text: `Write matches sorted by path. ORDER is either "bytes" for a
+reproducible byte-wise order or "locale" to collate paths using
+the locale set by LC_ALL, LC_COLLATE or LANG.`},
+		{Name: "-worktree DIR", Text: "Scan files in the git worktree at DIR."},
+		{Name: "-v", Text: "Enable verbose logging, including per-file timings."},
+		{Name: "-log-level LEVEL", Text: `Log messages at or above LEVEL, which is "debug", "info" or
+"warn".`},
+		{Name: "-log-file FILE", Text: "Append log messages to FILE, with timestamps & the run ID."},
+		{Name: "-trace FILE", Text: "Write a Go runtime execution trace to FILE."},
+	},
+	Examples: []docExample{
+		{
+			Title: "Save matches for later",
+			Text:  "Write matches to a file which can be edited & applied separately.",
+			Args:  []string{"timeout = [0-9]+", "main.go"},
+			Files: []docFile{
+				{Path: "main.go", Data: "const timeout = 10\n"},
+			},
+			Output: "#bed:begin {\"path\":\"main.go\",\"pos\":6,\"len\":12,\"line\":1,\"col\":7}\ntimeout = 10\n#bed:end\n\n",
+		},
+	},
+}
+
+// parseLineRange parses a range of lines, such as "100:250", where sep is
+// the separator between the start & end lines. Either line can be omitted
+// to start from the first line or to end at the last line.
+func parseLineRange(s, sep string) (bed.LineRange, error) {
+	i := strings.Index(s, sep)
+	if i == -1 {
+		return bed.LineRange{}, fmt.Errorf("invalid line range: %q", s)
+	}
+
+	var r bed.LineRange
+	var err error
+	if start := s[:i]; start != "" {
+		if r.Start, err = strconv.Atoi(start); err != nil || r.Start < 1 {
+			return bed.LineRange{}, fmt.Errorf("invalid line range: %q", s)
+		}
+	}
+	if end := s[i+len(sep):]; end != "" {
+		if r.End, err = strconv.Atoi(end); err != nil || r.End < 1 || r.End < r.Start {
+			return bed.LineRange{}, fmt.Errorf("invalid line range: %q", s)
+		}
+	}
+	return r, nil
+}
+
+// splitPathLineRange splits a line range suffix, such as ":100-250", from
+// path. Paths of existing files are never split.
+func splitPathLineRange(path string) (string, bed.LineRange, bool) {
+	i := strings.LastIndex(path, ":")
+	if i == -1 {
+		return path, bed.LineRange{}, false
+	} else if _, err := os.Stat(path); err == nil {
+		return path, bed.LineRange{}, false
+	}
+
+	r, err := parseLineRange(path[i+1:], "-")
+	if err != nil || r.Start == 0 || r.End == 0 {
+		return path, bed.LineRange{}, false
+	}
+	return path[:i], r, true
+}
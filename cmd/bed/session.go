@@ -0,0 +1,543 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// session is an editing session whose match files were kept after the
+// editor failed, so the edits can be recovered & applied with "bed resume".
+// Sessions are recorded in the temp directory alongside their match files.
+type session struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Dir     string    `json:"dir"`   // directory match paths are relative to
+	Args    []string  `json:"args"`  // command line of the original run
+	Files   []string  `json:"files"` // match files
+
+	// Checksums of the source files of the matches when they were searched,
+	// used to detect files which have since changed.
+	Sources map[string]uint32 `json:"sources,omitempty"`
+}
+
+// Expiry policies for kept sessions unless specified with flags. Sessions
+// are reminded about once stale & are invalid once expired or once more
+// than the maximum percentage of their source files have changed, since
+// their match positions are unlikely to still be valid.
+const (
+	DefaultSessionStaleAge = 24 * time.Hour
+	DefaultSessionMaxAge   = 7 * 24 * time.Hour
+	DefaultSessionMaxChurn = 50
+)
+
+// Statuses of a kept session.
+const (
+	SessionOK      = "ok"
+	SessionStale   = "stale"
+	SessionExpired = "expired"
+	SessionChurned = "churned"
+)
+
+// sessionPrefix & sessionExt surround the ID in the names of session files.
+const (
+	sessionPrefix = "bed-session-"
+	sessionExt    = ".json"
+)
+
+// path returns the path of the session's record.
+func (s *session) path() string {
+	return filepath.Join(os.TempDir(), sessionPrefix+s.ID+sessionExt)
+}
+
+// remove deletes the session's record & match files.
+func (s *session) remove() error {
+	for _, path := range s.Files {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Remove(s.path())
+}
+
+// age returns how long ago the session was kept.
+func (s *session) age() time.Duration {
+	return time.Since(s.Created)
+}
+
+// churn returns the number of the session's source files which changed or
+// were removed since they were searched & the total number of files.
+func (s *session) churn() (changed, total int) {
+	for path, sum := range s.Sources {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.Dir, path)
+		}
+		if data, err := ioutil.ReadFile(path); err != nil || checksum(data) != sum {
+			changed++
+		}
+	}
+	return changed, len(s.Sources)
+}
+
+// status returns the status of the session under the given expiry policy.
+// Churn is a percentage of the source files.
+func (s *session) status(maxAge time.Duration, maxChurn int) string {
+	if age := s.age(); maxAge > 0 && age > maxAge {
+		return SessionExpired
+	} else if changed, total := s.churn(); total > 0 && changed*100 > maxChurn*total {
+		return SessionChurned
+	} else if age > DefaultSessionStaleAge {
+		return SessionStale
+	}
+	return SessionOK
+}
+
+// saveSession records a new session for the match files.
+func saveSession(files []string, sources map[string]uint32) (*session, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile("", sessionPrefix+runID+"-*"+sessionExt)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	name := filepath.Base(f.Name())
+	s := &session{
+		ID:      strings.TrimSuffix(strings.TrimPrefix(name, sessionPrefix), sessionExt),
+		Created: time.Now(),
+		Dir:     wd,
+		Args:    os.Args,
+		Files:   files,
+		Sources: sources,
+	}
+	if err := json.NewEncoder(f).Encode(s); err != nil {
+		return nil, err
+	}
+	return s, f.Close()
+}
+
+// loadSessions returns all recorded sessions, newest first.
+func loadSessions() ([]*session, error) {
+	paths, err := filepath.Glob(filepath.Join(os.TempDir(), sessionPrefix+"*"+sessionExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*session
+	for _, path := range paths {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var s session
+		if err := json.Unmarshal(buf, &s); err != nil {
+			return nil, fmt.Errorf("invalid session %s: %s", path, err)
+		}
+		sessions = append(sessions, &s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Created.After(sessions[j].Created) })
+	return sessions, nil
+}
+
+// findSession returns the session with the given ID or, if id is blank,
+// the newest session started in dir.
+func findSession(id, dir string) (*session, error) {
+	sessions, err := loadSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		if (id != "" && s.ID == id) || (id == "" && bed.SameDir(s.Dir, dir)) {
+			return s, nil
+		}
+	}
+	if id != "" {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	return nil, fmt.Errorf("no session to resume in %s", dir)
+}
+
+// keepSession is called when the editor fails. If any match file was changed
+// from its original contents, or the editor left swap files which may hold
+// unsaved changes, the files are recorded as a session & recovery guidance
+// is written to w. Sources are the checksums of the matches' source files
+// when they were searched. Returns true if the session was kept.
+func keepSession(w io.Writer, files []string, orig [][]byte, sources map[string]uint32) bool {
+	var modified []bool
+	var swapFiles [][]string
+	var keep bool
+	for i, path := range files {
+		data, err := ioutil.ReadFile(path)
+		modified = append(modified, err == nil && !bytes.Equal(data, orig[i]))
+		swapFiles = append(swapFiles, findSwapFiles(path))
+		keep = keep || modified[i] || len(swapFiles[i]) > 0
+	}
+	if !keep {
+		return false
+	}
+
+	s, err := saveSession(files, sources)
+	if err != nil {
+		fmt.Fprintf(w, "cannot keep editing session: %s\n", err)
+		return false
+	}
+
+	fmt.Fprintln(w, "The editor exited with an error. The editing session was kept so edits are not lost:")
+	for i, path := range files {
+		if modified[i] {
+			fmt.Fprintf(w, "\t%s (modified)\n", path)
+		} else {
+			fmt.Fprintf(w, "\t%s\n", path)
+		}
+		for _, swapPath := range swapFiles[i] {
+			fmt.Fprintf(w, "\t\tswap file: %s, %s\n", swapPath, recoveryHint(swapPath, path))
+		}
+	}
+	fmt.Fprintf(w, "Resume editing & apply the changes with: bed resume %s\n", s.ID)
+	return true
+}
+
+// sourceChecksums returns the checksums of the source files of matches from
+// the checksums of all searched files.
+func sourceChecksums(matches []*bed.Match, checksums map[string]uint32) map[string]uint32 {
+	sums := make(map[string]uint32)
+	for _, m := range matches {
+		if sum, ok := checksums[m.Path]; ok {
+			sums[m.Path] = sum
+		}
+	}
+	return sums
+}
+
+// remindSessions writes a reminder to w if sessions kept in dir are stale
+// so that they are resumed or removed rather than forgotten.
+func remindSessions(w io.Writer, dir string) {
+	sessions, err := loadSessions()
+	if err != nil {
+		return
+	}
+	var n int
+	var oldest time.Duration
+	for _, s := range sessions {
+		if !bed.SameDir(s.Dir, dir) || s.age() <= DefaultSessionStaleAge {
+			continue
+		}
+		n++
+		if age := s.age(); age > oldest {
+			oldest = age
+		}
+	}
+	if n > 0 {
+		fmt.Fprintf(w, "note: %d editing session(s) kept in this directory, the oldest %s ago, see \"bed sessions\"\n", n, formatAge(oldest))
+	}
+}
+
+// formatAge returns d rounded to the largest whole unit, e.g. "3d" or "5h".
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+// findSwapFiles returns the swap & auto-save files that common editors keep
+// for path while it is being edited, if any remain.
+func findSwapFiles(path string) []string {
+	dir, base := filepath.Split(path)
+	patterns := []string{
+		filepath.Join(dir, "."+base+".sw?"), // vim & neovim, in the file's directory
+		filepath.Join(dir, "#"+base+"#"),    // emacs auto-save
+	}
+
+	// Vim & neovim swap directories name swap files by the full path with
+	// separators replaced by "%".
+	if abs, err := filepath.Abs(path); err == nil {
+		name := strings.Replace(filepath.ToSlash(abs), "/", "%", -1) + ".sw?"
+		stateHome := os.Getenv("XDG_STATE_HOME")
+		if home := os.Getenv("HOME"); home != "" {
+			patterns = append(patterns, filepath.Join(home, ".vim", "swap", name))
+			if stateHome == "" {
+				stateHome = filepath.Join(home, ".local", "state")
+			}
+		}
+		if stateHome != "" {
+			patterns = append(patterns, filepath.Join(stateHome, "nvim", "swap", name))
+		}
+	}
+
+	var a []string
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		a = append(a, matches...)
+	}
+	return a
+}
+
+// recoveryHint returns how to recover path from the swap file swapPath.
+func recoveryHint(swapPath, path string) string {
+	if strings.HasPrefix(filepath.Base(swapPath), "#") {
+		return fmt.Sprintf("recover with: emacs %s, then M-x recover-this-file", path)
+	}
+	return fmt.Sprintf("recover with: vim -r %s, then save it", path)
+}
+
+// resumeEditing reopens the match files of s in editor & returns their
+// matches, excluding skipped ones, once the editor exits successfully. The
+// editing is recorded as a "session" span, if tracing.
+func resumeEditing(editor string, s *session, waitFlag string) (matches []*bed.Match, err error) {
+	edit := tracing.start("session")
+	edit.setString("bed.session_id", s.ID)
+	defer func() {
+		edit.setMatches(matches)
+		edit.finish(err)
+	}()
+
+	if err := runEditor(editor, s.Files, waitFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "The editing session was kept, resume it with: bed resume %s\n", s.ID)
+		return nil, err
+	}
+	for _, path := range s.Files {
+		a, err := bed.ReadMatchFile(path)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, a...)
+	}
+	return bed.RemoveSkipped(matches), nil
+}
+
+// RunResume executes the "resume" command which reopens the match files of
+// a kept editing session in the editor & applies the changes.
+func RunResume(args []string) error {
+	fs := flag.NewFlagSet("bed-resume", flag.ContinueOnError)
+	af := newApplyFlags(fs)
+	waitFlag := fs.String("wait-flag", "", "")
+	editorFlag := fs.String("editor", "", "")
+	promptFD := fs.Int("prompt-fd", -1, "")
+	promptJSON := fs.Bool("prompt-json", false, "")
+	maxAge := fs.Duration("max-age", DefaultSessionMaxAge, "")
+	maxChurn := fs.Int("max-churn", DefaultSessionMaxChurn, "")
+	force := fs.Bool("force", false, "")
+	lf := newLogFlags(fs)
+	configPath := fs.String("config", "", "")
+	profile := fs.String("profile", "", "")
+	fs.Usage = func() { writeUsage(os.Stderr, resumeDoc) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 1 {
+		return errors.New("too many arguments")
+	} else if err := af.validateFlags(); err != nil {
+		return err
+	} else if err := lf.validateFlags(); err != nil {
+		return err
+	}
+	closeLog, err := lf.open()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	config, err := ReadConfigFile(*configPath, *profile)
+	if err != nil {
+		return err
+	}
+	af.setSafe(fs, config)
+
+	// Changed files are always skipped, unless another policy is specified,
+	// since the positions of their matches are no longer valid.
+	if !isFlagSet(fs, "drift") && *af.drift == DriftOff {
+		*af.drift = DriftSkip
+	}
+
+	editor, _ := lookupEditor(*editorFlag, config.Editor)
+	if editor == "" {
+		return errors.New("EDITOR must be set")
+	}
+
+	// Find the session & resolve its match paths from its directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	s, err := findSession(fs.Arg(0), wd)
+	if err != nil {
+		return err
+	}
+
+	// Refuse sessions which are likely to apply edits to the wrong places.
+	switch s.status(*maxAge, *maxChurn) {
+	case SessionExpired:
+		if !*force {
+			return fmt.Errorf("session %s expired, it was kept %s ago, use -force to resume it anyway", s.ID, formatAge(s.age()))
+		}
+	case SessionChurned:
+		if !*force {
+			changed, total := s.churn()
+			return fmt.Errorf("session %s is invalid, %d of %d source file(s) changed since they were searched, use -force to resume it anyway", s.ID, changed, total)
+		}
+	}
+	if err := os.Chdir(s.Dir); err != nil {
+		return err
+	}
+	af.checksums = s.Sources
+
+	// Reopen the match files. The session is kept if the editor fails again.
+	matches, err := resumeEditing(editor, s, *waitFlag)
+	if err != nil {
+		return err
+	}
+
+	if len(matches) > 0 {
+		if err := af.checkPermissions(matches); err != nil {
+			return err
+		}
+
+		var p prompter
+		if *af.readOnly == ReadOnlyPrompt {
+			var closer io.Closer
+			if p, closer, err = openPrompter(*promptFD, *promptJSON); err != nil {
+				return err
+			}
+			defer closer.Close()
+		}
+
+		if matches, err = af.preflight(matches, config, p); err != nil {
+			return err
+		} else if err := af.apply(matches, config); err != nil {
+			return err
+		}
+	}
+	return s.remove()
+}
+
+var resumeDoc = &commandDoc{
+	Name:  "bed resume",
+	Short: "resume a kept editing session",
+	Long: `Reopens the match files of an editing session in the editor & applies
+the changes once the editor exits successfully. Sessions are kept when
+the editor fails after matches were edited, such as when it crashes, or
+leaves swap files behind. Without an ID, the newest session started in
+the current directory is resumed.`,
+	Synopsis: []string{
+		"bed resume [arguments] [ID]",
+	},
+	Sections: []docSection{
+		{Text: `If the editor left a swap file, such as vim's .swp files, it may hold
+edits which were not saved. Recover them when the editor asks, e.g. by
+choosing "(R)ecover" in vim, & save the file before exiting.`},
+		{Text: `Sessions expire after 7 days & are invalid once more than half of
+their source files have changed, since the positions of their matches
+are unlikely to still be valid. Use "bed sessions" to list kept
+sessions & remove old ones.`},
+	},
+	Flags: []docItem{
+		{Name: "-config PATH", Text: "Read configuration from PATH."},
+		{Name: "-profile NAME", Text: `Use the settings of profile NAME from the configuration
+file. See "bed -h" for details.`},
+		{Name: "-editor CMD", Text: "Edit with the editor command CMD instead of the environment's."},
+		{Name: "-wait-flag FLAG", Text: "Pass FLAG to the editor so that it waits for files to be closed."},
+		{Name: "-max-age DURATION", Text: `Refuse to resume sessions kept longer than DURATION ago.
+Defaults to 168h (7 days). Zero disables the limit.`},
+		{Name: "-max-churn PERCENT", Text: `Refuse to resume sessions once more than PERCENT of their
+source files have changed since they were searched. Defaults
+to 50.`},
+		{Name: "-force", Text: "Resume expired or invalid sessions anyway."},
+		{Name: "-readonly POLICY", Text: `How to handle read-only files. Either "skip", "force" or
+"prompt". See "bed -h" for details.`},
+		{Name: "-drift POLICY", Text: `How to handle source files which changed after they were
+searched. Either "skip", to leave them unchanged, "strict", to
+apply no changes, or "off". Defaults to "skip", or "strict"
+with -safe.`},
+		{Name: "-emit-script FILE", Text: `Write a standalone POSIX shell script to FILE which applies
+the changes instead of applying them.`},
+		{Name: "-emit-suggestions FILE", Text: `Write the changes to FILE as GitHub "suggested change" review
+comments instead of applying them. See "bed -h" for details.`},
+		{Name: "-safe", Text: `Back up files to .bed/backups, enforce protected paths & apply
+no more than 50 files. See "bed -h" for details.`},
+		{Name: "-prompt-fd N", Text: `Read & write interactive prompts on file descriptor N
+instead of the terminal.`},
+		{Name: "-prompt-json", Text: "Write interactive prompts as JSON objects, one per line."},
+		{Name: "-v", Text: "Enable verbose logging."},
+		{Name: "-log-file FILE", Text: "Append log messages to FILE, with timestamps & the run ID."},
+	},
+}
+
+// RunSessions executes the "sessions" command which lists kept editing
+// sessions with their age & status, & optionally removes invalid sessions.
+func RunSessions(args []string) error {
+	fs := flag.NewFlagSet("bed-sessions", flag.ContinueOnError)
+	maxAge := fs.Duration("max-age", DefaultSessionMaxAge, "")
+	maxChurn := fs.Int("max-churn", DefaultSessionMaxChurn, "")
+	prune := fs.Bool("prune", false, "")
+	fs.Usage = func() { writeUsage(os.Stderr, sessionsDoc) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return errors.New("too many arguments")
+	}
+
+	sessions, err := loadSessions()
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		status := s.status(*maxAge, *maxChurn)
+		if *prune && (status == SessionExpired || status == SessionChurned) {
+			if err := s.remove(); err != nil {
+				return err
+			}
+			status = "removed"
+		}
+		if _, err := fmt.Printf("%s\t%s\t%s\t%d file(s)\t%s\n", s.ID, formatAge(s.age()), status, len(s.Files), s.Dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var sessionsDoc = &commandDoc{
+	Name:  "bed sessions",
+	Short: "list kept editing sessions",
+	Long: `Lists the editing sessions kept after the editor failed, newest first,
+with their ID, age, status, number of match files & directory.`,
+	Synopsis: []string{
+		"bed sessions [arguments]",
+	},
+	Sections: []docSection{
+		{Text: `A session is "stale" once it is older than a day, "expired" once it
+is older than -max-age & "churned" once more than -max-churn percent
+of its source files have changed since it was kept. Expired & churned
+sessions cannot be resumed without -force. Running bed in a directory
+with stale sessions prints a reminder.`},
+	},
+	Flags: []docItem{
+		{Name: "-max-age DURATION", Text: "Consider sessions kept longer than DURATION ago expired."},
+		{Name: "-max-churn PERCENT", Text: `Consider sessions invalid once more than PERCENT of their
+source files have changed.`},
+		{Name: "-prune", Text: "Remove expired & churned sessions along with their match files."},
+	},
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+// TestRunResume checks that resuming a kept session applies its matches &
+// removes the session.
+func TestRunResume(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the true command as an editor")
+	}
+	chdirTemp(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("BED_EDITOR", "true")
+
+	writeTestFile(t, "a.txt", "foo\n")
+	matchPath, err := writeTempMatchFile("bed-test-*.txt", []*bed.Match{{Path: "a.txt", Pos: 0, Len: 3, Data: []byte("bar")}}, bed.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := saveSession([]string{matchPath}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunResume([]string{s.ID}); err != nil {
+		t.Fatal(err)
+	} else if s := readTestFile(t, "a.txt"); s != "bar\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+	for _, path := range []string{s.path(), matchPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed: %v", path, err)
+		}
+	}
+}
+
+// TestRunResume_Churn checks that a session is not resumed once most of its
+// source files have changed since they were searched.
+func TestRunResume_Churn(t *testing.T) {
+	chdirTemp(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("BED_EDITOR", "true")
+
+	var matches []*bed.Match
+	for _, path := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeTestFile(t, path, "foo\n")
+		matches = append(matches, &bed.Match{Path: path, Pos: 0, Len: 3, Data: []byte("bar")})
+	}
+	matchPath, err := writeTempMatchFile("bed-test-*.txt", matches, bed.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := checksum([]byte("foo\n"))
+	s, err := saveSession([]string{matchPath}, sourceChecksums(matches, map[string]uint32{"a.txt": sum, "b.txt": sum, "c.txt": sum}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, "a.txt", "// new\nfoo\n")
+	writeTestFile(t, "b.txt", "// new\nfoo\n")
+
+	if err := RunResume([]string{s.ID}); err == nil || !strings.Contains(err.Error(), "2 of 3 source file(s) changed") {
+		t.Fatalf("unexpected error: %v", err)
+	} else if s := readTestFile(t, "c.txt"); s != "foo\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+}
+
+// TestRunResume_Drift checks that a resumed session does not apply its
+// matches to source files which changed after they were searched.
+func TestRunResume_Drift(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the true command as an editor")
+	}
+	chdirTemp(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	// Search three files, then change one while the session is kept.
+	paths := []string{"a.txt", "b.txt", "c.txt"}
+	var matches []*bed.Match
+	for _, path := range paths {
+		writeTestFile(t, path, "foo\n")
+		matches = append(matches, &bed.Match{Path: path, Pos: 0, Len: 3, Data: []byte("bar")})
+	}
+	checksums := map[string]uint32{"a.txt": checksum([]byte("foo\n")), "b.txt": checksum([]byte("foo\n")), "c.txt": checksum([]byte("foo\n"))}
+
+	matchPath, err := writeTempMatchFile("bed-test-*.txt", matches, bed.WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := saveSession([]string{matchPath}, sourceChecksums(matches, checksums))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, "b.txt", "// new\nfoo\n")
+
+	if err := RunResume([]string{"-editor", "true", s.ID}); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"a.txt": "bar\n", "b.txt": "// new\nfoo\n", "c.txt": "bar\n"} {
+		if s := readTestFile(t, path); s != want {
+			t.Errorf("unexpected contents of %s: %q", path, s)
+		}
+	}
+}
+
+func TestSourceChecksums(t *testing.T) {
+	matches := []*bed.Match{{Path: "a.txt"}, {Path: "a.txt", Pos: 5}, {Path: "c.txt"}}
+	sums := sourceChecksums(matches, map[string]uint32{"a.txt": 1, "b.txt": 2})
+	if len(sums) != 1 || sums["a.txt"] != 1 {
+		t.Fatalf("unexpected checksums: %v", sums)
+	}
+}
+
+func TestKeepSession(t *testing.T) {
+	chdirTemp(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	orig := []byte("#bed:begin a.txt:0:3\nfoo\n#bed:end\n")
+	writeTestFile(t, "bed-1.txt", string(orig))
+
+	// Unmodified match files without swap files are not worth keeping.
+	var buf bytes.Buffer
+	if keepSession(&buf, []string{"bed-1.txt"}, [][]byte{orig}, nil) {
+		t.Fatal("expected unmodified session not to be kept")
+	}
+
+	writeTestFile(t, "bed-1.txt", "#bed:begin a.txt:0:3\nbar\n#bed:end\n")
+	if !keepSession(&buf, []string{"bed-1.txt"}, [][]byte{orig}, nil) {
+		t.Fatal("expected modified session to be kept")
+	}
+	sessions, err := loadSessions()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(sessions) != 1 {
+		t.Fatalf("unexpected sessions: %d", len(sessions))
+	} else if !strings.Contains(buf.String(), "bed resume "+sessions[0].ID) || !strings.Contains(buf.String(), "bed-1.txt (modified)") {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestFindSwapFiles(t *testing.T) {
+	chdirTemp(t)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", "")
+	writeTestFile(t, ".a.txt.swp", "")
+	writeTestFile(t, "#a.txt#", "")
+
+	if a := findSwapFiles("a.txt"); len(a) != 2 {
+		t.Fatalf("unexpected swap files: %v", a)
+	} else if a := findSwapFiles("b.txt"); len(a) != 0 {
+		t.Fatalf("unexpected swap files: %v", a)
+	}
+}
@@ -0,0 +1,93 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Path sort orders.
+const (
+	SortBytes  = "bytes"  // byte-wise, reproducible across machines
+	SortLocale = "locale" // collated using the user's locale
+)
+
+// validSortOrder returns true if order is blank or a supported sort order.
+func validSortOrder(order string) bool {
+	switch order {
+	case "", SortBytes, SortLocale:
+		return true
+	default:
+		return false
+	}
+}
+
+// pathLess returns a function which compares paths in the given sort order.
+// Returns nil if order is blank so callers can keep their default order.
+func pathLess(order string) func(a, b string) bool {
+	switch order {
+	case SortBytes:
+		return func(a, b string) bool { return a < b }
+	case SortLocale:
+		c := collate.New(localeTag(), collate.Numeric)
+		return func(a, b string) bool {
+			if v := c.CompareString(a, b); v != 0 {
+				return v < 0
+			}
+			return a < b // fall back to bytes for equally collated paths
+		}
+	default:
+		return nil
+	}
+}
+
+// localeTag returns the language of the collation locale from the
+// environment. Returns the root locale if unset or set to "C" or "POSIX".
+func localeTag() language.Tag {
+	for _, key := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+
+		// Strip the codeset & modifier, e.g. "de_DE.UTF-8@euro".
+		if i := strings.IndexAny(v, ".@"); i != -1 {
+			v = v[:i]
+		}
+		if v == "C" || v == "POSIX" {
+			return language.Und
+		}
+		tag, err := language.Parse(strings.Replace(v, "_", "-", -1))
+		if err != nil {
+			return language.Und
+		}
+		return tag
+	}
+	return language.Und
+}
+
+// sortMatches sorts matches by path using less. Matches within the same
+// file keep their order.
+func sortMatches(matches []*bed.Match, less func(a, b string) bool) {
+	if less == nil {
+		return
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return less(matches[i].Path, matches[j].Path)
+	})
+}
+
+// sortPaths sorts paths using less, if set.
+func sortPaths(paths []string, less func(a, b string) bool) {
+	if less == nil {
+		return
+	}
+	sort.SliceStable(paths, func(i, j int) bool { return less(paths[i], paths[j]) })
+}
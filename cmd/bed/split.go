@@ -0,0 +1,191 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// RunSplit executes the "split" command which divides a match file into
+// smaller match files which can be reviewed & applied separately.
+func RunSplit(args []string) error {
+	fs := flag.NewFlagSet("bed-split", flag.ContinueOnError)
+	by := fs.String("by", "file", "")
+	dir := fs.String("dir", ".", "")
+	header := fs.String("header", bed.HeaderJSON, "")
+	encode := fs.String("encode", "", "")
+	fs.Usage = usageSplit
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		return errors.New("match file required")
+	} else if fs.NArg() > 1 {
+		return errors.New("too many arguments")
+	} else if !bed.ValidHeaderFormat(*header) {
+		return fmt.Errorf("unknown header format: %q", *header)
+	} else if !bed.ValidEncoding(*encode) {
+		return fmt.Errorf("unknown encoding: %q", *encode)
+	}
+	count, err := parseSplitBy(*by)
+	if err != nil {
+		return err
+	}
+
+	// Paths are kept as they are written, along with any base directory, so
+	// each part can be applied in the same way as the original.
+	path := fs.Arg(0)
+	matches, base, err := bed.ReadMatchFileBase(path)
+	if err != nil {
+		return err
+	} else if len(matches) == 0 {
+		return ErrNoMatches
+	}
+
+	var parts [][]*bed.Match
+	switch {
+	case count > 0:
+		parts = splitByCount(matches, count)
+	case *by == "dir":
+		parts = splitByKey(matches, func(m *bed.Match) string { return filepath.Dir(filepath.FromSlash(m.Path)) })
+	default:
+		parts = splitByKey(matches, func(m *bed.Match) string { return m.Path })
+	}
+
+	// Name each part after the original match file, e.g. "changes-001.bed".
+	name := filepath.Base(path)
+	if path == "-" {
+		name = "matches.bed"
+	}
+	ext := filepath.Ext(name)
+	if ext == "" {
+		ext = ".bed"
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+
+	if err := os.MkdirAll(*dir, 0777); err != nil {
+		return err
+	}
+	opt := bed.WriteOptions{Header: *header, Encoding: *encode}
+	for i, part := range parts {
+		partPath := filepath.Join(*dir, fmt.Sprintf("%s-%03d%s", name, i+1, ext))
+		if err := writeSplitPart(partPath, part, base, opt); err != nil {
+			return err
+		}
+		paths, _ := bed.GroupMatchesByPath(part)
+		fmt.Printf("%s\t%d match(es) in %d file(s)\n", partPath, len(part), len(paths))
+	}
+	return nil
+}
+
+// parseSplitBy returns the number of matches per part if by is "count=N".
+// Returns zero for "file" or "dir".
+func parseSplitBy(by string) (int, error) {
+	switch {
+	case by == "file" || by == "dir":
+		return 0, nil
+	case strings.HasPrefix(by, "count="):
+		n, err := strconv.Atoi(strings.TrimPrefix(by, "count="))
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid split count: %q", by)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("unknown split criteria: %q", by)
+	}
+}
+
+// splitByKey groups matches into parts with the same key, in the order
+// keys first appear.
+func splitByKey(matches []*bed.Match, key func(*bed.Match) string) [][]*bed.Match {
+	var keys []string
+	m := make(map[string][]*bed.Match)
+	for _, match := range matches {
+		k := key(match)
+		if _, ok := m[k]; !ok {
+			keys = append(keys, k)
+		}
+		m[k] = append(m[k], match)
+	}
+
+	parts := make([][]*bed.Match, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, m[k])
+	}
+	return parts
+}
+
+// splitByCount groups matches into parts of up to n matches. The matches in
+// a file are never divided between parts since applying one part would move
+// the positions of matches in the others, so a file with more than n matches
+// is a part by itself.
+func splitByCount(matches []*bed.Match, n int) [][]*bed.Match {
+	var parts [][]*bed.Match
+	var part []*bed.Match
+	for _, a := range splitByKey(matches, func(m *bed.Match) string { return m.Path }) {
+		if len(part) > 0 && len(part)+len(a) > n {
+			parts, part = append(parts, part), nil
+		}
+		part = append(part, a...)
+	}
+	if len(part) > 0 {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// writeSplitPart writes matches to a match file at path, along with the base
+// directory of the original match file, if any.
+func writeSplitPart(path string, matches []*bed.Match, base string, opt bed.WriteOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if base != "" {
+		if err := bed.WriteMatchBase(f, base); err != nil {
+			return err
+		}
+	}
+	if err := bed.WriteMatchFileOptions(f, matches, opt); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func usageSplit() {
+	writeUsage(os.Stderr, splitDoc)
+}
+
+var splitDoc = &commandDoc{
+	Name:  "bed split",
+	Short: "divide a match file into smaller match files",
+	Long: `Divides a match file into smaller match files so that a large edit can be
+reviewed & applied in parts. Each part is written to a new match file
+named after the original with a number, e.g. "changes-001.bed", & the
+path & number of matches in each part are printed. Matches within a file
+are always kept in the same part since applying one part would otherwise
+move the positions of matches in another.`,
+	Synopsis: []string{
+		"bed split [arguments] matchfile",
+	},
+	Flags: []docItem{
+		{Name: "-by CRITERIA", Text: `Divide matches into a part for each "file" (default), a part
+for each "dir" or parts of up to N matches with "count=N". A
+file with more than N matches is a part by itself.`},
+		{Name: "-dir DIR", Text: "Write the parts to DIR instead of the current directory."},
+		{Name: "-header FORMAT", Text: `Write match headers as "json" (default), "plain" key=value
+pairs or a "yaml" flow mapping. See "bed -h" for details.`},
+		{Name: "-encode ENCODING", Text: `Write the text of matches which cannot be edited safely as
+text as "base64". See "bed -h" for details.`},
+	},
+}
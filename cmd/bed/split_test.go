@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestRunSplit(t *testing.T) {
+	chdirTemp(t)
+	writeTestMatchFile(t, "changes.bed", []*bed.Match{
+		{Path: "a/x.txt", Pos: 0, Len: 1, Data: []byte("1")},
+		{Path: "a/y.txt", Pos: 0, Len: 1, Data: []byte("2")},
+		{Path: "a/x.txt", Pos: 4, Len: 1, Data: []byte("3")},
+		{Path: "b/z.txt", Pos: 0, Len: 1, Data: []byte("4")},
+	})
+
+	for _, tt := range []struct {
+		by    string
+		parts []int // match count of each part
+	}{
+		{by: "file", parts: []int{2, 1, 1}},
+		{by: "dir", parts: []int{3, 1}},
+		{by: "count=2", parts: []int{2, 2}},
+		{by: "count=1", parts: []int{2, 1, 1}},
+	} {
+		t.Run(tt.by, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := RunSplit([]string{"-by", tt.by, "-dir", dir, "changes.bed"}); err != nil {
+				t.Fatal(err)
+			}
+
+			paths, err := filepath.Glob(filepath.Join(dir, "*"))
+			if err != nil {
+				t.Fatal(err)
+			} else if len(paths) != len(tt.parts) {
+				t.Fatalf("unexpected parts: %v", paths)
+			}
+			for i, n := range tt.parts {
+				path := filepath.Join(dir, fmt.Sprintf("changes-%03d.bed", i+1))
+				if matches, err := bed.ReadMatchFile(path); err != nil {
+					t.Fatal(err)
+				} else if len(matches) != n {
+					t.Fatalf("%s: unexpected match count: %d", path, len(matches))
+				}
+			}
+		})
+	}
+}
+
+func TestParseSplitBy(t *testing.T) {
+	for _, tt := range []struct {
+		by  string
+		n   int
+		err bool
+	}{
+		{by: "file"},
+		{by: "dir"},
+		{by: "count=10", n: 10},
+		{by: "count=0", err: true},
+		{by: "count=x", err: true},
+		{by: "size", err: true},
+	} {
+		if n, err := parseSplitBy(tt.by); (err != nil) != tt.err {
+			t.Fatalf("%q: unexpected error: %v", tt.by, err)
+		} else if n != tt.n {
+			t.Fatalf("%q: unexpected count: %d", tt.by, n)
+		}
+	}
+}
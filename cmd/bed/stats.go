@@ -0,0 +1,126 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// validStatsFormat returns true if format is blank or a supported format
+// for the end of run statistics.
+func validStatsFormat(format string) bool {
+	switch format {
+	case "", "text", "json":
+		return true
+	default:
+		return false
+	}
+}
+
+// runStats is a summary of a run, written at the end of the run by -stats.
+type runStats struct {
+	Run            string  `json:"run"`
+	FilesScanned   int     `json:"files_scanned"`
+	FilesEmpty     int     `json:"files_empty"`
+	FilesMatched   int     `json:"files_matched"`
+	Matches        int     `json:"matches"`
+	MatchesEdited  int     `json:"matches_edited"`
+	FilesEdited    int     `json:"files_edited"`
+	MatchesSkipped int     `json:"matches_skipped"`
+	BytesAdded     int     `json:"bytes_added"`
+	BytesRemoved   int     `json:"bytes_removed"`
+	Elapsed        float64 `json:"elapsed_seconds"`
+
+	start time.Time
+	orig  map[matchKey][]byte // original data of found matches
+}
+
+// matchKey uniquely identifies a match within a run.
+type matchKey struct {
+	path string
+	pos  int
+}
+
+func newRunStats() *runStats {
+	return &runStats{start: time.Now()}
+}
+
+// found records the files scanned & the matches found by the search.
+func (s *runStats) found(matches []*bed.Match, timings *bed.Timings, emptyFiles int) {
+	paths, _ := bed.GroupMatchesByPath(matches)
+	s.FilesScanned = len(timings.Files())
+	s.FilesEmpty = emptyFiles
+	s.FilesMatched = len(paths)
+	s.Matches = len(matches)
+
+	s.orig = make(map[matchKey][]byte, len(matches))
+	for _, m := range matches {
+		s.orig[matchKey{m.Path, m.Pos}] = m.Data
+	}
+}
+
+// applied records the changes made by the matches which will be applied.
+// Matches which are unchanged from the original text are not counted.
+func (s *runStats) applied(matches []*bed.Match) error {
+	var a []*bed.Match
+	for _, m := range matches {
+		if orig, ok := s.orig[matchKey{m.Path, m.Pos}]; !ok || m.Directive != "" || !bytes.Equal(m.Data, orig) {
+			a = append(a, m)
+		}
+	}
+	s.MatchesEdited = len(a)
+
+	// Count bytes added & removed by each edit to the files.
+	paths, pathMatches := bed.GroupMatchesByPath(a)
+	s.FilesEdited = len(paths)
+	for i, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		} else if err := bed.CheckMatchData(path, data, pathMatches[i]); err != nil {
+			return err
+		}
+		for _, e := range bed.MatchEdits(data, pathMatches[i]) {
+			s.BytesAdded += len(e.Data)
+			s.BytesRemoved += e.Len
+		}
+	}
+	return nil
+}
+
+// write writes the statistics to w in the given format.
+func (s *runStats) write(w io.Writer, format string) error {
+	elapsed := time.Since(s.start)
+	s.Run = runID
+	s.Elapsed = elapsed.Seconds()
+	s.MatchesSkipped = s.Matches - s.MatchesEdited
+
+	if format == "json" {
+		return json.NewEncoder(w).Encode(s)
+	}
+
+	_, err := fmt.Fprintf(w, ""+
+		"run:             %s\n"+
+		"files scanned:   %d\n"+
+		"files empty:     %d\n"+
+		"files matched:   %d\n"+
+		"matches:         %d\n"+
+		"matches edited:  %d\n"+
+		"matches skipped: %d\n"+
+		"files edited:    %d\n"+
+		"bytes added:     %d\n"+
+		"bytes removed:   %d\n"+
+		"elapsed:         %s\n",
+		runID, s.FilesScanned, s.FilesEmpty, s.FilesMatched, s.Matches, s.MatchesEdited, s.MatchesSkipped, s.FilesEdited,
+		s.BytesAdded, s.BytesRemoved, elapsed.Round(time.Millisecond),
+	)
+	return err
+}
@@ -0,0 +1,57 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readStdinFile copies STDIN to a file in a new temporary directory so it
+// can be searched & edited like any other file with -stdin. The file is
+// named "stdin" with the extension ext, if set, so editors can apply syntax
+// highlighting. The directory should be removed once the run is complete.
+func readStdinFile(ext string) (string, error) {
+	dir, err := ioutil.TempDir("", "bed-"+runID+"-stdin-")
+	if err != nil {
+		return "", err
+	}
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	path := filepath.Join(dir, "stdin"+ext)
+
+	f, err := os.Create(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, os.Stdin); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	} else if err := f.Close(); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return path, nil
+}
+
+// writeStdinFile writes the contents of the file read from STDIN, with any
+// changes applied, to w. Nothing is written if the file was deleted with
+// the delete-file directive.
+func writeStdinFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
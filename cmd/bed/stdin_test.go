@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// runStdin runs bed with args, reading STDIN from input, & returns what was
+// written to STDOUT.
+func runStdin(t *testing.T, input string, args []string) (string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	inPath, outPath := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	writeTestFile(t, inPath, input)
+
+	in, err := os.Open(inPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.Create(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = in, out
+	defer func() { os.Stdin, os.Stdout = stdin, stdout }()
+
+	err = Run(args)
+	return readTestFile(t, outPath), err
+}
+
+func TestRun_Stdin(t *testing.T) {
+	chdirTemp(t)
+	t.Setenv("HOME", t.TempDir())
+
+	if s, err := runStdin(t, "foo\nbaz foo\n", []string{"-stdin", "-replace", "bar", "foo"}); err != nil {
+		t.Fatal(err)
+	} else if s != "bar\nbaz bar\n" {
+		t.Fatalf("unexpected output: %q", s)
+	}
+
+	// Text without matches is written unchanged.
+	if s, err := runStdin(t, "baz\n", []string{"-stdin", "-replace", "bar", "foo"}); err != nil && err != ErrNoMatches {
+		t.Fatal(err)
+	} else if s != "baz\n" {
+		t.Fatalf("unexpected output: %q", s)
+	}
+}
+
+func TestRun_StdinInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"-stdin", "foo", "a.txt"},
+		{"-stdin", "-names", "foo"},
+		{"-stdin", "-emit-script", "x.sh", "foo"},
+	} {
+		if err := Run(args); err == nil {
+			t.Fatalf("%q: expected error", args)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/benbjohnson/bed"
+)
+
+// reviewPayload is the body of a request to the GitHub API which creates a
+// pull request review, POST /repos/OWNER/REPO/pulls/NUMBER/reviews.
+type reviewPayload struct {
+	Event    string          `json:"event"`
+	Body     string          `json:"body"`
+	Comments []reviewComment `json:"comments"`
+}
+
+// reviewComment is an inline review comment on a range of lines in a file.
+type reviewComment struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line,omitempty"`
+	StartSide string `json:"start_side,omitempty"`
+	Line      int    `json:"line"`
+	Side      string `json:"side"`
+	Body      string `json:"body"`
+}
+
+// suggestionHunk is a range of whole lines in a file & the edits to them.
+type suggestionHunk struct {
+	start, end         int // byte range of the lines, including the final newline
+	startLine, endLine int
+	edits              []bed.Edit
+}
+
+// writeSuggestions writes matches to w as a GitHub pull request review with
+// a "suggested change" comment for each group of changed lines, so changes
+// can be proposed on a pull request instead of being applied. Paths are
+// relative to the root of the git worktree. Deleted files & files which are
+// not UTF-8 cannot be suggested & are skipped with a warning.
+func writeSuggestions(w io.Writer, matches []*bed.Match) error {
+	root, err := checkoutRoot("")
+	if err != nil {
+		return err
+	}
+
+	paths, pathMatches := bed.GroupMatchesByPath(bed.RemoveSkipped(matches))
+	rel, err := relativeMatches(bed.RemoveSkipped(matches), root)
+	if err != nil {
+		return err
+	}
+	relPaths, _ := bed.GroupMatchesByPath(rel)
+
+	payload := reviewPayload{Event: "COMMENT", Comments: []reviewComment{}}
+	for i, path := range paths {
+		if bed.DeletesFile(pathMatches[i]) {
+			warnf("%s: cannot suggest deleting a file, skipping", path)
+			continue
+		} else if hasCharset(pathMatches[i]) {
+			warnf("%s: cannot suggest changes to files which are not UTF-8, skipping", path)
+			continue
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		} else if err := bed.CheckMatchData(path, data, pathMatches[i]); err != nil {
+			return err
+		}
+		for _, h := range suggestionHunks(data, bed.MatchEdits(data, pathMatches[i])) {
+			text := h.apply(data)
+			if !utf8.Valid(text) {
+				warnf("%s:%d: cannot suggest changes which are not UTF-8, skipping", path, h.startLine)
+				continue
+			}
+
+			c := reviewComment{Path: relPaths[i], Line: h.endLine, Side: "RIGHT", Body: suggestionBody(text)}
+			if h.startLine != h.endLine {
+				c.StartLine, c.StartSide = h.startLine, "RIGHT"
+			}
+			payload.Comments = append(payload.Comments, c)
+		}
+	}
+	payload.Body = fmt.Sprintf("bed suggests %d change(s).", len(payload.Comments))
+
+	buf, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// suggestionHunks groups edits into ranges of whole lines of data. Edits on
+// the same lines are grouped together since a line can only have one
+// suggestion.
+func suggestionHunks(data []byte, edits []bed.Edit) []*suggestionHunk {
+	var hunks []*suggestionHunk
+	for _, e := range edits {
+		// Text inserted at the end of a file is suggested with its last line.
+		h := &suggestionHunk{start: bytes.LastIndexByte(data[:e.Pos], '\n') + 1, edits: []bed.Edit{e}}
+		if h.start == len(data) && h.start > 0 {
+			h.start = bytes.LastIndexByte(data[:h.start-1], '\n') + 1
+		}
+		h.startLine = bytes.Count(data[:h.start], []byte("\n")) + 1
+
+		// The hunk ends with the line containing the last byte of the edit,
+		// or the line it is inserted into.
+		last := e.Pos
+		if e.Len > 0 {
+			last = e.Pos + e.Len - 1
+		}
+		h.setEnd(data, last)
+
+		// Merge with the previous hunk if they share a line.
+		if n := len(hunks); n > 0 && h.start < hunks[n-1].end {
+			hunks[n-1].merge(h)
+			continue
+		}
+		hunks = append(hunks, h)
+	}
+
+	// Extend hunks whose edits remove the newline at the end of their last
+	// line, since the following line is then joined to it.
+	for i := 0; i < len(hunks); i++ {
+		h := hunks[i]
+		for h.end < len(data) {
+			if text := h.apply(data); len(text) == 0 || text[len(text)-1] == '\n' {
+				break
+			}
+			h.setEnd(data, h.end)
+			if i+1 < len(hunks) && hunks[i+1].start < h.end {
+				h.merge(hunks[i+1])
+				hunks = append(hunks[:i+1], hunks[i+2:]...)
+			}
+		}
+	}
+	return hunks
+}
+
+// setEnd ends the hunk after the line of data containing pos.
+func (h *suggestionHunk) setEnd(data []byte, pos int) {
+	h.end = len(data)
+	if pos < len(data) {
+		if i := bytes.IndexByte(data[pos:], '\n'); i >= 0 {
+			h.end = pos + i + 1
+		}
+	}
+
+	h.endLine = h.startLine + bytes.Count(data[h.start:h.end], []byte("\n"))
+	if h.end > h.start && data[h.end-1] == '\n' {
+		h.endLine--
+	}
+}
+
+// merge adds the lines & edits of other, which follows h, to h.
+func (h *suggestionHunk) merge(other *suggestionHunk) {
+	if other.end > h.end {
+		h.end, h.endLine = other.end, other.endLine
+	}
+	h.edits = append(h.edits, other.edits...)
+}
+
+// apply returns the lines of the hunk with its edits applied. CRLF line
+// endings are written as LF since suggestions are shown line by line.
+func (h *suggestionHunk) apply(data []byte) []byte {
+	var buf bytes.Buffer
+	pos := h.start
+	for _, e := range h.edits {
+		buf.Write(data[pos:e.Pos])
+		buf.Write(e.Data)
+		pos = e.Pos + e.Len
+	}
+	buf.Write(data[pos:h.end])
+	return bytes.Replace(buf.Bytes(), []byte("\r\n"), []byte("\n"), -1)
+}
+
+// suggestionBody returns text as a GitHub suggestion block. The fence is
+// longer than any run of backticks in text so the block cannot be closed
+// early. An empty suggestion deletes the lines.
+func suggestionBody(text []byte) string {
+	fence := "```"
+	for strings.Contains(string(text), fence) {
+		fence += "`"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fence + "suggestion\n")
+	sb.Write(text)
+	if len(text) > 0 && text[len(text)-1] != '\n' {
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(fence + "\n")
+	return sb.String()
+}
+
+// hasCharset returns true if any of matches refer to text decoded from
+// another character set.
+func hasCharset(matches []*bed.Match) bool {
+	for _, m := range matches {
+		if m.Charset != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSuggestionsFile writes the suggestions for matches to path, or to
+// STDOUT if path is "-".
+func writeSuggestionsFile(path string, matches []*bed.Match) error {
+	if path == "-" {
+		return writeSuggestions(os.Stdout, matches)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeSuggestions(f, matches); err != nil {
+		return err
+	}
+	return f.Close()
+}
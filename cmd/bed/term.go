@@ -0,0 +1,23 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import "os"
+
+// isTerminal returns true if f is attached to a terminal. This includes
+// Windows consoles & the pipes which Cygwin & MSYS2 terminals, such as
+// mintty, use in place of a console.
+func isTerminal(f *os.File) bool {
+	return terminalKind(f) != ""
+}
+
+// useColor returns true if output to f should be colorized. Color is only
+// used on terminals & can be disabled with the NO_COLOR environment variable
+// or a TERM of "dumb".
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(f)
+}
@@ -0,0 +1,12 @@
+//go:build (darwin || dragonfly || freebsd || netbsd || openbsd) && !audit
+// +build darwin dragonfly freebsd netbsd openbsd
+// +build !audit
+
+package main
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlReadTermios  = unix.TIOCGETA
+	ioctlWriteTermios = unix.TIOCSETA
+)
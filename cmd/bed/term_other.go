@@ -0,0 +1,25 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows && !audit
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows,!audit
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// termState is unused on platforms without terminal support.
+type termState struct{}
+
+// errNoTerminal is returned by terminal functions on unsupported platforms.
+var errNoTerminal = errors.New("terminals are not supported on this platform")
+
+// terminalKind always returns a blank string since terminals are not
+// supported.
+func terminalKind(f *os.File) string { return "" }
+
+func makeRaw(fd int) (*termState, error)             { return nil, errNoTerminal }
+func restoreTerminal(fd int, state *termState) error { return errNoTerminal }
+func terminalSize(fd int) (width, height int, err error) {
+	return 0, 0, errNoTerminal
+}
@@ -0,0 +1,12 @@
+//go:build (aix || linux || solaris) && !audit
+// +build aix linux solaris
+// +build !audit
+
+package main
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlReadTermios  = unix.TCGETS
+	ioctlWriteTermios = unix.TCSETS
+)
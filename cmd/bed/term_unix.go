@@ -0,0 +1,60 @@
+//go:build (aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris) && !audit
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+// +build !audit
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// termState is the state of a terminal before it was put in raw mode.
+type termState struct {
+	termios unix.Termios
+}
+
+// terminalKind returns "terminal" if f is a terminal or a blank string.
+func terminalKind(f *os.File) string {
+	if _, err := unix.IoctlGetTermios(int(f.Fd()), ioctlReadTermios); err != nil {
+		return ""
+	}
+	return "terminal"
+}
+
+// makeRaw puts the terminal fd in raw mode, so key presses are read one at
+// a time without echo, & returns its previous state.
+func makeRaw(fd int) (*termState, error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	state := &termState{termios: *termios}
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, termios); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// restoreTerminal returns the terminal fd to a state returned by makeRaw.
+func restoreTerminal(fd int, state *termState) error {
+	return unix.IoctlSetTermios(fd, ioctlWriteTermios, &state.termios)
+}
+
+// terminalSize returns the width & height of the terminal fd.
+func terminalSize(fd int) (width, height int, err error) {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
@@ -0,0 +1,86 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"os"
+	"regexp"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// termState is the mode of a console before it was put in raw mode.
+type termState struct {
+	mode uint32
+}
+
+// cygwinPipeRegex matches the names of the pipes used as standard streams by
+// Cygwin & MSYS2 terminals, e.g. \msys-dd50a72ab4668b33-pty0-to-master.
+var cygwinPipeRegex = regexp.MustCompile(`^\\(cygwin|msys)-[0-9a-f]+-pty[0-9]+-(from|to)-master`)
+
+// terminalKind returns "console" if f is a Windows console, "cygwin" if it
+// is the pipe of a Cygwin or MSYS2 terminal or a blank string otherwise.
+func terminalKind(f *os.File) string {
+	h := windows.Handle(f.Fd())
+	var mode uint32
+	if windows.GetConsoleMode(h, &mode) == nil {
+		return "console"
+	} else if isCygwinPipe(h) {
+		return "cygwin"
+	}
+	return ""
+}
+
+// isCygwinPipe returns true if h is a pipe named like a Cygwin or MSYS2
+// terminal's pipe.
+func isCygwinPipe(h windows.Handle) bool {
+	if t, err := windows.GetFileType(h); err != nil || t != windows.FILE_TYPE_PIPE {
+		return false
+	}
+
+	// The FILE_NAME_INFO structure is a uint32 length in bytes followed by
+	// the UTF-16 name.
+	var buf [4 + windows.MAX_PATH*2]byte
+	if err := windows.GetFileInformationByHandleEx(h, windows.FileNameInfo, &buf[0], uint32(len(buf))); err != nil {
+		return false
+	}
+	n := *(*uint32)(unsafe.Pointer(&buf[0])) / 2
+	if int(n) > windows.MAX_PATH {
+		return false
+	}
+	name := (*[windows.MAX_PATH]uint16)(unsafe.Pointer(&buf[4]))[:n:n]
+	return cygwinPipeRegex.MatchString(string(utf16.Decode(name)))
+}
+
+// makeRaw puts the console fd in raw mode, so key presses are read one at a
+// time without echo, & returns its previous mode.
+func makeRaw(fd int) (*termState, error) {
+	var mode uint32
+	if err := windows.GetConsoleMode(windows.Handle(fd), &mode); err != nil {
+		return nil, err
+	}
+	raw := mode &^ (windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT | windows.ENABLE_PROCESSED_OUTPUT)
+	raw |= windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(windows.Handle(fd), raw); err != nil {
+		return nil, err
+	}
+	return &termState{mode: mode}, nil
+}
+
+// restoreTerminal returns the console fd to a mode returned by makeRaw.
+func restoreTerminal(fd int, state *termState) error {
+	return windows.SetConsoleMode(windows.Handle(fd), state.mode)
+}
+
+// terminalSize returns the width & height of the visible window of the
+// console fd.
+func terminalSize(fd int) (width, height int, err error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(fd), &info); err != nil {
+		return 0, 0, err
+	}
+	return int(info.Window.Right - info.Window.Left + 1), int(info.Window.Bottom - info.Window.Top + 1), nil
+}
@@ -0,0 +1,67 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"log"
+	"os"
+	"runtime/trace"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// logTimings logs the timing of each file followed by any slow files.
+func logTimings(t *bed.Timings) {
+	for _, ft := range t.Files() {
+		log.Printf("debug: timing: %s size=%d read=%s match=%s write=%s", ft.Path, ft.Size, ft.Read, ft.Match, ft.Write)
+	}
+	for _, ft := range t.Slow() {
+		log.Printf("slow file: %s took %s (read=%s match=%s write=%s)", ft.Path, ft.Total(), ft.Read, ft.Match, ft.Write)
+	}
+}
+
+// startTrace writes a runtime execution trace to path until the returned
+// function is called. Returns a no-op function if path is blank.
+func startTrace(path string) (stop func(), err error) {
+	if path == "" {
+		return func() {}, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	} else if err := trace.Start(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		trace.Stop()
+		f.Close()
+	}, nil
+}
+
+// totalReadTime returns the total time spent reading files.
+func totalReadTime(t *bed.Timings) (d time.Duration) {
+	for _, ft := range t.Files() {
+		d += ft.Read
+	}
+	return d
+}
+
+// totalWriteTime returns the total time spent writing files.
+func totalWriteTime(t *bed.Timings) (d time.Duration) {
+	for _, ft := range t.Files() {
+		d += ft.Write
+	}
+	return d
+}
+
+// formatDuration returns d rounded for display, e.g. "1.2s" or "35ms".
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,383 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/benbjohnson/bed"
+)
+
+// tuiHelp is displayed on the status line of the terminal interface.
+const tuiHelp = "j/k:move e:edit d:delete D:delete line X:delete file s:skip u:undo w:write q:quit"
+
+// tui is a full screen terminal interface for reviewing & editing matches
+// without an external editor.
+type tui struct {
+	keys   *keyReader
+	w      *bufio.Writer
+	width  int
+	height int
+	fd     int
+
+	matches []*bed.Match
+	orig    [][]byte          // original data of each match
+	files   map[string][]byte // file contents cache for previews
+	sel     int               // index of selected match
+	top     int               // index of first match in visible list
+	status  string
+}
+
+// runTUI displays matches in a full screen terminal interface where they can
+// be reviewed & edited. Returns the changed matches once the user writes
+// their changes or nil if the user quits without writing.
+func runTUI(matches []*bed.Match) ([]*bed.Match, error) {
+	f, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start tui without a terminal: %s", err)
+	}
+	defer f.Close()
+
+	state, err := makeRaw(int(f.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	defer restoreTerminal(int(f.Fd()), state)
+
+	t := newTUI(f, f, int(f.Fd()), matches)
+
+	// Use the alternate screen so the terminal is restored on exit.
+	fmt.Fprint(t.w, "\x1b[?1049h")
+	defer func() {
+		fmt.Fprint(t.w, "\x1b[?25h\x1b[?1049l")
+		t.w.Flush()
+	}()
+
+	return t.run()
+}
+
+// newTUI returns a tui which reads key presses from r & draws to w. The size
+// of the terminal fd is used for layout, falling back to 80x24.
+func newTUI(r io.Reader, w io.Writer, fd int, matches []*bed.Match) *tui {
+	t := &tui{
+		keys:    newKeyReader(r),
+		w:       bufio.NewWriter(w),
+		fd:      fd,
+		matches: matches,
+		orig:    make([][]byte, len(matches)),
+		files:   make(map[string][]byte),
+	}
+	for i, m := range matches {
+		t.orig[i] = m.Data
+	}
+	return t
+}
+
+// run processes key presses until the user writes or quits.
+func (t *tui) run() ([]*bed.Match, error) {
+	for {
+		t.draw()
+
+		key, err := t.keys.ReadKey()
+		if err != nil {
+			return nil, err
+		}
+		t.status = ""
+
+		switch key {
+		case 'j', keyDown:
+			t.move(1)
+		case 'k', keyUp:
+			t.move(-1)
+		case keyPageDown, ' ':
+			t.move(t.listHeight())
+		case keyPageUp:
+			t.move(-t.listHeight())
+		case 'g', keyHome:
+			t.move(-len(t.matches))
+		case 'G', keyEnd:
+			t.move(len(t.matches))
+		case 'e', keyEnter:
+			if err := t.edit(); err != nil {
+				return nil, err
+			}
+		case 'd':
+			t.toggle(bed.DirectiveDelete)
+		case 'D':
+			t.toggle(bed.DirectiveDeleteLine)
+		case 'X':
+			t.toggle(bed.DirectiveDeleteFile)
+		case 's':
+			t.toggle(bed.DirectiveSkip)
+		case 'u':
+			if m := t.selected(); m != nil {
+				m.Data, m.Directive = t.orig[t.sel], ""
+			}
+		case 'w':
+			return t.changed(), nil
+		case 'q', keyCtrlC:
+			return nil, nil
+		}
+	}
+}
+
+// selected returns the currently selected match, if any.
+func (t *tui) selected() *bed.Match {
+	if len(t.matches) == 0 {
+		return nil
+	}
+	return t.matches[t.sel]
+}
+
+// move moves the selection by n matches and scrolls the list to keep the
+// selection visible.
+func (t *tui) move(n int) {
+	if t.sel += n; t.sel >= len(t.matches) {
+		t.sel = len(t.matches) - 1
+	}
+	if t.sel < 0 {
+		t.sel = 0
+	}
+
+	if t.sel < t.top {
+		t.top = t.sel
+	} else if h := t.listHeight(); t.sel >= t.top+h {
+		t.top = t.sel - h + 1
+	}
+}
+
+// toggle sets the directive on the selected match or clears it if it is
+// already set.
+func (t *tui) toggle(directive string) {
+	if m := t.selected(); m == nil {
+		return
+	} else if m.Directive == directive {
+		m.Directive = ""
+	} else {
+		m.Directive = directive
+	}
+}
+
+// edit edits the text of the selected match on the status line.
+func (t *tui) edit() error {
+	m := t.selected()
+	if m == nil {
+		return nil
+	}
+
+	fmt.Fprintf(t.w, "\x1b[%d;1H\x1b[?25h", t.height)
+	e := &lineEditor{keys: t.keys, w: t.w, width: t.width}
+	text, ok, err := e.Edit("edit: ", string(m.Data))
+	fmt.Fprint(t.w, "\x1b[?25l")
+	if err != nil {
+		return err
+	} else if !ok {
+		t.status = "edit cancelled"
+		return nil
+	}
+	m.Data, m.Directive = []byte(text), ""
+	return nil
+}
+
+// changed returns the matches which were edited or have a directive.
+func (t *tui) changed() []*bed.Match {
+	a := make([]*bed.Match, 0, len(t.matches))
+	for i, m := range t.matches {
+		if m.Directive != "" || !bytes.Equal(m.Data, t.orig[i]) {
+			a = append(a, m)
+		}
+	}
+	return a
+}
+
+// listHeight returns the number of rows used to display the match list.
+func (t *tui) listHeight() int {
+	if h := (t.height - 2) / 2; h > 1 {
+		return h
+	}
+	return 1
+}
+
+// draw redraws the entire screen.
+func (t *tui) draw() {
+	if w, h, err := terminalSize(t.fd); err == nil && w > 0 && h > 0 {
+		t.width, t.height = w, h
+	} else {
+		t.width, t.height = 80, 24
+	}
+	t.move(0)
+
+	fmt.Fprint(t.w, "\x1b[?25l\x1b[H")
+
+	// Draw the list of matches with the selection highlighted.
+	listHeight := t.listHeight()
+	for row := 0; row < listHeight; row++ {
+		fmt.Fprint(t.w, "\x1b[K")
+		if i := t.top + row; i < len(t.matches) {
+			line := t.truncate(fmt.Sprintf("%s %s:%d %s", t.marker(i), t.matches[i].Path, t.line(t.matches[i]), oneLine(t.matches[i].Data)))
+			if i == t.sel {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			}
+			fmt.Fprint(t.w, line)
+		}
+		fmt.Fprint(t.w, "\r\n")
+	}
+
+	// Draw a separator followed by a preview of the selected match.
+	var title string
+	if m := t.selected(); m != nil {
+		title = fmt.Sprintf(" %s (%d/%d) ", m.Path, t.sel+1, len(t.matches))
+	}
+	fmt.Fprintf(t.w, "\x1b[K%s\r\n", t.truncate("──"+title+strings.Repeat("─", t.width)))
+
+	previewHeight := t.height - listHeight - 2
+	lines := t.preview(previewHeight)
+	for row := 0; row < previewHeight; row++ {
+		fmt.Fprint(t.w, "\x1b[K")
+		if row < len(lines) {
+			fmt.Fprint(t.w, lines[row])
+		}
+		fmt.Fprint(t.w, "\r\n")
+	}
+
+	// Draw status line.
+	status := t.status
+	if status == "" {
+		status = tuiHelp
+	}
+	fmt.Fprintf(t.w, "\x1b[K\x1b[2m%s\x1b[0m", t.truncate(status))
+	t.w.Flush()
+}
+
+// marker returns a character representing the state of the match at index i.
+func (t *tui) marker(i int) string {
+	switch m := t.matches[i]; {
+	case m.Directive == bed.DirectiveDelete:
+		return "d"
+	case m.Directive == bed.DirectiveDeleteLine:
+		return "D"
+	case m.Directive == bed.DirectiveDeleteFile:
+		return "X"
+	case m.Directive == bed.DirectiveSkip:
+		return "s"
+	case !bytes.Equal(m.Data, t.orig[i]):
+		return "*"
+	default:
+		return " "
+	}
+}
+
+// preview returns up to n lines of the selected match's file surrounding the
+// match, with the pending replacement applied & highlighted.
+func (t *tui) preview(n int) []string {
+	m := t.selected()
+	if m == nil || n <= 0 {
+		return nil
+	}
+
+	data := t.file(m)
+	if m.Pos+m.Len > len(data) {
+		return []string{"(file has changed)"}
+	}
+
+	mid := m.Data
+	switch m.Directive {
+	case bed.DirectiveDelete, bed.DirectiveDeleteLine, bed.DirectiveDeleteFile:
+		mid = nil
+	case bed.DirectiveSkip:
+		mid = data[m.Pos : m.Pos+m.Len]
+	}
+
+	// Include context lines before & after the match.
+	start, end := m.Pos, m.Pos+m.Len
+	for i := 0; i <= n/2 && start > 0; i++ {
+		start = bytes.LastIndexByte(data[:start-1], '\n') + 1
+	}
+	for i := 0; i < n && end < len(data); i++ {
+		if j := bytes.IndexByte(data[end:], '\n'); j != -1 {
+			end += j + 1
+		} else {
+			end = len(data)
+		}
+	}
+
+	// Build lines, highlighting the replacement text on every line it spans.
+	var lines []string
+	var line []byte
+	var width int
+	add := func(b []byte, highlight bool) {
+		for len(b) > 0 {
+			ch, size := utf8.DecodeRune(b)
+			b = b[size:]
+			if ch == '\n' {
+				lines, line, width = append(lines, string(line)+"\x1b[0m"), nil, 0
+				continue
+			}
+			if width == 0 && highlight {
+				line = append(line, "\x1b[7m"...)
+			}
+			if width < t.width {
+				line = append(line, string(ch)...)
+			}
+			width++
+		}
+	}
+	add(data[start:m.Pos], false)
+	line = append(line, "\x1b[7m"...)
+	add(mid, true)
+	line = append(line, "\x1b[0m"...)
+	add(data[m.Pos+m.Len:end], false)
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+
+	if len(lines) > n {
+		lines = lines[:n]
+	}
+	return lines
+}
+
+// line returns the line number of the match in its file.
+func (t *tui) line(m *bed.Match) int {
+	data := t.file(m)
+	if m.Pos > len(data) {
+		return 0
+	}
+	return bytes.Count(data[:m.Pos], []byte("\n")) + 1
+}
+
+// file returns the text of the file containing m, reading it from disk on
+// first use. Files in other character sets are decoded to UTF-8 & any byte
+// order mark is removed, since match positions are relative to the text.
+func (t *tui) file(m *bed.Match) []byte {
+	data, ok := t.files[m.Path]
+	if !ok {
+		data, _ = ioutil.ReadFile(m.Path)
+		if text, err := bed.DecodeCharset(data, m.Charset); err == nil {
+			data = bed.TrimByteOrderMark(text)
+		}
+		t.files[m.Path] = data
+	}
+	return data
+}
+
+// truncate shortens s to fit the width of the screen.
+func (t *tui) truncate(s string) string {
+	if utf8.RuneCountInString(s) <= t.width {
+		return s
+	}
+	return string([]rune(s)[:t.width])
+}
+
+// oneLine returns data as a single line with newlines shown as "↵".
+func oneLine(data []byte) string {
+	return strings.Replace(string(data), "\n", "↵", -1)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestTUI_Run(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		keys []string
+		want []string // path, directive & data of each changed match
+		err  error
+	}{
+		{name: "Quit", keys: []string{"d", "q"}, want: nil},
+		{name: "CtrlC", keys: []string{"d", "\x03"}, want: nil},
+		{name: "WriteUnchanged", keys: []string{"w"}, want: []string{}},
+		{name: "Delete", keys: []string{"d", "w"}, want: []string{"a.txt delete foo"}},
+		{name: "DeleteLine", keys: []string{"D", "w"}, want: []string{"a.txt delete-line foo"}},
+		{name: "DeleteFile", keys: []string{"X", "w"}, want: []string{"a.txt delete-file foo"}},
+		{name: "Skip", keys: []string{"s", "w"}, want: []string{"a.txt skip foo"}},
+		{name: "ToggleOff", keys: []string{"d", "d", "w"}, want: []string{}},
+		{name: "ToggleSwitch", keys: []string{"d", "s", "w"}, want: []string{"a.txt skip foo"}},
+		{name: "Down", keys: []string{"j", "d", "w"}, want: []string{"a.txt delete bar"}},
+		{name: "Up", keys: []string{"j", "j", "k", "d", "w"}, want: []string{"a.txt delete bar"}},
+		{name: "Arrows", keys: []string{"\x1b[B", "\x1b[B", "\x1b[A", "d", "w"}, want: []string{"a.txt delete bar"}},
+		{name: "End", keys: []string{"G", "d", "w"}, want: []string{"b.txt delete baz"}},
+		{name: "Home", keys: []string{"G", "g", "d", "w"}, want: []string{"a.txt delete foo"}},
+		{name: "ClampTop", keys: []string{"k", "k", "d", "w"}, want: []string{"a.txt delete foo"}},
+		{name: "ClampBottom", keys: []string{"j", "j", "j", "j", "d", "w"}, want: []string{"b.txt delete baz"}},
+		{name: "Multiple", keys: []string{"d", "j", "j", "s", "w"}, want: []string{"a.txt delete foo", "b.txt skip baz"}},
+		{name: "Edit", keys: []string{"e", "\x15", "x", "y", "\r", "w"}, want: []string{"a.txt  xy"}},
+		{name: "EditEnter", keys: []string{"\r", "\x7f", "\r", "w"}, want: []string{"a.txt  fo"}},
+		{name: "EditClearsDirective", keys: []string{"d", "e", "!", "\r", "w"}, want: []string{"a.txt  foo!"}},
+		{name: "EditEscape", keys: []string{"e", "x", "\x1b", "w"}, want: []string{}},
+		{name: "EditCtrlC", keys: []string{"e", "x", "\x03", "w"}, want: []string{}},
+		{name: "EditUnchanged", keys: []string{"d", "e", "\r", "w"}, want: []string{}},
+		{name: "Undo", keys: []string{"e", "x", "\r", "d", "u", "w"}, want: []string{}},
+		{name: "EOF", keys: []string{"d"}, err: io.EOF},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirTemp(t)
+			writeTestFile(t, "a.txt", "foo\nbar\n")
+			writeTestFile(t, "b.txt", "baz\n")
+			matches := []*bed.Match{
+				{Path: "a.txt", Pos: 0, Len: 3, Data: []byte("foo")},
+				{Path: "a.txt", Pos: 4, Len: 3, Data: []byte("bar")},
+				{Path: "b.txt", Pos: 0, Len: 3, Data: []byte("baz")},
+			}
+
+			ui := newTUI(&keyPresses{keys: tt.keys}, ioutil.Discard, -1, matches)
+			changed, err := ui.run()
+			if err != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			} else if tt.err != nil {
+				return
+			}
+
+			var got []string
+			if changed != nil {
+				got = []string{}
+			}
+			for _, m := range changed {
+				got = append(got, m.Path+" "+m.Directive+" "+string(m.Data))
+			}
+			if (got == nil) != (tt.want == nil) || strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Fatalf("unexpected changes: %q", got)
+			}
+		})
+	}
+}
+
+func TestTUI_Move(t *testing.T) {
+	matches := make([]*bed.Match, 20)
+	for i := range matches {
+		matches[i] = &bed.Match{Path: "a.txt"}
+	}
+	ui := newTUI(strings.NewReader(""), ioutil.Discard, -1, matches)
+	ui.width, ui.height = 80, 24 // list shows 11 matches
+
+	for _, tt := range []struct {
+		n        int
+		sel, top int
+	}{
+		{n: 5, sel: 5, top: 0},
+		{n: 5, sel: 10, top: 0},
+		{n: 1, sel: 11, top: 1},
+		{n: 100, sel: 19, top: 9},
+		{n: -9, sel: 10, top: 9},
+		{n: -2, sel: 8, top: 8},
+		{n: -100, sel: 0, top: 0},
+	} {
+		if ui.move(tt.n); ui.sel != tt.sel || ui.top != tt.top {
+			t.Fatalf("move(%d): unexpected sel/top: %d/%d", tt.n, ui.sel, ui.top)
+		}
+	}
+}
+
+// keyPresses returns one key press per read, as a raw mode terminal does,
+// so a lone escape is not mistaken for the start of an escape sequence.
+type keyPresses struct {
+	keys []string
+}
+
+func (kp *keyPresses) Read(p []byte) (int, error) {
+	if len(kp.keys) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, kp.keys[0])
+	kp.keys = kp.keys[1:]
+	return n, nil
+}
@@ -0,0 +1,373 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// ReleasesURL is the GitHub API endpoint for the latest release of bed.
+const ReleasesURL = "https://api.github.com/repos/benbjohnson/bed/releases/latest"
+
+// ReleaseKey is the base64 encoded Ed25519 public key which signs the
+// checksums of each release. It is set at link time by release builds:
+//
+//	go build -ldflags "-X main.ReleaseKey=..." ./cmd/bed
+//
+// Builds without a key cannot verify releases & so cannot upgrade.
+var ReleaseKey = ""
+
+// RunUpgrade executes the "upgrade" command which replaces the current
+// executable with the latest release from GitHub.
+//
+// Release assets are expected to be archives named with a "_<os>_<arch>"
+// suffix (e.g. "bed_1.2.0_linux_amd64.tar.gz", or ".zip" on Windows) along
+// with a "checksums.txt" file containing SHA-256 sums of each archive & a
+// "checksums.txt.sig" file containing the base64 encoded Ed25519 signature
+// of the checksums by the release key.
+func RunUpgrade(args []string) error {
+	fs := flag.NewFlagSet("bed-upgrade", flag.ContinueOnError)
+	checkOnly := fs.Bool("check", false, "")
+	force := fs.Bool("force", false, "")
+	fs.Usage = usageUpgrade
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return errors.New("too many arguments")
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	current := bed.GetBuildInfo().Version
+
+	// Fetch information about the latest release.
+	var release githubRelease
+	if buf, err := httpGet(client, ReleasesURL); err != nil {
+		return err
+	} else if err := json.Unmarshal(buf, &release); err != nil {
+		return fmt.Errorf("invalid release info: %s", err)
+	}
+
+	if !*force {
+		if current == "dev" {
+			return errors.New("cannot upgrade a development build, use -force to install the latest release")
+		} else if compareVersions(release.TagName, current) <= 0 {
+			fmt.Printf("bed %s is up to date\n", current)
+			return nil
+		}
+	}
+
+	if *checkOnly {
+		fmt.Printf("bed %s is available (current: %s)\n", release.TagName, current)
+		return nil
+	}
+
+	// Releases are only trusted if they are signed by the release key.
+	key, err := parseReleaseKey(ReleaseKey)
+	if err != nil {
+		return err
+	}
+
+	// Find the archive for this platform, the checksum file & its signature.
+	archive, checksums, signature := release.findAssets(runtime.GOOS, runtime.GOARCH)
+	if archive == nil {
+		return fmt.Errorf("no release asset available for %s/%s", runtime.GOOS, runtime.GOARCH)
+	} else if checksums == nil {
+		return errors.New("release has no checksums.txt asset")
+	} else if signature == nil {
+		return errors.New("release has no checksums.txt.sig asset")
+	}
+
+	// Verify the signature of the checksums & then download the archive &
+	// verify it against its checksum.
+	sums, err := httpGet(client, checksums.URL)
+	if err != nil {
+		return err
+	}
+	sig, err := httpGet(client, signature.URL)
+	if err != nil {
+		return err
+	} else if err := verifyChecksums(key, sums, sig); err != nil {
+		return err
+	}
+	expected, err := findChecksum(sums, archive.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "downloading %s\n", archive.Name)
+	data, err := httpGet(client, archive.URL)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != expected {
+		return fmt.Errorf("checksum mismatch for %s", archive.Name)
+	}
+
+	// Extract the binary & replace the current executable.
+	bin, err := extractBinary(archive.Name, data)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	} else if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if err := replaceExecutable(exe, bin); err != nil {
+		return err
+	}
+
+	fmt.Printf("upgraded bed %s to %s\n", current, release.TagName)
+	return nil
+}
+
+type githubRelease struct {
+	TagName string        `json:"tag_name"`
+	Assets  []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// findAssets returns the archive asset for the given platform, the checksum
+// file asset & its signature asset, if they exist.
+func (r *githubRelease) findAssets(goos, goarch string) (archive, checksums, signature *githubAsset) {
+	suffix := "_" + goos + "_" + goarch
+	for i := range r.Assets {
+		a := &r.Assets[i]
+		switch {
+		case strings.HasSuffix(a.Name, "checksums.txt"):
+			checksums = a
+		case strings.HasSuffix(a.Name, "checksums.txt.sig"):
+			signature = a
+		case strings.HasSuffix(a.Name, suffix+".tar.gz"), strings.HasSuffix(a.Name, suffix+".zip"):
+			archive = a
+		}
+	}
+	return archive, checksums, signature
+}
+
+// parseReleaseKey returns the Ed25519 public key encoded in s.
+func parseReleaseKey(s string) (ed25519.PublicKey, error) {
+	if s == "" {
+		return nil, errors.New("this build has no release key to verify releases with, install the latest release manually")
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid release key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifyChecksums returns an error unless sig, a base64 encoded signature,
+// is a valid signature of the checksum file sums by key.
+func verifyChecksums(key ed25519.PublicKey, sums, sig []byte) error {
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(key, sums, buf) {
+		return errors.New("release checksums are not signed by the release key")
+	}
+	return nil
+}
+
+// httpGet returns the body of a successful GET request to url.
+func httpGet(client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "bed/"+bed.Version)
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && strings.HasPrefix(url, "https://api.github.com/") {
+		req.Header.Set("Authorization", "token "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// findChecksum returns the hex-encoded checksum for name from a checksum
+// file in the "<sum>  <name>" format used by sha256sum.
+func findChecksum(data []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum found for %s", name)
+}
+
+// extractBinary returns the contents of the bed executable from a .tar.gz
+// or .zip archive.
+func extractBinary(name string, data []byte) ([]byte, error) {
+	bin := "bed"
+	if runtime.GOOS == "windows" {
+		bin = "bed.exe"
+	}
+
+	if strings.HasSuffix(name, ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if filepath.Base(f.Name) == bin {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return ioutil.ReadAll(rc)
+			}
+		}
+		return nil, fmt.Errorf("%s not found in %s", bin, name)
+	}
+
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", bin, name)
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && filepath.Base(hdr.Name) == bin {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
+
+// replaceExecutable atomically replaces the executable at path with data,
+// keeping its permissions. On Windows, the running executable cannot be
+// overwritten so it is renamed out of the way first & restored if it cannot
+// be replaced.
+func replaceExecutable(path string, data []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".bed-upgrade-")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	} else if err := os.Chmod(tmpPath, fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if runtime.GOOS != "windows" {
+		return os.Rename(tmpPath, path)
+	}
+
+	old := path + ".old"
+	os.Remove(old)
+	if err := os.Rename(path, old); err != nil {
+		return err
+	} else if err := os.Rename(tmpPath, path); err != nil {
+		if e := os.Rename(old, path); e != nil {
+			return fmt.Errorf("%s; the previous executable is at %s", err, old)
+		}
+		return err
+	}
+	return nil
+}
+
+// compareVersions compares two "vMAJOR.MINOR.PATCH" version strings and
+// returns -1, 0 or 1 if a is less than, equal to or greater than b.
+// Pre-release suffixes are ignored.
+func compareVersions(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for i := range pa {
+		if pa[i] < pb[i] {
+			return -1
+		} else if pa[i] > pb[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseVersion(s string) [3]int {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i != -1 {
+		s = s[:i]
+	}
+
+	var v [3]int
+	for i, part := range strings.SplitN(s, ".", 3) {
+		v[i], _ = strconv.Atoi(part)
+	}
+	return v
+}
+
+func usageUpgrade() {
+	writeUsage(os.Stderr, upgradeDoc)
+}
+
+var upgradeDoc = &commandDoc{
+	Name:  "bed upgrade",
+	Short: "install the latest release",
+	Long: `Replaces the bed executable with the latest release from GitHub after
+verifying the signature of the release's checksums with the release
+key built into bed & verifying the downloaded archive against its
+checksum. Builds without a release key, such as those installed with
+"go get", cannot upgrade.`,
+	Synopsis: []string{
+		"bed upgrade [arguments]",
+	},
+	Flags: []docItem{
+		{Name: "-check", Text: "Only report whether a newer version is available."},
+		{Name: "-force", Text: `Install the latest release even if it is not newer than the
+current version or if running a development build.`},
+	},
+}
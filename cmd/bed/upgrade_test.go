@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestVerifyChecksums(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums := []byte("abc123  bed_1.0.0_linux_amd64.tar.gz\n")
+	sig := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, sums)) + "\n")
+
+	for _, tt := range []struct {
+		name  string
+		key   ed25519.PublicKey
+		sums  []byte
+		sig   []byte
+		valid bool
+	}{
+		{name: "OK", key: pub, sums: sums, sig: sig, valid: true},
+		{name: "ChangedSums", key: pub, sums: []byte("def456  bed_1.0.0_linux_amd64.tar.gz\n"), sig: sig},
+		{name: "OtherKey", key: other, sums: sums, sig: sig},
+		{name: "InvalidEncoding", key: pub, sums: sums, sig: []byte("not base64!")},
+		{name: "Empty", key: pub, sums: sums, sig: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyChecksums(tt.key, tt.sums, tt.sig); tt.valid && err != nil {
+				t.Fatal(err)
+			} else if !tt.valid && err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestParseReleaseKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := parseReleaseKey(base64.StdEncoding.EncodeToString(pub)); err != nil {
+		t.Fatal(err)
+	} else if !key.Equal(pub) {
+		t.Fatal("key mismatch")
+	}
+
+	for _, s := range []string{"", "!!!", base64.StdEncoding.EncodeToString(pub[:16])} {
+		if _, err := parseReleaseKey(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	sums := []byte("ABC123  bed_1.0.0_linux_amd64.tar.gz\ndef456 *bed_1.0.0_windows_amd64.zip\n")
+	for _, tt := range []struct {
+		name string
+		sum  string
+	}{
+		{name: "bed_1.0.0_linux_amd64.tar.gz", sum: "abc123"},
+		{name: "bed_1.0.0_windows_amd64.zip", sum: "def456"},
+		{name: "bed_1.0.0_darwin_amd64.tar.gz"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sum, err := findChecksum(sums, tt.name)
+			if tt.sum == "" && err == nil {
+				t.Fatal("expected error")
+			} else if tt.sum != "" && (err != nil || sum != tt.sum) {
+				t.Fatalf("unexpected checksum: %q (%v)", sum, err)
+			}
+		})
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not kept on windows")
+	}
+	dir, err := ioutil.TempDir("", "bed-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bed")
+	if err := ioutil.WriteFile(path, []byte("old"), 0700); err != nil {
+		t.Fatal(err)
+	} else if err := os.Chmod(path, 0750); err != nil {
+		t.Fatal(err)
+	} else if err := replaceExecutable(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != "new" {
+		t.Fatalf("unexpected contents: %q", buf)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0750 {
+		t.Fatalf("unexpected mode: %s", fi.Mode())
+	}
+}
@@ -0,0 +1,185 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/benbjohnson/bed"
+)
+
+// originalFile is the original state of a file changed by an apply, used to
+// restore it if validation or verification fails.
+type originalFile struct {
+	path string
+	data []byte
+	mode os.FileMode
+}
+
+// snapshotFiles returns the original state of each file in paths.
+func snapshotFiles(paths []string) ([]originalFile, error) {
+	files := make([]originalFile, 0, len(paths))
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, originalFile{path: path, data: data, mode: fi.Mode().Perm()})
+	}
+	return files, nil
+}
+
+// restoreFiles writes the original contents of files back exactly, replacing
+// them atomically like any other change. Files which were deleted are
+// created again.
+func restoreFiles(files []originalFile, opt bed.ApplyOptions) error {
+	for _, f := range files {
+		_, err := os.Lstat(f.path)
+		if os.IsNotExist(err) {
+			err = ioutil.WriteFile(f.path, f.data, f.mode)
+		} else if err == nil {
+			err = bed.WriteFile(f.path, f.data, opt)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot restore %s: %s", f.path, err)
+		}
+	}
+	return nil
+}
+
+// verifyChange is a change to a file, located by its lines in the original
+// file & in the changed file so that errors reported by -verify can be
+// traced back to it.
+type verifyChange struct {
+	path               string
+	line               int // first line in the original file
+	startLine, endLine int // lines in the changed file
+}
+
+// verifyChanges returns the location of each change made by pathMatches to
+// the original files.
+func verifyChanges(files []originalFile, pathMatches [][]*bed.Match) []verifyChange {
+	var changes []verifyChange
+	for i, f := range files {
+		if bed.DeletesFile(pathMatches[i]) {
+			continue
+		}
+
+		var lineDelta int
+		for _, e := range bed.MatchEdits(f.data, pathMatches[i]) {
+			line := bytes.Count(f.data[:e.Pos], []byte("\n")) + 1
+			c := verifyChange{path: f.path, line: line, startLine: line + lineDelta}
+			c.endLine = c.startLine + bytes.Count(e.Data, []byte("\n"))
+			changes = append(changes, c)
+
+			lineDelta += bytes.Count(e.Data, []byte("\n")) - bytes.Count(f.data[e.Pos:e.Pos+e.Len], []byte("\n"))
+		}
+	}
+	return changes
+}
+
+// runVerify runs command with its output written to STDOUT & STDERR as
+// usual. Returns the combined output along with any error.
+func runVerify(command string) ([]byte, error) {
+	args, err := splitWords(command)
+	if err != nil {
+		return nil, err
+	} else if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	var buf bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = io.MultiWriter(os.Stdout, &buf)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &buf)
+	err = cmd.Run()
+	return buf.Bytes(), err
+}
+
+// verifyCulprits returns a description of each change which is at a location
+// reported in output, such as "main.go:12:5: undefined: x", or of the
+// location itself if it is in a changed file but not in a change. Locations
+// in other files are ignored.
+func verifyCulprits(output []byte, changes []verifyChange) []string {
+	seen := make(map[string]bool)
+	var a []string
+	for _, path := range changedPaths(changes) {
+		re := locationRegexp(path)
+		for _, m := range re.FindAllSubmatch(output, -1) {
+			line, _ := strconv.Atoi(string(m[1]))
+
+			desc := fmt.Sprintf("%s:%d is not part of a change", path, line)
+			for _, c := range changes {
+				if c.path == path && line >= c.startLine && line <= c.endLine {
+					desc = fmt.Sprintf("%s:%d is in the change to line %d of the original file", path, line, c.line)
+					break
+				}
+			}
+			if !seen[desc] {
+				seen[desc] = true
+				a = append(a, desc)
+			}
+		}
+	}
+	return a
+}
+
+// changedPaths returns the unique paths of changes, in order.
+func changedPaths(changes []verifyChange) []string {
+	var paths []string
+	for i, c := range changes {
+		if i == 0 || changes[i-1].path != c.path {
+			paths = append(paths, c.path)
+		}
+	}
+	return paths
+}
+
+// locationRegexp returns a regular expression matching "PATH:LINE" in tool
+// output, where PATH may also be written with a "./" prefix or as an
+// absolute path. The line number is the first submatch.
+func locationRegexp(path string) *regexp.Regexp {
+	alts := []string{regexp.QuoteMeta(path), regexp.QuoteMeta("./" + filepath.ToSlash(path))}
+	if abs, err := filepath.Abs(path); err == nil {
+		alts = append(alts, regexp.QuoteMeta(abs))
+	}
+	return regexp.MustCompile(`(?:^|[^\w./-])(?:` + strings.Join(alts, "|") + `):(\d+)`)
+}
+
+// verifyApply runs the verification command after changes are applied. If
+// it fails then every file is restored to its original contents & an error
+// describing the changes at the locations it reported is returned.
+func verifyApply(command string, files []originalFile, changes []verifyChange, opt bed.ApplyOptions) error {
+	log.Printf("info: verifying changes: %s", command)
+	output, err := runVerify(command)
+	if err == nil {
+		log.Printf("info: changes passed verification")
+		return nil
+	}
+
+	culprits := verifyCulprits(output, changes)
+	if rerr := restoreFiles(files, opt); rerr != nil {
+		return fmt.Errorf("verification failed: %s; %s", err, rerr)
+	}
+
+	msg := fmt.Sprintf("verification failed, changes to %d file(s) were rolled back: %s", len(files), err)
+	if len(culprits) > 0 {
+		msg += "\n\t" + strings.Join(culprits, "\n\t")
+	}
+	return fmt.Errorf("%s", msg)
+}
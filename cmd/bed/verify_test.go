@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestRun_Verify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("verify commands require a unix shell")
+	}
+
+	t.Run("Pass", func(t *testing.T) {
+		chdirTemp(t)
+		t.Setenv("HOME", t.TempDir())
+		writeTestFile(t, "a.txt", "foo\n")
+		writeTestFile(t, "b.txt", "x\nfoo\n")
+
+		if err := Run([]string{"-verify", "true", "-replace", "bar", "foo", "a.txt", "b.txt"}); err != nil {
+			t.Fatal(err)
+		} else if s := readTestFile(t, "a.txt"); s != "bar\n" {
+			t.Fatalf("unexpected contents: %q", s)
+		} else if s := readTestFile(t, "b.txt"); s != "x\nbar\n" {
+			t.Fatalf("unexpected contents: %q", s)
+		}
+	})
+
+	// A failing verification rolls back every file & reports the changes at
+	// the locations in its output.
+	t.Run("Fail", func(t *testing.T) {
+		chdirTemp(t)
+		t.Setenv("HOME", t.TempDir())
+		writeTestFile(t, "a.txt", "foo\n")
+		writeTestFile(t, "b.txt", "x\nfoo\n")
+
+		err := Run([]string{"-verify", "sh -c 'echo b.txt:2: bad; exit 1'", "-replace", "bar", "foo", "a.txt", "b.txt"})
+		if err == nil || !strings.Contains(err.Error(), "changes to 2 file(s) were rolled back") {
+			t.Fatalf("unexpected error: %v", err)
+		} else if !strings.Contains(err.Error(), "b.txt:2 is in the change to line 2 of the original file") {
+			t.Fatalf("expected culprit in error: %v", err)
+		}
+		if s := readTestFile(t, "a.txt"); s != "foo\n" {
+			t.Fatalf("unexpected contents: %q", s)
+		} else if s := readTestFile(t, "b.txt"); s != "x\nfoo\n" {
+			t.Fatalf("unexpected contents: %q", s)
+		}
+	})
+}
+
+func TestVerifyCulprits(t *testing.T) {
+	changes := []verifyChange{
+		{path: "a.go", line: 3, startLine: 3, endLine: 5},
+		{path: "a.go", line: 10, startLine: 12, endLine: 12},
+		{path: "b.go", line: 1, startLine: 1, endLine: 1},
+	}
+	output := []byte("./a.go:4:2: undefined: x\na.go:12: unused\na.go:20: other\nxa.go:3: ignored\nc.go:1: ignored\n")
+
+	want := []string{
+		"a.go:4 is in the change to line 3 of the original file",
+		"a.go:12 is in the change to line 10 of the original file",
+		"a.go:20 is not part of a change",
+	}
+	if got := verifyCulprits(output, changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected culprits: %q", got)
+	}
+}
+
+// TestRestoreFiles checks that files are restored byte for byte, even those
+// whose byte order mark & line endings are normally converted on apply.
+func TestRestoreFiles(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		orig    string
+		changed string
+	}{
+		{name: "BOM", orig: "\xef\xbb\xbffoo\n", changed: "\xef\xbb\xbfbar\n"},
+		{name: "MixedEOL", orig: "foo\r\nbar\n", changed: "baz\r\nbar\r\n"},
+		{name: "BOM_CRLF", orig: "\xef\xbb\xbffoo\r\nbar\r\n", changed: "bar\r\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirTemp(t)
+			writeTestFile(t, "a.txt", tt.orig)
+			files, err := snapshotFiles([]string{"a.txt"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			writeTestFile(t, "a.txt", tt.changed)
+			if err := restoreFiles(files, bed.ApplyOptions{}); err != nil {
+				t.Fatal(err)
+			} else if s := readTestFile(t, "a.txt"); s != tt.orig {
+				t.Fatalf("unexpected contents: %q", s)
+			}
+		})
+	}
+}
+
+// TestRun_VerifyRestoreExact checks that a failed verification restores files
+// with a byte order mark or mixed line endings exactly.
+func TestRun_VerifyRestoreExact(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("verify commands require a unix shell")
+	}
+	chdirTemp(t)
+	t.Setenv("HOME", t.TempDir())
+	writeTestFile(t, "bom.txt", "\xef\xbb\xbffoo\r\nx\r\n")
+	writeTestFile(t, "mixed.txt", "foo\r\nx\nfoo\n")
+
+	if err := Run([]string{"-verify", "false", "-replace", "bar", "foo", "bom.txt", "mixed.txt"}); err == nil {
+		t.Fatal("expected error")
+	} else if s := readTestFile(t, "bom.txt"); s != "\xef\xbb\xbffoo\r\nx\r\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	} else if s := readTestFile(t, "mixed.txt"); s != "foo\r\nx\nfoo\n" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/benbjohnson/bed"
+)
+
+// writeVersion writes the build information to w as text or JSON.
+func writeVersion(w io.Writer, isJSON bool) error {
+	info := bed.GetBuildInfo()
+	if isJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(info)
+	}
+	_, err := fmt.Fprintln(w, info)
+	return err
+}
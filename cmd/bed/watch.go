@@ -0,0 +1,183 @@
+//go:build !audit
+// +build !audit
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+// watchSessionEnv is set in the environment of the edit sessions started by
+// -watch so that they run once instead of watching as well.
+const watchSessionEnv = "BED_WATCH_SESSION"
+
+// watchOptions are the options for watching paths for new matches.
+type watchOptions struct {
+	Args     []string      // arguments to run each edit session with
+	Interval time.Duration // time between checks for changed files
+	Notify   func(n *notification)
+}
+
+// watchMatches scans paths for pattern whenever a file changes & starts an
+// edit session each time new matches appear, until bed is interrupted.
+// Files are checked for changes by polling their size & modification time,
+// which works the same on every platform & on network file systems. A match
+// is new if its file has more matches of the same text than it did at the
+// previous scan, so matches left unchanged in a session are not edited again
+// until more appear.
+func watchMatches(sf *searchFlags, pattern string, paths []string, opt watchOptions) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var prev map[string]fileStamp
+	var seen map[string]int
+	for first := true; ; first = false {
+		if !first {
+			time.Sleep(opt.Interval)
+		}
+
+		// Files are listed again each time so files added to a path list or
+		// tracked by git are watched as well.
+		stamps, err := statWatchedFiles(sf, paths)
+		if err != nil {
+			if first {
+				return err
+			}
+			warnf("cannot list watched files: %s", err)
+			continue
+		} else if !first && sameFileStamps(stamps, prev) {
+			continue
+		}
+		prev = stamps
+
+		scanStart := time.Now()
+		_, matches, err := sf.search(pattern, append([]string(nil), paths...))
+		if _, ok := err.(*nothingToScanError); ok {
+			matches, err = nil, nil
+		} else if err != nil {
+			if first {
+				return err
+			}
+			warnf("cannot scan watched files: %s", err)
+			continue
+		}
+
+		counts := watchedMatchCounts(matches)
+		n := newMatchCount(counts, seen)
+		seen = counts
+		if n == 0 {
+			if first {
+				log.Printf("info: watching for matches, press Ctrl-C to stop")
+			}
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "%d new match(es) found, starting an edit session\n", n)
+		notice := newNotification(NotifyWatch, matches, scanStart, nil)
+		notice.Matches = n
+		opt.Notify(notice)
+		if err := runWatchSession(exe, opt.Args); err != nil {
+			warnf("edit session failed: %s", err)
+		}
+		log.Printf("info: watching for matches, press Ctrl-C to stop")
+	}
+}
+
+// runWatchSession runs bed with args as a separate run so each session has
+// its own run ID, log entries, notifications & stats. Interrupts are left to
+// the session while it runs so Ctrl-C in the editor does not stop watching.
+// Sessions which find nothing to edit or are aborted are not failures.
+func runWatchSession(exe string, args []string) error {
+	cmd := exec.Command(exe, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), watchSessionEnv+"=1")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+
+	err := cmd.Run()
+	if e, ok := err.(*exec.ExitError); ok {
+		switch e.ExitCode() {
+		case ExitNoMatch, ExitAborted, ExitNothing:
+			return nil
+		}
+	}
+	return err
+}
+
+// fileStamp is the size & modification time of a watched file. Missing
+// files have a zero stamp.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// statWatchedFiles returns the stamps of the files listed by paths. Line
+// range suffixes are removed.
+func statWatchedFiles(sf *searchFlags, paths []string) (map[string]fileStamp, error) {
+	paths, err := sf.readPaths(append([]string(nil), paths...))
+	if _, ok := err.(*nothingToScanError); ok {
+		return map[string]fileStamp{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	stamps := make(map[string]fileStamp, len(paths))
+	for _, path := range paths {
+		if p, _, ok := splitPathLineRange(path); ok {
+			path = p
+		}
+		if fi, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{size: fi.Size(), modTime: fi.ModTime()}
+		} else {
+			stamps[path] = fileStamp{}
+		}
+	}
+	return stamps, nil
+}
+
+// sameFileStamps returns true if a & b have the same files & stamps.
+func sameFileStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, s := range a {
+		if t, ok := b[path]; !ok || s.size != t.size || !s.modTime.Equal(t.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchedMatchCounts returns the number of matches of each text by file.
+// Matches are counted by text rather than position since edits elsewhere in
+// a file move the matches after them.
+func watchedMatchCounts(matches []*bed.Match) map[string]int {
+	counts := make(map[string]int)
+	for _, m := range matches {
+		counts[m.Path+"\x00"+string(m.Data)]++
+	}
+	return counts
+}
+
+// newMatchCount returns the number of matches counted in counts beyond those
+// counted in prev.
+func newMatchCount(counts, prev map[string]int) int {
+	var n int
+	for k, c := range counts {
+		if c > prev[k] {
+			n += c - prev[k]
+		}
+	}
+	return n
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/bed"
+)
+
+func TestNewMatchCount(t *testing.T) {
+	prev := watchedMatchCounts([]*bed.Match{
+		{Path: "a.go", Pos: 0, Data: []byte("foo")},
+		{Path: "a.go", Pos: 10, Data: []byte("foo")},
+		{Path: "b.go", Pos: 0, Data: []byte("foo")},
+	})
+
+	// Moved matches are not new, but more matches of the same text are.
+	counts := watchedMatchCounts([]*bed.Match{
+		{Path: "a.go", Pos: 5, Data: []byte("foo")},
+		{Path: "a.go", Pos: 15, Data: []byte("foo")},
+		{Path: "a.go", Pos: 20, Data: []byte("foo")},
+		{Path: "a.go", Pos: 30, Data: []byte("bar")},
+	})
+	if n := newMatchCount(counts, prev); n != 2 {
+		t.Fatalf("unexpected new match count: %d", n)
+	} else if n := newMatchCount(counts, nil); n != 4 {
+		t.Fatalf("unexpected new match count: %d", n)
+	}
+}
+
+func TestStatWatchedFiles(t *testing.T) {
+	chdirTemp(t)
+	writeTestFile(t, "a.txt", "foo")
+	sf := newSearchFlags(flag.NewFlagSet("bed", flag.ContinueOnError))
+
+	prev, err := statWatchedFiles(sf, []string{"a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(prev) != 1 || prev["a.txt"].size != 3 {
+		t.Fatalf("unexpected stamps: %+v", prev)
+	}
+
+	if stamps, err := statWatchedFiles(sf, []string{"a.txt"}); err != nil {
+		t.Fatal(err)
+	} else if !sameFileStamps(stamps, prev) {
+		t.Fatal("expected same stamps")
+	}
+
+	// Changing a file's modification time is a change.
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes("a.txt", mtime, mtime); err != nil {
+		t.Fatal(err)
+	} else if stamps, err := statWatchedFiles(sf, []string{"a.txt"}); err != nil {
+		t.Fatal(err)
+	} else if sameFileStamps(stamps, prev) {
+		t.Fatal("expected changed stamps")
+	}
+}
+
+func TestRun_WatchInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"-watch", "-watch-interval", "0s", "foo", "a.txt"},
+		{"-watch", "-stdin", "foo"},
+		{"-watch", "-names", "foo", "a.txt"},
+	} {
+		if err := Run(args); err == nil {
+			t.Fatalf("%q: expected error", args)
+		}
+	}
+}
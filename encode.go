@@ -0,0 +1,83 @@
+package bed
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Encodings of match data in a match file, for data which cannot be edited
+// safely as text.
+const (
+	// Data is written as base64, wrapped at 76 columns.
+	EncodingBase64 = "base64"
+)
+
+// ValidEncoding returns true if encoding is blank or a known encoding.
+func ValidEncoding(encoding string) bool {
+	switch encoding {
+	case "", EncodingBase64:
+		return true
+	default:
+		return false
+	}
+}
+
+// base64LineWidth is the width that base64 data is wrapped at.
+const base64LineWidth = 76
+
+// needsEncoding returns true if data contains control characters other than
+// tabs & newlines, such as NUL bytes, is not valid UTF-8 or contains lines
+// which look like bed tags, so it may not survive editing as text.
+func needsEncoding(data []byte) bool {
+	if !utf8.Valid(data) {
+		return true
+	}
+	for _, b := range data {
+		if (b < 0x20 && b != '\t' && b != '\n' && b != '\r') || b == 0x7f {
+			return true
+		}
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if bytes.HasPrefix(bytes.TrimLeft(line, " \t"), []byte(directivePrefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeData returns data in the given encoding.
+func encodeData(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingBase64:
+		s := base64.StdEncoding.EncodeToString(data)
+		var buf bytes.Buffer
+		for len(s) > base64LineWidth {
+			buf.WriteString(s[:base64LineWidth])
+			buf.WriteByte('\n')
+			s = s[base64LineWidth:]
+		}
+		buf.WriteString(s)
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding: %q", encoding)
+	}
+}
+
+// decodeData returns data decoded from the given encoding. Whitespace, such
+// as line breaks, is ignored.
+func decodeData(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingBase64:
+		s := bytes.Join(bytes.Fields(data), nil)
+		buf := make([]byte, base64.StdEncoding.DecodedLen(len(s)))
+		n, err := base64.StdEncoding.Decode(buf, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 data: %s", err)
+		}
+		return buf[:n], nil
+	default:
+		return nil, fmt.Errorf("unknown encoding: %q", encoding)
+	}
+}
@@ -0,0 +1,75 @@
+package bed
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestWriteMatchFileOptions_Encoding checks that data which cannot be edited
+// as text round-trips through a base64 encoded match file for each header
+// format.
+func TestWriteMatchFileOptions_Encoding(t *testing.T) {
+	binary := []byte("a\x00b\xff\n#bed:end\n")
+	long := bytes.Repeat([]byte{0}, 100)
+
+	for _, header := range []string{HeaderJSON, HeaderPlain, HeaderYAML} {
+		t.Run(header, func(t *testing.T) {
+			matches := []*Match{
+				{Path: "a.bin", Pos: 0, Len: 1, Data: binary},
+				{Path: "a.bin", Pos: 4, Len: 1, Data: long},
+				{Path: "b.txt", Pos: 0, Len: 3, Data: []byte("plain text\n")},
+			}
+
+			var buf bytes.Buffer
+			if err := WriteMatchFileOptions(&buf, matches, WriteOptions{Header: header, Encoding: EncodingBase64}); err != nil {
+				t.Fatal(err)
+			} else if !strings.Contains(buf.String(), "plain text") {
+				t.Fatalf("expected text data to be written as text:\n%s", buf.String())
+			}
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if len(line) > base64LineWidth && !strings.HasPrefix(line, "#bed:") {
+					t.Fatalf("unwrapped line: %q", line)
+				}
+			}
+
+			other, err := ParseMatches(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			} else if len(other) != len(matches) {
+				t.Fatalf("unexpected match count: %d", len(other))
+			}
+			for i := range matches {
+				if !bytes.Equal(other[i].Data, matches[i].Data) {
+					t.Fatalf("%d: unexpected data: %q", i, other[i].Data)
+				}
+			}
+		})
+	}
+}
+
+func TestNeedsEncoding(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		want bool
+	}{
+		{data: "foo\tbar\r\n", want: false},
+		{data: "héllo", want: false},
+		{data: "a\x00b", want: true},
+		{data: "a\x7f", want: true},
+		{data: "\xff\xfe", want: true},
+		{data: "foo\n  #bed:end\n", want: true},
+	} {
+		if got := needsEncoding([]byte(tt.data)); got != tt.want {
+			t.Fatalf("%q: unexpected result: %v", tt.data, got)
+		}
+	}
+}
+
+func TestDecodeData_Invalid(t *testing.T) {
+	if _, err := decodeData([]byte("!!!"), EncodingBase64); err == nil || !strings.Contains(err.Error(), "invalid base64 data") {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := decodeData(nil, "rot13"); err == nil {
+		t.Fatal("expected error")
+	}
+}
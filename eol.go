@@ -0,0 +1,70 @@
+package bed
+
+import "bytes"
+
+// UsesCRLF returns true if data has at least one line ending & all of its
+// line endings are CRLF. Files with mixed line endings are left as they are.
+func UsesCRLF(data []byte) bool {
+	n := bytes.Count(data, []byte("\n"))
+	return n > 0 && bytes.Count(data, []byte("\r\n")) == n
+}
+
+// toLF returns the text of data from start to end with CRLF line endings
+// normalized to LF for editing, along with the positions of the removed CRs
+// relative to start. A CR at the end of the text is removed if it begins a
+// line ending.
+func toLF(data []byte, start, end int) ([]byte, []int) {
+	text := data[start:end:end]
+	if bytes.IndexByte(text, '\r') == -1 {
+		return text, nil
+	}
+
+	var removed []int
+	buf := make([]byte, 0, len(text))
+	for i, b := range text {
+		if b == '\r' && (i+1 < len(text) && text[i+1] == '\n' || i+1 == len(text) && end < len(data) && data[end] == '\n') {
+			removed = append(removed, i)
+			continue
+		}
+		buf = append(buf, b)
+	}
+	return buf, removed
+}
+
+// shiftSubmatches adjusts submatch positions, relative to the start of the
+// match, for the CRs removed from the match's text by toLF.
+func shiftSubmatches(submatches, removed []int) {
+	for i, pos := range submatches {
+		n := 0
+		for n < len(removed) && removed[n] < pos {
+			n++
+		}
+		if pos != -1 {
+			submatches[i] -= n
+		}
+	}
+}
+
+// toCRLF returns mid, the replacement for data from start to end in a file
+// with CRLF line endings, with LF line endings converted to CRLF. This
+// reverses toLF, including restoring a CR removed from the end of the text.
+func toCRLF(data []byte, start, end int, mid []byte) []byte {
+	trailingCR := end > start && data[end-1] == '\r' && end < len(data) && data[end] == '\n'
+	if bytes.IndexByte(mid, '\n') == -1 && !trailingCR {
+		return mid
+	}
+
+	buf := make([]byte, 0, len(mid)+bytes.Count(mid, []byte("\n"))+1)
+	for i, b := range mid {
+		if b == '\n' {
+			if i > 0 && mid[i-1] != '\r' || i == 0 && (start == 0 || data[start-1] != '\r') {
+				buf = append(buf, '\r')
+			}
+		}
+		buf = append(buf, b)
+	}
+	if trailingCR && (len(buf) == 0 || buf[len(buf)-1] != '\r') {
+		buf = append(buf, '\r')
+	}
+	return buf
+}
@@ -0,0 +1,349 @@
+package bed
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Formats of the header on the "#bed:begin" line of a match block. Match
+// files are parsed in any format.
+const (
+	// A JSON object, e.g. {"path":"main.go","pos":120,"len":14}. The default.
+	HeaderJSON = "json"
+
+	// Space separated key=value pairs, e.g. path=main.go pos=120 len=14.
+	// Values which are empty or contain spaces, quotes, "=" or characters
+	// which are not printable are written as double-quoted Go strings.
+	HeaderPlain = "plain"
+
+	// A YAML flow mapping, e.g. {path: main.go, pos: 120, len: 14}. Paths
+	// are double-quoted if they could be mistaken for another type of value
+	// or contain characters with special meaning in YAML.
+	HeaderYAML = "yaml"
+)
+
+// ValidHeaderFormat returns true if format is a known header format.
+func ValidHeaderFormat(format string) bool {
+	switch format {
+	case HeaderJSON, HeaderPlain, HeaderYAML:
+		return true
+	default:
+		return false
+	}
+}
+
+// encodeHeader returns hdr encoded in the given format.
+func encodeHeader(hdr matchJSON, format string) ([]byte, error) {
+	switch format {
+	case HeaderJSON, "":
+		return json.Marshal(hdr)
+	case HeaderPlain:
+		return encodePlainHeader(hdr), nil
+	case HeaderYAML:
+		return encodeYAMLHeader(hdr), nil
+	default:
+		return nil, fmt.Errorf("unknown header format: %q", format)
+	}
+}
+
+// decodeHeader decodes a header in any format. YAML headers begin with "{"
+// like JSON headers, but their keys are not quoted.
+func decodeHeader(data []byte) (matchJSON, error) {
+	var hdr matchJSON
+	if bytes.HasPrefix(data, []byte(`{"`)) {
+		err := json.Unmarshal(data, &hdr)
+		return hdr, err
+	} else if bytes.HasPrefix(data, []byte("{")) {
+		return decodeYAMLHeader(string(data))
+	}
+	return decodePlainHeader(string(data))
+}
+
+// encodePlainHeader returns hdr as key=value pairs. Line & column are only
+// included if known.
+func encodePlainHeader(hdr matchJSON) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "path=%s pos=%d len=%d", quotePlainValue(hdr.Path), hdr.Pos, hdr.Len)
+	if hdr.Line > 0 {
+		fmt.Fprintf(&buf, " line=%d col=%d", hdr.Line, hdr.Col)
+	}
+	if hdr.Enc != "" {
+		fmt.Fprintf(&buf, " enc=%s", hdr.Enc)
+	}
+	if hdr.Charset != "" {
+		fmt.Fprintf(&buf, " charset=%s", hdr.Charset)
+	}
+	return buf.Bytes()
+}
+
+// quotePlainValue returns s quoted if it cannot be written as a bare value.
+func quotePlainValue(s string) string {
+	if s == "" || !utf8.ValidString(s) {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if r == '"' || r == '=' || r == '\\' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// decodePlainHeader parses key=value pairs.
+func decodePlainHeader(s string) (matchJSON, error) {
+	var hdr matchJSON
+	seen := make(map[string]bool)
+	for s = strings.TrimLeft(s, " "); s != ""; s = strings.TrimLeft(s, " ") {
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return hdr, fmt.Errorf("invalid header field: %q", s)
+		}
+		key := s[:i]
+		s = s[i+1:]
+
+		// Read a quoted or bare value.
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := quotedEnd(s)
+			if end == -1 {
+				return hdr, fmt.Errorf("unterminated quoted value for %q", key)
+			}
+			v, err := strconv.Unquote(s[:end])
+			if err != nil {
+				return hdr, fmt.Errorf("invalid quoted value for %q: %s", key, err)
+			}
+			value, s = v, s[end:]
+			if s != "" && s[0] != ' ' {
+				return hdr, fmt.Errorf("expected space after value for %q", key)
+			}
+		} else if i := strings.IndexByte(s, ' '); i != -1 {
+			value, s = s[:i], s[i:]
+		} else {
+			value, s = s, ""
+		}
+
+		if err := setHeaderField(&hdr, key, value); err != nil {
+			return hdr, err
+		}
+		seen[key] = true
+	}
+
+	return hdr, checkHeaderFields(seen)
+}
+
+// setHeaderField sets the header field for key to value. Unknown keys are
+// ignored so that fields can be added in the future.
+func setHeaderField(hdr *matchJSON, key, value string) (err error) {
+	switch key {
+	case "path":
+		hdr.Path = value
+	case "pos":
+		hdr.Pos, err = strconv.Atoi(value)
+	case "len":
+		hdr.Len, err = strconv.Atoi(value)
+	case "line":
+		hdr.Line, err = strconv.Atoi(value)
+	case "col":
+		hdr.Col, err = strconv.Atoi(value)
+	case "enc":
+		hdr.Enc = value
+	case "charset":
+		hdr.Charset = value
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %q", key, value)
+	}
+	return nil
+}
+
+// checkHeaderFields returns an error if a required field was not seen.
+func checkHeaderFields(seen map[string]bool) error {
+	for _, key := range []string{"path", "pos", "len"} {
+		if !seen[key] {
+			return errors.New("missing " + key + " in header")
+		}
+	}
+	return nil
+}
+
+// quotedEnd returns the position after the closing quote of the double
+// quoted string at the start of s, or -1 if it is not terminated.
+func quotedEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// encodeYAMLHeader returns hdr as a YAML flow mapping. Line & column are
+// only included if known.
+func encodeYAMLHeader(hdr matchJSON) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{path: %s, pos: %d, len: %d", quoteYAMLValue(hdr.Path), hdr.Pos, hdr.Len)
+	if hdr.Line > 0 {
+		fmt.Fprintf(&buf, ", line: %d, col: %d", hdr.Line, hdr.Col)
+	}
+	if hdr.Enc != "" {
+		fmt.Fprintf(&buf, ", enc: %s", hdr.Enc)
+	}
+	if hdr.Charset != "" {
+		fmt.Fprintf(&buf, ", charset: %s", hdr.Charset)
+	}
+	buf.WriteString("}")
+	return buf.Bytes()
+}
+
+// yamlPlainRegex matches strings which can be written as plain YAML scalars
+// in a flow mapping without being read as another type, such as a number.
+var yamlPlainRegex = regexp.MustCompile(`^[A-Za-z_./][A-Za-z0-9_./+@-]*$`)
+
+// yamlReserved are plain scalars which YAML reads as booleans or null.
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "null": true, ".inf": true, ".nan": true,
+}
+
+// quoteYAMLValue returns s as a plain scalar, if it is unambiguous, or a
+// double-quoted scalar otherwise.
+func quoteYAMLValue(s string) string {
+	if yamlPlainRegex.MatchString(s) && !yamlReserved[strings.ToLower(s)] {
+		return s
+	}
+	buf, _ := json.Marshal(s) // JSON strings are valid YAML double-quoted scalars
+	return string(buf)
+}
+
+// decodeYAMLHeader parses a single-line YAML flow mapping of scalars.
+func decodeYAMLHeader(s string) (matchJSON, error) {
+	var hdr matchJSON
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return hdr, errors.New("invalid YAML header, expected {key: value, ...}")
+	}
+	s = s[1 : len(s)-1]
+
+	seen := make(map[string]bool)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		key, rest, err := readYAMLScalar(s, ":")
+		if err != nil {
+			return hdr, err
+		} else if !strings.HasPrefix(rest, ":") {
+			return hdr, fmt.Errorf("expected ':' after %q in YAML header", key)
+		}
+
+		value, rest, err := readYAMLScalar(strings.TrimSpace(rest[1:]), ",")
+		if err != nil {
+			return hdr, err
+		} else if rest != "" && !strings.HasPrefix(rest, ",") {
+			return hdr, fmt.Errorf("expected ',' after value for %q in YAML header", key)
+		}
+		s = strings.TrimPrefix(rest, ",")
+
+		if err := setHeaderField(&hdr, key, value); err != nil {
+			return hdr, err
+		}
+		seen[key] = true
+	}
+	return hdr, checkHeaderFields(seen)
+}
+
+// readYAMLScalar reads a quoted or plain scalar from the start of s. Plain
+// scalars end at the delimiter. Returns the value & the rest of s after any
+// trailing spaces.
+func readYAMLScalar(s, delim string) (value, rest string, err error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := quotedEnd(s)
+		if end == -1 {
+			return "", "", errors.New("unterminated double-quoted value in YAML header")
+		}
+		if value, err = unquoteYAML(s[1 : end-1]); err != nil {
+			return "", "", err
+		}
+		return value, strings.TrimSpace(s[end:]), nil
+
+	case strings.HasPrefix(s, "'"):
+		// Single-quoted scalars escape quotes by doubling them.
+		var buf strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				buf.WriteByte(s[i])
+			} else if i+1 < len(s) && s[i+1] == '\'' {
+				buf.WriteByte('\'')
+				i++
+			} else {
+				return buf.String(), strings.TrimSpace(s[i+1:]), nil
+			}
+		}
+		return "", "", errors.New("unterminated single-quoted value in YAML header")
+
+	default:
+		i := strings.Index(s, delim)
+		if i == -1 {
+			i = len(s)
+		}
+		return strings.TrimSpace(s[:i]), s[i:], nil
+	}
+}
+
+// unquoteYAML returns the contents of a double-quoted YAML scalar with its
+// escape sequences replaced.
+func unquoteYAML(s string) (string, error) {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf.WriteByte(s[i])
+			continue
+		} else if i+1 >= len(s) {
+			return "", errors.New("invalid escape at end of YAML value")
+		}
+
+		i++
+		if r, ok := yamlEscapes[s[i]]; ok {
+			buf.WriteString(r)
+			continue
+		}
+
+		// Hexadecimal escapes of code points.
+		var n int
+		switch s[i] {
+		case 'x':
+			n = 2
+		case 'u':
+			n = 4
+		case 'U':
+			n = 8
+		default:
+			return "", fmt.Errorf("invalid escape in YAML value: \\%c", s[i])
+		}
+		if i+n >= len(s) {
+			return "", errors.New("invalid escape in YAML value")
+		}
+		v, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in YAML value: %s", err)
+		}
+		buf.WriteRune(rune(v))
+		i += n
+	}
+	return buf.String(), nil
+}
+
+// yamlEscapes maps single character YAML escapes to their values.
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v",
+	'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': `"`, '/': "/", '\\': `\`,
+	'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
@@ -0,0 +1,80 @@
+package bed
+
+import (
+	"testing"
+)
+
+func TestHeader_RoundTrip(t *testing.T) {
+	for _, path := range []string{
+		"main.go",
+		`a\b.txt`,
+		`C:\Users\bob\main.go`,
+		`\\server\share\x.go`,
+		"my file.go",
+		`say "hi".txt`,
+		"tab\there.go",
+		"a:b, c.go",
+		"{x}.go",
+		"true",
+		"123",
+		"ünïcödé.go",
+		"'quoted'.go",
+	} {
+		for _, format := range []string{HeaderJSON, HeaderPlain, HeaderYAML} {
+			t.Run(format+"/"+path, func(t *testing.T) {
+				hdr := matchJSON{Path: path, Pos: 120, Len: 14, Line: 3, Col: 7}
+				buf, err := encodeHeader(hdr, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				other, err := decodeHeader(buf)
+				if err != nil {
+					t.Fatalf("cannot decode %s: %s", buf, err)
+				} else if other != hdr {
+					t.Fatalf("mismatch: %s decoded as %#v", buf, other)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeYAMLHeader(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		path string
+	}{
+		{s: `{path: main.go, pos: 1, len: 2}`, path: "main.go"},
+		{s: `{path: "a\\b.txt", pos: 1, len: 2}`, path: `a\b.txt`},
+		{s: `{path: 'a\b.txt', pos: 1, len: 2}`, path: `a\b.txt`},
+		{s: `{path: 'it''s.go', pos: 1, len: 2}`, path: "it's.go"},
+		{s: `{path: "\x41\u00e9\"\t", pos: 1, len: 2}`, path: "A\u00e9\"\t"},
+		{s: `{ path : main.go , pos : 1 , len : 2 }`, path: "main.go"},
+	} {
+		t.Run(tt.s, func(t *testing.T) {
+			hdr, err := decodeYAMLHeader(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			} else if hdr.Path != tt.path || hdr.Pos != 1 || hdr.Len != 2 {
+				t.Fatalf("unexpected header: %#v", hdr)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLHeader_Error(t *testing.T) {
+	for _, tt := range []struct {
+		s   string
+		err string
+	}{
+		{s: `path: main.go, pos: 1, len: 2`, err: "invalid YAML header, expected {key: value, ...}"},
+		{s: `{path: "main.go, pos: 1, len: 2}`, err: "unterminated double-quoted value in YAML header"},
+		{s: `{path: "a\qb", pos: 1, len: 2}`, err: `invalid escape in YAML value: \q`},
+		{s: `{path main.go, pos: 1, len: 2}`, err: "missing path in header"},
+	} {
+		t.Run(tt.s, func(t *testing.T) {
+			if _, err := decodeYAMLHeader(tt.s); err == nil || err.Error() != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
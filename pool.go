@@ -0,0 +1,97 @@
+package bed
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// minPooledBufferSize & maxPooledBufferSize are the capacities of the
+// smallest & largest pooled buffers. Larger buffers are not returned to the
+// pool, so that a few large files do not pin memory for every scan.
+const (
+	minPooledBufferSize = 4 << 10
+	maxPooledBufferSize = 4 << 20
+)
+
+// bufferPools hold file buffers which are no longer referenced by matches,
+// by size class. Each class holds buffers with a capacity of at least twice
+// that of the class before, starting at minPooledBufferSize, so a buffer
+// taken from a class always fits a file of the class's size & buffers which
+// are too small for one file are kept for smaller files.
+var bufferPools = make([]sync.Pool, bufferClass(maxPooledBufferSize)+1)
+
+// bufferClass returns the index of the smallest size class whose buffers
+// have a capacity of at least n.
+func bufferClass(n int) int {
+	class := 0
+	for size := minPooledBufferSize; size < n; size *= 2 {
+		class++
+	}
+	return class
+}
+
+// ReadFile returns the contents of path like ioutil.ReadFile but reads into
+// a pooled buffer. The buffer may be handed back with ReleaseBuffer() once
+// nothing refers to it.
+func ReadFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Size the buffer from the file so it is usually read in one pass. One
+	// extra byte is needed to see EOF without growing the buffer.
+	var size int
+	if fi, err := f.Stat(); err == nil && fi.Size() < int64(maxInt) {
+		size = int(fi.Size())
+	}
+
+	buf := getBuffer(size + 1)
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := f.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		} else if err != nil {
+			ReleaseBuffer(buf)
+			return nil, err
+		}
+	}
+}
+
+// ReleaseBuffer returns a buffer read by ReadFile() to the pool. The buffer
+// must not be used afterwards, including through slices of it.
+func ReleaseBuffer(buf []byte) {
+	if cap(buf) < minPooledBufferSize || cap(buf) > maxPooledBufferSize {
+		return
+	}
+
+	// Buffers may have grown to any capacity while being read so they are
+	// added to the largest class that they fit.
+	class := bufferClass(cap(buf))
+	if cap(buf) < minPooledBufferSize<<class {
+		class--
+	}
+	buf = buf[:0]
+	bufferPools[class].Put(&buf)
+}
+
+// getBuffer returns an empty buffer with a capacity of at least n. Buffers
+// are allocated with the capacity of their size class so they can be pooled.
+func getBuffer(n int) []byte {
+	if n > maxPooledBufferSize {
+		return make([]byte, 0, n)
+	}
+	class := bufferClass(n)
+	if p, _ := bufferPools[class].Get().(*[]byte); p != nil {
+		return (*p)[:0]
+	}
+	return make([]byte, 0, minPooledBufferSize<<class)
+}
+
+const maxInt = int(^uint(0) >> 1)
@@ -0,0 +1,61 @@
+package bed
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// BenchmarkReadFile reads files of sizes from 100B to 400KB in a random
+// order, holding every fourth buffer until all of the files are read as a
+// scan does for files with matches, so that pooled buffers are often too
+// small for the next file.
+func BenchmarkReadFile(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	dir := b.TempDir()
+	paths := make([]string, 64)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprint(i))
+		if err := ioutil.WriteFile(paths[i], make([]byte, 100<<uint(rnd.Intn(13))), 0666); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var held [][]byte
+		for _, j := range rnd.Perm(len(paths)) {
+			buf, err := ReadFile(paths[j])
+			if err != nil {
+				b.Fatal(err)
+			} else if j%4 == 0 {
+				held = append(held, buf)
+				continue
+			}
+			ReleaseBuffer(buf)
+		}
+		for _, buf := range held {
+			ReleaseBuffer(buf)
+		}
+	}
+}
+
+func TestBufferClass(t *testing.T) {
+	for _, tt := range []struct {
+		n     int
+		class int
+	}{
+		{n: 0, class: 0},
+		{n: 4 << 10, class: 0},
+		{n: 4<<10 + 1, class: 1},
+		{n: 8 << 10, class: 1},
+		{n: 4 << 20, class: 10},
+	} {
+		if class := bufferClass(tt.n); class != tt.class {
+			t.Fatalf("%d: unexpected class: %d", tt.n, class)
+		}
+	}
+}
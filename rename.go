@@ -0,0 +1,121 @@
+//go:build !audit
+// +build !audit
+
+package bed
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Rename represents a file to be moved from one path to another.
+type Rename struct {
+	From string
+	To   string
+}
+
+// CheckRenames returns an error if renames would overwrite each other or an
+// existing file, or would rename one of bed's own state files. Files may be
+// renamed to a path which is itself being renamed, such as when swapping the
+// names of two files.
+func CheckRenames(renames []Rename) error {
+	sources := make(map[string]bool)
+	for _, r := range renames {
+		sources[filepath.Clean(r.From)] = true
+	}
+
+	var collisions []string
+	targets := make(map[string]string)
+	for _, r := range renames {
+		if IsStateFile(r.From) {
+			return fmt.Errorf("%s: cannot rename bed state file", r.From)
+		} else if r.To == "" {
+			return fmt.Errorf("%s: blank file name", r.From)
+		}
+
+		to := filepath.Clean(r.To)
+		if from, ok := targets[to]; ok {
+			collisions = append(collisions, fmt.Sprintf("%s: both %s and %s are renamed to it", r.To, from, r.From))
+			continue
+		}
+		targets[to] = r.From
+
+		if sources[to] {
+			continue
+		} else if _, err := os.Lstat(to); err == nil {
+			collisions = append(collisions, fmt.Sprintf("%s: file already exists", r.To))
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return fmt.Errorf("rename collision(s):\n\t%s", strings.Join(collisions, "\n\t"))
+	}
+	return nil
+}
+
+// RenamePaths moves each file to its new path, creating parent directories
+// as needed. Renames are checked with CheckRenames first & no files are
+// moved if they collide. Files are first moved to a temporary name so that
+// renames which form a cycle do not overwrite each other.
+func RenamePaths(renames []Rename) error {
+	if err := CheckRenames(renames); err != nil {
+		return err
+	}
+
+	// Ignore renames which do not change the path.
+	a := renames[:0:0]
+	for _, r := range renames {
+		if filepath.Clean(r.From) != filepath.Clean(r.To) {
+			a = append(a, r)
+		}
+	}
+
+	// Move each file to a temporary name next to it. Files which were
+	// already moved are restored if one cannot be.
+	var tmpPaths []string
+	for _, r := range a {
+		tmpPath, err := renameTemp(r.From)
+		if err != nil {
+			for i, tmpPath := range tmpPaths {
+				os.Rename(tmpPath, a[i].From)
+			}
+			return err
+		}
+		tmpPaths = append(tmpPaths, tmpPath)
+	}
+
+	// Move each file from its temporary name to its new path.
+	for i, r := range a {
+		if err := os.MkdirAll(filepath.Dir(r.To), 0777); err != nil {
+			return err
+		} else if err := os.Rename(tmpPaths[i], r.To); err != nil {
+			return fmt.Errorf("%s: %s (file left at %s)", r.From, err, tmpPaths[i])
+		}
+		log.Printf("info: renamed %s to %s", r.From, r.To)
+	}
+	return nil
+}
+
+// renameTemp moves path to a unique, hidden name in the same directory &
+// returns the new name.
+func renameTemp(path string) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".bed-rename-")
+	if err != nil {
+		return "", err
+	} else if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	} else if err := os.Rename(path, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
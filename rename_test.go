@@ -0,0 +1,67 @@
+package bed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRenamePaths_Swap checks that files can be renamed to each other's
+// names without either being overwritten.
+func TestRenamePaths_Swap(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	if err := ioutil.WriteFile(a, []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(b, []byte("b"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RenamePaths([]Rename{{From: a, To: b}, {From: b, To: a}}); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadFile(a); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != "b" {
+		t.Fatalf("unexpected contents: %q", buf)
+	}
+	if names, err := filepath.Glob(filepath.Join(dir, ".*")); err != nil {
+		t.Fatal(err)
+	} else if len(names) != 0 {
+		t.Fatalf("unexpected temporary files: %q", names)
+	}
+}
+
+func TestCheckRenames(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "c.txt")
+	if err := ioutil.WriteFile(existing, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		renames []Rename
+		err     string
+	}{
+		{name: "OK", renames: []Rename{{From: "a", To: filepath.Join(dir, "d.txt")}}},
+		{name: "Blank", renames: []Rename{{From: "a", To: ""}}, err: "a: blank file name"},
+		{name: "Exists", renames: []Rename{{From: "a", To: existing}}, err: "file already exists"},
+		{name: "SameTarget", renames: []Rename{{From: "a", To: "x"}, {From: "b", To: "./x"}}, err: "both a and b are renamed to it"},
+		{name: "RenamedTarget", renames: []Rename{{From: "a", To: existing}, {From: existing, To: "a"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRenames(tt.renames)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+	if _, err := os.Stat(existing); err != nil {
+		t.Fatal(err)
+	}
+}
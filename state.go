@@ -0,0 +1,99 @@
+package bed
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// StateDir is the name of the directory where bed keeps its own files, such
+// as backups & campaign history, within a project.
+const StateDir = ".bed"
+
+// Names of bed's own files. Files written to the temp directory & backup
+// directories include the ID of the run which wrote them, which is 8 hex
+// digits, & temporary files include the random digits of ioutil.TempFile.
+var (
+	// Match, session & index files in the temp directory, along with any
+	// swap files left by an editor, e.g. "bed-1a2b3c4d-123.go".
+	tempStateFileRegexp = regexp.MustCompile(`^\.?bed-(?:session-)?[0-9a-f]{8}-[0-9]+`)
+
+	// Temporary files written next to a file while replacing, renaming or
+	// backing it up, e.g. ".main.go.bed-123", & while checking that a
+	// directory is writable or replacing the bed executable.
+	siblingStateFileRegexp = regexp.MustCompile(`^(?:\..+\.bed-(?:rename-|backup-)?|\.bed-(?:check|upgrade)-)[0-9]+$`)
+
+	// Timestamped directories of backups, e.g. "20200101T000000Z-1a2b3c4d".
+	backupDirRegexp = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z-[0-9a-f]{8}$`)
+)
+
+// stateDirFiles are the files bed keeps in a project's state directory.
+var stateDirFiles = map[string]bool{
+	"applied.jsonl":   true,
+	"campaigns.jsonl": true,
+}
+
+// IsStateFile returns true if path is one of bed's own files, such as a
+// match file in the temp directory, a temporary file written while applying
+// changes, a backup or the journal. These files are excluded from scanning
+// & applying so that bed does not edit its own in-flight buffers. Only the
+// names bed writes are matched so that users' files are never excluded.
+func IsStateFile(path string) bool {
+	elems := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	name := elems[len(elems)-1]
+
+	// The journal & history kept in a project's state directory.
+	if len(elems) >= 2 && elems[len(elems)-2] == StateDir && stateDirFiles[name] {
+		return true
+	}
+
+	// Backups of original files.
+	for _, elem := range elems[:len(elems)-1] {
+		if backupDirRegexp.MatchString(elem) {
+			return true
+		}
+	}
+
+	// Temporary files written next to a file while replacing it.
+	if siblingStateFileRegexp.MatchString(name) {
+		return true
+	}
+
+	// Match files written to the temp directory for editing.
+	if tempStateFileRegexp.MatchString(name) {
+		return SameDir(filepath.Dir(path), os.TempDir())
+	}
+	return false
+}
+
+// SameDir returns true if a & b refer to the same directory.
+func SameDir(a, b string) bool {
+	a, b = ResolveDir(a), ResolveDir(b)
+	if a == b {
+		return true
+	}
+
+	afi, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bfi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(afi, bfi)
+}
+
+// ResolveDir returns the absolute path of dir with symlinks resolved, where
+// possible, so paths can be compared, e.g. /tmp is a symlink to /private/tmp
+// on macOS.
+func ResolveDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if s, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = s
+	}
+	return dir
+}
@@ -0,0 +1,67 @@
+package bed
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsStateFile(t *testing.T) {
+	tmp := os.TempDir()
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		// Files written by bed.
+		{path: filepath.Join(tmp, "bed-1a2b3c4d-123456.go"), want: true},
+		{path: filepath.Join(tmp, "bed-1a2b3c4d-123456-main.go"), want: true},
+		{path: filepath.Join(tmp, "bed-1a2b3c4d-123456.names"), want: true},
+		{path: filepath.Join(tmp, ".bed-1a2b3c4d-123456.go.swp"), want: true},
+		{path: filepath.Join(tmp, "bed-session-1a2b3c4d-123456.json"), want: true},
+		{path: "src/.main.go.bed-123456", want: true},
+		{path: "src/.main.go.bed-rename-123456", want: true},
+		{path: "src/.main.go.bed-backup-123456", want: true},
+		{path: "src/.bed-check-123456", want: true},
+		{path: ".bed/applied.jsonl", want: true},
+		{path: "project/.bed/campaigns.jsonl", want: true},
+		{path: ".bed/backups/20200101T000000Z-1a2b3c4d/main.go", want: true},
+		{path: "backups/20200101T000000Z-1a2b3c4d/src/main.go", want: true},
+
+		// Users' files.
+		{path: "main.go", want: false},
+		{path: ".bed/config.go", want: false},
+		{path: ".bed/src/main.go", want: false},
+		{path: ".bed/backups/notes.txt", want: false},
+		{path: "src/.my.bed-notes", want: false},
+		{path: "src/.x.bed-", want: false},
+		{path: "src/bed-1a2b3c4d-123456.go", want: false},
+		{path: filepath.Join(tmp, "bed-notes.txt"), want: false},
+		{path: filepath.Join(tmp, "bed-1a2b3c4d-123456", "stdin.txt"), want: false},
+		{path: "applied.jsonl", want: false},
+	} {
+		if got := IsStateFile(tt.path); got != tt.want {
+			t.Errorf("IsStateFile(%q)=%v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSameDir(t *testing.T) {
+	dir := chdirTemp(t)
+	if err := os.MkdirAll(filepath.Join("a", "b"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		a, b string
+		want bool
+	}{
+		{a: dir, b: ".", want: true},
+		{a: "a", b: filepath.Join(dir, "a"), want: true},
+		{a: "a", b: filepath.Join("a", "b", ".."), want: true},
+		{a: "a", b: filepath.Join("a", "b"), want: false},
+		{a: "a", b: "missing", want: false},
+	} {
+		if got := SameDir(tt.a, tt.b); got != tt.want {
+			t.Errorf("SameDir(%q, %q)=%v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package bed
+
+import (
+	"context"
+	"runtime/trace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowFileThreshold is the minimum total duration for a file to be
+// reported as slow. Files are also only reported if they take much longer
+// than the typical file.
+const slowFileThreshold = 100 * time.Millisecond
+
+// slowFileFactor is how many times slower than the median a file must be
+// to be reported as slow.
+const slowFileFactor = 10
+
+// Timings records the time spent reading, matching & writing each file.
+// A nil *Timings discards all timings.
+type Timings struct {
+	mu    sync.Mutex
+	files map[string]*FileTiming
+	paths []string
+}
+
+// FileTiming is the time spent in each stage of processing a single file.
+type FileTiming struct {
+	Path  string
+	Size  int
+	Read  time.Duration
+	Match time.Duration
+	Write time.Duration
+}
+
+// Total returns the total time spent on the file.
+func (ft *FileTiming) Total() time.Duration {
+	return ft.Read + ft.Match + ft.Write
+}
+
+// Stages of processing a file, used for timings & trace regions.
+const (
+	stageRead  = "read"
+	stageMatch = "match"
+	stageWrite = "write"
+)
+
+// timeStage executes fn within a trace region for stage & adds its duration
+// to the timing for path.
+func (t *Timings) timeStage(path, stage string, fn func() error) error {
+	start := time.Now()
+	region := trace.StartRegion(context.Background(), stage)
+	err := fn()
+	region.End()
+
+	if t != nil {
+		t.add(path, stage, time.Since(start))
+	}
+	return err
+}
+
+// setSize records the size of the file at path.
+func (t *Timings) setSize(path string, size int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.file(path).Size = size
+}
+
+func (t *Timings) add(path, stage string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ft := t.file(path)
+	switch stage {
+	case stageRead:
+		ft.Read += d
+	case stageMatch:
+		ft.Match += d
+	case stageWrite:
+		ft.Write += d
+	}
+}
+
+// file returns the timing for path, creating it if needed. Must be called
+// with the lock held.
+func (t *Timings) file(path string) *FileTiming {
+	if t.files == nil {
+		t.files = make(map[string]*FileTiming)
+	}
+	ft := t.files[path]
+	if ft == nil {
+		ft = &FileTiming{Path: path}
+		t.files[path] = ft
+		t.paths = append(t.paths, path)
+	}
+	return ft
+}
+
+// Files returns the timings of every file in the order they were first seen.
+func (t *Timings) Files() []*FileTiming {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a := make([]*FileTiming, len(t.paths))
+	for i, path := range t.paths {
+		a[i] = t.files[path]
+	}
+	return a
+}
+
+// Slow returns the files which took much longer than the median file.
+func (t *Timings) Slow() []*FileTiming {
+	files := t.Files()
+	if len(files) == 0 {
+		return nil
+	}
+
+	totals := make([]time.Duration, len(files))
+	for i, ft := range files {
+		totals[i] = ft.Total()
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i] < totals[j] })
+	median := totals[len(totals)/2]
+
+	var a []*FileTiming
+	for _, ft := range files {
+		if total := ft.Total(); total >= slowFileThreshold && total > slowFileFactor*median {
+			a = append(a, ft)
+		}
+	}
+	return a
+}
@@ -0,0 +1,72 @@
+package bed
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata. These are set at link time, for example by goreleaser:
+//
+//	go build -ldflags "-X github.com/benbjohnson/bed.Version=v1.0.0 -X github.com/benbjohnson/bed.Commit=abc123 -X github.com/benbjohnson/bed.BuildDate=2020-01-01T00:00:00Z" ./cmd/bed
+//
+// If unset, they are filled in from the module & VCS information embedded
+// by the Go toolchain, where available.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// BuildInfo describes the build of the running bed executable.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"date,omitempty"`
+	GoVersion string `json:"go"`
+	Platform  string `json:"platform"`
+}
+
+// GetBuildInfo returns the build metadata of the running executable.
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	// Fall back to information embedded by "go install" or "go build".
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	return info
+}
+
+// String returns a single line description of the build.
+func (info BuildInfo) String() string {
+	s := "bed " + info.Version
+	if info.Commit != "" {
+		commit := info.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		s += " (" + commit
+		if info.BuildDate != "" {
+			s += ", " + info.BuildDate
+		}
+		s += ")"
+	}
+	return fmt.Sprintf("%s %s %s", s, info.GoVersion, info.Platform)
+}
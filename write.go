@@ -0,0 +1,330 @@
+//go:build !audit
+// +build !audit
+
+package bed
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ApplyMatches writes each match's data to the specified path & position.
+// Matches with the skip directive are ignored. Returns an error without
+// writing any files if a match refers to one of bed's own state files.
+func ApplyMatches(matches []*Match, opt ApplyOptions) error {
+	paths, pathMatches := GroupMatchesByPath(RemoveSkipped(matches))
+	for _, path := range paths {
+		if IsStateFile(path) {
+			return fmt.Errorf("%s: cannot apply changes to bed state file", path)
+		}
+	}
+
+	// Check the matches against the current contents of every file before
+	// any file is written, so a stale or hand-edited match file is rejected
+	// instead of corrupting files.
+	for i, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		} else if err := CheckMatchData(path, data, pathMatches[i]); err != nil {
+			return err
+		}
+	}
+
+	// Determine the order to write files in.
+	order, err := orderPaths(paths, opt.Order)
+	if err != nil {
+		return err
+	}
+	if len(opt.Order) > 0 {
+		log.Printf("apply plan:")
+		for i, j := range order {
+			log.Printf("  %d. %s", i+1, paths[j])
+		}
+	}
+
+	for _, i := range order {
+		if err := applyPathMatches(paths[i], pathMatches[i], opt); err != nil {
+			return err
+		} else if opt.OnApply != nil {
+			opt.OnApply(paths[i])
+		}
+	}
+	return nil
+}
+
+func applyPathMatches(path string, matches []*Match, opt ApplyOptions) error {
+	// Read current file data.
+	var data []byte
+	if err := opt.Timings.timeStage(path, stageRead, func() (err error) {
+		data, err = ioutil.ReadFile(path)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	// Copy the original file before changing it, if specified.
+	if opt.BackupDir != "" {
+		if err := backupFile(opt.BackupDir, path, data); err != nil {
+			return err
+		}
+	}
+
+	// Delete the file instead of writing it, if any match says to. Symlinks
+	// are removed rather than their target.
+	if DeletesFile(matches) {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		log.Printf("info: deleted %s", path)
+		return nil
+	}
+
+	// The file may have changed since it was checked, such as while other
+	// files were written, so check the matches again.
+	if err := CheckMatchData(path, data, matches); err != nil {
+		return err
+	}
+
+	// Apply matches to data.
+	data = ApplyMatchData(data, matches)
+
+	// Write new data back to file.
+	return opt.Timings.timeStage(path, stageWrite, func() error {
+		return WriteFile(path, data, opt)
+	})
+}
+
+// WriteFile replaces the contents of the existing file at path with data in
+// the same way that ApplyMatches writes changes: atomically where possible,
+// through symlinks unless opt.NoFollowSymlinks is set & making a read-only
+// file writable while it is written if opt.ForceReadOnly is set. Data is
+// written exactly, without restoring line endings or a byte order mark, so
+// it can be used to restore a file's original contents.
+func WriteFile(path string, data []byte, opt ApplyOptions) error {
+	// Write through symlinks to their target unless they should be replaced.
+	target := path
+	if !opt.NoFollowSymlinks {
+		var err error
+		if target, err = filepath.EvalSymlinks(path); err != nil {
+			return err
+		}
+	}
+
+	// Make read-only files writable & restore their mode afterward.
+	if opt.ForceReadOnly {
+		fi, err := os.Stat(target)
+		if err != nil {
+			return err
+		} else if mode := fi.Mode().Perm(); mode&0200 == 0 {
+			if err := os.Chmod(target, mode|0200); err != nil {
+				return err
+			}
+			defer os.Chmod(target, mode)
+		}
+	}
+
+	return writeFile(target, data)
+}
+
+// backupFile writes data, the original contents of path, to its backup path
+// within dir.
+func backupFile(dir, path string, data []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = strings.TrimLeft(strings.TrimPrefix(abs, filepath.VolumeName(abs)), `/\`)
+	}
+
+	backupPath := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0777); err != nil {
+		return err
+	} else if err := ioutil.WriteFile(backupPath, data, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	log.Printf("debug: backed up %s to %s", path, backupPath)
+	return nil
+}
+
+// writeFile replaces the contents of the existing file at path with data.
+// The file is replaced atomically where possible. Files with other hard
+// links are rewritten in place so the links keep sharing the new contents.
+// The file is also rewritten in place if its directory does not allow new
+// files, if it is a mount point, or if the filesystem does not support
+// renaming over a file or syncing it, such as some FUSE mounts & SMB shares.
+func writeFile(path string, data []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if n := linkCount(fi); n > 1 {
+		log.Printf("debug: %s has %d hard links, rewriting in place", path, n)
+	} else if err := writeFileRename(path, fi, data); err == nil {
+		log.Printf("debug: wrote %s (strategy=rename)", path)
+		return nil
+	} else if !canWriteInPlace(err) {
+		return err
+	} else {
+		log.Printf("debug: cannot replace %s atomically, rewriting in place: %s", path, err)
+	}
+
+	if err := writeFileInPlace(path, data); err != nil {
+		return err
+	}
+	log.Printf("debug: wrote %s (strategy=in-place)", path)
+	return nil
+}
+
+// dirNotWritableError is returned by writeFileRename if the directory does
+// not allow a temporary file to be created next to the file.
+type dirNotWritableError struct {
+	err error
+}
+
+func (e *dirNotWritableError) Error() string {
+	return e.err.Error()
+}
+
+// canWriteInPlace returns true if err from writeFileRename means the file
+// can still be rewritten in place.
+func canWriteInPlace(err error) bool {
+	if _, ok := err.(*dirNotWritableError); ok {
+		return true
+	} else if e, ok := err.(*os.LinkError); ok && e.Op == "rename" && underlyingErrno(e) == syscall.EBUSY {
+		return true // path is a mount point, such as a bind-mounted file
+	}
+	return isUnsupportedWrite(err)
+}
+
+// writeFileRename atomically replaces the contents of the file at path,
+// which has the info fi. The data is written to a temporary file in the same
+// directory which is then renamed over path. The original file's mode,
+// ownership and extended attributes (including ACLs, file capabilities &
+// security labels) are copied to the new file first.
+func writeFileRename(path string, fi os.FileInfo, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".bed-")
+	if os.IsPermission(err) {
+		return &dirNotWritableError{err: err}
+	} else if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+
+	// Ownership must be copied before the mode & attributes since changing
+	// ownership can clear setuid bits.
+	if err := copyOwner(tmpPath, fi); err != nil {
+		return err
+	} else if err := os.Chmod(tmpPath, fi.Mode()); err != nil {
+		return err
+	} else if err := copyXattrs(path, tmpPath); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// writeFileInPlace truncates the file at path & writes data to it. Since a
+// failure part way through would leave the file incomplete, the original
+// contents are copied to a backup file first. The backup is removed once
+// the write succeeds & kept otherwise. The file's mode, ownership &
+// attributes are unchanged since it is the same file.
+func writeFileInPlace(path string, data []byte) error {
+	backupPath, err := writeInPlaceBackup(path)
+	if err != nil {
+		return fmt.Errorf("cannot back up %s: %s", path, err)
+	}
+	log.Printf("debug: backed up %s to %s", path, backupPath)
+
+	if err := overwriteFile(path, data); err != nil {
+		return fmt.Errorf("%s (original contents saved to %s)", err, backupPath)
+	}
+	return os.Remove(backupPath)
+}
+
+// writeInPlaceBackup copies the contents of path to a new file & returns its
+// path. The backup is written next to the file if possible, otherwise to the
+// temporary directory since the filesystem may not allow new files.
+func writeInPlaceBackup(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	pattern := "." + filepath.Base(path) + ".bed-backup-"
+	f, err := ioutil.TempFile(filepath.Dir(path), pattern)
+	if err != nil {
+		if f, err = ioutil.TempFile("", pattern); err != nil {
+			return "", err
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	} else if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// overwriteFile truncates the file at path & writes data to it. Sync errors
+// from filesystems which do not support syncing are ignored.
+func overwriteFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Sync(); err != nil && !isUnsupportedWrite(err) {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// underlyingErrno returns the system error code wrapped by err, or zero if
+// err is not a system error.
+func underlyingErrno(err error) syscall.Errno {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	errno, _ := err.(syscall.Errno)
+	return errno
+}
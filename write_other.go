@@ -0,0 +1,17 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows && !audit
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows,!audit
+
+package bed
+
+import "os"
+
+// copyOwner is a no-op on other platforms, such as Plan 9 & WebAssembly,
+// since their file info does not include a numeric owner & group.
+func copyOwner(path string, fi os.FileInfo) error { return nil }
+
+// linkCount returns 1 since the number of hard links is not known.
+func linkCount(fi os.FileInfo) uint64 { return 1 }
+
+// isUnsupportedWrite returns false since the errors of filesystems which do
+// not support renaming over files are not known, so every error is reported.
+func isUnsupportedWrite(err error) bool { return false }
@@ -0,0 +1,46 @@
+//go:build (aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris) && !audit
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+// +build !audit
+
+package bed
+
+import (
+	"log"
+	"os"
+	"syscall"
+)
+
+// copyOwner sets the owner & group of path to those of fi. Permission errors
+// are logged & ignored since only privileged users can change ownership.
+func copyOwner(path string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	if err := os.Lchown(path, int(st.Uid), int(st.Gid)); os.IsPermission(err) {
+		log.Printf("warn: cannot preserve ownership of %s: %s", path, err)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// isUnsupportedWrite returns true if err is returned by filesystems which
+// do not support renaming over files or syncing them, such as some FUSE
+// mounts & SMB shares. Other errors, such as EPERM, are real failures which
+// must be reported rather than falling back to a write which is not atomic.
+func isUnsupportedWrite(err error) bool {
+	// ENOTSUP & EOPNOTSUPP are the same on some platforms so a switch cannot
+	// be used.
+	errno := underlyingErrno(err)
+	return errno == syscall.EXDEV || errno == syscall.ENOTSUP || errno == syscall.EOPNOTSUPP || errno == syscall.ENOSYS
+}
+
+// linkCount returns the number of hard links to the file described by fi.
+func linkCount(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 1
+}
@@ -0,0 +1,115 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package bed
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestIsUnsupportedWrite(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{err: &os.LinkError{Op: "rename", Err: syscall.EXDEV}, want: true},
+		{err: &os.PathError{Op: "sync", Err: syscall.ENOTSUP}, want: true},
+		{err: &os.PathError{Op: "sync", Err: syscall.EOPNOTSUPP}, want: true},
+		{err: os.NewSyscallError("fsync", syscall.ENOSYS), want: true},
+		{err: &os.LinkError{Op: "rename", Err: syscall.EPERM}, want: false},
+		{err: &os.LinkError{Op: "rename", Err: syscall.EACCES}, want: false},
+		{err: &os.PathError{Op: "sync", Err: syscall.EINVAL}, want: false},
+		{err: &os.LinkError{Op: "rename", Err: syscall.EBUSY}, want: false},
+		{err: syscall.ENOSPC, want: false},
+	} {
+		if got := isUnsupportedWrite(tt.err); got != tt.want {
+			t.Errorf("isUnsupportedWrite(%v)=%v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCanWriteInPlace(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{err: &dirNotWritableError{err: &os.PathError{Op: "open", Err: syscall.EACCES}}, want: true},
+		{err: &os.LinkError{Op: "rename", Err: syscall.EBUSY}, want: true},
+		{err: &os.LinkError{Op: "rename", Err: syscall.EXDEV}, want: true},
+		{err: &os.PathError{Op: "sync", Err: syscall.EBUSY}, want: false},
+		{err: &os.LinkError{Op: "rename", Err: syscall.EPERM}, want: false},
+		{err: &os.PathError{Op: "open", Err: syscall.EACCES}, want: false},
+	} {
+		if got := canWriteInPlace(tt.err); got != tt.want {
+			t.Errorf("canWriteInPlace(%v)=%v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWriteFile_HardLink(t *testing.T) {
+	dir := chdirTemp(t)
+	writeTestFile(t, "a.txt", "foo")
+	if err := os.Link("a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	} else if err := writeFile(filepath.Join(dir, "a.txt"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both links must still share the new contents.
+	if s := readTestFile(t, "b.txt"); s != "bar" {
+		t.Fatalf("unexpected contents of other link: %q", s)
+	} else if fi, err := os.Stat("a.txt"); err != nil {
+		t.Fatal(err)
+	} else if n := linkCount(fi); n != 2 {
+		t.Fatalf("unexpected link count: %d", n)
+	}
+}
+
+func TestWriteFile_ReadOnlyDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("directory permissions do not apply to root")
+	}
+	dir := chdirTemp(t)
+	if err := os.Mkdir("ro", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, "ro/a.txt", "foo")
+	if err := os.Chmod("ro", 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod("ro", 0755)
+
+	if err := writeFile(filepath.Join(dir, "ro", "a.txt"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	} else if s := readTestFile(t, "ro/a.txt"); s != "bar" {
+		t.Fatalf("unexpected contents: %q", s)
+	}
+}
+
+func TestWriteFile_Rename(t *testing.T) {
+	dir := chdirTemp(t)
+	writeTestFile(t, "a.txt", "foo")
+	if err := os.Chmod("a.txt", 0640); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := writeFile(filepath.Join(dir, "a.txt"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is replaced by a new file with the same mode.
+	if s := readTestFile(t, "a.txt"); s != "bar" {
+		t.Fatalf("unexpected contents: %q", s)
+	} else if after, err := os.Stat("a.txt"); err != nil {
+		t.Fatal(err)
+	} else if os.SameFile(before, after) {
+		t.Fatal("expected file to be replaced")
+	} else if after.Mode() != 0640 {
+		t.Fatalf("unexpected mode: %s", after.Mode())
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !audit
+// +build !audit
+
+package bed
+
+import (
+	"os"
+	"syscall"
+)
+
+// copyOwner is a no-op on Windows since ownership is inherited from the
+// containing directory.
+func copyOwner(path string, fi os.FileInfo) error { return nil }
+
+// linkCount returns 1 since hard links are rare on Windows & their count is
+// not included in the file info.
+func linkCount(fi os.FileInfo) uint64 { return 1 }
+
+// Windows error codes returned by network & virtual filesystems which do not
+// support replacing files.
+const (
+	errorInvalidFunction = syscall.Errno(1)
+	errorNotSameDevice   = syscall.Errno(17)
+	errorNotSupported    = syscall.Errno(50)
+)
+
+// isUnsupportedWrite returns true if err is returned by filesystems which
+// do not support renaming over files or syncing them, such as some SMB
+// shares.
+func isUnsupportedWrite(err error) bool {
+	switch underlyingErrno(err) {
+	case errorInvalidFunction, errorNotSameDevice, errorNotSupported:
+		return true
+	default:
+		return false
+	}
+}
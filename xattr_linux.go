@@ -0,0 +1,119 @@
+//go:build !audit
+// +build !audit
+
+package bed
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"syscall"
+)
+
+// copyXattrs copies extended attributes from src to dst. This includes POSIX
+// ACLs which are stored in the "system.posix_acl_*" attributes, as well as
+// file capabilities & security labels. Attributes which cannot be set due to
+// missing privileges or filesystem support are logged & skipped, except for
+// security attributes since losing them can break binaries & services. The
+// file is not replaced unless they can be preserved.
+func copyXattrs(src, dst string) error {
+	names, err := listXattrs(src)
+	if err == syscall.ENOTSUP {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		security := strings.HasPrefix(name, "security.")
+		if security && !isCopiedSecurityXattr(name) {
+			continue
+		}
+
+		value, err := getXattr(src, name)
+		if err != nil {
+			return err
+		}
+
+		err = syscall.Setxattr(dst, name, value, 0)
+		switch {
+		case err == nil:
+			if security {
+				log.Printf("debug: preserved attribute %s on %s", name, src)
+			}
+		case security:
+			// New files may already be given the same label, such as the
+			// SELinux context of their directory, without permission to
+			// set it explicitly.
+			if v, gerr := getXattr(dst, name); gerr != nil || !bytes.Equal(v, value) {
+				return fmt.Errorf("cannot preserve security attribute %s on %s: %s", name, src, err)
+			}
+		case err == syscall.EPERM || err == syscall.ENOTSUP:
+			log.Printf("warn: cannot preserve attribute %s on %s: %s", name, src, err)
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// isCopiedSecurityXattr returns true if the attribute name in the "security"
+// namespace is copied. File capabilities, set with setcap, & the labels of
+// security modules such as SELinux are copied. Other attributes, such as
+// IMA & EVM hashes, are maintained by the kernel.
+func isCopiedSecurityXattr(name string) bool {
+	switch {
+	case name == "security.capability", name == "security.selinux", name == "security.apparmor":
+		return true
+	case strings.HasPrefix(name, "security.SMACK64"):
+		return true
+	default:
+		return false
+	}
+}
+
+// listXattrs returns the names of all extended attributes on path.
+func listXattrs(path string) ([]string, error) {
+	for {
+		sz, err := syscall.Listxattr(path, nil)
+		if err != nil {
+			return nil, err
+		} else if sz == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, sz)
+		if sz, err = syscall.Listxattr(path, buf); err == syscall.ERANGE {
+			continue // attributes added since size was read
+		} else if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, name := range bytes.Split(buf[:sz], []byte{0}) {
+			if len(name) > 0 {
+				names = append(names, string(name))
+			}
+		}
+		return names, nil
+	}
+}
+
+// getXattr returns the value of the extended attribute name on path.
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		sz, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, sz)
+		if sz, err = syscall.Getxattr(path, name, buf); err == syscall.ERANGE {
+			continue // value grew since size was read
+		} else if err != nil {
+			return nil, err
+		}
+		return buf[:sz], nil
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !audit
+// +build !linux,!audit
+
+package bed
+
+// copyXattrs is a no-op on platforms without extended attribute support.
+func copyXattrs(src, dst string) error { return nil }